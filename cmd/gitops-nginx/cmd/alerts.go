@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var allowMassDeleteOpts struct {
+	group  string
+	host   string
+	reason string
+}
+
+var alertsCmd = &cobra.Command{
+	Use:          "alerts",
+	Short:        "List open alerts, e.g. syncs and deploys blocked by the delete guard",
+	SilenceUsage: true,
+	Long: `List open alerts. An alert stays open until the blocked operation succeeds, e.g. the next
+git sync of a host that deletes fewer files than sync.delete_guard allows. Exits 2 if any alert is open.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		var res api.AlertsResponse
+		if err := client.do("GET", "/alerts", nil, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			w := newTable()
+			fmt.Fprintln(w, "KIND\tSOURCE\tGROUP\tHOST\tCOUNT\tLAST SEEN\tMESSAGE")
+			for _, a := range res.Alerts {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+					a.Kind, a.Source, a.Group, a.Host, a.Count, a.LastSeen.Local().Format("2006-01-02 15:04:05"), a.Message)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if len(res.Alerts) > 0 {
+			return withExitCode(exitChanges, fmt.Errorf("%d open alert(s)", len(res.Alerts)))
+		}
+		return nil
+	},
+}
+
+var allowMassDeleteCmd = &cobra.Command{
+	Use:          "allow-mass-delete",
+	Short:        "Let the next git sync of a server delete more files than the delete guard allows",
+	SilenceUsage: true,
+	Long: `Grant the next git sync of a server a one-time exception from sync.delete_guard, e.g. after
+intentionally removing most of its files from git. Requires an admin token; the grant is audited.
+Deploys are overridden per call with apply --allow-mass-delete instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if allowMassDeleteOpts.group == "" || allowMassDeleteOpts.host == "" || allowMassDeleteOpts.reason == "" {
+			return fmt.Errorf("--group, --host and --reason are required")
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		req := api.MassDeleteAllowRequest{
+			Group:  allowMassDeleteOpts.group,
+			Server: allowMassDeleteOpts.host,
+			Reason: allowMassDeleteOpts.reason,
+		}
+		var grant state.MassDeleteGrant
+		if err := client.do("POST", "/sync/allow-mass-delete", nil, req, &grant); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			return printJSON(grant)
+		}
+		fmt.Printf("The next sync of %s/%s may delete any number of files (granted by %s).\n", grant.Group, grant.Host, grant.GrantedBy)
+		return nil
+	},
+}
+
+func init() {
+	addClientFlags(alertsCmd)
+	rootCmd.AddCommand(alertsCmd)
+
+	allowMassDeleteCmd.Flags().StringVar(&allowMassDeleteOpts.group, "group", "", "server group name")
+	allowMassDeleteCmd.Flags().StringVar(&allowMassDeleteOpts.host, "host", "", "server host")
+	allowMassDeleteCmd.Flags().StringVar(&allowMassDeleteOpts.reason, "reason", "", "why the deletion is intended")
+	addClientFlags(allowMassDeleteCmd)
+	rootCmd.AddCommand(allowMassDeleteCmd)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/spf13/cobra"
+)
+
+var applyOpts struct {
+	group                string
+	host                 string
+	changeID             string
+	freezeOverrideReason string
+	skipPrepare          bool
+	allowMassDelete      bool
+	massDeleteReason     string
+}
+
+var applyCmd = &cobra.Command{
+	Use:          "apply",
+	Short:        "Deploy the production prefix to a server and reload nginx",
+	SilenceUsage: true,
+	Long: `Deploy the production tree of a server: first prepare (upload and nginx -t), then apply
+(upload and reload). The apply is skipped if nginx -t fails. Hooks configured for the server run
+around the apply and its health probes after the reload; both are printed. Uploads that would
+delete more remote files than sync.delete_guard allows are blocked unless --allow-mass-delete is
+given with --mass-delete-reason. Exits 1 on failure.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if applyOpts.group == "" || applyOpts.host == "" {
+			return fmt.Errorf("--group and --host are required")
+		}
+		if applyOpts.allowMassDelete && applyOpts.massDeleteReason == "" {
+			return fmt.Errorf("--allow-mass-delete requires --mass-delete-reason")
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		req := api.UpdateRequest{
+			Group:                applyOpts.group,
+			Server:               applyOpts.host,
+			FreezeOverrideReason: applyOpts.freezeOverrideReason,
+			ChangeID:             applyOpts.changeID,
+			AllowMassDelete:      applyOpts.allowMassDelete,
+			MassDeleteReason:     applyOpts.massDeleteReason,
+		}
+		query := url.Values{}
+		query.Set("mode", "prod")
+
+		result := struct {
+			Prepare *api.UpdatePrepareResponse `json:"prepare,omitempty"`
+			Apply   *api.UpdateApplyResponse   `json:"apply,omitempty"`
+		}{}
+		report := func() error {
+			if clientOpts.output == "json" {
+				return printJSON(result)
+			}
+			if p := result.Prepare; p != nil {
+				if p.ConfigPolicy != nil {
+					printPolicyFindings(os.Stdout, p.ConfigPolicy)
+				}
+				if p.Sync != nil {
+					fmt.Printf("Prepare: total %d, added %d, updated %d, deleted %d\n", p.Sync.Total, p.Sync.Added, p.Sync.Updated, p.Sync.Deleted)
+				}
+				if p.Nginx != nil {
+					fmt.Printf("$ %s\n%s", p.Nginx.Command, p.Nginx.Output)
+				}
+			}
+			if a := result.Apply; a != nil {
+				if a.ConfigPolicy != nil {
+					printPolicyFindings(os.Stdout, a.ConfigPolicy)
+				}
+				if v := a.Verification; v != nil {
+					if err := v.Err(); err != nil {
+						fmt.Printf("Verification: %v\n", err)
+					} else {
+						fmt.Printf("Verification: %d/%d files match production\n", v.Matched, v.Expected)
+					}
+				}
+				for _, h := range a.Hooks {
+					status := "ok"
+					if !h.OK {
+						status = "FAILED: " + h.Error
+					}
+					fmt.Printf("[%s] %s (%s, %dms): %s\n%s", h.Phase, h.Name, h.Where, h.DurationMs, status, h.Output)
+				}
+				if a.Nginx != nil {
+					fmt.Printf("$ %s\n%s", a.Nginx.Command, a.Nginx.Output)
+				}
+				for _, h := range a.Health {
+					status := "ok"
+					if !h.OK {
+						status = "FAILED: " + h.Error
+					}
+					fmt.Printf("health %s %s (%s, %d attempts): %s\n", h.Name, h.URL, h.Where, h.Attempts, status)
+				}
+				if r := a.Rollback; r != nil {
+					if r.Error != "" {
+						fmt.Printf("Rollback failed: %s\n", r.Error)
+					}
+					if r.Message != "" {
+						fmt.Printf("Rollback: %s\n", r.Message)
+					}
+				}
+				fmt.Println(a.Message)
+			}
+			return nil
+		}
+
+		if !applyOpts.skipPrepare {
+			var prepare api.UpdatePrepareResponse
+			err := client.do("POST", "/update/prepare", query, req, &prepare)
+			result.Prepare = &prepare
+			if err != nil {
+				_ = report()
+				return fmt.Errorf("prepare failed: %w", err)
+			}
+			if !prepare.Success {
+				_ = report()
+				return fmt.Errorf("prepare failed: nginx -t did not pass, not applying")
+			}
+		}
+
+		var apply api.UpdateApplyResponse
+		err = client.do("POST", "/update/apply", query, req, &apply)
+		result.Apply = &apply
+		if rerr := report(); rerr != nil {
+			return rerr
+		}
+		if err != nil {
+			return fmt.Errorf("apply failed: %w", err)
+		}
+		if !apply.Success {
+			return fmt.Errorf("apply failed: %s", apply.Message)
+		}
+		return nil
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringVar(&applyOpts.group, "group", "", "server group name")
+	applyCmd.Flags().StringVar(&applyOpts.host, "host", "", "server host")
+	applyCmd.Flags().StringVar(&applyOpts.changeID, "change-id", "", "approved change request, required for groups with require_approval")
+	applyCmd.Flags().StringVar(&applyOpts.freezeOverrideReason, "freeze-override-reason", "", "admin override of a freeze window or the allowed deploy hours")
+	applyCmd.Flags().BoolVar(&applyOpts.skipPrepare, "skip-prepare", false, "apply without running prepare (nginx -t) first")
+	applyCmd.Flags().BoolVar(&applyOpts.allowMassDelete, "allow-mass-delete", false, "admin override of sync.delete_guard for this deploy (audited, with --mass-delete-reason)")
+	applyCmd.Flags().StringVar(&applyOpts.massDeleteReason, "mass-delete-reason", "", "why the mass delete is intended, required with --allow-mass-delete")
+	addClientFlags(applyCmd)
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/logn-xu/gitops-nginx/internal/bootstrap"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var bootstrapOpts bootstrap.Options
+
+var bootstrapCmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Onboard an existing server into the git repository",
+	Long: `Pull the nginx configuration tree of an existing server over SFTP, write it into the
+git repository using the <group>/<host>/<config_dir_suffix> layout and create the initial commit.
+After committing, the remote file hashes are verified against the committed content.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bootstrapOpts.Group == "" || bootstrapOpts.Host == "" {
+			return fmt.Errorf("--group and --host are required")
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		result, err := bootstrap.Run(context.Background(), cfg, bootstrapOpts)
+		if result != nil {
+			fmt.Printf("Repository directory: %s\n", result.RepoDir)
+			fmt.Printf("Files committed: %d (ignored: %d)\n", len(result.Files), len(result.Ignored))
+			if result.Commit != "" {
+				fmt.Printf("Commit: %s (pushed: %t)\n", result.Commit, result.Pushed)
+			}
+			for _, f := range result.Mismatched {
+				fmt.Printf("  mismatch: %s\n", f)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("bootstrap failed: %w", err)
+		}
+
+		fmt.Println("Verification passed: git and remote hashes match.")
+		return nil
+	},
+}
+
+func init() {
+	bootstrapCmd.Flags().StringVar(&bootstrapOpts.Group, "group", "", "server group name")
+	bootstrapCmd.Flags().StringVar(&bootstrapOpts.Host, "host", "", "server host (IP address as in servers.yaml)")
+	bootstrapCmd.Flags().BoolVar(&bootstrapOpts.Force, "force", false, "replace the host directory if it already exists in the repository")
+	bootstrapCmd.Flags().BoolVar(&bootstrapOpts.Push, "push", true, "push the bootstrap commit to the remote")
+	bootstrapCmd.Flags().StringVarP(&bootstrapOpts.Message, "message", "m", "", "commit message")
+	rootCmd.AddCommand(bootstrapCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/certs"
+	"github.com/spf13/cobra"
+)
+
+var certsOpts struct {
+	group    string
+	host     string
+	source   string
+	expiring bool
+}
+
+var certsCmd = &cobra.Command{
+	Use:          "certs",
+	Short:        "List the TLS certificates of each server with their expiry and users",
+	SilenceUsage: true,
+	Long: `Parse every PEM certificate in the production and remote trees of each server and list its
+subject alternative names, expiry and the server blocks that use it. Certificates expiring within
+certs.warn_days are reported as expiring. With --expiring only expired and expiring certificates are
+listed. Exits 2 if any certificate is expired or expiring.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		for k, v := range map[string]string{
+			"group":  certsOpts.group,
+			"host":   certsOpts.host,
+			"source": certsOpts.source,
+		} {
+			if v != "" {
+				query.Set(k, v)
+			}
+		}
+
+		var res api.CertsResponse
+		if err := client.do("GET", "/certs", query, nil, &res); err != nil {
+			return err
+		}
+
+		attention := 0
+		for i := range res.Hosts {
+			kept := res.Hosts[i].Certs[:0]
+			for _, c := range res.Hosts[i].Certs {
+				expiring := c.Status == certs.StatusExpired || c.Status == certs.StatusExpiring
+				if expiring {
+					attention++
+				}
+				if expiring || !certsOpts.expiring {
+					kept = append(kept, c)
+				}
+			}
+			res.Hosts[i].Certs = kept
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			w := newTable()
+			fmt.Fprintln(w, "GROUP\tHOST\tSOURCE\tCERT\tSTATUS\tNOT AFTER\tDAYS\tNAMES\tUSED BY")
+			for _, h := range res.Hosts {
+				if h.Error != "" {
+					fmt.Fprintf(w, "%s\t%s\t%s\t\terror\t\t\t\t%s\n", h.Group, h.Host, h.Source, h.Error)
+				}
+				for _, c := range h.Certs {
+					notAfter := ""
+					if !c.NotAfter.IsZero() {
+						notAfter = c.NotAfter.Format("2006-01-02")
+					}
+					var usedBy []string
+					for _, u := range c.UsedBy {
+						usedBy = append(usedBy, fmt.Sprintf("%s (%s:%d)", u.Server, u.File, u.Line))
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+						h.Group, h.Host, h.Source, c.Path, c.Status, notAfter, c.DaysLeft, strings.Join(c.SANs, " "), strings.Join(usedBy, ", "))
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if attention > 0 {
+			return withExitCode(exitChanges, fmt.Errorf("%d certificate(s) expired or expiring within %d days", attention, res.WarnDays))
+		}
+		return nil
+	},
+}
+
+func init() {
+	certsCmd.Flags().StringVar(&certsOpts.group, "group", "", "only servers of this group")
+	certsCmd.Flags().StringVar(&certsOpts.host, "host", "", "only this server host")
+	certsCmd.Flags().StringVar(&certsOpts.source, "source", "", "tree to inspect: prod or remote, both when empty")
+	certsCmd.Flags().BoolVar(&certsOpts.expiring, "expiring", false, "only list expired and expiring certificates")
+	addClientFlags(certsCmd)
+	rootCmd.AddCommand(certsCmd)
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/spf13/cobra"
+)
+
+var checkNginxOpts struct {
+	group string
+	host  string
+	mode  string
+}
+
+var checkNginxCmd = &cobra.Command{
+	Use:          "check-nginx",
+	Short:        "Run nginx -t against the preview or production tree of a server",
+	SilenceUsage: true,
+	Long: `Lint the preview or production tree of a server, then copy it into its check directory and
+run nginx -t; both results are printed, and either failing fails the check. The live configuration
+is not touched. Exits 1 if the check fails.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if checkNginxOpts.group == "" || checkNginxOpts.host == "" {
+			return fmt.Errorf("--group and --host are required")
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		query.Set("mode", checkNginxOpts.mode)
+
+		var res api.CheckResponse
+		err = client.do("POST", "/check", query, api.CheckRequest{Group: checkNginxOpts.group, Server: checkNginxOpts.host}, &res)
+		if err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			if res.Lint != nil {
+				printLintFindings(os.Stdout, res.Lint)
+			}
+			if res.Sync != nil {
+				fmt.Printf("Synced to check directory: total %d, added %d, updated %d, deleted %d\n",
+					res.Sync.Total, res.Sync.Added, res.Sync.Updated, res.Sync.Deleted)
+			}
+			if res.Nginx != nil {
+				fmt.Printf("$ %s\n%s", res.Nginx.Command, res.Nginx.Output)
+			}
+			files := make([]string, 0, len(res.FileErrors))
+			for f := range res.FileErrors {
+				files = append(files, f)
+			}
+			sort.Strings(files)
+			for _, f := range files {
+				fmt.Printf("render error: %s: %s\n", f, res.FileErrors[f])
+			}
+		}
+
+		if !res.OK {
+			return fmt.Errorf("check failed for %s/%s (%s)", checkNginxOpts.group, checkNginxOpts.host, res.Mode)
+		}
+		if clientOpts.output != "json" {
+			fmt.Println("Check passed.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	checkNginxCmd.Flags().StringVar(&checkNginxOpts.group, "group", "", "server group name")
+	checkNginxCmd.Flags().StringVar(&checkNginxOpts.host, "host", "", "server host")
+	checkNginxCmd.Flags().StringVar(&checkNginxOpts.mode, "mode", "prod", "tree to check: prod or preview")
+	addClientFlags(checkNginxCmd)
+	rootCmd.AddCommand(checkNginxCmd)
+}
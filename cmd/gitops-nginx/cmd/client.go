@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the operational commands
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitChanges = 2
+)
+
+// exitCodeError makes Execute exit with a specific code.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+var clientOpts struct {
+	server string
+	token  string
+	output string
+}
+
+// addClientFlags registers the flags shared by the commands that talk to the API.
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&clientOpts.server, "server", os.Getenv("GITOPS_NGINX_SERVER"), "URL of a running apiserver (env GITOPS_NGINX_SERVER), empty runs against the local config")
+	cmd.Flags().StringVar(&clientOpts.token, "token", os.Getenv("GITOPS_NGINX_TOKEN"), "API bearer token (env GITOPS_NGINX_TOKEN)")
+	cmd.Flags().StringVarP(&clientOpts.output, "output", "o", "table", "output format: table or json")
+}
+
+// apiClient calls the gitops-nginx API, either over HTTP or in-process with the local config.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+	closeFn func()
+}
+
+func newAPIClient() (*apiClient, error) {
+	if clientOpts.output != "table" && clientOpts.output != "json" {
+		return nil, fmt.Errorf("--output must be 'table' or 'json'")
+	}
+
+	if clientOpts.server != "" {
+		return &apiClient{
+			baseURL: strings.TrimRight(clientOpts.server, "/"),
+			token:   clientOpts.token,
+			http:    &http.Client{Timeout: 10 * time.Minute},
+			closeFn: func() {},
+		}, nil
+	}
+
+	// Local mode: serve the API in-process, keeping stdout clean for the command output
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	gin.SetMode(gin.ReleaseMode)
+	log.Logger.SetOutput(os.Stderr)
+	log.AccessLogger.SetOutput(io.Discard)
+
+	etcdClient, err := etcd.NewClient(cfg.Etcd)
+	if err != nil {
+		return nil, err
+	}
+	srv := api.NewServerWithoutUI(cfg, etcdClient)
+	// A broken policy only fails the requests that enforce it, rollback and the like keep working
+	if err := srv.LoadConfigPolicy(); err != nil {
+		log.Logger.WithError(err).Warn("failed to load config policy")
+	}
+	return &apiClient{
+		baseURL: "http://local",
+		token:   clientOpts.token,
+		http:    &http.Client{Transport: handlerTransport{srv.Handler()}},
+		closeFn: func() { etcdClient.Close() },
+	}, nil
+}
+
+func (c *apiClient) Close() {
+	c.closeFn()
+}
+
+// do sends a request and decodes the JSON response into out. Responses with an error status are
+// decoded as well (they may carry a result), and reported as an error.
+func (c *apiClient) do(method, apiPath string, query url.Values, body, out any) error {
+	u := c.baseURL + "/api/v1" + apiPath
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		if out != nil {
+			_ = json.Unmarshal(data, out)
+		}
+		msg := apiErr.Error
+		if msg == "" {
+			msg = apiErr.Message
+		}
+		if msg == "" {
+			msg = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("%s (HTTP %d)", msg, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// handlerTransport serves requests with an in-process http.Handler.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// newTable returns a tabwriter for table output; call Flush when done.
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// withExitCode wraps err so that Execute exits with code.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// exitCode returns the process exit code for an error returned by a command.
+func exitCode(err error) int {
+	var ece *exitCodeError
+	if errors.As(err, &ece) {
+		return ece.code
+	}
+	if err != nil {
+		return exitError
+	}
+	return exitOK
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
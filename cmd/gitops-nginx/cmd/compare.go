@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/compare"
+	"github.com/spf13/cobra"
+)
+
+var compareOpts struct {
+	group  string
+	a      string
+	b      string
+	source string
+	all    bool
+}
+
+var compareCmd = &cobra.Command{
+	Use:          "compare",
+	Short:        "Compare the config trees of the hosts of a group",
+	SilenceUsage: true,
+	Long: `Without --a and --b, report whether every host of the group holds the same config tree,
+clustering the hosts by tree hash. With --a and --b, list the files that differ between the two
+hosts with their unified diffs (--all also lists identical files). --source picks the tree: prod
+(default), preview or remote. Exits 2 when the trees differ.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if compareOpts.group == "" {
+			return fmt.Errorf("--group is required")
+		}
+		if (compareOpts.a == "") != (compareOpts.b == "") {
+			return fmt.Errorf("--a and --b must be given together")
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		query.Set("group", compareOpts.group)
+		if compareOpts.source != "" {
+			query.Set("source", compareOpts.source)
+		}
+
+		if compareOpts.a == "" {
+			return runConsistency(client, query)
+		}
+
+		query.Set("a", compareOpts.a)
+		query.Set("b", compareOpts.b)
+		var res api.CompareResponse
+		if err := client.do("GET", "/compare", query, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			for _, f := range res.Files {
+				if f.Status == compare.StatusSame && !compareOpts.all {
+					continue
+				}
+				fmt.Printf("%-8s %s\n", f.Status, f.Path)
+			}
+			for _, f := range res.Files {
+				if f.Diff != "" {
+					fmt.Printf("\n%s", f.Diff)
+				}
+			}
+			fmt.Printf("\n%s vs %s (%s): %d equal, %d changed, %d only on %s, %d only on %s.\n",
+				res.A, res.B, res.Source, res.Equal, res.Changed, res.OnlyA, res.A, res.OnlyB, res.B)
+		}
+
+		if !res.Same {
+			return withExitCode(exitChanges, fmt.Errorf("%s and %s differ", res.A, res.B))
+		}
+		return nil
+	},
+}
+
+// runConsistency prints the tree hash clusters of a group.
+func runConsistency(client *apiClient, query url.Values) error {
+	var res api.ConsistencyResponse
+	if err := client.do("GET", "/consistency", query, nil, &res); err != nil {
+		return err
+	}
+
+	if clientOpts.output == "json" {
+		if err := printJSON(res); err != nil {
+			return err
+		}
+	} else {
+		w := newTable()
+		fmt.Fprintln(w, "CLUSTER\tHASH\tFILES\tHOSTS")
+		for i, cl := range res.Clusters {
+			fmt.Fprintf(w, "%d\t%.12s\t%d\t%s\n", i+1, cl.Hash, cl.Files, strings.Join(cl.Hosts, ", "))
+		}
+		for _, h := range res.Errors {
+			fmt.Fprintf(w, "error\t\t\t%s: %s\n", h.Host, h.Error)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("%d host(s) could not be read", len(res.Errors))
+	}
+	if !res.Consistent {
+		return withExitCode(exitChanges, fmt.Errorf("group %s has %d distinct trees", res.Group, len(res.Clusters)))
+	}
+	return nil
+}
+
+func init() {
+	compareCmd.Flags().StringVar(&compareOpts.group, "group", "", "group of the hosts (required)")
+	compareCmd.Flags().StringVar(&compareOpts.a, "a", "", "first host to compare")
+	compareCmd.Flags().StringVar(&compareOpts.b, "b", "", "second host to compare")
+	compareCmd.Flags().StringVar(&compareOpts.source, "source", "", "tree to compare: prod, preview or remote (default prod)")
+	compareCmd.Flags().BoolVar(&compareOpts.all, "all", false, "also list identical files")
+	addClientFlags(compareCmd)
+	rootCmd.AddCommand(compareCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/logn-xu/gitops-nginx/internal/plan"
+	"github.com/spf13/cobra"
+)
+
+var diffOpts struct {
+	group string
+	host  string
+}
+
+var diffCmd = &cobra.Command{
+	Use:          "diff",
+	Short:        "Show the difference between the production prefix and the live servers",
+	SilenceUsage: true,
+	Long: `Show the unified diff between the production prefix in etcd and the live nginx config
+directory of each server, through the API. Exits 0 when the servers are up to date, 2 when
+there are differences and 1 on error.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		query.Set("group", diffOpts.group)
+		query.Set("host", diffOpts.host)
+
+		var p plan.Plan
+		if err := client.do("GET", "/plan", query, nil, &p); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			err = printJSON(p)
+		} else {
+			err = plan.WriteText(os.Stdout, &p, true)
+		}
+		if err != nil {
+			return err
+		}
+
+		if p.Errors > 0 {
+			return fmt.Errorf("%d host(s) could not be compared", p.Errors)
+		}
+		if p.HasChanges() {
+			return withExitCode(exitChanges, fmt.Errorf("live config differs from the production prefix"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffOpts.group, "group", "", "only compare servers of this group")
+	diffCmd.Flags().StringVar(&diffOpts.host, "host", "", "only compare this server host")
+	addClientFlags(diffCmd)
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/spf13/cobra"
+)
+
+var gitStatusCmd = &cobra.Command{
+	Use:          "git-status",
+	Short:        "Show the state of the local repository against its remote",
+	SilenceUsage: true,
+	Long: `Show the local and remote commit of the tracked branch, the release policy state and the pins.
+Exits 0 when the repository is synced, 2 when it is ahead, behind or diverged and 1 on error.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		var res api.GitStatusResponse
+		if err := client.do("GET", "/git/status", nil, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			w := newTable()
+			fmt.Fprintf(w, "Branch:\t%s\n", res.Branch)
+			fmt.Fprintf(w, "Status:\t%s\n", res.Status)
+			if res.LocalCommit != nil {
+				fmt.Fprintf(w, "Local:\t%s %s\n", shortHash(res.LocalCommit.Hash), firstLine(res.LocalCommit.Message))
+			}
+			if res.RemoteCommit != nil {
+				fmt.Fprintf(w, "Remote:\t%s %s\n", shortHash(res.RemoteCommit.Hash), firstLine(res.RemoteCommit.Message))
+			}
+			if r := res.Release; r != nil {
+				deployable := "-"
+				if r.DeployableCommit != nil {
+					deployable = shortHash(r.DeployableCommit.Hash)
+				}
+				fmt.Fprintf(w, "Release:\t%s, deployable %s, %d pending\n", r.Mode, deployable, len(r.PendingCommits))
+			}
+			for _, pin := range res.Pins {
+				target := pin.Group
+				if pin.Host != "" {
+					target += "/" + pin.Host
+				}
+				state := "active"
+				if !pin.Active {
+					state = "expired"
+				}
+				fmt.Fprintf(w, "Pin:\t%s -> %s (%s) %s\n", target, shortHash(pin.Commit), state, pin.Reason)
+			}
+			if res.Error != "" {
+				fmt.Fprintf(w, "Error:\t%s\n", res.Error)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		switch res.Status {
+		case "synced":
+			return nil
+		case "error":
+			return fmt.Errorf("git status error: %s", res.Error)
+		default:
+			return withExitCode(exitChanges, fmt.Errorf("repository is %s", res.Status))
+		}
+	},
+}
+
+func init() {
+	addClientFlags(gitStatusCmd)
+	rootCmd.AddCommand(gitStatusCmd)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/spf13/cobra"
+)
+
+var inventoryOpts struct {
+	group   string
+	host    string
+	source  string
+	domain  string
+	backend string
+}
+
+var inventoryCmd = &cobra.Command{
+	Use:          "inventory",
+	Short:        "List the virtual hosts and upstreams of each server, or find who serves a domain or backend",
+	SilenceUsage: true,
+	Long: `Parse the production and remote trees of each server from etcd and list their http server blocks
+and upstreams. With --domain, list the server blocks whose server_name matches a domain; with --backend,
+list the upstreams and locations sending requests to an address or upstream name.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		for k, v := range map[string]string{
+			"group":   inventoryOpts.group,
+			"host":    inventoryOpts.host,
+			"source":  inventoryOpts.source,
+			"domain":  inventoryOpts.domain,
+			"backend": inventoryOpts.backend,
+		} {
+			if v != "" {
+				query.Set(k, v)
+			}
+		}
+
+		var res api.InventoryResponse
+		if err := client.do("GET", "/inventory", query, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			return printJSON(res)
+		}
+
+		w := newTable()
+		if inventoryOpts.domain != "" || inventoryOpts.backend != "" {
+			fmt.Fprintln(w, "GROUP\tHOST\tSOURCE\tKIND\tPOSITION\tDETAIL")
+			for _, m := range res.Matches {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s:%d\t%s\n", m.Group, m.Host, m.Source, m.Kind, m.File, m.Line, m.Detail)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if len(res.Matches) == 0 {
+				return fmt.Errorf("no matches")
+			}
+			return nil
+		}
+
+		fmt.Fprintln(w, "GROUP\tHOST\tSOURCE\tKIND\tNAME\tLISTEN / MEMBERS\tPOSITION")
+		for _, h := range res.Hosts {
+			if h.Error != "" {
+				fmt.Fprintf(w, "%s\t%s\t%s\terror\t\t\t%s\n", h.Group, h.Host, h.Source, h.Error)
+			}
+			for _, srv := range h.Servers {
+				var listens []string
+				for _, l := range srv.Listens {
+					listens = append(listens, l.Address)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\tserver\t%s\t%s\t%s:%d\n",
+					h.Group, h.Host, h.Source, strings.Join(srv.Names, " "), strings.Join(listens, " "), srv.File, srv.Line)
+			}
+			for _, u := range h.Upstreams {
+				var members []string
+				for _, m := range u.Members {
+					members = append(members, m.Address)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\tupstream\t%s\t%s\t%s:%d\n",
+					h.Group, h.Host, h.Source, u.Name, strings.Join(members, " "), u.File, u.Line)
+			}
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	inventoryCmd.Flags().StringVar(&inventoryOpts.group, "group", "", "only servers of this group")
+	inventoryCmd.Flags().StringVar(&inventoryOpts.host, "host", "", "only this server host")
+	inventoryCmd.Flags().StringVar(&inventoryOpts.source, "source", "", "tree to inspect: prod or remote, both when empty")
+	inventoryCmd.Flags().StringVar(&inventoryOpts.domain, "domain", "", "find the server blocks serving a domain")
+	inventoryCmd.Flags().StringVar(&inventoryOpts.backend, "backend", "", "find the upstreams and locations using a backend address or upstream")
+	addClientFlags(inventoryCmd)
+	rootCmd.AddCommand(inventoryCmd)
+}
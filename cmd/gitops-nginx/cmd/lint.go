@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/lint"
+	"github.com/spf13/cobra"
+)
+
+var lintOpts struct {
+	group string
+	host  string
+	mode  string
+	rules bool
+}
+
+var lintCmd = &cobra.Command{
+	Use:          "lint",
+	Short:        "Lint the nginx config trees in etcd without connecting to the servers",
+	SilenceUsage: true,
+	Long: `Parse the production, preview or remote tree of each server from etcd, following includes
+from nginx.conf, and run the built-in lint rules: syntax errors, missing include targets, conflicting
+server names, missing certificates, undefined upstreams and deprecated directives.
+Severities are configured under lint.rules. Exits 1 if a finding reaches lint.fail_on.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if lintOpts.rules {
+			w := newTable()
+			fmt.Fprintln(w, "RULE\tSEVERITY\tDESCRIPTION")
+			for _, r := range lint.Rules() {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.ID, r.Severity, r.Description)
+			}
+			return w.Flush()
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		query.Set("mode", lintOpts.mode)
+		if lintOpts.group != "" {
+			query.Set("group", lintOpts.group)
+		}
+		if lintOpts.host != "" {
+			query.Set("host", lintOpts.host)
+		}
+
+		var res api.LintResponse
+		if err := client.do("GET", "/lint", query, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			w := newTable()
+			fmt.Fprintln(w, "GROUP\tHOST\tSEVERITY\tRULE\tPOSITION\tMESSAGE")
+			for _, h := range res.Hosts {
+				if h.Error != "" {
+					fmt.Fprintf(w, "%s\t%s\t%s\t\t\t%s\n", h.Group, h.Host, "error", h.Error)
+					continue
+				}
+				for _, f := range h.Result.Findings {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", h.Group, h.Host, f.Severity, f.Rule, findingPosition(f), f.Message)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if !res.OK {
+			return fmt.Errorf("lint failed (%s)", res.Mode)
+		}
+		return nil
+	},
+}
+
+// findingPosition formats the position of a lint finding as file:line.
+func findingPosition(f lint.Finding) string {
+	if f.Line == 0 {
+		return f.File
+	}
+	return fmt.Sprintf("%s:%d", f.File, f.Line)
+}
+
+// printLintFindings writes one line per lint finding.
+func printLintFindings(w io.Writer, res *lint.Result) {
+	for _, f := range res.Findings {
+		fmt.Fprintf(w, "lint %s: %s: %s [%s]\n", f.Severity, findingPosition(f), f.Message, f.Rule)
+	}
+}
+
+func init() {
+	lintCmd.Flags().StringVar(&lintOpts.group, "group", "", "only lint servers of this group")
+	lintCmd.Flags().StringVar(&lintOpts.host, "host", "", "only lint this server host")
+	lintCmd.Flags().StringVar(&lintOpts.mode, "mode", "prod", "tree to lint: prod, preview or remote")
+	lintCmd.Flags().BoolVar(&lintOpts.rules, "rules", false, "list the built-in rules and exit")
+	addClientFlags(lintCmd)
+	rootCmd.AddCommand(lintCmd)
+}
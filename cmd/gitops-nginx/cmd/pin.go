@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var pinOpts struct {
+	group   string
+	host    string
+	commit  string
+	reason  string
+	expires time.Duration
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin",
+	Short: "Pin a host or group to a specific commit",
+	Long: `Pin a host (or every host of a group when --host is omitted) to a specific commit.
+While a pin is active the syncer keeps the production tree on the pinned commit, even if the
+tracked branch moves on. The pinned commit must satisfy the release policy like any release.`,
+}
+
+var pinSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Create or replace a pin",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pinOpts.group == "" || pinOpts.commit == "" || pinOpts.reason == "" {
+			return fmt.Errorf("--group, --commit and --reason are required")
+		}
+
+		cfg, store, closeFn, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if pinOpts.host == "" && cfg.FindGroup(pinOpts.group) == nil {
+			return fmt.Errorf("group %s not found", pinOpts.group)
+		}
+		if pinOpts.host != "" && cfg.FindServer(pinOpts.group, pinOpts.host) == nil {
+			return fmt.Errorf("server %s not found in group %s", pinOpts.host, pinOpts.group)
+		}
+
+		repo, err := gitrepo.OpenRepository(&cfg.Git)
+		if err != nil {
+			return err
+		}
+		hash, err := repo.ResolveRevision(plumbing.Revision(pinOpts.commit))
+		if err != nil {
+			return fmt.Errorf("failed to resolve commit %s: %w", pinOpts.commit, err)
+		}
+		commit, err := repo.CommitObject(*hash)
+		if err != nil {
+			return fmt.Errorf("failed to get commit %s: %w", pinOpts.commit, err)
+		}
+		releasable, err := gitrepo.IsReleasable(repo, &cfg.Git.Release, commit)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate release policy: %w", err)
+		}
+		if !releasable {
+			return fmt.Errorf("commit %s does not satisfy the release policy (mode %s)", hash, cfg.Git.Release.Mode)
+		}
+
+		now := time.Now()
+		pin := state.Pin{
+			Group:     pinOpts.group,
+			Host:      pinOpts.host,
+			Commit:    hash.String(),
+			Reason:    pinOpts.reason,
+			CreatedBy: "cli:" + os.Getenv("USER"),
+			CreatedAt: now,
+		}
+		if pinOpts.expires > 0 {
+			pin.ExpiresAt = now.Add(pinOpts.expires)
+		}
+
+		if err := store.PutPin(context.Background(), pin); err != nil {
+			return err
+		}
+		event := state.AuditEvent{
+			Actor:   pin.CreatedBy,
+			Action:  "pin_set",
+			Group:   pin.Group,
+			Host:    pin.Host,
+			Reason:  pin.Reason,
+			Details: map[string]string{"commit": pin.Commit},
+		}
+		if !pin.ExpiresAt.IsZero() {
+			event.Details["expires_at"] = pin.ExpiresAt.Format(time.RFC3339)
+		}
+		if err := store.RecordAudit(context.Background(), event); err != nil {
+			return fmt.Errorf("pin set but not recorded in the audit trail: %w", err)
+		}
+
+		fmt.Printf("Pinned %s to %s\n", pinTarget(pin.Group, pin.Host), pin.Commit)
+		return nil
+	},
+}
+
+var pinClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove a pin",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pinOpts.group == "" {
+			return fmt.Errorf("--group is required")
+		}
+
+		_, store, closeFn, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if err := store.DeletePin(context.Background(), pinOpts.group, pinOpts.host); err != nil {
+			return err
+		}
+		if err := store.RecordAudit(context.Background(), state.AuditEvent{
+			Actor:  "cli:" + os.Getenv("USER"),
+			Action: "pin_clear",
+			Group:  pinOpts.group,
+			Host:   pinOpts.host,
+			Reason: pinOpts.reason,
+		}); err != nil {
+			return fmt.Errorf("pin cleared but not recorded in the audit trail: %w", err)
+		}
+
+		fmt.Printf("Cleared pin of %s\n", pinTarget(pinOpts.group, pinOpts.host))
+		return nil
+	},
+}
+
+var pinListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pins",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, store, closeFn, err := openStateStore()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		pins, err := store.ListPins(context.Background(), pinOpts.group)
+		if err != nil {
+			return err
+		}
+		if len(pins) == 0 {
+			fmt.Println("No pins.")
+			return nil
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tCOMMIT\tSTATUS\tEXPIRES\tCREATED BY\tREASON")
+		for _, pin := range pins {
+			status := "active"
+			if !pin.Active(now) {
+				status = "expired"
+			}
+			expires := "never"
+			if !pin.ExpiresAt.IsZero() {
+				expires = pin.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%.12s\t%s\t%s\t%s\t%s\n",
+				pinTarget(pin.Group, pin.Host), pin.Commit, status, expires, pin.CreatedBy, pin.Reason)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	pinCmd.PersistentFlags().StringVar(&pinOpts.group, "group", "", "server group name")
+	pinCmd.PersistentFlags().StringVar(&pinOpts.host, "host", "", "server host, omit to target the whole group")
+	pinSetCmd.Flags().StringVar(&pinOpts.commit, "commit", "", "commit, tag or revision to pin to")
+	pinSetCmd.Flags().StringVar(&pinOpts.reason, "reason", "", "why the pin is needed")
+	pinClearCmd.Flags().StringVar(&pinOpts.reason, "reason", "", "why the pin is removed")
+	pinSetCmd.Flags().DurationVar(&pinOpts.expires, "expires", 0, "expire the pin after this duration (e.g. 4h), 0 means never")
+
+	pinCmd.AddCommand(pinSetCmd, pinClearCmd, pinListCmd)
+	rootCmd.AddCommand(pinCmd)
+}
+
+// openStateStore loads the configuration and connects to the state store in etcd.
+func openStateStore() (*config.Config, *state.Store, func(), error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	etcdClient, err := etcd.NewClient(cfg.Etcd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	closeFn := func() { etcdClient.Close() }
+	return cfg, state.NewStore(etcdClient, cfg.Sync.State.KeyPrefix), closeFn, nil
+}
+
+func pinTarget(group, host string) string {
+	if host == "" {
+		return group + " (group)"
+	}
+	return group + "/" + host
+}
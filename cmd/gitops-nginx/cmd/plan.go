@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	"github.com/logn-xu/gitops-nginx/internal/plan"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+var planOpts struct {
+	group            string
+	host             string
+	output           string
+	noDiff           bool
+	detailedExitCode bool
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the file operations an apply would perform",
+	Long: `Compare the production prefix in etcd with the live nginx config directory of each
+server and list the files that an apply would add, update or delete, with unified diffs.
+With -o semantic, nginx config files show structural changes instead, e.g.
+"http › server api.example.com › location /v2: proxy_pass changed from X to Y", ignoring
+formatting, comments and reordering. Nothing is written to the servers.
+
+With --detailed-exitcode the command exits 0 when there are no changes, 2 when there are
+changes and 1 on error.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if planOpts.output != "text" && planOpts.output != "semantic" && planOpts.output != "json" {
+			return fmt.Errorf("--output must be 'text', 'semantic' or 'json'")
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		etcdClient, err := etcd.NewClient(cfg.Etcd)
+		if err != nil {
+			return err
+		}
+		defer etcdClient.Close()
+
+		ctx := context.Background()
+		var hosts []plan.HostPlan
+		for _, group := range cfg.NginxServers {
+			if planOpts.group != "" && group.Group != planOpts.group {
+				continue
+			}
+			for i := range group.Servers {
+				srvCfg := &group.Servers[i]
+				if planOpts.host != "" && srvCfg.Host != planOpts.host {
+					continue
+				}
+				hosts = append(hosts, planHost(ctx, etcdClient, cfg, group.Group, srvCfg))
+			}
+		}
+		if len(hosts) == 0 {
+			return fmt.Errorf("no matching servers")
+		}
+
+		p := plan.Summarize(hosts)
+		if planOpts.noDiff {
+			for i := range p.Hosts {
+				for j := range p.Hosts[i].Changes {
+					p.Hosts[i].Changes[j].Diff = ""
+				}
+			}
+		}
+
+		switch planOpts.output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(p)
+		case "semantic":
+			err = plan.WriteSemantic(os.Stdout, p)
+		default:
+			err = plan.WriteText(os.Stdout, p, !planOpts.noDiff)
+		}
+		if err != nil {
+			return err
+		}
+
+		if p.Errors > 0 {
+			return fmt.Errorf("%d host(s) could not be planned", p.Errors)
+		}
+		if planOpts.detailedExitCode && p.HasChanges() {
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVar(&planOpts.group, "group", "", "only plan servers of this group")
+	planCmd.Flags().StringVar(&planOpts.host, "host", "", "only plan this server host")
+	planCmd.Flags().StringVarP(&planOpts.output, "output", "o", "text", "output format: text, semantic (nginx-aware changes instead of line diffs) or json")
+	planCmd.Flags().BoolVar(&planOpts.noDiff, "no-diff", false, "omit unified diffs")
+	planCmd.Flags().BoolVar(&planOpts.detailedExitCode, "detailed-exitcode", false, "exit 2 when there are changes")
+	rootCmd.AddCommand(planCmd)
+}
+
+func planHost(ctx context.Context, etcdClient *etcd.Client, cfg *config.Config, group string, srvCfg *config.ServerConfig) plan.HostPlan {
+	client, err := ssh.NewClient(srvCfg)
+	if err != nil {
+		return plan.HostPlan{Group: group, Host: srvCfg.Host, Name: srvCfg.Name, Error: err.Error()}
+	}
+	defer client.Close()
+
+	return plan.ForHost(ctx, etcdClient, client, cfg.Sync.GitSyncer.KeyPrefix, group, srvCfg, ssh.NewScpOptions(srvCfg, cfg.Sync.NginxSyncer.IgnorePatterns))
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/configpolicy"
+	"github.com/spf13/cobra"
+)
+
+var policyOpts struct {
+	group string
+	host  string
+	mode  string
+}
+
+var policyCmd = &cobra.Command{
+	Use:          "policy",
+	Short:        "Evaluate the config policy rules against the nginx config trees in etcd",
+	SilenceUsage: true,
+	Long: `Parse the production, preview or remote tree of each server from etcd and evaluate the rules of
+config_policy.file against it. Violations at or above config_policy.block_on block update/prepare and
+apply unless the block, or a block around it, has a "# policy:allow <rule> <justification>" comment.
+Allowed violations are listed with their justification. Exits 1 if a violation blocks.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		query.Set("mode", policyOpts.mode)
+		if policyOpts.group != "" {
+			query.Set("group", policyOpts.group)
+		}
+		if policyOpts.host != "" {
+			query.Set("host", policyOpts.host)
+		}
+
+		var res api.PolicyResponse
+		if err := client.do("GET", "/policy", query, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			w := newTable()
+			fmt.Fprintln(w, "GROUP\tHOST\tSEVERITY\tRULE\tPOSITION\tSTATUS\tMESSAGE")
+			for _, h := range res.Hosts {
+				if h.Error != "" {
+					fmt.Fprintf(w, "%s\t%s\t%s\t\t\t\t%s\n", h.Group, h.Host, "error", h.Error)
+					continue
+				}
+				for _, f := range h.Result.Findings {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", h.Group, h.Host, f.Severity, f.Rule, f.Position(), policyStatus(f), f.Message)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if !res.OK {
+			return fmt.Errorf("config policy violated (%s)", res.Mode)
+		}
+		return nil
+	},
+}
+
+// policyStatus describes whether a policy finding blocks deploys.
+func policyStatus(f configpolicy.Finding) string {
+	switch {
+	case f.Allowed:
+		return fmt.Sprintf("allowed at %s: %s", f.AllowedAt, f.Justification)
+	case f.Blocking:
+		return "blocking"
+	default:
+		return "reported"
+	}
+}
+
+// printPolicyFindings writes one line per config policy finding.
+func printPolicyFindings(w io.Writer, res *configpolicy.Result) {
+	for _, f := range res.Findings {
+		fmt.Fprintf(w, "policy %s: %s: %s [%s, %s]\n", f.Severity, f.Position(), f.Message, f.Rule, policyStatus(f))
+	}
+}
+
+func init() {
+	policyCmd.Flags().StringVar(&policyOpts.group, "group", "", "only evaluate servers of this group")
+	policyCmd.Flags().StringVar(&policyOpts.host, "host", "", "only evaluate this server host")
+	policyCmd.Flags().StringVar(&policyOpts.mode, "mode", "prod", "tree to evaluate: prod, preview or remote")
+	addClientFlags(policyCmd)
+	rootCmd.AddCommand(policyCmd)
+}
@@ -8,14 +8,17 @@ import (
 	"syscall"
 
 	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/configpolicy"
 	"github.com/spf13/cobra"
 )
 
 var reloadCmd = &cobra.Command{
 	Use:   "reload",
-	Short: "Reload servers.yaml configuration (hot reload)",
-	Long: `Send SIGHUP signal to the running gitops-nginx process to trigger hot reload of servers.yaml.
-This allows updating the nginx server list without restarting the entire application.`,
+	Short: "Reload servers.yaml and the config policy (hot reload)",
+	Long: `Send SIGHUP signal to the running gitops-nginx process to trigger hot reload of servers.yaml
+and of the config_policy.file rules. This allows updating the nginx server list and the policy
+without restarting the entire application. A policy file that fails to load on reload is
+reported in the logs and the previous policy stays in effect.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// First validate the new configuration
 		fmt.Println("Validating servers.yaml configuration...")
@@ -23,6 +26,15 @@ This allows updating the nginx server list without restarting the entire applica
 		if err != nil {
 			return fmt.Errorf("configuration validation failed: %w", err)
 		}
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.ConfigPolicy.File != "" {
+			if _, err := configpolicy.Load(cfg.ConfigPolicy.File, cfg.ConfigPolicy.BlockOn); err != nil {
+				return fmt.Errorf("config policy validation failed: %w", err)
+			}
+		}
 		fmt.Println("Configuration validation passed.")
 
 		// Read PID file
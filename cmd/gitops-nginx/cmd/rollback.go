@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/spf13/cobra"
+)
+
+var rollbackOpts struct {
+	group                string
+	host                 string
+	freezeOverrideReason string
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:          "rollback",
+	Short:        "Restore the live config of a server from the snapshot taken before the last deploy",
+	SilenceUsage: true,
+	Long: `Restore the live nginx config directory of a server from the snapshot taken before the last
+prepare or apply changed it, test it with nginx -t and reload nginx. The production prefix is not
+changed, pin the server to keep the syncer from deploying the newer commit again. Exits 1 on failure.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if rollbackOpts.group == "" || rollbackOpts.host == "" {
+			return fmt.Errorf("--group and --host are required")
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		req := api.RollbackRequest{
+			Group:                rollbackOpts.group,
+			Server:               rollbackOpts.host,
+			FreezeOverrideReason: rollbackOpts.freezeOverrideReason,
+		}
+		var res api.RollbackResponse
+		err = client.do("POST", "/rollback", nil, req, &res)
+
+		if clientOpts.output == "json" {
+			if perr := printJSON(res); perr != nil {
+				return perr
+			}
+		} else {
+			if res.Nginx != nil {
+				fmt.Printf("$ %s\n%s", res.Nginx.Command, res.Nginx.Output)
+			}
+			if res.Message != "" {
+				fmt.Println(res.Message)
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("rollback failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().StringVar(&rollbackOpts.group, "group", "", "server group name")
+	rollbackCmd.Flags().StringVar(&rollbackOpts.host, "host", "", "server host")
+	rollbackCmd.Flags().StringVar(&rollbackOpts.freezeOverrideReason, "freeze-override-reason", "", "admin override of a freeze window or the allowed deploy hours")
+	addClientFlags(rollbackCmd)
+	rootCmd.AddCommand(rollbackCmd)
+}
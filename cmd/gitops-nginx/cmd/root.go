@@ -19,12 +19,14 @@ var rootCmd = &cobra.Command{
 	Short: "GitOps-based Nginx configuration management tool",
 	Long: `gitops-nginx is a GitOps-based tool for managing Nginx configurations.
 It syncs configurations from Git repositories to remote Nginx servers via etcd.`,
+	// Errors are printed by Execute
+	SilenceErrors: true,
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/simulate"
+	"github.com/spf13/cobra"
+)
+
+var simulateOpts struct {
+	group   string
+	host    string
+	url     string
+	addr    string
+	mode    string
+	compare bool
+}
+
+var simulateCmd = &cobra.Command{
+	Use:          "simulate",
+	Short:        "Show which server and location nginx would pick for a URL",
+	SilenceUsage: true,
+	Long: `Route a request through the production, preview or remote tree of a server following nginx's
+server_name and location precedence, and show the matched server block, location and the resulting
+proxy_pass, root or return. The URL's host is used as the Host header; --addr is the server address
+the request arrives on, which matters when server blocks listen on specific addresses.
+
+With --compare the request is routed through the remote and the preview tree; the command exits 2
+when the answers differ.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if simulateOpts.group == "" || simulateOpts.host == "" || simulateOpts.url == "" {
+			return fmt.Errorf("--group, --host and --url are required")
+		}
+		u, err := url.Parse(simulateOpts.url)
+		if err != nil {
+			return fmt.Errorf("invalid --url: %w", err)
+		}
+		req := api.SimulateRequest{
+			Group:   simulateOpts.group,
+			Server:  simulateOpts.host,
+			Mode:    simulateOpts.mode,
+			Compare: simulateOpts.compare,
+			Request: simulate.Request{Scheme: u.Scheme, Host: u.Hostname(), Path: u.EscapedPath(), Addr: simulateOpts.addr},
+		}
+		if p := u.Port(); p != "" {
+			if req.Request.Port, err = strconv.Atoi(p); err != nil {
+				return fmt.Errorf("invalid port in --url: %s", p)
+			}
+		}
+
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		var res api.SimulateResponse
+		if err := client.do("POST", "/simulate", nil, req, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("%s://%s:%d%s\n", res.Request.Scheme, res.Request.Host, res.Request.Port, res.Request.Path)
+			for _, r := range res.Results {
+				fmt.Printf("\n[%s]\n", r.Mode)
+				printSimulateResult(r.Result)
+			}
+			if res.Same != nil {
+				fmt.Println()
+				if *res.Same {
+					fmt.Println("remote and preview route the request the same way")
+				}
+				for _, d := range res.Differences {
+					fmt.Printf("differs: %s\n", d)
+				}
+			}
+		}
+
+		if res.Same != nil && !*res.Same {
+			return withExitCode(exitChanges, fmt.Errorf("remote and preview route the request differently"))
+		}
+		return nil
+	},
+}
+
+func printSimulateResult(r *simulate.Result) {
+	if s := r.Server; s != nil {
+		fmt.Printf("  server:     %s:%d server_name %s (%s)\n", s.File, s.Line, strings.Join(s.Names, " "), s.MatchedBy)
+	}
+	if l := r.Location; l != nil {
+		fmt.Printf("  location:   %s:%d %s (%s)\n", l.File, l.Line, strings.TrimSpace(l.Modifier+" "+l.Path), l.MatchedBy)
+		if len(l.Parents) > 0 {
+			fmt.Printf("  nested in:  %s\n", strings.Join(l.Parents, " > "))
+		}
+	}
+	a := r.Action
+	for _, f := range []struct{ name, value string }{
+		{"return", a.Return},
+		{"proxy_pass", a.ProxyPass},
+		{"root", a.Root},
+		{"alias", a.Alias},
+		{"try_files", a.TryFiles},
+		{"file", a.File},
+	} {
+		if f.value != "" {
+			fmt.Printf("  %-11s %s\n", f.name+":", f.value)
+		}
+	}
+	for _, n := range r.Notes {
+		fmt.Printf("  note:       %s\n", n)
+	}
+}
+
+func init() {
+	simulateCmd.Flags().StringVar(&simulateOpts.group, "group", "", "server group name")
+	simulateCmd.Flags().StringVar(&simulateOpts.host, "host", "", "server host")
+	simulateCmd.Flags().StringVar(&simulateOpts.url, "url", "", "request URL, e.g. https://api.example.com/v1/users")
+	simulateCmd.Flags().StringVar(&simulateOpts.addr, "addr", "", "server address the request arrives on, for servers that listen on specific addresses")
+	simulateCmd.Flags().StringVar(&simulateOpts.mode, "mode", "prod", "tree to route through: prod, preview or remote")
+	simulateCmd.Flags().BoolVar(&simulateOpts.compare, "compare", false, "compare the remote and the preview tree")
+	addClientFlags(simulateCmd)
+	rootCmd.AddCommand(simulateCmd)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/spf13/cobra"
+)
+
+var statusOpts struct {
+	group string
+	host  string
+}
+
+var statusCmd = &cobra.Command{
+	Use:          "status",
+	Short:        "Show the synced commit, pins and render errors of each server",
+	SilenceUsage: true,
+	Long: `Show, per server, the commit synced into the production prefix, active pins, files that
+failed to render, the rollback snapshot and the outcome of the last apply. Exits 1 if any server has render errors.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		query := url.Values{}
+		query.Set("group", statusOpts.group)
+		query.Set("host", statusOpts.host)
+
+		var res api.StatusResponse
+		if err := client.do("GET", "/status", query, nil, &res); err != nil {
+			return err
+		}
+
+		if clientOpts.output == "json" {
+			if err := printJSON(res); err != nil {
+				return err
+			}
+		} else {
+			w := newTable()
+			fmt.Fprintln(w, "GROUP\tHOST\tNAME\tCOMMIT\tREF\tSYNCED AT\tPIN\tERRORS\tSNAPSHOT\tLAST DEPLOY")
+			for _, hs := range res.Hosts {
+				commit, ref, syncedAt := "-", "-", "-"
+				if hs.Synced != nil {
+					commit = shortHash(hs.Synced.Commit)
+					ref = hs.Synced.Ref
+					syncedAt = hs.Synced.SyncedAt.Local().Format("2006-01-02 15:04:05")
+				}
+				pin := "-"
+				if hs.Pin != nil {
+					pin = shortHash(hs.Pin.Commit)
+				}
+				snapshot := "-"
+				if hs.Snapshot != nil {
+					snapshot = hs.Snapshot.TakenAt.Local().Format("2006-01-02 15:04:05")
+				}
+				lastDeploy := "-"
+				if d := hs.LastDeploy; d != nil {
+					outcome := "ok"
+					if !d.Success {
+						outcome = "failed"
+					}
+					lastDeploy = d.StartedAt.Local().Format("2006-01-02 15:04:05") + " " + outcome
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+					hs.Group, hs.Host, hs.Name, commit, ref, syncedAt, pin, hs.FileErrors, snapshot, lastDeploy)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		for _, hs := range res.Hosts {
+			if hs.FileErrors > 0 {
+				return fmt.Errorf("%s/%s has %d file(s) that failed to render", hs.Group, hs.Host, hs.FileErrors)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&statusOpts.group, "group", "", "only show servers of this group")
+	statusCmd.Flags().StringVar(&statusOpts.host, "host", "", "only show this server host")
+	addClientFlags(statusCmd)
+	rootCmd.AddCommand(statusCmd)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/logn-xu/gitops-nginx/internal/api"
+	"github.com/logn-xu/gitops-nginx/internal/certs"
 	"github.com/logn-xu/gitops-nginx/internal/config"
 	"github.com/logn-xu/gitops-nginx/internal/etcd"
 	"github.com/logn-xu/gitops-nginx/internal/manager"
@@ -65,12 +66,17 @@ func runServer(withUI bool) error {
 
 	mgr := manager.NewManager()
 
-	// Add API server (not reloadable)
+	// Add API server (not reloadable, its config policy is reloaded in place)
+	var apiServer *api.Server
 	if withUI {
-		mgr.Add(api.NewServer(cfg, etcdClient, dist))
+		apiServer = api.NewServer(cfg, etcdClient, dist)
 	} else {
-		mgr.Add(api.NewServerWithoutUI(cfg, etcdClient))
+		apiServer = api.NewServerWithoutUI(cfg, etcdClient)
 	}
+	if err := apiServer.LoadConfigPolicy(); err != nil {
+		return err
+	}
+	mgr.Add(apiServer)
 
 	// Create syncer factory for reload
 	createSyncers := func() []manager.Service {
@@ -87,8 +93,8 @@ func runServer(withUI bool) error {
 		for _, group := range serverGroups {
 			for _, server := range group.Servers {
 				nginxSyncer := sync.NewNginxSyncer(etcdClient, &server, &cfg.Sync, group.Group, nginxInterval)
-				gitSyncer := sync.NewSyncer(etcdClient, &server, &cfg.Git, &cfg.Sync, group.Group, gitInterval)
-				if previewSyncer, err := sync.NewPreviewSyncer(etcdClient, &server, &cfg.Git, &cfg.Sync, group.Group); err != nil {
+				gitSyncer := sync.NewSyncer(etcdClient, &server, &cfg.Git, &cfg.Sync, &group, gitInterval)
+				if previewSyncer, err := sync.NewPreviewSyncer(etcdClient, &server, &cfg.Git, &cfg.Sync, &group); err != nil {
 					log.Logger.WithError(err).Errorf("failed to create preview syncer for %s", server.Host)
 				} else {
 					services = append(services, previewSyncer)
@@ -96,6 +102,7 @@ func runServer(withUI bool) error {
 				services = append(services, nginxSyncer, gitSyncer)
 			}
 		}
+		services = append(services, certs.NewScanner(etcdClient, cfg, serverGroups))
 		return services
 	}
 
@@ -122,6 +129,9 @@ func runServer(withUI bool) error {
 	for sig := range quit {
 		if sig == syscall.SIGHUP {
 			log.Logger.Info("received SIGHUP, reloading services...")
+			if err := apiServer.LoadConfigPolicy(); err != nil {
+				log.Logger.WithError(err).Error("failed to reload config policy, keeping the previous one")
+			}
 			mgr.Reload(createSyncers)
 			continue
 		}
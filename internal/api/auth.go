@@ -0,0 +1,63 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API roles
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+)
+
+const (
+	anonymousUser = "anonymous"
+	userKey       = "user"
+	roleKey       = "role"
+)
+
+// authMiddleware authenticates requests with the bearer tokens from api.tokens.
+// When no token is configured authentication is disabled and every caller is an anonymous
+// admin, see api.tokens in config.example.yaml. The Web UI sends the token from local storage.
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(s.cfg.API.Tokens) == 0 {
+			c.Set(userKey, anonymousUser)
+			c.Set(roleKey, RoleAdmin)
+			c.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+		for _, t := range s.cfg.API.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+				c.Set(userKey, t.User)
+				c.Set(roleKey, t.Role)
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+	}
+}
+
+// currentUser returns the authenticated user of the request.
+func currentUser(c *gin.Context) string {
+	if user := c.GetString(userKey); user != "" {
+		return user
+	}
+	return anonymousUser
+}
+
+// isAdmin reports whether the authenticated user of the request has the admin role.
+func isAdmin(c *gin.Context) bool {
+	return c.GetString(roleKey) == RoleAdmin
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/deploypolicy"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// maxAlertFiles bounds the file names stored in a mass delete alert.
+const maxAlertFiles = 20
+
+// deleteGuard returns the ssh.ScpOptions.DeleteGuard of an upload into the live config directory.
+// Crossing the delete guard raises an alert and aborts the upload with a *deploypolicy.Violation,
+// unless allow is set, which callers only pass for admins with a reason; the override is audited.
+func (s *Server) deleteGuard(ctx context.Context, action, group, host, user, reason string, allow bool) func([]string, int) error {
+	return func(deleting []string, existing int) error {
+		violation := deploypolicy.CheckDeletes(s.cfg.Sync.DeleteGuard, len(deleting), existing)
+		if violation == nil {
+			return nil
+		}
+
+		files := deleting
+		if len(files) > maxAlertFiles {
+			files = files[:maxAlertFiles]
+		}
+		details := map[string]string{
+			"operation": action,
+			"deleting":  fmt.Sprint(len(deleting)),
+			"existing":  fmt.Sprint(existing),
+			"files":     strings.Join(files, ", "),
+		}
+		l := log.Logger.WithFields(log.Fields{
+			"user":      user,
+			"operation": action,
+			"group":     group,
+			"host":      host,
+			"deleting":  len(deleting),
+			"existing":  existing,
+		})
+
+		if allow {
+			if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+				Actor:   user,
+				Action:  "mass_delete_override",
+				Group:   group,
+				Host:    host,
+				Reason:  reason,
+				Details: details,
+			}); err != nil {
+				return fmt.Errorf("failed to record mass delete override in audit trail: %w", err)
+			}
+			l.Warn("delete guard overridden")
+			return nil
+		}
+
+		if _, err := s.stateStore.RaiseAlert(ctx, state.Alert{
+			Kind:    state.AlertMassDelete,
+			Source:  action,
+			Group:   group,
+			Host:    host,
+			Message: violation.Message,
+			Details: details,
+		}); err != nil {
+			l.WithError(err).Warn("failed to raise mass delete alert")
+		}
+		l.Error("upload blocked by the delete guard")
+		return violation
+	}
+}
+
+// uploadOptions returns the options of an update into the live config directory of a server,
+// guarded against mass deletes. It writes the error response and returns false when a non-admin
+// asks to bypass the guard or the bypass comes without a mass delete reason.
+func (s *Server) uploadOptions(c *gin.Context, action string, req UpdateRequest, srvCfg *config.ServerConfig) (ssh.ScpOptions, bool) {
+	if req.AllowMassDelete && req.MassDeleteReason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mass_delete_reason is required with allow_mass_delete"})
+		return ssh.ScpOptions{}, false
+	}
+	if req.AllowMassDelete && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can allow mass deletes"})
+		return ssh.ScpOptions{}, false
+	}
+	opts := s.scpOptions(srvCfg)
+	opts.DeleteGuard = s.deleteGuard(c.Request.Context(), action, req.Group, srvCfg.Host, currentUser(c), req.MassDeleteReason, req.AllowMassDelete)
+	return opts, true
+}
+
+func (s *Server) handleListAlerts(c *gin.Context) {
+	alerts, err := s.stateStore.ListAlerts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if alerts == nil {
+		alerts = []state.Alert{}
+	}
+	c.JSON(http.StatusOK, AlertsResponse{Alerts: alerts})
+}
+
+// handleAllowMassDelete lets the next git sync of a host cross the delete guard once.
+func (s *Server) handleAllowMassDelete(c *gin.Context) {
+	var req MassDeleteAllowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+	if !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can allow mass deletes"})
+		return
+	}
+	srvCfg := s.findServerConfig(req.Group, req.Server)
+	if srvCfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	grant := state.MassDeleteGrant{
+		Group:     req.Group,
+		Host:      srvCfg.Host,
+		Reason:    req.Reason,
+		GrantedBy: currentUser(c),
+		GrantedAt: time.Now(),
+	}
+	if err := s.stateStore.PutMassDeleteGrant(ctx, grant); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+		Actor:  grant.GrantedBy,
+		Action: "mass_delete_allow",
+		Group:  grant.Group,
+		Host:   grant.Host,
+		Reason: grant.Reason,
+	}); err != nil {
+		log.Logger.WithError(err).Warn("failed to record mass delete grant in audit trail")
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/bootstrap"
+)
+
+func (s *Server) handleBootstrap(c *gin.Context) {
+	var req BootstrapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if s.findServerConfig(req.Group, req.Server) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	result, err := bootstrap.Run(c.Request.Context(), s.cfg, bootstrap.Options{
+		Group:   req.Group,
+		Host:    req.Server,
+		Force:   req.Force,
+		Push:    req.Push == nil || *req.Push,
+		Message: req.Message,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, bootstrap.ErrAlreadyBootstrapped) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, BootstrapResponse{
+			Success: false,
+			Error:   err.Error(),
+			Result:  result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, BootstrapResponse{
+		Success: true,
+		Result:  result,
+	})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/certs"
+)
+
+// handleGetCerts returns the certificates in the production and remote trees with their
+// expiry and the server blocks that use them.
+func (s *Server) handleGetCerts(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	source := c.Query("source") // "prod", "remote" or empty for both
+
+	if host != "" && group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required with host"})
+		return
+	}
+	sources := []string{"prod", "remote"}
+	switch source {
+	case "":
+	case "prod", "remote":
+		sources = []string{source}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be 'prod' or 'remote'"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var hosts []certs.HostCerts
+	for _, g := range s.cfg.NginxServers {
+		if group != "" && g.Group != group {
+			continue
+		}
+		for i := range g.Servers {
+			srvCfg := &g.Servers[i]
+			if host != "" && srvCfg.Host != host {
+				continue
+			}
+			for _, src := range sources {
+				h := certs.HostCerts{Group: g.Group, Host: srvCfg.Host, Name: srvCfg.Name, Source: src}
+				prefix, err := s.treePrefix(src, g.Group, srvCfg)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				h.Certs, err = certs.ScanPrefix(ctx, s.etcdClient, prefix, srvCfg, s.cfg.Certs.WarnDays)
+				if err != nil {
+					h.Error = err.Error()
+				}
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CertsResponse{WarnDays: s.cfg.Certs.WarnDays, Hosts: hosts})
+}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+func (s *Server) handleListChanges(c *gin.Context) {
+	changes, err := s.stateStore.ListChanges(c.Request.Context(), c.Query("group"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if changes == nil {
+		changes = []state.ChangeRequest{}
+	}
+	c.JSON(http.StatusOK, ChangesResponse{Changes: changes})
+}
+
+func (s *Server) handleCreateChange(c *gin.Context) {
+	var req ChangeCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hosts, ok := s.changeHosts(c, req.Group, req.Server)
+	if !ok {
+		return
+	}
+
+	// 1. The change deploys what is synced into the production prefix of its hosts
+	synced, err := s.syncedCommitOf(c.Request.Context(), req.Group, hosts)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. An explicit commit must be the synced one, so reviewers approve what will be applied
+	if req.Commit != "" {
+		repo, err := gitrepo.OpenRepository(&s.cfg.Git)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to open repo: %v", err)})
+			return
+		}
+		hash, err := repo.ResolveRevision(plumbing.Revision(req.Commit))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to resolve commit %s: %v", req.Commit, err)})
+			return
+		}
+		if hash.String() != synced {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("commit %s is not synced into the production prefix (synced: %s)", hash, synced)})
+			return
+		}
+	}
+
+	id, err := state.NewChangeID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	change := state.ChangeRequest{
+		ID:          id,
+		Group:       req.Group,
+		Host:        req.Server,
+		Commit:      synced,
+		Description: req.Description,
+		Status:      state.ChangePending,
+		CreatedBy:   currentUser(c),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.stateStore.PutChange(c.Request.Context(), change); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"change": change.ID,
+		"user":   change.CreatedBy,
+		"group":  change.Group,
+		"host":   change.Host,
+		"commit": change.Commit,
+	}).Info("change request created")
+
+	c.JSON(http.StatusOK, change)
+}
+
+func (s *Server) handleApproveChange(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := currentUser(c)
+	if user == anonymousUser {
+		c.JSON(http.StatusForbidden, gin.H{"error": "approving a change requires an authenticated user (configure api.tokens)"})
+		return
+	}
+
+	change, rev, err := s.stateStore.GetChangeRevision(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if change == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "change request not found"})
+		return
+	}
+	if change.Status == state.ChangeApplied || len(change.AppliedHosts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "change request has already been applied"})
+		return
+	}
+	if change.CreatedBy == user {
+		c.JSON(http.StatusForbidden, gin.H{"error": "a change request must be approved by a different user"})
+		return
+	}
+
+	ttl, err := time.ParseDuration(s.cfg.DeployPolicy.ApprovalTTL)
+	if err != nil || ttl <= 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("invalid deploy_policy.approval_ttl %q", s.cfg.DeployPolicy.ApprovalTTL)})
+		return
+	}
+
+	hosts, ok := s.changeHosts(c, change.Group, change.Host)
+	if !ok {
+		return
+	}
+
+	// 1. The production prefix must still hold the commit the change was created for
+	synced, err := s.syncedCommitOf(ctx, change.Group, hosts)
+	if err != nil || synced != change.Commit {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("production prefix no longer holds commit %s, create a new change request", change.Commit)})
+		return
+	}
+
+	// 2. Remember the production prefix being approved, any later change invalidates the approval
+	fingerprints := make(map[string]string, len(hosts))
+	for _, srvCfg := range hosts {
+		fp, err := s.prodFingerprint(ctx, change.Group, srvCfg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fingerprints[srvCfg.Host] = fp
+	}
+
+	now := time.Now()
+	change.Status = state.ChangeApproved
+	change.ApprovedBy = user
+	change.ApprovedAt = now
+	change.ExpiresAt = now.Add(ttl)
+	change.Fingerprints = fingerprints
+	// An apply consuming the previous approval in between must not be overwritten
+	stored, err := s.stateStore.PutChangeIfUnmodified(ctx, *change, rev)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !stored {
+		c.JSON(http.StatusConflict, gin.H{"error": "change request was modified while approving it, retry"})
+		return
+	}
+
+	if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+		Actor:  user,
+		Action: "change_approve",
+		Group:  change.Group,
+		Host:   change.Host,
+		Details: map[string]string{
+			"change":     change.ID,
+			"commit":     change.Commit,
+			"created_by": change.CreatedBy,
+		},
+	}); err != nil {
+		log.Logger.WithError(err).Warn("failed to record change approval in audit trail")
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"change":     change.ID,
+		"user":       user,
+		"group":      change.Group,
+		"host":       change.Host,
+		"commit":     change.Commit,
+		"expires_at": change.ExpiresAt,
+	}).Info("change request approved")
+
+	c.JSON(http.StatusOK, change)
+}
+
+// changeUpdateAttempts bounds how often a change request update that raced with another
+// update of the same record is retried.
+const changeUpdateAttempts = 5
+
+// authorizeChange checks, for groups that require approval, that changeID refers to an approved,
+// unexpired change request covering the host whose production prefix is unchanged since approval.
+// With consume set the host is also marked as applied, in an etcd transaction that fails if the
+// change request was written after it was checked, so two concurrent applies cannot both use it.
+// It writes the error response and returns false when the operation must not proceed.
+func (s *Server) authorizeChange(c *gin.Context, group, changeID string, srvCfg *config.ServerConfig, consume bool) (*state.ChangeRequest, bool) {
+	groupCfg := s.cfg.FindGroup(group)
+	if groupCfg == nil || !groupCfg.RequireApproval {
+		return nil, true
+	}
+
+	ctx := c.Request.Context()
+	if changeID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("group %s requires an approved change request (change_id)", group)})
+		return nil, false
+	}
+
+	for range changeUpdateAttempts {
+		change, rev, err := s.stateStore.GetChangeRevision(ctx, changeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if change == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "change request not found"})
+			return nil, false
+		}
+
+		switch {
+		case change.Group != group || !change.Covers(srvCfg.Host):
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("change request %s does not cover %s/%s", change.ID, group, srvCfg.Host)})
+			return nil, false
+		case change.Status == state.ChangePending:
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("change request %s is not approved", change.ID)})
+			return nil, false
+		case change.Status == state.ChangeApplied || slices.Contains(change.AppliedHosts, srvCfg.Host):
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("change request %s has already been applied to %s", change.ID, srvCfg.Host)})
+			return nil, false
+		case !time.Now().Before(change.ExpiresAt):
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("approval of change request %s expired at %s", change.ID, change.ExpiresAt.Format(time.RFC3339))})
+			return nil, false
+		}
+
+		fp, err := s.prodFingerprint(ctx, group, srvCfg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if fp != change.Fingerprints[srvCfg.Host] {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("production prefix of %s changed after change request %s was approved, approve it again", srvCfg.Host, change.ID)})
+			return nil, false
+		}
+		if !consume {
+			return change, true
+		}
+
+		s.markChangeApplied(change, srvCfg.Host)
+		stored, err := s.stateStore.PutChangeIfUnmodified(ctx, *change, rev)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to mark change request as applied: %v", err)})
+			return nil, false
+		}
+		if stored {
+			return change, true
+		}
+		// Another apply or approval wrote the change request in between, check it again
+	}
+
+	c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("change request %s is being updated concurrently, retry", changeID)})
+	return nil, false
+}
+
+// markChangeApplied records in change that it has been applied to host.
+// The change is consumed once every host it covers has been applied.
+func (s *Server) markChangeApplied(change *state.ChangeRequest, host string) {
+	change.AppliedHosts = append(change.AppliedHosts, host)
+	done := change.Host != ""
+	if !done {
+		done = true
+		if groupCfg := s.cfg.FindGroup(change.Group); groupCfg != nil {
+			for _, srv := range groupCfg.Servers {
+				if !slices.Contains(change.AppliedHosts, srv.Host) {
+					done = false
+					break
+				}
+			}
+		}
+	}
+	if done {
+		change.Status = state.ChangeApplied
+	}
+}
+
+// releaseChange undoes the consumption of a change request by authorizeChange for host after
+// the apply failed, so the approval can be used again.
+func (s *Server) releaseChange(ctx context.Context, changeID, host string) {
+	l := log.Logger.WithFields(log.Fields{"change": changeID, "host": host})
+	for range changeUpdateAttempts {
+		change, rev, err := s.stateStore.GetChangeRevision(ctx, changeID)
+		if err != nil || change == nil {
+			l.WithError(err).Error("failed to release change request")
+			return
+		}
+		i := slices.Index(change.AppliedHosts, host)
+		if i < 0 {
+			return
+		}
+		change.AppliedHosts = slices.Delete(change.AppliedHosts, i, i+1)
+		change.Status = state.ChangeApproved
+		stored, err := s.stateStore.PutChangeIfUnmodified(ctx, *change, rev)
+		if err != nil {
+			l.WithError(err).Error("failed to release change request")
+			return
+		}
+		if stored {
+			return
+		}
+	}
+	l.Error("failed to release change request: it is being updated concurrently")
+}
+
+// changeHosts returns the servers targeted by a change: the given server, or every server of the group.
+func (s *Server) changeHosts(c *gin.Context, group, host string) ([]*config.ServerConfig, bool) {
+	groupCfg := s.cfg.FindGroup(group)
+	if groupCfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return nil, false
+	}
+	if host != "" {
+		srvCfg := s.findServerConfig(group, host)
+		if srvCfg == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			return nil, false
+		}
+		return []*config.ServerConfig{srvCfg}, true
+	}
+	hosts := make([]*config.ServerConfig, 0, len(groupCfg.Servers))
+	for i := range groupCfg.Servers {
+		hosts = append(hosts, &groupCfg.Servers[i])
+	}
+	return hosts, true
+}
+
+// syncedCommitOf returns the commit synced into the production prefix of all hosts.
+func (s *Server) syncedCommitOf(ctx context.Context, group string, hosts []*config.ServerConfig) (string, error) {
+	var commit string
+	for _, srvCfg := range hosts {
+		rec, err := s.stateStore.GetSyncedCommit(ctx, group, srvCfg.Host)
+		if err != nil {
+			return "", err
+		}
+		if rec == nil {
+			return "", fmt.Errorf("no synced commit recorded for %s/%s", group, srvCfg.Host)
+		}
+		if commit != "" && commit != rec.Commit {
+			return "", fmt.Errorf("hosts of group %s are on different commits (%s, %s)", group, commit, rec.Commit)
+		}
+		commit = rec.Commit
+	}
+	return commit, nil
+}
+
+// prodFingerprint hashes the keys and modification revisions of the production prefix of a host,
+// so that any put or delete under the prefix changes the fingerprint.
+func (s *Server) prodFingerprint(ctx context.Context, group string, srvCfg *config.ServerConfig) (string, error) {
+	prefix := path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, group, srvCfg.Host, filepath.Base(srvCfg.NginxConfigDir))
+	resp, err := s.etcdClient.GetPrefix(ctx, prefix+"/")
+	if err != nil {
+		return "", fmt.Errorf("failed to read production prefix %s: %w", prefix, err)
+	}
+	h := sha256.New()
+	for _, kv := range resp.Kvs {
+		h.Write(kv.Key)
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(kv.ModRevision, 10)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd/etcdtest"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const syncedCommit = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// newChangeTestServer returns a server backed by an in-memory etcd with two groups that require
+// approval; every host has a synced production prefix.
+func newChangeTestServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		API: config.APIConfig{Tokens: []config.APITokenConfig{
+			{Token: "alice-token", User: "alice", Role: RoleOperator},
+			{Token: "bob-token", User: "bob", Role: RoleOperator},
+		}},
+		Sync: config.SyncConfig{
+			GitSyncer: config.GitSyncer{KeyPrefix: "/gitops-nginx"},
+			State:     config.StateConfig{KeyPrefix: "/gitops-nginx-state"},
+		},
+		DeployPolicy: config.DeployPolicyConfig{ApprovalTTL: "1h"},
+		NginxServers: []config.NginxServerGroup{
+			{Group: "web", RequireApproval: true, Servers: []config.ServerConfig{
+				{Host: "10.0.0.1", NginxConfigDir: "/etc/nginx"},
+				{Host: "10.0.0.2", NginxConfigDir: "/etc/nginx"},
+			}},
+			{Group: "edge", RequireApproval: true, Servers: []config.ServerConfig{
+				{Host: "10.0.0.1", NginxConfigDir: "/etc/nginx"},
+			}},
+		},
+	}
+	client, _ := etcdtest.NewClient()
+	s := NewServerWithoutUI(cfg, client)
+
+	ctx := context.Background()
+	for _, group := range cfg.NginxServers {
+		for _, srv := range group.Servers {
+			_, err := client.Put(ctx, "/gitops-nginx/"+group.Group+"/"+srv.Host+"/nginx/nginx.conf", "worker_processes 4;\n")
+			require.NoError(t, err)
+			require.NoError(t, s.stateStore.PutSyncedCommit(ctx, state.SyncedCommit{
+				Group: group.Group, Host: srv.Host, Ref: "master", Commit: syncedCommit, SyncedAt: time.Now(),
+			}))
+		}
+	}
+	return s
+}
+
+func serve(t *testing.T, s *Server, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// createChange creates a change request as alice and returns it.
+func createChange(t *testing.T, s *Server, group, host string) state.ChangeRequest {
+	t.Helper()
+	w := serve(t, s, http.MethodPost, "/api/v1/changes", "alice-token", ChangeCreateRequest{Group: group, Server: host})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var change state.ChangeRequest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &change))
+	assert.Equal(t, state.ChangePending, change.Status)
+	assert.Equal(t, "alice", change.CreatedBy)
+	assert.Equal(t, syncedCommit, change.Commit)
+	return change
+}
+
+// approveChange approves a change request as bob.
+func approveChange(t *testing.T, s *Server, id string) {
+	t.Helper()
+	w := serve(t, s, http.MethodPost, "/api/v1/changes/"+id+"/approve", "bob-token", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+// authorize runs authorizeChange for a deploy to group/host and returns the response status,
+// 0 when the deploy may proceed. With consume it authorizes an apply, which consumes the change.
+func authorize(t *testing.T, s *Server, group, host, changeID string, consume bool) (int, *state.ChangeRequest) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/update/apply", nil)
+	srvCfg := s.findServerConfig(group, host)
+	require.NotNil(t, srvCfg)
+	change, ok := s.authorizeChange(c, group, changeID, srvCfg, consume)
+	if ok {
+		return 0, change
+	}
+	return w.Code, nil
+}
+
+func TestApproveChangeRejectsSelfApproval(t *testing.T) {
+	s := newChangeTestServer(t)
+	change := createChange(t, s, "web", "10.0.0.1")
+
+	w := serve(t, s, http.MethodPost, "/api/v1/changes/"+change.ID+"/approve", "alice-token", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "different user")
+	code, _ := authorize(t, s, "web", "10.0.0.1", change.ID, false)
+	assert.Equal(t, http.StatusForbidden, code, "a pending change does not authorize a deploy")
+
+	approveChange(t, s, change.ID)
+	stored, err := s.stateStore.GetChange(context.Background(), change.ID)
+	require.NoError(t, err)
+	assert.Equal(t, state.ChangeApproved, stored.Status)
+	assert.Equal(t, "bob", stored.ApprovedBy)
+	code, _ = authorize(t, s, "web", "10.0.0.1", change.ID, false)
+	assert.Zero(t, code)
+}
+
+func TestAuthorizeChangeExpired(t *testing.T) {
+	s := newChangeTestServer(t)
+	change := createChange(t, s, "web", "10.0.0.1")
+	approveChange(t, s, change.ID)
+
+	stored, err := s.stateStore.GetChange(context.Background(), change.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, stored.ApprovedAt.Add(time.Hour), stored.ExpiresAt, time.Second)
+	stored.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, s.stateStore.PutChange(context.Background(), *stored))
+
+	code, _ := authorize(t, s, "web", "10.0.0.1", change.ID, false)
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestAuthorizeChangeConsumedByApply(t *testing.T) {
+	s := newChangeTestServer(t)
+	ctx := context.Background()
+
+	t.Run("host", func(t *testing.T) {
+		change := createChange(t, s, "web", "10.0.0.1")
+		approveChange(t, s, change.ID)
+
+		// Prepare checks the change without consuming it
+		code, _ := authorize(t, s, "web", "10.0.0.1", change.ID, false)
+		require.Zero(t, code)
+		code, _ = authorize(t, s, "web", "10.0.0.1", change.ID, true)
+		require.Zero(t, code)
+
+		code, _ = authorize(t, s, "web", "10.0.0.1", change.ID, true)
+		assert.Equal(t, http.StatusConflict, code)
+		w := serve(t, s, http.MethodPost, "/api/v1/changes/"+change.ID+"/approve", "bob-token", nil)
+		assert.Equal(t, http.StatusConflict, w.Code, "an applied change cannot be approved again")
+	})
+
+	t.Run("group", func(t *testing.T) {
+		change := createChange(t, s, "web", "")
+		approveChange(t, s, change.ID)
+
+		code, _ := authorize(t, s, "web", "10.0.0.1", change.ID, true)
+		require.Zero(t, code)
+
+		// The change stays valid for the other host of the group, but only once per host
+		code, _ = authorize(t, s, "web", "10.0.0.1", change.ID, true)
+		assert.Equal(t, http.StatusConflict, code)
+		code, _ = authorize(t, s, "web", "10.0.0.2", change.ID, true)
+		require.Zero(t, code)
+
+		stored, err := s.stateStore.GetChange(ctx, change.ID)
+		require.NoError(t, err)
+		assert.Equal(t, state.ChangeApplied, stored.Status)
+		code, _ = authorize(t, s, "web", "10.0.0.2", change.ID, true)
+		assert.Equal(t, http.StatusConflict, code)
+	})
+
+	t.Run("released after a failed apply", func(t *testing.T) {
+		change := createChange(t, s, "web", "10.0.0.2")
+		approveChange(t, s, change.ID)
+
+		code, _ := authorize(t, s, "web", "10.0.0.2", change.ID, true)
+		require.Zero(t, code)
+		s.releaseChange(ctx, change.ID, "10.0.0.2")
+
+		stored, err := s.stateStore.GetChange(ctx, change.ID)
+		require.NoError(t, err)
+		assert.Equal(t, state.ChangeApproved, stored.Status)
+		assert.Empty(t, stored.AppliedHosts)
+		code, _ = authorize(t, s, "web", "10.0.0.2", change.ID, true)
+		assert.Zero(t, code)
+	})
+}
+
+func TestAuthorizeChangeConcurrentApplies(t *testing.T) {
+	s := newChangeTestServer(t)
+	hostChange := createChange(t, s, "web", "10.0.0.1")
+	approveChange(t, s, hostChange.ID)
+	groupChange := createChange(t, s, "web", "")
+	approveChange(t, s, groupChange.ID)
+
+	const applies = 8
+	var wg sync.WaitGroup
+	codes := make(chan int, 2*applies)
+	for i := range applies {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			code, _ := authorize(t, s, "web", "10.0.0.1", hostChange.ID, true)
+			codes <- code
+		}()
+		go func() {
+			defer wg.Done()
+			host := []string{"10.0.0.1", "10.0.0.2"}[i%2]
+			code, _ := authorize(t, s, "web", host, groupChange.ID, true)
+			if code == 0 {
+				codes <- 100 + i%2
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	// The host change is applied once, the group change once per host
+	granted := map[int]int{}
+	for code := range codes {
+		granted[code]++
+	}
+	assert.Equal(t, 1, granted[0], "applies of the host change")
+	assert.Equal(t, applies-1, granted[http.StatusConflict])
+	assert.Equal(t, 1, granted[100], "applies of the group change to 10.0.0.1")
+	assert.Equal(t, 1, granted[101], "applies of the group change to 10.0.0.2")
+
+	stored, err := s.stateStore.GetChange(context.Background(), groupChange.ID)
+	require.NoError(t, err)
+	assert.Equal(t, state.ChangeApplied, stored.Status)
+	assert.ElementsMatch(t, []string{"10.0.0.1", "10.0.0.2"}, stored.AppliedHosts)
+}
+
+func TestAuthorizeChangeScope(t *testing.T) {
+	s := newChangeTestServer(t)
+	change := createChange(t, s, "web", "10.0.0.1")
+	approveChange(t, s, change.ID)
+
+	code, _ := authorize(t, s, "web", "10.0.0.2", change.ID, false)
+	assert.Equal(t, http.StatusForbidden, code, "another host of the group")
+	code, _ = authorize(t, s, "edge", "10.0.0.1", change.ID, false)
+	assert.Equal(t, http.StatusForbidden, code, "the same host in another group")
+	code, _ = authorize(t, s, "web", "10.0.0.1", "", false)
+	assert.Equal(t, http.StatusForbidden, code, "no change request")
+
+	// A production prefix changed after approval invalidates it
+	_, err := s.etcdClient.Put(context.Background(), "/gitops-nginx/web/10.0.0.1/nginx/nginx.conf", "worker_processes 8;\n")
+	require.NoError(t, err)
+	code, _ = authorize(t, s, "web", "10.0.0.1", change.ID, false)
+	assert.Equal(t, http.StatusConflict, code)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/compare"
+)
+
+// handleCompareHosts compares the trees of two hosts of a group file by file.
+func (s *Server) handleCompareHosts(c *gin.Context) {
+	group := c.Query("group")
+	hostA := c.Query("a")
+	hostB := c.Query("b")
+	source := c.DefaultQuery("source", "prod")
+
+	if group == "" || hostA == "" || hostB == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group, a and b are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	trees := make([]map[string][]byte, 0, 2)
+	for _, host := range []string{hostA, hostB} {
+		srvCfg := s.findServerConfig(group, host)
+		if srvCfg == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "server " + host + " not found in group " + group})
+			return
+		}
+		prefix, err := s.treePrefix(source, group, srvCfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		files, err := s.etcdClient.GetFiles(ctx, prefix)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get files from etcd: " + err.Error()})
+			return
+		}
+		trees = append(trees, files)
+	}
+
+	result, err := compare.Trees(trees[0], trees[1])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, CompareResponse{Group: group, A: hostA, B: hostB, Source: source, Result: *result})
+}
+
+// handleGroupConsistency clusters the hosts of a group by the hash of their tree.
+func (s *Server) handleGroupConsistency(c *gin.Context) {
+	group := c.Query("group")
+	source := c.DefaultQuery("source", "prod")
+
+	if group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var trees []compare.HostTree
+	for _, g := range s.cfg.NginxServers {
+		if g.Group != group {
+			continue
+		}
+		for i := range g.Servers {
+			srvCfg := &g.Servers[i]
+			prefix, err := s.treePrefix(source, g.Group, srvCfg)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			t := compare.HostTree{Host: srvCfg.Host, Name: srvCfg.Name}
+			hashes, err := s.etcdClient.GetFileHashes(ctx, prefix)
+			if err != nil {
+				t.Error = err.Error()
+			} else {
+				t.Hash = compare.TreeHash(hashes)
+				t.Files = len(hashes)
+			}
+			trees = append(trees, t)
+		}
+	}
+	if len(trees) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ConsistencyResponse{Group: group, Source: source, Hosts: trees, Report: *compare.Group(trees)})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/lint"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/logn-xu/gitops-nginx/internal/simulate"
+)
+
+// treePrefix returns the etcd prefix of the config tree of a host for a mode:
+// "prod" (git, the default), "preview" or "remote".
+func (s *Server) treePrefix(mode, group string, srvCfg *config.ServerConfig) (string, error) {
+	configDirSuffix := filepath.Base(srvCfg.NginxConfigDir)
+	switch mode {
+	case "", "prod":
+		return path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, group, srvCfg.Host, configDirSuffix), nil
+	case "preview":
+		return path.Join(s.cfg.Sync.PreviewSyncer.KeyPrefix, group, srvCfg.Host, configDirSuffix), nil
+	case "remote":
+		return path.Join(s.cfg.Sync.NginxSyncer.KeyPrefix, group, srvCfg.Host, configDirSuffix), nil
+	}
+	return "", fmt.Errorf("mode must be 'prod', 'preview' or 'remote'")
+}
+
+// loadNginxConfig parses the config tree of a host stored under prefix, following includes from nginx.conf.
+func (s *Server) loadNginxConfig(ctx context.Context, prefix string, srvCfg *config.ServerConfig) (*nginxconf.Config, error) {
+	files, err := s.etcdClient.GetFiles(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files from etcd: %w", err)
+	}
+	return nginxconf.Load(files, nginxconf.Options{ConfigDir: srvCfg.NginxConfigDir}), nil
+}
+
+func (s *Server) handleGetConfigGraph(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	mode := c.DefaultQuery("mode", "prod")
+
+	if group == "" || host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group and host are required"})
+		return
+	}
+	srvCfg := s.findServerConfig(group, host)
+	if srvCfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+	prefix, err := s.treePrefix(mode, group, srvCfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg, err := s.loadNginxConfig(c.Request.Context(), prefix, srvCfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ConfigGraphResponse{
+		Group:  group,
+		Host:   host,
+		Mode:   mode,
+		Prefix: prefix,
+		Graph:  cfg.Graph,
+	})
+}
+
+// lintTree runs the lint rules on the config tree of a host stored under prefix.
+func (s *Server) lintTree(ctx context.Context, prefix string, srvCfg *config.ServerConfig) (*lint.Result, error) {
+	linter, err := lint.New(s.cfg.Lint)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.loadNginxConfig(ctx, prefix, srvCfg)
+	if err != nil {
+		return nil, err
+	}
+	return linter.Lint(&lint.Input{Config: cfg, Protected: s.scpOptions(srvCfg).Protected}), nil
+}
+
+// handleLint lints the config trees of a host, of every host of a group without host,
+// or of every host without group.
+func (s *Server) handleLint(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	mode := c.DefaultQuery("mode", "prod")
+
+	if host != "" && group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required with host"})
+		return
+	}
+	if _, err := lint.New(s.cfg.Lint); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := LintResponse{OK: true, Mode: mode, Hosts: []HostLint{}}
+	for _, g := range s.cfg.NginxServers {
+		if group != "" && g.Group != group {
+			continue
+		}
+		for i := range g.Servers {
+			srvCfg := &g.Servers[i]
+			if host != "" && srvCfg.Host != host {
+				continue
+			}
+			prefix, err := s.treePrefix(mode, g.Group, srvCfg)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			hl := HostLint{Group: g.Group, Host: srvCfg.Host, Name: srvCfg.Name}
+			hl.Result, err = s.lintTree(c.Request.Context(), prefix, srvCfg)
+			if err != nil {
+				hl.Error = err.Error()
+			}
+			if hl.Error != "" || !hl.Result.OK {
+				res.OK = false
+			}
+			res.Hosts = append(res.Hosts, hl)
+		}
+	}
+	if len(res.Hosts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// handleSimulate routes a request through the config tree of a host, or through its remote and
+// preview trees to compare them.
+func (s *Server) handleSimulate(c *gin.Context) {
+	var req SimulateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	srvCfg := s.findServerConfig(req.Group, req.Server)
+	if srvCfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+	modes := []string{req.Mode}
+	if req.Compare {
+		modes = []string{"remote", "preview"}
+	} else if req.Mode == "" {
+		modes = []string{"prod"}
+	}
+
+	var res SimulateResponse
+	for _, mode := range modes {
+		prefix, err := s.treePrefix(mode, req.Group, srvCfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cfg, err := s.loadNginxConfig(c.Request.Context(), prefix, srvCfg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		r := req.Request
+		result, err := simulate.Route(cfg, &r)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res.Request = r
+		res.Results = append(res.Results, SimulateResult{Mode: mode, Result: result})
+	}
+
+	if req.Compare {
+		res.Differences = simulate.Diff(res.Results[0].Result, res.Results[1].Result)
+		same := len(res.Differences) == 0
+		res.Same = &same
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/configpolicy"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// LoadConfigPolicy reads and validates config_policy.file and makes it the policy enforced on
+// deploys. It is called at startup and on reload; on error the previously loaded policy stays
+// in effect, so a broken edit of the policy file does not block every deploy.
+func (s *Server) LoadConfigPolicy() error {
+	var policy *configpolicy.Policy
+	if s.cfg.ConfigPolicy.File != "" {
+		var err error
+		policy, err = configpolicy.Load(s.cfg.ConfigPolicy.File, s.cfg.ConfigPolicy.BlockOn)
+		if err != nil {
+			return fmt.Errorf("config policy %s: %w", s.cfg.ConfigPolicy.File, err)
+		}
+	}
+	s.configPolicyMu.Lock()
+	s.configPolicy = policy
+	s.configPolicyMu.Unlock()
+	return nil
+}
+
+// loadedConfigPolicy returns the policy loaded by LoadConfigPolicy, nil when no policy file is
+// configured.
+func (s *Server) loadedConfigPolicy() (*configpolicy.Policy, error) {
+	s.configPolicyMu.RLock()
+	defer s.configPolicyMu.RUnlock()
+	if s.configPolicy == nil && s.cfg.ConfigPolicy.File != "" {
+		return nil, fmt.Errorf("config policy %s is not loaded", s.cfg.ConfigPolicy.File)
+	}
+	return s.configPolicy, nil
+}
+
+// errIncompleteTree is returned by evaluateConfigPolicy for a tree whose root file is missing or
+// whose files do not all parse: rules only see the files that parsed, so such a tree is never
+// reported as compliant.
+var errIncompleteTree = errors.New("config tree is incomplete")
+
+// treeErrors returns the parse errors and the missing root file of cfg.
+func treeErrors(cfg *nginxconf.Config) []string {
+	var problems []string
+	for _, e := range cfg.Graph.Unresolved {
+		if e.From == "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", e.Pattern, e.Error))
+		}
+	}
+	for _, pe := range cfg.Graph.Errors {
+		problems = append(problems, pe.Error())
+	}
+	return problems
+}
+
+// evaluateConfigPolicy evaluates the config policy against the config tree of a host stored under
+// prefix. It returns nil when no policy file is configured, and an errIncompleteTree error when
+// the tree cannot be evaluated completely.
+func (s *Server) evaluateConfigPolicy(ctx context.Context, prefix string, srvCfg *config.ServerConfig) (*configpolicy.Result, error) {
+	policy, err := s.loadedConfigPolicy()
+	if policy == nil || err != nil {
+		return nil, err
+	}
+	cfg, err := s.loadNginxConfig(ctx, prefix, srvCfg)
+	if err != nil {
+		return nil, err
+	}
+	if problems := treeErrors(cfg); len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", errIncompleteTree, strings.Join(problems, "; "))
+	}
+	return policy.Evaluate(cfg), nil
+}
+
+// enforceConfigPolicy evaluates the config policy against the production tree of a host and
+// writes an error response if a violation blocks the operation. It returns false when the
+// request must be aborted.
+func (s *Server) enforceConfigPolicy(c *gin.Context, action, group string, srvCfg *config.ServerConfig) bool {
+	prefix, err := s.treePrefix("prod", group, srvCfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	res, err := s.evaluateConfigPolicy(c.Request.Context(), prefix, srvCfg)
+	if errors.Is(err, errIncompleteTree) {
+		log.Logger.WithFields(log.Fields{
+			"user":      currentUser(c),
+			"operation": action,
+			"group":     group,
+			"host":      srvCfg.Host,
+			"error":     err,
+		}).Warn("deploy blocked: config policy cannot be evaluated")
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("config policy blocks %s: %v", action, err)})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to evaluate config policy: %v", err)})
+		return false
+	}
+	if res == nil || res.OK {
+		return true
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"user":       currentUser(c),
+		"operation":  action,
+		"group":      group,
+		"host":       srvCfg.Host,
+		"violations": res.Blocking,
+	}).Warn("deploy blocked by config policy")
+	c.JSON(http.StatusConflict, gin.H{
+		"error":         fmt.Sprintf("%d config policy violation(s) block %s", res.Blocking, action),
+		"config_policy": res,
+	})
+	return false
+}
+
+// handleConfigPolicy evaluates the config policy against the trees of a host, of every host of
+// a group without host, or of every host without group.
+func (s *Server) handleConfigPolicy(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	mode := c.DefaultQuery("mode", "prod")
+
+	if host != "" && group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required with host"})
+		return
+	}
+	if s.cfg.ConfigPolicy.File == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no config policy configured (config_policy.file)"})
+		return
+	}
+	if _, err := s.loadedConfigPolicy(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := PolicyResponse{OK: true, Mode: mode, Hosts: []HostPolicy{}}
+	for _, g := range s.cfg.NginxServers {
+		if group != "" && g.Group != group {
+			continue
+		}
+		for i := range g.Servers {
+			srvCfg := &g.Servers[i]
+			if host != "" && srvCfg.Host != host {
+				continue
+			}
+			prefix, err := s.treePrefix(mode, g.Group, srvCfg)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			hp := HostPolicy{Group: g.Group, Host: srvCfg.Host, Name: srvCfg.Name}
+			hp.Result, err = s.evaluateConfigPolicy(c.Request.Context(), prefix, srvCfg)
+			if err != nil {
+				hp.Error = err.Error()
+			}
+			if hp.Error != "" || !hp.Result.OK {
+				res.OK = false
+			}
+			res.Hosts = append(res.Hosts, hp)
+		}
+	}
+	if len(res.Hosts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd/etcdtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policies.yaml")
+	cfg := &config.Config{ConfigPolicy: config.ConfigPolicyConfig{File: file}}
+	client, _ := etcdtest.NewClient()
+	s := NewServerWithoutUI(cfg, client)
+
+	// Nothing is enforced before the policy is loaded
+	_, err := s.loadedConfigPolicy()
+	assert.ErrorContains(t, err, "not loaded")
+
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n  - {id: a, match: {block: server}, assert: {has: {name: listen}}}\n"), 0o644))
+	require.NoError(t, s.LoadConfigPolicy())
+	policy, err := s.loadedConfigPolicy()
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 1)
+
+	// A broken edit keeps the previous policy in effect
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n  - {id: a, match: {block: server}}\n"), 0o644))
+	assert.ErrorContains(t, s.LoadConfigPolicy(), "exactly one of")
+	loaded, err := s.loadedConfigPolicy()
+	require.NoError(t, err)
+	assert.Same(t, policy, loaded)
+
+	// Without a policy file nothing is enforced
+	cfg.ConfigPolicy.File = ""
+	require.NoError(t, s.LoadConfigPolicy())
+	loaded, err = s.loadedConfigPolicy()
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+}
+
+func TestEnforceConfigPolicyIncompleteTree(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "policies.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n  - {id: no-autoindex, match: {block: \"*\"}, assert: {not: {has: {name: autoindex, args: [on]}}}}\n"), 0o644))
+	cfg := &config.Config{
+		ConfigPolicy: config.ConfigPolicyConfig{File: file},
+		Sync:         config.SyncConfig{GitSyncer: config.GitSyncer{KeyPrefix: "/gitops-nginx"}},
+		NginxServers: []config.NginxServerGroup{
+			{Group: "web", Servers: []config.ServerConfig{{Host: "10.0.0.1", NginxConfigDir: "/etc/nginx"}}},
+		},
+	}
+	client, _ := etcdtest.NewClient()
+	s := NewServerWithoutUI(cfg, client)
+	require.NoError(t, s.LoadConfigPolicy())
+	srvCfg := s.findServerConfig("web", "10.0.0.1")
+
+	enforce := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/update/apply", nil)
+		if s.enforceConfigPolicy(c, "update.apply", "web", srvCfg) {
+			return nil
+		}
+		return w
+	}
+	put := func(name, content string) {
+		_, err := client.Put(context.Background(), "/gitops-nginx/web/10.0.0.1/nginx/"+name, content)
+		require.NoError(t, err)
+	}
+
+	// Without nginx.conf there is nothing to evaluate the policy against
+	w := enforce()
+	require.NotNil(t, w)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "root file not found")
+
+	put("nginx.conf", "http { include conf.d/*.conf; }\n")
+	put("conf.d/ok.conf", "server { listen 80; }\n")
+	assert.Nil(t, enforce())
+
+	// A violation in a file that does not parse is not skipped
+	put("conf.d/broken.conf", "server { listen 80; autoindex on;\n")
+	w = enforce()
+	require.NotNil(t, w)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "conf.d/broken.conf")
+}
@@ -1,14 +1,18 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/logn-xu/gitops-nginx/internal/config"
 	"github.com/logn-xu/gitops-nginx/internal/diff"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -45,6 +49,9 @@ func (s *Server) handleGetTree(c *gin.Context) {
 	var previewResp *clientv3.GetResponse
 	var remoteResp *clientv3.GetResponse
 	var targetHashes map[string]string
+	var targetLayers map[string]string
+	var targetGenerated map[string]string
+	var targetErrors map[string]string
 	if mode == "preview" {
 		prefix = previewPrefix
 		previewResp, err = s.etcdClient.GetPrefix(c.Request.Context(), previewPrefix)
@@ -63,6 +70,8 @@ func (s *Server) handleGetTree(c *gin.Context) {
 		}
 
 		targetHashes = previewHashes
+		targetLayers, targetGenerated = collectFileLayers(previewResp, previewPrefix)
+		targetErrors = collectFileErrors(previewResp, previewPrefix)
 	} else {
 		prefix = gitPrefix
 		gitResp, err = s.etcdClient.GetPrefix(c.Request.Context(), gitPrefix)
@@ -81,6 +90,8 @@ func (s *Server) handleGetTree(c *gin.Context) {
 		}
 
 		targetHashes = gitHashes
+		targetLayers, targetGenerated = collectFileLayers(gitResp, gitPrefix)
+		targetErrors = collectFileErrors(gitResp, gitPrefix)
 	}
 
 	// Get data from all sources to determine status
@@ -135,11 +146,75 @@ func (s *Server) handleGetTree(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, TreeResponse{
-		Prefix:       prefix,
-		Paths:        paths,
-		FileStatuses: fileStatuses,
-	})
+	// Add files that failed to render and were never stored successfully
+	for relPath := range targetErrors {
+		if _, ok := seenPaths["/"+relPath]; ok {
+			continue
+		}
+		if _, ok := sourceHashes["/"+relPath]; ok {
+			continue
+		}
+		paths = append(paths, relPath)
+	}
+
+	res := TreeResponse{
+		Prefix:        prefix,
+		Paths:         paths,
+		FileStatuses:  fileStatuses,
+		FileLayers:    targetLayers,
+		FileGenerated: targetGenerated,
+		FileErrors:    targetErrors,
+	}
+
+	// Show the pin that freezes the production tree of this host
+	if pin, err := s.stateStore.ResolvePin(c.Request.Context(), group, host); err != nil {
+		log.Logger.WithError(err).Warn("failed to resolve pin")
+	} else if pin != nil {
+		pinStatus := toPinStatus(*pin, time.Now())
+		res.Pin = &pinStatus
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// collectFileErrors returns the render or read errors recorded in the .error keys.
+func collectFileErrors(resp *clientv3.GetResponse, prefix string) map[string]string {
+	fileErrors := make(map[string]string)
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		if !strings.HasSuffix(key, ".error") {
+			continue
+		}
+		relPath := strings.TrimPrefix(strings.TrimSuffix(key, ".error"), prefix)
+		fileErrors[strings.TrimPrefix(relPath, "/")] = string(kv.Value)
+	}
+	return fileErrors
+}
+
+// collectFileLayers returns the source layer (common or host) of each file recorded in the .meta keys,
+// and the vhost spec of each generated file.
+func collectFileLayers(resp *clientv3.GetResponse, prefix string) (map[string]string, map[string]string) {
+	layers := make(map[string]string)
+	generated := make(map[string]string)
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		if !strings.HasSuffix(key, ".meta") {
+			continue
+		}
+		var meta struct {
+			Layer     string `json:"layer"`
+			Generated string `json:"generated"`
+		}
+		if err := json.Unmarshal(kv.Value, &meta); err != nil || meta.Layer == "" {
+			continue
+		}
+		relPath := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(key, ".meta"), prefix), "/")
+		layers[relPath] = meta.Layer
+		if meta.Generated != "" {
+			generated[relPath] = meta.Generated
+		}
+	}
+	return layers, generated
 }
 
 func (s *Server) handleGetTripleDiff(c *gin.Context) {
@@ -218,26 +293,29 @@ func (s *Server) handleGetTripleDiff(c *gin.Context) {
 		diffText = diffResult.UnifiedDiff
 	}
 
-	c.JSON(http.StatusOK, TripleDiffResponse{
+	res := TripleDiffResponse{
 		Path:           relPath,
 		RemoteContent:  remoteContent,
 		CompareContent: compareContent,
 		Diff:           diffText,
 		Mode:           mode,
 		CompareLabel:   compareLabel,
-	})
+	}
+
+	// Structural diff of nginx config files, free of formatting and comment noise
+	if nginxconf.IsConfigFile(relPath) {
+		changes, err := nginxconf.DiffContent(relPath, []byte(remoteContent), []byte(compareContent))
+		if err != nil {
+			res.SemanticError = err.Error()
+		} else {
+			res.Semantic = changes
+		}
+	}
+
+	c.JSON(http.StatusOK, res)
 }
 
 // findServerConfig is a helper function to find a server configuration by group and host.
 func (s *Server) findServerConfig(group, host string) *config.ServerConfig {
-	for _, g := range s.cfg.NginxServers {
-		if g.Group == group {
-			for i := range g.Servers {
-				if g.Servers[i].Host == host {
-					return &g.Servers[i]
-				}
-			}
-		}
-	}
-	return nil
+	return s.cfg.FindServer(group, host)
 }
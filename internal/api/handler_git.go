@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -34,8 +35,8 @@ func (s *Server) handleGetGitStatus(c *gin.Context) {
 		return
 	}
 
-	// 2. Get Remote Commit (origin/branch)
-	remoteRefName := plumbing.NewRemoteReferenceName("origin", branchName)
+	// 2. Get Remote Commit (<remote>/branch)
+	remoteRefName := plumbing.NewRemoteReferenceName(gitrepo.RemoteName(&s.cfg.Git), branchName)
 	remoteRef, err := repo.Reference(remoteRefName, true)
 
 	var remoteCommit *object.Commit
@@ -95,6 +96,28 @@ func (s *Server) handleGetGitStatus(c *gin.Context) {
 		response.Error = "Remote reference not found. Please ensure the repository is synced."
 	}
 
+	// 5. Evaluate the release policy against the local branch
+	if s.cfg.Git.Release.Mode != gitrepo.ReleaseModeHead {
+		response.Release = &ReleaseStatus{Mode: s.cfg.Git.Release.Mode}
+		release, err := gitrepo.ResolveRelease(repo, &s.cfg.Git.Release, localCommit)
+		if err != nil {
+			response.Release.Error = err.Error()
+		} else {
+			response.Release.DeployableCommit = toCommitInfo(release.Deployable)
+			for _, pending := range release.Pending {
+				response.Release.PendingCommits = append(response.Release.PendingCommits, toCommitInfo(pending))
+			}
+		}
+	}
+
+	// 6. List pins holding hosts on a fixed commit
+	if pins, err := s.stateStore.ListPins(c.Request.Context(), ""); err == nil {
+		now := time.Now()
+		for _, pin := range pins {
+			response.Pins = append(response.Pins, toPinStatus(pin, now))
+		}
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
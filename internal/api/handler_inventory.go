@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/inventory"
+)
+
+// handleGetInventory returns the http servers and upstreams of the production and remote trees,
+// or the servers and backends matching a domain or backend lookup.
+func (s *Server) handleGetInventory(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	source := c.Query("source") // "prod", "remote" or empty for both
+	domain := c.Query("domain")
+	backend := c.Query("backend")
+
+	if host != "" && group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required with host"})
+		return
+	}
+	if domain != "" && backend != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "domain and backend are mutually exclusive"})
+		return
+	}
+	sources := []string{"prod", "remote"}
+	switch source {
+	case "":
+	case "prod", "remote":
+		sources = []string{source}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be 'prod' or 'remote'"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var hosts []inventory.Host
+	for _, g := range s.cfg.NginxServers {
+		if group != "" && g.Group != group {
+			continue
+		}
+		for i := range g.Servers {
+			srvCfg := &g.Servers[i]
+			if host != "" && srvCfg.Host != host {
+				continue
+			}
+			for _, src := range sources {
+				h := inventory.Host{Group: g.Group, Host: srvCfg.Host, Name: srvCfg.Name, Source: src}
+				prefix, err := s.treePrefix(src, g.Group, srvCfg)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				cfg, err := s.loadNginxConfig(ctx, prefix, srvCfg)
+				if err != nil {
+					h.Error = err.Error()
+				} else {
+					h.Servers, h.Upstreams = inventory.Build(cfg)
+					if n := len(cfg.Graph.Errors); n > 0 {
+						h.Error = fmt.Sprintf("%d file(s) could not be parsed, see /config-graph", n)
+					}
+				}
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	switch {
+	case domain != "":
+		c.JSON(http.StatusOK, InventoryResponse{Matches: inventory.FindDomain(hosts, domain)})
+	case backend != "":
+		c.JSON(http.StatusOK, InventoryResponse{Matches: inventory.FindBackend(hosts, backend)})
+	default:
+		c.JSON(http.StatusOK, InventoryResponse{Hosts: hosts})
+	}
+}
@@ -1,13 +1,23 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/deploypolicy"
+	"github.com/logn-xu/gitops-nginx/internal/health"
+	"github.com/logn-xu/gitops-nginx/internal/hooks"
 	"github.com/logn-xu/gitops-nginx/internal/ssh"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/internal/verify"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
 )
 
 func (s *Server) handleCheckConfig(c *gin.Context) {
@@ -39,7 +49,23 @@ func (s *Server) handleCheckConfig(c *gin.Context) {
 		etcdPrefix = path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, req.Group, req.Server, configDirSuffix)
 	}
 
-	// 2. Get pool and sync files to remote check directory
+	// 2. Collect files that failed to render, their content in etcd is stale
+	prefixResp, err := s.etcdClient.GetPrefix(c.Request.Context(), etcdPrefix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	fileErrors := collectFileErrors(prefixResp, etcdPrefix)
+
+	// 3. Lint the tree offline. nginx -t runs even if lint fails, lint rules are heuristics and
+	// only nginx itself can tell whether a finding is a real error
+	lintResult, err := s.lintTree(c.Request.Context(), etcdPrefix, srvCfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 4. Get pool and sync files to remote check directory
 	pool, err := s.getPool(srvCfg)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get SSH pool: %v", err)})
@@ -51,13 +77,15 @@ func (s *Server) handleCheckConfig(c *gin.Context) {
 		remoteCheckDir = path.Join(srvCfg.NginxConfigDir, "check")
 	}
 
-	scpResult, err := ssh.ScpEtcdToRemote(c.Request.Context(), s.etcdClient, pool, srvCfg, etcdPrefix, remoteCheckDir)
+	// The check directory is scratch space, it mirrors the prefix exactly so no stale file,
+	// hidden or not, takes part in the nginx -t
+	scpResult, err := ssh.ScpEtcdToRemote(c.Request.Context(), s.etcdClient, pool, srvCfg, etcdPrefix, remoteCheckDir, ssh.ScpOptions{Exact: true})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to sync files to check directory: %v", err)})
 		return
 	}
 
-	// 3. Run nginx test command using the check directory
+	// 5. Run nginx test command using the check directory
 	sshClient, err := pool.Get(srvCfg)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get SSH client: %v", err)})
@@ -65,22 +93,16 @@ func (s *Server) handleCheckConfig(c *gin.Context) {
 	}
 	defer pool.Put(sshClient)
 
-	nginxBinary := srvCfg.NginxBinaryPath
-	if nginxBinary == "" {
-		nginxBinary = "nginx"
-	}
-
-	// Construct nginx -t command with custom config file
-	// Assuming nginx.conf is at the root of the synced directory
-	mainConfigFile := path.Join(remoteCheckDir, "nginx.conf")
-	testCmd := fmt.Sprintf("%s -t -c %s", nginxBinary, mainConfigFile)
+	testCmd := nginxTestCommand(srvCfg, remoteCheckDir)
 
 	output, err := sshClient.RunCommand(testCmd)
 	success := err == nil
 
 	res := CheckResponse{
-		OK:   success,
-		Mode: mode,
+		OK:         success && lintResult.OK && len(fileErrors) == 0,
+		Mode:       mode,
+		FileErrors: fileErrors,
+		Lint:       lintResult,
 		Sync: &SyncResult{
 			Total:        scpResult.Total,
 			Skipped:      scpResult.Skipped,
@@ -121,6 +143,21 @@ func (s *Server) handleUpdatePrepare(c *gin.Context) {
 		return
 	}
 
+	// Prepare writes into the live config directory, so it is subject to the deploy policy
+	if !s.enforceDeployPolicy(c, "update.prepare", req.Group, req.Server, req.FreezeOverrideReason) {
+		return
+	}
+	if !s.enforceConfigPolicy(c, "update.prepare", req.Group, srvCfg) {
+		return
+	}
+	if _, ok := s.authorizeChange(c, req.Group, req.ChangeID, srvCfg, false); !ok {
+		return
+	}
+	uploadOpts, ok := s.uploadOptions(c, "update.prepare", req, srvCfg)
+	if !ok {
+		return
+	}
+
 	// 1. Determine etcd prefix
 	configDirSuffix := filepath.Base(srvCfg.NginxConfigDir)
 	etcdPrefix := path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, req.Group, req.Server, configDirSuffix)
@@ -137,7 +174,17 @@ func (s *Server) handleUpdatePrepare(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("NginxConfigDir not find: %v", err)})
 	}
 
-	scpResult, err := ssh.ScpEtcdToRemote(c.Request.Context(), s.etcdClient, pool, srvCfg, etcdPrefix, remoteConfigDir)
+	if err := s.snapshotRemote(c.Request.Context(), pool, req.Group, srvCfg, currentUser(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to snapshot live config: %v", err)})
+		return
+	}
+
+	scpResult, err := ssh.ScpEtcdToRemote(c.Request.Context(), s.etcdClient, pool, srvCfg, etcdPrefix, remoteConfigDir, uploadOpts)
+	var violation *deploypolicy.Violation
+	if errors.As(err, &violation) {
+		c.JSON(http.StatusConflict, gin.H{"error": violation.Message, "policy": violation})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to sync files to check directory: %v", err)})
 		return
@@ -151,15 +198,7 @@ func (s *Server) handleUpdatePrepare(c *gin.Context) {
 	}
 	defer pool.Put(sshClient)
 
-	nginxBinary := srvCfg.NginxBinaryPath
-	if nginxBinary == "" {
-		nginxBinary = "nginx"
-	}
-
-	// Construct nginx -t command with custom config file
-	// Assuming nginx.conf is at the root of the synced directory
-	mainConfigFile := path.Join(remoteConfigDir, "nginx.conf")
-	testCmd := fmt.Sprintf("%s -t -c %s", nginxBinary, mainConfigFile)
+	testCmd := nginxTestCommand(srvCfg, remoteConfigDir)
 
 	output, err := sshClient.RunCommand(testCmd)
 	success := err == nil
@@ -200,42 +239,132 @@ func (s *Server) handleUpdateApply(c *gin.Context) {
 		return
 	}
 
+	if !s.enforceDeployPolicy(c, "update.apply", req.Group, req.Server, req.FreezeOverrideReason) {
+		return
+	}
+	if !s.enforceConfigPolicy(c, "update.apply", req.Group, srvCfg) {
+		return
+	}
+	uploadOpts, ok := s.uploadOptions(c, "update.apply", req, srvCfg)
+	if !ok {
+		return
+	}
+	// The change request is consumed up front so a concurrent apply cannot use it too, and
+	// released again unless the apply gets past the health probes
+	change, ok := s.authorizeChange(c, req.Group, req.ChangeID, srvCfg, true)
+	if !ok {
+		return
+	}
+	applied := false
+	if change != nil {
+		defer func() {
+			if !applied {
+				s.releaseChange(context.WithoutCancel(c.Request.Context()), change.ID, srvCfg.Host)
+			}
+		}()
+	}
+
 	pool, err := s.getPool(srvCfg)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get SSH pool: %v", err)})
 		return
 	}
 
+	// Hooks and the reload share one connection
+	sshClient, err := pool.Get(srvCfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get SSH client: %v", err)})
+		return
+	}
+	defer pool.Put(sshClient)
+
+	ctx := c.Request.Context()
+	hookCfg := hooks.Merge(s.cfg.FindGroup(req.Group), srvCfg)
+	if err := hooks.Validate(hookCfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("invalid hooks config: %v", err)})
+		return
+	}
+	if err := health.Validate(srvCfg.Health); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("invalid health config: %v", err)})
+		return
+	}
+	hookEnv := s.hookEnv(ctx, req.Group, srvCfg, currentUser(c))
+	var hookResults []hooks.Result
+
+	deployment := state.Deployment{
+		Group:      req.Group,
+		Host:       srvCfg.Host,
+		Commit:     hookEnv["GITOPS_COMMIT"],
+		DeployedBy: currentUser(c),
+		StartedAt:  time.Now(),
+	}
+	record := func(res UpdateApplyResponse) {
+		deployment.FinishedAt = time.Now()
+		deployment.Success = res.Success
+		deployment.Message = res.Message
+		deployment.Error = res.Error
+		deployment.Verification = res.Verification
+		if err := s.stateStore.RecordDeployment(ctx, deployment); err != nil {
+			log.Logger.WithError(err).Warn("failed to record deployment")
+		}
+	}
+
+	// fail runs the on_failure hooks and responds with everything that ran
+	fail := func(status int, res UpdateApplyResponse) {
+		res.Hooks = append(hookResults, hooks.RunAll(ctx, hooks.PhaseOnFailure, hookCfg.OnFailure, sshClient, hookEnv)...)
+		record(res)
+		c.JSON(status, res)
+	}
+
+	// 1. Run pre-apply hooks, a failure aborts the apply
+	results, err := hooks.Run(ctx, hooks.PhasePreApply, hookCfg.PreApply, sshClient, hookEnv)
+	hookResults = append(hookResults, results...)
+	if err != nil {
+		fail(http.StatusInternalServerError, UpdateApplyResponse{Message: "Apply aborted", Error: err.Error()})
+		return
+	}
+
 	configDirSuffix := filepath.Base(srvCfg.NginxConfigDir)
 	gitPrefix := path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, req.Group, req.Server, configDirSuffix)
 
-	// 1. Upload files from etcd (production state)
-	scpResult, err := ssh.ScpEtcdToRemote(c.Request.Context(), s.etcdClient, pool, srvCfg, gitPrefix, srvCfg.NginxConfigDir)
+	// 2. Keep the live config for rollback, then upload files from etcd (production state)
+	if err := s.snapshotRemote(ctx, pool, req.Group, srvCfg, currentUser(c)); err != nil {
+		fail(http.StatusInternalServerError, UpdateApplyResponse{Message: "Apply aborted", Error: fmt.Sprintf("failed to snapshot live config: %v", err)})
+		return
+	}
+	scpResult, err := ssh.ScpEtcdToRemote(ctx, s.etcdClient, pool, srvCfg, gitPrefix, srvCfg.NginxConfigDir, uploadOpts)
+	var violation *deploypolicy.Violation
+	if errors.As(err, &violation) {
+		fail(http.StatusConflict, UpdateApplyResponse{Message: "Apply blocked by the delete guard, pass allow_mass_delete to override", Error: violation.Message})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to sync files to remote: %v", err)})
+		fail(http.StatusInternalServerError, UpdateApplyResponse{Message: "Apply failed", Error: fmt.Sprintf("failed to sync files to remote: %v", err)})
 		return
 	}
 
-	// 2. Reload Nginx
-	sshClient, err := pool.Get(srvCfg)
+	// 3. Re-hash the remote tree, partial writes or concurrent edits must not be reloaded
+	report, err := verify.Remote(ctx, s.etcdClient, sshClient, gitPrefix, srvCfg.NginxConfigDir, s.scpOptions(srvCfg))
+	if err == nil {
+		err = report.Err()
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get SSH client: %v", err)})
+		fail(http.StatusInternalServerError, UpdateApplyResponse{
+			Message:      "Remote config does not match production, Nginx not reloaded",
+			Error:        fmt.Sprintf("verification failed: %v", err),
+			Verification: report,
+		})
 		return
 	}
-	defer pool.Put(sshClient)
 
-	// reloadCmd := srvCfg.ReloadCmd
-	var reloadCmd string
-	if srvCfg.NginxBinaryPath == "" {
-		reloadCmd = "nginx -s reload"
-	} else {
-		reloadCmd = fmt.Sprint(srvCfg.NginxBinaryPath, " -s", " reload")
-	}
+	// 4. Reload Nginx
+	reloadCmd := nginxReloadCommand(srvCfg)
 	output, err := sshClient.RunCommand(reloadCmd)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, UpdateApplyResponse{
-			Success: false,
-			Message: "Failed to reload Nginx",
+		fail(http.StatusInternalServerError, UpdateApplyResponse{
+			Success:      false,
+			Message:      "Failed to reload Nginx",
+			Verification: report,
 			Nginx: &NginxExecOutput{
 				Command: reloadCmd,
 				OK:      false,
@@ -245,14 +374,84 @@ func (s *Server) handleUpdateApply(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, UpdateApplyResponse{
+	res := UpdateApplyResponse{
 		Success: true,
 		Message: fmt.Sprintf("Config applied (total: %d, updated: %d, skipped: %d) and Nginx reloaded",
 			scpResult.Total, scpResult.Updated, scpResult.Skipped),
+		Verification: report,
 		Nginx: &NginxExecOutput{
 			Command: reloadCmd,
 			OK:      true,
 			Output:  output,
 		},
-	})
+	}
+
+	// 5. Probe the reloaded server, a reload alone does not prove traffic is served
+	if len(srvCfg.Health.Probes) > 0 {
+		res.Health, err = health.Check(ctx, srvCfg.Health, sshClient)
+		if err != nil {
+			res.Success = false
+			res.Message = "Config applied and Nginx reloaded, but health probes failed"
+			res.Error = err.Error()
+			if srvCfg.Health.RollbackOnFailure {
+				res.Rollback = s.autoRollback(ctx, pool, req.Group, srvCfg, currentUser(c), err)
+				if res.Rollback.Success {
+					res.Message = "Health probes failed, live config rolled back"
+				}
+			}
+			fail(http.StatusInternalServerError, res)
+			return
+		}
+	}
+
+	applied = true
+
+	// 6. Run post-apply hooks
+	results, err = hooks.Run(ctx, hooks.PhasePostApply, hookCfg.PostApply, sshClient, hookEnv)
+	hookResults = append(hookResults, results...)
+	if err != nil {
+		res.Success = false
+		res.Message += ", but a post_apply hook failed"
+		res.Error = err.Error()
+		fail(http.StatusInternalServerError, res)
+		return
+	}
+
+	res.Hooks = hookResults
+	record(res)
+	c.JSON(http.StatusOK, res)
+}
+
+// hookEnv returns the environment exported to the hooks of a server.
+func (s *Server) hookEnv(ctx context.Context, group string, srvCfg *config.ServerConfig, user string) map[string]string {
+	env := map[string]string{
+		"GITOPS_GROUP":       group,
+		"GITOPS_HOST":        srvCfg.Host,
+		"GITOPS_SERVER_NAME": srvCfg.Name,
+		"GITOPS_CONFIG_DIR":  srvCfg.NginxConfigDir,
+		"GITOPS_USER":        user,
+	}
+	if synced, err := s.stateStore.GetSyncedCommit(ctx, group, srvCfg.Host); err == nil && synced != nil {
+		env["GITOPS_COMMIT"] = synced.Commit
+	}
+	return env
+}
+
+// nginxTestCommand returns the nginx -t command for the config tree in configDir.
+// Assuming nginx.conf is at the root of the synced directory
+func nginxTestCommand(srvCfg *config.ServerConfig, configDir string) string {
+	nginxBinary := srvCfg.NginxBinaryPath
+	if nginxBinary == "" {
+		nginxBinary = "nginx"
+	}
+	return fmt.Sprintf("%s -t -c %s", nginxBinary, path.Join(configDir, "nginx.conf"))
+}
+
+// nginxReloadCommand returns the command that reloads nginx.
+func nginxReloadCommand(srvCfg *config.ServerConfig) string {
+	// reloadCmd := srvCfg.ReloadCmd
+	if srvCfg.NginxBinaryPath == "" {
+		return "nginx -s reload"
+	}
+	return fmt.Sprint(srvCfg.NginxBinaryPath, " -s", " reload")
 }
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5/plumbing"
+	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+func (s *Server) handleListPins(c *gin.Context) {
+	pins, err := s.stateStore.ListPins(c.Request.Context(), c.Query("group"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	res := PinsResponse{Pins: []PinStatus{}}
+	for _, pin := range pins {
+		res.Pins = append(res.Pins, toPinStatus(pin, now))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) handleSetPin(c *gin.Context) {
+	var req PinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Commit == "" || req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "commit and reason are required"})
+		return
+	}
+	if !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can pin commits"})
+		return
+	}
+	if req.Server == "" && s.cfg.FindGroup(req.Group) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+	if req.Server != "" && s.findServerConfig(req.Group, req.Server) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := req.ExpiresAt
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ttl %q", req.TTL)})
+			return
+		}
+		expiresAt = now.Add(ttl)
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiry must be in the future"})
+		return
+	}
+
+	// Resolve the commit so the syncer never has to deal with short hashes or moving tags
+	repo, err := gitrepo.OpenRepository(&s.cfg.Git)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to open repo: %v", err)})
+		return
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(req.Commit))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to resolve commit %s: %v", req.Commit, err)})
+		return
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to get commit %s: %v", req.Commit, err)})
+		return
+	}
+	// A pinned commit reaches production like a release, so it has to satisfy the release policy
+	releasable, err := gitrepo.IsReleasable(repo, &s.cfg.Git.Release, commit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to evaluate release policy: %v", err)})
+		return
+	}
+	if !releasable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("commit %s does not satisfy the release policy (mode %s)", hash, s.cfg.Git.Release.Mode)})
+		return
+	}
+
+	pin := state.Pin{
+		Group:     req.Group,
+		Host:      req.Server,
+		Commit:    hash.String(),
+		Reason:    req.Reason,
+		CreatedBy: currentUser(c),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.stateStore.PutPin(c.Request.Context(), pin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	event := state.AuditEvent{
+		Actor:   pin.CreatedBy,
+		Action:  "pin_set",
+		Group:   pin.Group,
+		Host:    pin.Host,
+		Reason:  pin.Reason,
+		Details: map[string]string{"commit": pin.Commit},
+	}
+	if !pin.ExpiresAt.IsZero() {
+		event.Details["expires_at"] = pin.ExpiresAt.Format(time.RFC3339)
+	}
+	if err := s.stateStore.RecordAudit(c.Request.Context(), event); err != nil {
+		log.Logger.WithError(err).Warn("failed to record pin in audit trail")
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"user":       pin.CreatedBy,
+		"group":      pin.Group,
+		"host":       pin.Host,
+		"commit":     pin.Commit,
+		"reason":     pin.Reason,
+		"expires_at": pin.ExpiresAt,
+	}).Info("pin set")
+
+	c.JSON(http.StatusOK, toPinStatus(pin, now))
+}
+
+func (s *Server) handleDeletePin(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	if group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required"})
+		return
+	}
+	if !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can clear pins"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	// Record the commit the host was pinned to, so the audit trail shows what was released
+	var commit string
+	if pins, err := s.stateStore.ListPins(ctx, group); err == nil {
+		for _, pin := range pins {
+			if pin.Group == group && pin.Host == host {
+				commit = pin.Commit
+			}
+		}
+	}
+
+	if err := s.stateStore.DeletePin(ctx, group, host); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := currentUser(c)
+	if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+		Actor:   user,
+		Action:  "pin_clear",
+		Group:   group,
+		Host:    host,
+		Reason:  c.Query("reason"),
+		Details: map[string]string{"commit": commit},
+	}); err != nil {
+		log.Logger.WithError(err).Warn("failed to record pin removal in audit trail")
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"user":   user,
+		"group":  group,
+		"host":   host,
+		"commit": commit,
+	}).Info("pin cleared")
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func toPinStatus(pin state.Pin, now time.Time) PinStatus {
+	return PinStatus{
+		Pin:    pin,
+		Active: pin.Active(now),
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/plan"
+)
+
+func (s *Server) handleGetPlan(c *gin.Context) {
+	group := c.Query("group")
+	host := c.Query("host")
+	withDiff := c.DefaultQuery("diff", "true") != "false"
+
+	targets := s.planTargets(group, host)
+	if len(targets) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	hosts := make([]plan.HostPlan, 0, len(targets))
+	for _, t := range targets {
+		hp := s.planHost(c, t.group, t.server)
+		if !withDiff {
+			for i := range hp.Changes {
+				hp.Changes[i].Diff = ""
+			}
+		}
+		hosts = append(hosts, hp)
+	}
+
+	c.JSON(http.StatusOK, plan.Summarize(hosts))
+}
+
+type planTarget struct {
+	group  string
+	server *config.ServerConfig
+}
+
+// planTargets returns the servers matching the optional group and host filters.
+func (s *Server) planTargets(group, host string) []planTarget {
+	var targets []planTarget
+	for gi := range s.cfg.NginxServers {
+		g := &s.cfg.NginxServers[gi]
+		if group != "" && g.Group != group {
+			continue
+		}
+		for si := range g.Servers {
+			if host != "" && g.Servers[si].Host != host {
+				continue
+			}
+			targets = append(targets, planTarget{group: g.Group, server: &g.Servers[si]})
+		}
+	}
+	return targets
+}
+
+func (s *Server) planHost(c *gin.Context, group string, srvCfg *config.ServerConfig) plan.HostPlan {
+	pool, err := s.getPool(srvCfg)
+	if err != nil {
+		return plan.HostPlan{Group: group, Host: srvCfg.Host, Name: srvCfg.Name, Error: fmt.Sprintf("failed to get SSH pool: %v", err)}
+	}
+	client, err := pool.Get(srvCfg)
+	if err != nil {
+		return plan.HostPlan{Group: group, Host: srvCfg.Host, Name: srvCfg.Name, Error: fmt.Sprintf("failed to get SSH client: %v", err)}
+	}
+	defer pool.Put(client)
+
+	return plan.ForHost(c.Request.Context(), s.etcdClient, client, s.cfg.Sync.GitSyncer.KeyPrefix, group, srvCfg, s.scpOptions(srvCfg))
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5/plumbing"
+	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+const (
+	promoteModeFastForward = "fast-forward"
+	promoteModeTag         = "tag"
+)
+
+func (s *Server) handlePromote(c *gin.Context) {
+	var req PromoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can promote commits"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = promoteModeFastForward
+	}
+	if req.Mode != promoteModeFastForward && req.Mode != promoteModeTag {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be 'fast-forward' or 'tag'"})
+		return
+	}
+
+	sourceGroup := s.cfg.FindGroup(req.SourceGroup)
+	targetGroup := s.cfg.FindGroup(req.TargetGroup)
+	if sourceGroup == nil || targetGroup == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "source or target group not found"})
+		return
+	}
+	if sourceGroup.Group == targetGroup.Group {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and target group must differ"})
+		return
+	}
+
+	// 1. Find the commit currently synced into the production prefix of every source host
+	synced, err := s.stateStore.ListSyncedCommits(c.Request.Context(), sourceGroup.Group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var commitHash string
+	for _, rec := range synced {
+		if s.findServerConfig(sourceGroup.Group, rec.Host) == nil {
+			continue
+		}
+		if commitHash != "" && commitHash != rec.Commit {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("hosts of group %s are on different commits (%s, %s)", sourceGroup.Group, commitHash, rec.Commit)})
+			return
+		}
+		commitHash = rec.Commit
+	}
+	if commitHash == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("no synced commit recorded for group %s", sourceGroup.Group)})
+		return
+	}
+
+	repo, err := gitrepo.OpenRepository(&s.cfg.Git)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to open repo: %v", err)})
+		return
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(commitHash))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get commit %s: %v", commitHash, err)})
+		return
+	}
+
+	// 2. Move the target ref
+	var targetRef string
+	switch req.Mode {
+	case promoteModeFastForward:
+		if targetGroup.Ref != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("group %s tracks the fixed ref %s, use mode 'tag' or change its ref", targetGroup.Group, targetGroup.Ref)})
+			return
+		}
+		targetRef = gitrepo.GroupRef(&s.cfg.Git, targetGroup)
+		if err := gitrepo.FastForwardBranch(&s.cfg.Git, repo, targetRef, commit.Hash); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, gitrepo.ErrNotFastForward) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	case promoteModeTag:
+		targetRef = req.Tag
+		if targetRef == "" {
+			targetRef = fmt.Sprintf("promote/%s/%s", targetGroup.Group, time.Now().UTC().Format("20060102-150405"))
+		}
+		if err := gitrepo.PushTag(&s.cfg.Git, repo, targetRef, commit.Hash); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, gitrepo.ErrTagExists) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user := currentUser(c)
+	if err := s.stateStore.RecordAudit(c.Request.Context(), state.AuditEvent{
+		Actor:  user,
+		Action: "promote",
+		Group:  targetGroup.Group,
+		Details: map[string]string{
+			"source_group": sourceGroup.Group,
+			"mode":         req.Mode,
+			"target_ref":   targetRef,
+			"commit":       commit.Hash.String(),
+		},
+	}); err != nil {
+		log.Logger.WithError(err).Warn("failed to record promotion in audit trail")
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"user":         user,
+		"source_group": sourceGroup.Group,
+		"target_group": targetGroup.Group,
+		"mode":         req.Mode,
+		"target_ref":   targetRef,
+		"commit":       commit.Hash.String(),
+	}).Info("promoted commit")
+
+	c.JSON(http.StatusOK, PromoteResponse{
+		Success:   true,
+		Mode:      req.Mode,
+		TargetRef: targetRef,
+		Commit:    toCommitInfo(commit),
+		Message:   fmt.Sprintf("Promoted %s from %s to %s (%s)", commit.Hash.String()[:8], sourceGroup.Group, targetGroup.Group, targetRef),
+	})
+}
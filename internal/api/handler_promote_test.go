@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd/etcdtest"
+	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPromoteTestServer returns a server whose git repository is cloned from a local bare remote,
+// with a "staging" group on master and a "prod" group on the "prod" branch, and a function that
+// commits a file in a second clone, pushes it to branch and returns the commit.
+func newPromoteTestServer(t *testing.T) (*Server, string, func(branch, parent, content string) plumbing.Hash) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	base := t.TempDir()
+
+	bareDir := filepath.Join(base, "remote.git")
+	_, err := git.PlainInit(bareDir, true)
+	require.NoError(t, err)
+	dev, err := git.PlainInit(filepath.Join(base, "dev"), false)
+	require.NoError(t, err)
+	_, err = dev.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{bareDir}})
+	require.NoError(t, err)
+	w, err := dev.Worktree()
+	require.NoError(t, err)
+
+	commit := func(branch, parent, content string) plumbing.Hash {
+		t.Helper()
+		if parent != "" {
+			require.NoError(t, w.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(parent), Force: true}))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(w.Filesystem.Root(), "nginx.conf"), []byte(content), 0o644))
+		_, err := w.Add("nginx.conf")
+		require.NoError(t, err)
+		hash, err := w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+		refSpec := gitconfig.RefSpec(hash.String() + ":" + plumbing.NewBranchReferenceName(branch).String())
+		require.NoError(t, dev.Push(&git.PushOptions{RefSpecs: []gitconfig.RefSpec{refSpec}}))
+		return hash
+	}
+	commit("master", "", "worker_processes 1;\n")
+
+	cfg := &config.Config{
+		Git:  config.GitConfig{RepoURL: bareDir, RepoPath: filepath.Join(base, "work"), Branch: "master"},
+		Sync: config.SyncConfig{State: config.StateConfig{KeyPrefix: "/gitops-nginx-state"}},
+		NginxServers: []config.NginxServerGroup{
+			{Group: "staging", Servers: []config.ServerConfig{{Host: "10.0.0.1", NginxConfigDir: "/etc/nginx"}}},
+			{Group: "prod", Branch: "prod", Servers: []config.ServerConfig{{Host: "10.0.1.1", NginxConfigDir: "/etc/nginx"}}},
+		},
+	}
+	_, err = gitrepo.SyncRepository(&cfg.Git)
+	require.NoError(t, err)
+
+	client, _ := etcdtest.NewClient()
+	return NewServerWithoutUI(cfg, client), bareDir, commit
+}
+
+// syncStaging records hash as synced into staging and fetches it into the server repository.
+func syncStaging(t *testing.T, s *Server, hash plumbing.Hash) {
+	t.Helper()
+	_, err := gitrepo.SyncRepository(&s.cfg.Git)
+	require.NoError(t, err)
+	require.NoError(t, s.stateStore.PutSyncedCommit(context.Background(), state.SyncedCommit{
+		Group: "staging", Host: "10.0.0.1", Ref: "master", Commit: hash.String(), SyncedAt: time.Now(),
+	}))
+}
+
+func promote(t *testing.T, s *Server, req PromoteRequest) (int, PromoteResponse) {
+	t.Helper()
+	w := serve(t, s, http.MethodPost, "/api/v1/promote", "", req)
+	var resp PromoteResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w.Code, resp
+}
+
+func bareRef(t *testing.T, bareDir string, name plumbing.ReferenceName) plumbing.Hash {
+	t.Helper()
+	bare, err := git.PlainOpen(bareDir)
+	require.NoError(t, err)
+	ref, err := bare.Reference(name, true)
+	require.NoError(t, err)
+	return ref.Hash()
+}
+
+func TestPromoteFastForward(t *testing.T) {
+	s, bareDir, commit := newPromoteTestServer(t)
+	prod := plumbing.NewBranchReferenceName("prod")
+
+	c1 := commit("master", "", "worker_processes 2;\n")
+	syncStaging(t, s, c1)
+	code, resp := promote(t, s, PromoteRequest{SourceGroup: "staging", TargetGroup: "prod"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "prod", resp.TargetRef)
+	assert.Equal(t, c1, bareRef(t, bareDir, prod))
+
+	c2 := commit("master", "", "worker_processes 4;\n")
+	syncStaging(t, s, c2)
+	code, _ = promote(t, s, PromoteRequest{SourceGroup: "staging", TargetGroup: "prod"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, c2, bareRef(t, bareDir, prod))
+}
+
+func TestPromoteRejectsNonFastForward(t *testing.T) {
+	s, bareDir, commit := newPromoteTestServer(t)
+	prod := plumbing.NewBranchReferenceName("prod")
+
+	base := commit("master", "", "worker_processes 2;\n")
+	hotfix := commit("prod", base.String(), "worker_processes 3;\n")
+	staged := commit("master", base.String(), "worker_processes 4;\n")
+	syncStaging(t, s, staged)
+
+	code, _ := promote(t, s, PromoteRequest{SourceGroup: "staging", TargetGroup: "prod"})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, hotfix, bareRef(t, bareDir, prod))
+}
+
+func TestPromoteTagExists(t *testing.T) {
+	s, bareDir, commit := newPromoteTestServer(t)
+	tag := plumbing.NewTagReferenceName("release-1")
+
+	c1 := commit("master", "", "worker_processes 2;\n")
+	syncStaging(t, s, c1)
+	code, resp := promote(t, s, PromoteRequest{SourceGroup: "staging", TargetGroup: "prod", Mode: promoteModeTag, Tag: "release-1"})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "release-1", resp.TargetRef)
+	assert.Equal(t, c1, bareRef(t, bareDir, tag))
+
+	c2 := commit("master", "", "worker_processes 4;\n")
+	syncStaging(t, s, c2)
+	code, _ = promote(t, s, PromoteRequest{SourceGroup: "staging", TargetGroup: "prod", Mode: promoteModeTag, Tag: "release-1"})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, c1, bareRef(t, bareDir, tag))
+}
+
+func TestPromoteRequiresAdminAndIsAudited(t *testing.T) {
+	s, bareDir, commit := newPromoteTestServer(t)
+	s.cfg.API.Tokens = []config.APITokenConfig{
+		{Token: "admin-token", User: "carol", Role: RoleAdmin},
+		{Token: "operator-token", User: "dave", Role: RoleOperator},
+	}
+	c1 := commit("master", "", "worker_processes 2;\n")
+	syncStaging(t, s, c1)
+	req := PromoteRequest{SourceGroup: "staging", TargetGroup: "prod"}
+
+	w := serve(t, s, http.MethodPost, "/api/v1/promote", "operator-token", req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(t, s, http.MethodPost, "/api/v1/promote", "admin-token", req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, c1, bareRef(t, bareDir, plumbing.NewBranchReferenceName("prod")))
+
+	events, err := s.stateStore.ListAudit(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "carol", events[0].Actor)
+	assert.Equal(t, "promote", events[0].Action)
+	assert.Equal(t, "prod", events[0].Group)
+	assert.Equal(t, map[string]string{
+		"source_group": "staging",
+		"mode":         promoteModeFastForward,
+		"target_ref":   "prod",
+		"commit":       c1.String(),
+	}, events[0].Details)
+}
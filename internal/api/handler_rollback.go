@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// snapshotRemote stores the live config tree of a host in etcd before an operation overwrites it,
+// so that it can be restored with POST /rollback. Nothing is stored when the live tree already
+// matches the production prefix, which keeps the snapshot taken by prepare when apply follows.
+func (s *Server) snapshotRemote(ctx context.Context, pool *ssh.SFTPPool, group string, srvCfg *config.ServerConfig, user string) error {
+	prefix := path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, group, srvCfg.Host, filepath.Base(srvCfg.NginxConfigDir))
+	desired, err := s.etcdClient.GetFiles(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to get files from etcd: %w", err)
+	}
+
+	client, err := pool.Get(srvCfg)
+	if err != nil {
+		return fmt.Errorf("failed to get SSH client: %w", err)
+	}
+	defer pool.Put(client)
+
+	remote, err := ssh.ListRemoteFiles(client, srvCfg.NginxConfigDir)
+	if err != nil {
+		return fmt.Errorf("failed to list remote files: %w", err)
+	}
+
+	// Protected files that git does not manage are left alone by uploads, they are no change
+	opts := s.scpOptions(srvCfg)
+	changed := false
+	for relPath := range remote {
+		if _, ok := desired[relPath]; !ok && !opts.Protected(relPath) {
+			changed = true
+			break
+		}
+	}
+	for relPath, content := range desired {
+		if changed {
+			break
+		}
+		sum := md5.Sum(content)
+		changed = remote[relPath] != hex.EncodeToString(sum[:])
+	}
+	if !changed {
+		return nil
+	}
+
+	files := make(map[string][]byte, len(remote))
+	for relPath := range remote {
+		content, err := client.ReadFile(path.Join(srvCfg.NginxConfigDir, relPath))
+		if err != nil {
+			return err
+		}
+		files[relPath] = content
+	}
+
+	snap := state.Snapshot{
+		Group:   group,
+		Host:    srvCfg.Host,
+		TakenBy: user,
+		TakenAt: time.Now(),
+	}
+	if synced, err := s.stateStore.GetSyncedCommit(ctx, group, srvCfg.Host); err == nil && synced != nil {
+		snap.Commit = synced.Commit
+	}
+	if err := s.stateStore.PutSnapshot(ctx, snap, files); err != nil {
+		return err
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"group": group,
+		"host":  srvCfg.Host,
+		"files": len(files),
+	}).Info("snapshot of live config taken")
+	return nil
+}
+
+func (s *Server) handleRollback(c *gin.Context) {
+	var req RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	srvCfg := s.findServerConfig(req.Group, req.Server)
+	if srvCfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	if !s.enforceDeployPolicy(c, "rollback", req.Group, req.Server, req.FreezeOverrideReason) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	snap, files, err := s.stateStore.GetSnapshot(ctx, req.Group, req.Server)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if snap == nil || len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no snapshot to roll back to"})
+		return
+	}
+
+	pool, err := s.getPool(srvCfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get SSH pool: %v", err)})
+		return
+	}
+
+	res, err := s.restoreSnapshot(ctx, pool, srvCfg, snap, files)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, res)
+		return
+	}
+
+	user := currentUser(c)
+	if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+		Actor:  user,
+		Action: "rollback",
+		Group:  req.Group,
+		Host:   req.Server,
+		Details: map[string]string{
+			"snapshot_taken_at": snap.TakenAt.Format(time.RFC3339),
+			"snapshot_commit":   snap.Commit,
+		},
+	}); err != nil {
+		log.Logger.WithError(err).Warn("failed to record rollback in audit trail")
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"user":  user,
+		"group": req.Group,
+		"host":  req.Server,
+	}).Warn("rolled back live config to snapshot")
+
+	// The production prefix still holds the newer commit, the next apply would deploy it again
+	res.Message += "; pin the host to keep it"
+	c.JSON(http.StatusOK, res)
+}
+
+// restoreSnapshot uploads a snapshot into the live config directory, tests it and reloads nginx.
+// The returned response describes how far it got, also on error.
+func (s *Server) restoreSnapshot(ctx context.Context, pool *ssh.SFTPPool, srvCfg *config.ServerConfig, snap *state.Snapshot, files map[string][]byte) (RollbackResponse, error) {
+	res := RollbackResponse{Snapshot: snap}
+
+	// 1. Restore the snapshot into the live config directory
+	scpResult, err := ssh.ScpFilesToRemote(ctx, pool, srvCfg, files, srvCfg.NginxConfigDir, s.scpOptions(srvCfg))
+	if err != nil {
+		res.Error = fmt.Sprintf("failed to restore snapshot: %v", err)
+		return res, err
+	}
+	res.Sync = toSyncResult(scpResult)
+
+	sshClient, err := pool.Get(srvCfg)
+	if err != nil {
+		res.Error = fmt.Sprintf("failed to get SSH client: %v", err)
+		return res, err
+	}
+	defer pool.Put(sshClient)
+
+	// 2. Test and reload nginx
+	testCmd := nginxTestCommand(srvCfg, srvCfg.NginxConfigDir)
+	output, err := sshClient.RunCommand(testCmd)
+	res.Nginx = &NginxExecOutput{Command: testCmd, OK: err == nil, Output: output}
+	if err != nil {
+		res.Message = "Restored snapshot does not pass nginx -t, Nginx not reloaded"
+		return res, err
+	}
+
+	reloadCmd := nginxReloadCommand(srvCfg)
+	output, err = sshClient.RunCommand(reloadCmd)
+	res.Nginx = &NginxExecOutput{Command: reloadCmd, OK: err == nil, Output: output}
+	if err != nil {
+		res.Message = "Failed to reload Nginx"
+		return res, err
+	}
+
+	res.Success = true
+	res.Message = fmt.Sprintf("Restored snapshot from %s (updated: %d, added: %d, deleted: %d) and Nginx reloaded",
+		snap.TakenAt.Format(time.RFC3339), scpResult.Updated, scpResult.Added, scpResult.Deleted)
+	return res, nil
+}
+
+// autoRollback restores the latest snapshot of a server after its health probes failed.
+func (s *Server) autoRollback(ctx context.Context, pool *ssh.SFTPPool, group string, srvCfg *config.ServerConfig, user string, cause error) *RollbackResponse {
+	snap, files, err := s.stateStore.GetSnapshot(ctx, group, srvCfg.Host)
+	if err != nil {
+		return &RollbackResponse{Error: err.Error()}
+	}
+	if snap == nil || len(files) == 0 {
+		return &RollbackResponse{Error: "no snapshot to roll back to"}
+	}
+
+	res, err := s.restoreSnapshot(ctx, pool, srvCfg, snap, files)
+	entry := log.Logger.WithFields(log.Fields{
+		"group": group,
+		"host":  srvCfg.Host,
+		"cause": cause.Error(),
+	})
+	if err != nil {
+		entry.WithError(err).Error("automatic rollback after failed health probes failed")
+		return &res
+	}
+	entry.Warn("rolled back live config after failed health probes")
+
+	if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+		Actor:  user,
+		Action: "auto_rollback",
+		Group:  group,
+		Host:   srvCfg.Host,
+		Reason: cause.Error(),
+		Details: map[string]string{
+			"snapshot_taken_at": snap.TakenAt.Format(time.RFC3339),
+			"snapshot_commit":   snap.Commit,
+		},
+	}); err != nil {
+		log.Logger.WithError(err).Warn("failed to record rollback in audit trail")
+	}
+	return &res
+}
+
+func toSyncResult(r ssh.ScpResult) *SyncResult {
+	return &SyncResult{
+		Total:          r.Total,
+		Skipped:        r.Skipped,
+		Added:          r.Added,
+		Updated:        r.Updated,
+		Deleted:        r.Deleted,
+		Preserved:      r.Preserved,
+		AddedFiles:     r.AddedFiles,
+		UpdatedFiles:   r.UpdatedFiles,
+		DeletedFiles:   r.DeletedFiles,
+		PreservedFiles: r.PreservedFiles,
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+)
+
+// handleGetStatus reports, per host, what the production prefix holds. It only reads etcd.
+func (s *Server) handleGetStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	targets := s.planTargets(c.Query("group"), c.Query("host"))
+	if len(targets) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching servers"})
+		return
+	}
+
+	now := time.Now()
+	res := StatusResponse{Hosts: make([]HostStatus, 0, len(targets))}
+	for _, t := range targets {
+		hs := HostStatus{
+			Group: t.group,
+			Host:  t.server.Host,
+			Name:  t.server.Name,
+		}
+
+		synced, err := s.stateStore.GetSyncedCommit(ctx, t.group, t.server.Host)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		hs.Synced = synced
+
+		if pin, err := s.stateStore.ResolvePin(ctx, t.group, t.server.Host); err == nil && pin != nil {
+			pinStatus := toPinStatus(*pin, now)
+			hs.Pin = &pinStatus
+		}
+		if snap, err := s.stateStore.GetSnapshotInfo(ctx, t.group, t.server.Host); err == nil {
+			hs.Snapshot = snap
+		}
+		if deployments, err := s.stateStore.ListDeployments(ctx, t.group, t.server.Host, 1); err == nil && len(deployments) > 0 {
+			hs.LastDeploy = &deployments[0]
+		}
+
+		prefix := path.Join(s.cfg.Sync.GitSyncer.KeyPrefix, t.group, t.server.Host, filepath.Base(t.server.NginxConfigDir))
+		if resp, err := s.etcdClient.GetPrefix(ctx, prefix); err == nil {
+			hs.FileErrors = len(collectFileErrors(resp, prefix))
+		}
+
+		res.Hosts = append(res.Hosts, hs)
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) handleListDeployments(c *gin.Context) {
+	group := c.Query("group")
+	if group == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group is required"})
+		return
+	}
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+		limit = n
+	}
+
+	deployments, err := s.stateStore.ListDeployments(c.Request.Context(), group, c.Query("host"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if deployments == nil {
+		deployments = []state.Deployment{}
+	}
+	c.JSON(http.StatusOK, DeploymentsResponse{Deployments: deployments})
+}
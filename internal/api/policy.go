@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/deploypolicy"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// enforceDeployPolicy rejects a deploy operation inside a freeze window or outside the allowed
+// deploy hours, unless an admin supplies a freeze override reason. Overrides are recorded in the
+// audit trail. It writes the error response and returns false when the operation must not proceed.
+func (s *Server) enforceDeployPolicy(c *gin.Context, action, group, host, overrideReason string) bool {
+	policy, err := deploypolicy.New(s.cfg.DeployPolicy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("invalid deploy policy: %v", err)})
+		return false
+	}
+
+	violation := policy.Check(group, time.Now())
+	if violation == nil {
+		return true
+	}
+
+	if overrideReason == "" {
+		c.JSON(http.StatusLocked, gin.H{"error": violation.Message, "policy": violation})
+		return false
+	}
+	if !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can override the deploy policy", "policy": violation})
+		return false
+	}
+
+	event := state.AuditEvent{
+		Actor:  currentUser(c),
+		Action: "policy_override",
+		Group:  group,
+		Host:   host,
+		Reason: overrideReason,
+		Details: map[string]string{
+			"operation": action,
+			"violation": violation.Kind,
+			"window":    violation.Name,
+			"message":   violation.Message,
+		},
+	}
+	if err := s.stateStore.RecordAudit(c.Request.Context(), event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to record override in audit trail: %v", err)})
+		return false
+	}
+
+	log.Logger.WithFields(log.Fields{
+		"user":      event.Actor,
+		"operation": action,
+		"group":     group,
+		"host":      host,
+		"violation": violation.Message,
+		"reason":    overrideReason,
+	}).Warn("deploy policy overridden")
+
+	return true
+}
+
+func (s *Server) handleListAudit(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+		limit = n
+	}
+
+	events, err := s.stateStore.ListAudit(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if events == nil {
+		events = []state.AuditEvent{}
+	}
+	c.JSON(http.StatusOK, AuditResponse{Events: events})
+}
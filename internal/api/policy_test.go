@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/deploypolicy"
+	"github.com/logn-xu/gitops-nginx/internal/etcd/etcdtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverridesAreSeparate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		API: config.APIConfig{Tokens: []config.APITokenConfig{{Token: "admin-token", User: "carol", Role: RoleAdmin}}},
+		Sync: config.SyncConfig{
+			GitSyncer:   config.GitSyncer{KeyPrefix: "/gitops-nginx"},
+			State:       config.StateConfig{KeyPrefix: "/gitops-nginx-state"},
+			DeleteGuard: config.DeleteGuardConfig{MaxFiles: 2},
+		},
+		DeployPolicy: config.DeployPolicyConfig{Freezes: []config.FreezeConfig{
+			{Name: "always", Start: "2000-01-01", End: "2999-12-31"},
+		}},
+		NginxServers: []config.NginxServerGroup{
+			{Group: "web", Servers: []config.ServerConfig{{Host: "10.0.0.1", NginxConfigDir: "/etc/nginx"}}},
+		},
+	}
+	client, _ := etcdtest.NewClient()
+	s := NewServerWithoutUI(cfg, client)
+	ctx := context.Background()
+
+	// A mass delete reason does not lift the freeze
+	w := serve(t, s, http.MethodPost, "/api/v1/update/apply", "admin-token", UpdateRequest{
+		Group: "web", Server: "10.0.0.1", AllowMassDelete: true, MassDeleteReason: "host directory moved",
+	})
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	// A freeze override reason does not allow a mass delete
+	w = serve(t, s, http.MethodPost, "/api/v1/update/apply", "admin-token", UpdateRequest{
+		Group: "web", Server: "10.0.0.1", FreezeOverrideReason: "hotfix", AllowMassDelete: true,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "mass_delete_reason")
+
+	events, err := s.stateStore.ListAudit(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "policy_override", events[0].Action)
+	assert.Equal(t, "hotfix", events[0].Reason)
+
+	// Without allow_mass_delete the guard blocks even with a freeze override reason, with it the
+	// override is audited with its own reason
+	uploadOpts := func(req UpdateRequest) func([]string, int) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/update/apply", nil)
+		c.Set(roleKey, RoleAdmin)
+		opts, ok := s.uploadOptions(c, "update.apply", req, s.findServerConfig("web", "10.0.0.1"))
+		require.True(t, ok)
+		return opts.DeleteGuard
+	}
+	deleting := []string{"a.conf", "b.conf", "c.conf"}
+	var violation *deploypolicy.Violation
+	err = uploadOpts(UpdateRequest{Group: "web", FreezeOverrideReason: "hotfix"})(deleting, 10)
+	assert.ErrorAs(t, err, &violation)
+
+	err = uploadOpts(UpdateRequest{Group: "web", FreezeOverrideReason: "hotfix", AllowMassDelete: true, MassDeleteReason: "host directory moved"})(deleting, 10)
+	require.NoError(t, err)
+	events, err = s.stateStore.ListAudit(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "mass_delete_override", events[0].Action)
+	assert.Equal(t, "host directory moved", events[0].Reason)
+}
@@ -11,8 +11,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/configpolicy"
 	"github.com/logn-xu/gitops-nginx/internal/etcd"
 	"github.com/logn-xu/gitops-nginx/internal/ssh"
+	"github.com/logn-xu/gitops-nginx/internal/state"
 	"github.com/logn-xu/gitops-nginx/pkg/log"
 )
 
@@ -22,6 +24,11 @@ type Server struct {
 	router     *gin.Engine
 	sshPools   map[string]*ssh.SFTPPool
 	poolsMu    sync.Mutex
+	stateStore *state.Store
+
+	// configPolicy is the policy loaded from config_policy.file by LoadConfigPolicy
+	configPolicy   *configpolicy.Policy
+	configPolicyMu sync.RWMutex
 }
 
 func NewServer(cfg *config.Config, etcdClient *etcd.Client, dist embed.FS) *Server {
@@ -30,6 +37,7 @@ func NewServer(cfg *config.Config, etcdClient *etcd.Client, dist embed.FS) *Serv
 		etcdClient: etcdClient,
 		router:     gin.New(),
 		sshPools:   make(map[string]*ssh.SFTPPool),
+		stateStore: state.NewStore(etcdClient, cfg.Sync.State.KeyPrefix),
 	}
 	s.setupRoutes()
 	s.setupStaticRoutes(dist)
@@ -43,6 +51,7 @@ func NewServerWithoutUI(cfg *config.Config, etcdClient *etcd.Client) *Server {
 		etcdClient: etcdClient,
 		router:     gin.New(),
 		sshPools:   make(map[string]*ssh.SFTPPool),
+		stateStore: state.NewStore(etcdClient, cfg.Sync.State.KeyPrefix),
 	}
 	s.setupRoutes()
 	return s
@@ -65,6 +74,11 @@ func (s *Server) getPool(srvCfg *config.ServerConfig) (*ssh.SFTPPool, error) {
 	return pool, nil
 }
 
+// scpOptions returns the upload options for the live config directory of a server.
+func (s *Server) scpOptions(srvCfg *config.ServerConfig) ssh.ScpOptions {
+	return ssh.NewScpOptions(srvCfg, s.cfg.Sync.NginxSyncer.IgnorePatterns)
+}
+
 func (s *Server) setupRoutes() {
 	// Custom logger middleware
 	s.router.Use(log.GinMiddleware())
@@ -108,14 +122,38 @@ func (s *Server) setupRoutes() {
 	})
 
 	v1 := s.router.Group("/api/v1")
+	v1.Use(s.authMiddleware())
 	{
 		v1.GET("/groups", s.handleGetGroups)
 		v1.GET("/tree", s.handleGetTree)
 		v1.GET("/triple-diff", s.handleGetTripleDiff)
+		v1.GET("/config-graph", s.handleGetConfigGraph)
+		v1.GET("/lint", s.handleLint)
+		v1.GET("/policy", s.handleConfigPolicy)
+		v1.GET("/inventory", s.handleGetInventory)
+		v1.GET("/certs", s.handleGetCerts)
+		v1.GET("/compare", s.handleCompareHosts)
+		v1.GET("/consistency", s.handleGroupConsistency)
+		v1.POST("/simulate", s.handleSimulate)
 		v1.POST("/check", s.handleCheckConfig)
 		v1.POST("/update/prepare", s.handleUpdatePrepare)
 		v1.POST("/update/apply", s.handleUpdateApply)
 		v1.GET("/git/status", s.handleGetGitStatus)
+		v1.GET("/plan", s.handleGetPlan)
+		v1.GET("/status", s.handleGetStatus)
+		v1.GET("/deployments", s.handleListDeployments)
+		v1.POST("/rollback", s.handleRollback)
+		v1.POST("/bootstrap", s.handleBootstrap)
+		v1.POST("/promote", s.handlePromote)
+		v1.GET("/pins", s.handleListPins)
+		v1.PUT("/pins", s.handleSetPin)
+		v1.DELETE("/pins", s.handleDeletePin)
+		v1.GET("/audit", s.handleListAudit)
+		v1.GET("/alerts", s.handleListAlerts)
+		v1.POST("/sync/allow-mass-delete", s.handleAllowMassDelete)
+		v1.GET("/changes", s.handleListChanges)
+		v1.POST("/changes", s.handleCreateChange)
+		v1.POST("/changes/:id/approve", s.handleApproveChange)
 	}
 
 }
@@ -169,6 +207,11 @@ func mustSub(fsys fs.FS, dir string) fs.FS {
 	return sub
 }
 
+// Handler returns the HTTP handler of the API, e.g. to serve it in-process.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:    s.cfg.API.Listen,
@@ -183,6 +226,9 @@ func (s *Server) Start(ctx context.Context) error {
 		srv.Shutdown(shutdownCtx)
 	}()
 
+	if len(s.cfg.API.Tokens) == 0 {
+		log.Logger.Warn("api.tokens is empty: authentication is disabled and every caller is an anonymous admin")
+	}
 	log.Logger.Infof("API server starting on %s", srv.Addr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return err
@@ -1,6 +1,21 @@
 package api
 
-import "time"
+import (
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/bootstrap"
+	"github.com/logn-xu/gitops-nginx/internal/certs"
+	"github.com/logn-xu/gitops-nginx/internal/compare"
+	"github.com/logn-xu/gitops-nginx/internal/configpolicy"
+	"github.com/logn-xu/gitops-nginx/internal/health"
+	"github.com/logn-xu/gitops-nginx/internal/hooks"
+	"github.com/logn-xu/gitops-nginx/internal/inventory"
+	"github.com/logn-xu/gitops-nginx/internal/lint"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/logn-xu/gitops-nginx/internal/simulate"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/internal/verify"
+)
 
 // GroupSummary matches the frontend expectations
 type GroupSummary struct {
@@ -23,6 +38,11 @@ type TreeResponse struct {
 	Paths        []string          `json:"paths"`
 	DiffPaths    []string          `json:"diff_paths,omitempty"`
 	FileStatuses map[string]string `json:"file_statuses,omitempty"`
+	FileLayers   map[string]string `json:"file_layers,omitempty"`
+	// FileGenerated maps files generated from a *.vhost.yaml spec to the spec path.
+	FileGenerated map[string]string `json:"file_generated,omitempty"`
+	FileErrors    map[string]string `json:"file_errors,omitempty"`
+	Pin           *PinStatus        `json:"pin,omitempty"`
 }
 
 type TripleDiffResponse struct {
@@ -33,6 +53,9 @@ type TripleDiffResponse struct {
 	Mode           string `json:"mode"`
 	CompareLabel   string `json:"compare_label"`
 	FileStatus     string `json:"file_status,omitempty"`
+	// Semantic lists the structural changes of an nginx config file from remote to compare content.
+	Semantic      []nginxconf.Change `json:"semantic,omitempty"`
+	SemanticError string             `json:"semantic_error,omitempty"`
 }
 
 type CheckRequest struct {
@@ -41,21 +64,33 @@ type CheckRequest struct {
 }
 
 type CheckResponse struct {
-	OK    bool             `json:"ok"`
-	Mode  string           `json:"mode"`
-	Sync  *SyncResult      `json:"sync,omitempty"`
-	Nginx *NginxExecOutput `json:"nginx,omitempty"`
+	OK         bool              `json:"ok"`
+	Mode       string            `json:"mode"`
+	Sync       *SyncResult       `json:"sync,omitempty"`
+	Nginx      *NginxExecOutput  `json:"nginx,omitempty"`
+	FileErrors map[string]string `json:"file_errors,omitempty"`
+	Lint       *lint.Result      `json:"lint,omitempty"`
 }
 
 type UpdateRequest struct {
 	Server string `json:"server"`
 	Group  string `json:"group"`
+	// FreezeOverrideReason lets an admin deploy inside a freeze window or outside the allowed hours.
+	FreezeOverrideReason string `json:"freeze_override_reason,omitempty"`
+	// ChangeID is the approved change request, required for groups with require_approval.
+	ChangeID string `json:"change_id,omitempty"`
+	// AllowMassDelete lets an admin delete more remote files than sync.delete_guard allows,
+	// MassDeleteReason is required with it and recorded in the audit trail.
+	AllowMassDelete  bool   `json:"allow_mass_delete,omitempty"`
+	MassDeleteReason string `json:"mass_delete_reason,omitempty"`
 }
 
 type UpdatePrepareResponse struct {
 	Success bool             `json:"success"`
 	Nginx   *NginxExecOutput `json:"nginx,omitempty"`
 	Sync    *SyncResult      `json:"sync,omitempty"`
+	// ConfigPolicy holds the policy findings when violations blocked the prepare.
+	ConfigPolicy *configpolicy.Result `json:"config_policy,omitempty"`
 	// Message string           `json:"message"`
 	// Changes []string         `json:"changes,omitempty"`
 }
@@ -63,18 +98,29 @@ type UpdatePrepareResponse struct {
 type UpdateApplyResponse struct {
 	Success bool             `json:"success"`
 	Message string           `json:"message"`
+	Error   string           `json:"error,omitempty"`
 	Nginx   *NginxExecOutput `json:"nginx,omitempty"`
+	Hooks   []hooks.Result   `json:"hooks,omitempty"`
+	Health  []health.Result  `json:"health,omitempty"`
+	// Verification compares the uploaded remote tree with the production prefix.
+	Verification *verify.Report `json:"verification,omitempty"`
+	// Rollback is set when failed health probes restored the pre-deploy snapshot.
+	Rollback *RollbackResponse `json:"rollback,omitempty"`
+	// ConfigPolicy holds the policy findings when violations blocked the apply.
+	ConfigPolicy *configpolicy.Result `json:"config_policy,omitempty"`
 }
 
 type SyncResult struct {
-	Total        int      `json:"total"`
-	Skipped      int      `json:"skipped"`
-	Added        int      `json:"added"`
-	Updated      int      `json:"updated"`
-	Deleted      int      `json:"deleted"`
-	AddedFiles   []string `json:"added_files,omitempty"`
-	UpdatedFiles []string `json:"updated_files,omitempty"`
-	DeletedFiles []string `json:"deleted_files,omitempty"`
+	Total          int      `json:"total"`
+	Skipped        int      `json:"skipped"`
+	Added          int      `json:"added"`
+	Updated        int      `json:"updated"`
+	Deleted        int      `json:"deleted"`
+	Preserved      int      `json:"preserved,omitempty"`
+	AddedFiles     []string `json:"added_files,omitempty"`
+	UpdatedFiles   []string `json:"updated_files,omitempty"`
+	DeletedFiles   []string `json:"deleted_files,omitempty"`
+	PreservedFiles []string `json:"preserved_files,omitempty"`
 }
 
 type NginxExecOutput struct {
@@ -84,13 +130,23 @@ type NginxExecOutput struct {
 }
 
 type GitStatusResponse struct {
-	Branch       string      `json:"branch"`
-	SyncMode     string      `json:"sync_mode"`
-	LocalCommit  *CommitInfo `json:"local_commit,omitempty"`
-	RemoteCommit *CommitInfo `json:"remote_commit,omitempty"`
-	Status       string      `json:"status"` // "synced", "ahead", "behind", "diverged", "error"
-	Diff         string      `json:"diff,omitempty"`
-	Error        string      `json:"error,omitempty"`
+	Branch       string         `json:"branch"`
+	SyncMode     string         `json:"sync_mode"`
+	LocalCommit  *CommitInfo    `json:"local_commit,omitempty"`
+	RemoteCommit *CommitInfo    `json:"remote_commit,omitempty"`
+	Status       string         `json:"status"` // "synced", "ahead", "behind", "diverged", "error"
+	Diff         string         `json:"diff,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Release      *ReleaseStatus `json:"release,omitempty"`
+	Pins         []PinStatus    `json:"pins,omitempty"`
+}
+
+// ReleaseStatus reports which commit the release policy allows to deploy and which are pending
+type ReleaseStatus struct {
+	Mode             string        `json:"mode"`
+	DeployableCommit *CommitInfo   `json:"deployable_commit,omitempty"`
+	PendingCommits   []*CommitInfo `json:"pending_commits,omitempty"`
+	Error            string        `json:"error,omitempty"`
 }
 
 type CommitInfo struct {
@@ -99,3 +155,192 @@ type CommitInfo struct {
 	Author    string    `json:"author"`
 	Timestamp time.Time `json:"timestamp"`
 }
+
+type BootstrapRequest struct {
+	Server  string `json:"server"`
+	Group   string `json:"group"`
+	Force   bool   `json:"force"`
+	Push    *bool  `json:"push,omitempty"` // defaults to true
+	Message string `json:"message,omitempty"`
+}
+
+type BootstrapResponse struct {
+	Success bool              `json:"success"`
+	Error   string            `json:"error,omitempty"`
+	Result  *bootstrap.Result `json:"result,omitempty"`
+}
+
+type PromoteRequest struct {
+	SourceGroup string `json:"source_group"`
+	TargetGroup string `json:"target_group"`
+	Mode        string `json:"mode"` // "fast-forward" (default) or "tag"
+	Tag         string `json:"tag,omitempty"`
+}
+
+type PromoteResponse struct {
+	Success   bool        `json:"success"`
+	Mode      string      `json:"mode"`
+	TargetRef string      `json:"target_ref"`
+	Commit    *CommitInfo `json:"commit,omitempty"`
+	Message   string      `json:"message"`
+}
+
+type PinRequest struct {
+	Group     string    `json:"group"`
+	Server    string    `json:"server,omitempty"` // empty pins the whole group
+	Commit    string    `json:"commit"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	TTL       string    `json:"ttl,omitempty"` // e.g. "4h", takes precedence over expires_at
+}
+
+type PinStatus struct {
+	state.Pin
+	Active bool `json:"active"`
+}
+
+type PinsResponse struct {
+	Pins []PinStatus `json:"pins"`
+}
+
+type AuditResponse struct {
+	Events []state.AuditEvent `json:"events"`
+}
+
+type ChangeCreateRequest struct {
+	Group       string `json:"group"`
+	Server      string `json:"server,omitempty"` // empty targets every server of the group
+	Commit      string `json:"commit,omitempty"` // defaults to the synced commit
+	Description string `json:"description,omitempty"`
+}
+
+type ChangesResponse struct {
+	Changes []state.ChangeRequest `json:"changes"`
+}
+
+type RollbackRequest struct {
+	Server               string `json:"server"`
+	Group                string `json:"group"`
+	FreezeOverrideReason string `json:"freeze_override_reason,omitempty"`
+}
+
+type RollbackResponse struct {
+	Success  bool             `json:"success"`
+	Message  string           `json:"message"`
+	Error    string           `json:"error,omitempty"`
+	Snapshot *state.Snapshot  `json:"snapshot,omitempty"`
+	Sync     *SyncResult      `json:"sync,omitempty"`
+	Nginx    *NginxExecOutput `json:"nginx,omitempty"`
+}
+
+type HostStatus struct {
+	Group      string              `json:"group"`
+	Host       string              `json:"host"`
+	Name       string              `json:"name"`
+	Synced     *state.SyncedCommit `json:"synced,omitempty"`
+	Pin        *PinStatus          `json:"pin,omitempty"`
+	FileErrors int                 `json:"file_errors"`
+	Snapshot   *state.Snapshot     `json:"snapshot,omitempty"`
+	LastDeploy *state.Deployment   `json:"last_deploy,omitempty"`
+}
+
+type StatusResponse struct {
+	Hosts []HostStatus `json:"hosts"`
+}
+
+type DeploymentsResponse struct {
+	Deployments []state.Deployment `json:"deployments"`
+}
+
+type AlertsResponse struct {
+	Alerts []state.Alert `json:"alerts"`
+}
+
+type MassDeleteAllowRequest struct {
+	Group  string `json:"group"`
+	Server string `json:"server"`
+	Reason string `json:"reason"`
+}
+
+type ConfigGraphResponse struct {
+	Group  string           `json:"group"`
+	Host   string           `json:"host"`
+	Mode   string           `json:"mode"`
+	Prefix string           `json:"prefix"`
+	Graph  *nginxconf.Graph `json:"graph"`
+}
+
+type LintResponse struct {
+	OK    bool       `json:"ok"`
+	Mode  string     `json:"mode"`
+	Hosts []HostLint `json:"hosts"`
+}
+
+type HostLint struct {
+	Group  string       `json:"group"`
+	Host   string       `json:"host"`
+	Name   string       `json:"name"`
+	Result *lint.Result `json:"result,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+type PolicyResponse struct {
+	OK    bool         `json:"ok"`
+	Mode  string       `json:"mode"`
+	Hosts []HostPolicy `json:"hosts"`
+}
+
+type HostPolicy struct {
+	Group  string               `json:"group"`
+	Host   string               `json:"host"`
+	Name   string               `json:"name"`
+	Result *configpolicy.Result `json:"result,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+type InventoryResponse struct {
+	Hosts   []inventory.Host  `json:"hosts,omitempty"`
+	Matches []inventory.Match `json:"matches"`
+}
+
+type CertsResponse struct {
+	WarnDays int               `json:"warn_days"`
+	Hosts    []certs.HostCerts `json:"hosts"`
+}
+
+type CompareResponse struct {
+	Group  string `json:"group"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+	Source string `json:"source"`
+	compare.Result
+}
+
+type ConsistencyResponse struct {
+	Group  string             `json:"group"`
+	Source string             `json:"source"`
+	Hosts  []compare.HostTree `json:"hosts"`
+	compare.Report
+}
+
+type SimulateRequest struct {
+	Group  string `json:"group"`
+	Server string `json:"server"`
+	// Mode is the tree to route through: "prod" (default), "preview" or "remote".
+	Mode string `json:"mode,omitempty"`
+	// Compare routes through the remote and the preview tree and reports the differences.
+	Compare bool             `json:"compare,omitempty"`
+	Request simulate.Request `json:"request"`
+}
+
+type SimulateResult struct {
+	Mode   string           `json:"mode"`
+	Result *simulate.Result `json:"result"`
+}
+
+type SimulateResponse struct {
+	Request     simulate.Request `json:"request"` // normalized
+	Results     []SimulateResult `json:"results"`
+	Same        *bool            `json:"same,omitempty"` // with compare
+	Differences []string         `json:"differences,omitempty"`
+}
@@ -0,0 +1,209 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/ignore"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// Options controls how a server is onboarded into the git repository.
+type Options struct {
+	Group string
+	Host  string
+	// Force replaces an existing host directory in the repository.
+	Force bool
+	// Push pushes the bootstrap commit to the remote after committing. Without it the commit
+	// stays local and the next pull of a moved branch fails, so the API and CLI push by default.
+	Push bool
+	// Message overrides the default commit message.
+	Message string
+}
+
+// Result holds the summary of a bootstrap run.
+type Result struct {
+	Group      string   `json:"group"`
+	Host       string   `json:"host"`
+	RepoDir    string   `json:"repo_dir"`
+	Files      []string `json:"files"`
+	Ignored    []string `json:"ignored,omitempty"`
+	Commit     string   `json:"commit"`
+	Pushed     bool     `json:"pushed"`
+	Verified   bool     `json:"verified"`
+	Mismatched []string `json:"mismatched,omitempty"`
+}
+
+// ErrAlreadyBootstrapped is returned when the host directory already exists in the repository.
+var ErrAlreadyBootstrapped = errors.New("host directory already exists in repository")
+
+// remoteTree is the part of the SSH client bootstrap reads the nginx configuration with.
+type remoteTree interface {
+	// ListFiles returns the md5 hash of every file under dir keyed by path relative to dir.
+	ListFiles(dir string) (map[string]string, error)
+	ReadFile(path string) ([]byte, error)
+}
+
+type sshTree struct {
+	*ssh.Client
+}
+
+func (t sshTree) ListFiles(dir string) (map[string]string, error) {
+	return ssh.ListRemoteFiles(t.Client, dir)
+}
+
+// Run pulls the nginx configuration tree of a server over SFTP, writes it into the git
+// repository using the <group>/<host>/<config_dir_suffix> layout and commits it.
+// After committing, the remote hashes are compared against the committed content.
+func Run(ctx context.Context, cfg *config.Config, opts Options) (*Result, error) {
+	srvCfg := cfg.FindServer(opts.Group, opts.Host)
+	if srvCfg == nil {
+		return nil, fmt.Errorf("server %s not found in group %s", opts.Host, opts.Group)
+	}
+	if srvCfg.NginxConfigDir == "" {
+		return nil, fmt.Errorf("nginx_config_dir is not configured for %s", opts.Host)
+	}
+
+	sshClient, err := ssh.NewClient(srvCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server %s: %w", srvCfg.Host, err)
+	}
+	defer sshClient.Close()
+
+	return run(ctx, cfg, srvCfg, opts, sshTree{sshClient})
+}
+
+func run(ctx context.Context, cfg *config.Config, srvCfg *config.ServerConfig, opts Options, remote remoteTree) (*Result, error) {
+	l := log.Logger.WithFields(log.Fields{"bootstrap": srvCfg.Host, "group": opts.Group})
+
+	repo, err := gitrepo.SyncRepository(&cfg.Git)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync git repo: %w", err)
+	}
+
+	configDirSuffix := filepath.Base(srvCfg.NginxConfigDir)
+	repoRelDir := path.Join(opts.Group, srvCfg.Host, configDirSuffix)
+
+	// Fail early, CommitDir checks again while holding the repository lock
+	targetDir := filepath.Join(cfg.Git.RepoPath, filepath.FromSlash(repoRelDir))
+	if entries, err := os.ReadDir(targetDir); err == nil && len(entries) > 0 && !opts.Force {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyBootstrapped, repoRelDir)
+	}
+
+	remoteFiles, err := remote.ListFiles(srvCfg.NginxConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote files: %w", err)
+	}
+	if len(remoteFiles) == 0 {
+		return nil, fmt.Errorf("no files found under %s on %s", srvCfg.NginxConfigDir, srvCfg.Host)
+	}
+
+	result := &Result{
+		Group:   opts.Group,
+		Host:    srvCfg.Host,
+		RepoDir: repoRelDir,
+	}
+
+	relPaths := make([]string, 0, len(remoteFiles))
+	for relPath := range remoteFiles {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	// Read the whole tree before touching the repository, so a failed read leaves it as it was
+	files := make(map[string][]byte, len(relPaths))
+	for _, relPath := range relPaths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Preserved files are not managed by git, e.g. package-owned mime.types or certbot certs
+		if ignore.IsIgnored(relPath, cfg.Sync.NginxSyncer.IgnorePatterns) || ignore.Match(relPath, srvCfg.PreservePatterns) {
+			result.Ignored = append(result.Ignored, relPath)
+			continue
+		}
+
+		content, err := remote.ReadFile(path.Join(srvCfg.NginxConfigDir, relPath))
+		if err != nil {
+			return nil, err
+		}
+		files[relPath] = content
+		result.Files = append(result.Files, relPath)
+	}
+
+	if len(result.Files) == 0 {
+		return nil, fmt.Errorf("all remote files under %s are ignored", srvCfg.NginxConfigDir)
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = fmt.Sprintf("bootstrap %s/%s from %s:%s", opts.Group, srvCfg.Host, srvCfg.Host, srvCfg.NginxConfigDir)
+	}
+
+	hash, err := gitrepo.CommitDir(&cfg.Git, repo, repoRelDir, files, opts.Force, message, opts.Push)
+	if err != nil {
+		if errors.Is(err, gitrepo.ErrDirExists) {
+			return nil, fmt.Errorf("%w: %s", ErrAlreadyBootstrapped, repoRelDir)
+		}
+		return result, err
+	}
+	result.Commit = hash.String()
+	result.Pushed = opts.Push
+
+	l.WithFields(log.Fields{
+		"commit": result.Commit,
+		"files":  len(result.Files),
+	}).Info("bootstrapped server configuration into git")
+
+	// Verify the committed tree against the live remote
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return result, fmt.Errorf("failed to get commit object %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return result, fmt.Errorf("failed to get tree from commit %s: %w", hash, err)
+	}
+
+	remoteFiles, err = remote.ListFiles(srvCfg.NginxConfigDir)
+	if err != nil {
+		return result, fmt.Errorf("failed to list remote files for verification: %w", err)
+	}
+
+	for _, relPath := range result.Files {
+		file, err := tree.File(path.Join(repoRelDir, relPath))
+		if err != nil {
+			result.Mismatched = append(result.Mismatched, relPath)
+			continue
+		}
+		reader, err := file.Reader()
+		if err != nil {
+			result.Mismatched = append(result.Mismatched, relPath)
+			continue
+		}
+		h := md5.New()
+		_, err = io.Copy(h, reader)
+		reader.Close()
+		if err != nil || hex.EncodeToString(h.Sum(nil)) != strings.TrimSpace(remoteFiles[relPath]) {
+			result.Mismatched = append(result.Mismatched, relPath)
+		}
+	}
+
+	if len(result.Mismatched) > 0 {
+		return result, fmt.Errorf("verification failed: %d file(s) differ between git and remote", len(result.Mismatched))
+	}
+	result.Verified = true
+
+	return result, nil
+}
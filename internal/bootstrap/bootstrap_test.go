@@ -0,0 +1,207 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRemote is a server config tree served from memory.
+type fakeRemote struct {
+	dir     string
+	files   map[string]string
+	failure string // relPath whose read fails
+}
+
+func (f *fakeRemote) ListFiles(dir string) (map[string]string, error) {
+	hashes := make(map[string]string, len(f.files))
+	for relPath, content := range f.files {
+		sum := md5.Sum([]byte(content))
+		hashes[relPath] = hex.EncodeToString(sum[:])
+	}
+	return hashes, nil
+}
+
+func (f *fakeRemote) ReadFile(p string) ([]byte, error) {
+	relPath := strings.TrimPrefix(p, f.dir+"/")
+	if relPath == f.failure {
+		return nil, fmt.Errorf("permission denied: %s", p)
+	}
+	content, ok := f.files[relPath]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content), nil
+}
+
+// newTestConfig creates a bare remote with an initial commit on master and a config that
+// clones it into a fresh worktree.
+func newTestConfig(t *testing.T) (*config.Config, *config.ServerConfig, string) {
+	t.Helper()
+	base := t.TempDir()
+
+	seedDir := filepath.Join(base, "seed")
+	seed, err := git.PlainInit(seedDir, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "README.md"), []byte("nginx configs\n"), 0o644))
+	w, err := seed.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add("README.md")
+	require.NoError(t, err)
+	_, err = w.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	bareDir := filepath.Join(base, "remote.git")
+	_, err = git.PlainClone(bareDir, true, &git.CloneOptions{URL: seedDir})
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			RepoURL:  bareDir,
+			RepoPath: filepath.Join(base, "work"),
+			Branch:   "master",
+		},
+		NginxServers: []config.NginxServerGroup{{
+			Group: "web",
+			Servers: []config.ServerConfig{{
+				Host:             "10.0.0.1",
+				NginxConfigDir:   "/etc/nginx",
+				PreservePatterns: []string{"mime.types"},
+			}},
+		}},
+	}
+	return cfg, &cfg.NginxServers[0].Servers[0], bareDir
+}
+
+func treeFiles(t *testing.T, repoDir, ref string, dir string) map[string]string {
+	t.Helper()
+	repo, err := git.PlainOpen(repoDir)
+	require.NoError(t, err)
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	require.NoError(t, err)
+	commit, err := repo.CommitObject(*hash)
+	require.NoError(t, err)
+	tree, err := commit.Tree()
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	require.NoError(t, tree.Files().ForEach(func(f *object.File) error {
+		if relPath, ok := strings.CutPrefix(f.Name, dir+"/"); ok {
+			content, err := f.Contents()
+			files[relPath] = content
+			return err
+		}
+		return nil
+	}))
+	return files
+}
+
+func TestRun(t *testing.T) {
+	cfg, srvCfg, bareDir := newTestConfig(t)
+	remote := &fakeRemote{dir: "/etc/nginx", files: map[string]string{
+		"nginx.conf":      "worker_processes 4;\n",
+		"conf.d/www.conf": "server { listen 80; }\n",
+		"mime.types":      "types {}\n",
+		".hidden":         "x\n",
+	}}
+
+	result, err := run(context.Background(), cfg, srvCfg, Options{Group: "web", Host: "10.0.0.1", Push: true}, remote)
+	require.NoError(t, err)
+	assert.Equal(t, "web/10.0.0.1/nginx", result.RepoDir)
+	assert.Equal(t, []string{"conf.d/www.conf", "nginx.conf"}, result.Files)
+	assert.Equal(t, []string{".hidden", "mime.types"}, result.Ignored)
+	assert.True(t, result.Pushed)
+	assert.True(t, result.Verified)
+
+	// The commit reached the remote branch
+	assert.Equal(t, map[string]string{
+		"nginx.conf":      "worker_processes 4;\n",
+		"conf.d/www.conf": "server { listen 80; }\n",
+	}, treeFiles(t, bareDir, "master", result.RepoDir))
+	bare, err := git.PlainOpen(bareDir)
+	require.NoError(t, err)
+	ref, err := bare.Reference(plumbing.NewBranchReferenceName("master"), true)
+	require.NoError(t, err)
+	assert.Equal(t, result.Commit, ref.Hash().String())
+
+	// A second run without --force refuses to overwrite the host directory
+	_, err = run(context.Background(), cfg, srvCfg, Options{Group: "web", Host: "10.0.0.1", Push: true}, remote)
+	assert.ErrorIs(t, err, ErrAlreadyBootstrapped)
+}
+
+func TestRunForceStagesRemovals(t *testing.T) {
+	cfg, srvCfg, bareDir := newTestConfig(t)
+	remote := &fakeRemote{dir: "/etc/nginx", files: map[string]string{
+		"nginx.conf":      "worker_processes 4;\n",
+		"conf.d/old.conf": "server { listen 8080; }\n",
+	}}
+	_, err := run(context.Background(), cfg, srvCfg, Options{Group: "web", Host: "10.0.0.1", Push: true}, remote)
+	require.NoError(t, err)
+
+	delete(remote.files, "conf.d/old.conf")
+	remote.files["conf.d/new.conf"] = "server { listen 80; }\n"
+	result, err := run(context.Background(), cfg, srvCfg, Options{Group: "web", Host: "10.0.0.1", Force: true, Push: true}, remote)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"nginx.conf":      "worker_processes 4;\n",
+		"conf.d/new.conf": "server { listen 80; }\n",
+	}, treeFiles(t, bareDir, "master", result.RepoDir))
+
+	// Nothing is left over in the worktree
+	repo, err := git.PlainOpen(cfg.Git.RepoPath)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status.String())
+}
+
+func TestRunFailureLeavesRepositoryUntouched(t *testing.T) {
+	cfg, srvCfg, _ := newTestConfig(t)
+	remote := &fakeRemote{dir: "/etc/nginx", files: map[string]string{
+		"nginx.conf":      "worker_processes 4;\n",
+		"conf.d/www.conf": "server { listen 80; }\n",
+	}}
+	_, err := run(context.Background(), cfg, srvCfg, Options{Group: "web", Host: "10.0.0.1", Push: true}, remote)
+	require.NoError(t, err)
+
+	repo, err := git.PlainOpen(cfg.Git.RepoPath)
+	require.NoError(t, err)
+	head, err := repo.Head()
+	require.NoError(t, err)
+
+	// A failed read aborts before the repository is touched
+	remote.files["conf.d/www.conf"] = "server { listen 8080; }\n"
+	remote.failure = "nginx.conf"
+	_, err = run(context.Background(), cfg, srvCfg, Options{Group: "web", Host: "10.0.0.1", Force: true, Push: true}, remote)
+	require.ErrorContains(t, err, "permission denied")
+
+	after, err := repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash(), after.Hash())
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status.String())
+	content, err := os.ReadFile(filepath.Join(cfg.Git.RepoPath, "web/10.0.0.1/nginx/conf.d/www.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "server { listen 80; }\n", string(content))
+}
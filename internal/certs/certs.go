@@ -0,0 +1,219 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+// Certificate states
+const (
+	StatusOK          = "ok"
+	StatusExpiring    = "expiring"
+	StatusExpired     = "expired"
+	StatusNotYetValid = "not_yet_valid"
+	StatusInvalid     = "invalid"
+)
+
+var pemCertificate = []byte("-----BEGIN CERTIFICATE-----")
+
+// Cert is a PEM certificate file of a config tree. Only the first (leaf) certificate is described.
+type Cert struct {
+	Path        string    `json:"path"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	NotBefore   time.Time `json:"not_before,omitempty"`
+	NotAfter    time.Time `json:"not_after,omitempty"`
+	DaysLeft    int       `json:"days_left"`
+	Chain       int       `json:"chain"` // certificates in the file
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	UsedBy      []Usage   `json:"used_by,omitempty"`
+}
+
+// Usage is an ssl_certificate directive referencing a certificate, with its key.
+type Usage struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Server   string `json:"server"` // server names, "http" for the http block
+	Key      string `json:"key,omitempty"`
+	KeyMatch *bool  `json:"key_match,omitempty"` // nil when the key is not in the tree
+	KeyError string `json:"key_error,omitempty"`
+}
+
+// Scan parses every PEM certificate of a config tree (relPath -> content) and finds the
+// ssl_certificate directives using them. Certificates expiring within warnDays are "expiring".
+func Scan(files map[string][]byte, cfg *nginxconf.Config, now time.Time, warnDays int) []Cert {
+	byPath := make(map[string]*Cert)
+	for relPath, content := range files {
+		if !bytes.Contains(content, pemCertificate) {
+			continue
+		}
+		byPath[relPath] = parseCert(relPath, content, now, warnDays)
+	}
+
+	if cfg != nil {
+		for _, u := range usages(cfg) {
+			c, ok := byPath[u.cert]
+			if !ok {
+				// outside of the tree, or missing (the missing_certificate lint rule)
+				continue
+			}
+			usage := u.Usage
+			if u.key != "" {
+				if key, ok := files[u.key]; ok {
+					_, err := tls.X509KeyPair(files[u.cert], key)
+					match := err == nil
+					usage.KeyMatch = &match
+					if err != nil {
+						usage.KeyError = err.Error()
+					}
+				}
+			}
+			c.UsedBy = append(c.UsedBy, usage)
+		}
+	}
+
+	certs := make([]Cert, 0, len(byPath))
+	for _, c := range byPath {
+		certs = append(certs, *c)
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].Path < certs[j].Path
+	})
+	return certs
+}
+
+func parseCert(relPath string, content []byte, now time.Time, warnDays int) *Cert {
+	c := &Cert{Path: relPath}
+	var leaf *x509.Certificate
+	rest := content
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c.Chain++
+		if leaf != nil {
+			continue
+		}
+		parsed, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			c.Status = StatusInvalid
+			c.Error = err.Error()
+			return c
+		}
+		leaf = parsed
+	}
+	if leaf == nil {
+		c.Status = StatusInvalid
+		c.Error = "no certificate found in PEM data"
+		return c
+	}
+
+	sum := sha256.Sum256(leaf.Raw)
+	c.Subject = leaf.Subject.String()
+	c.Issuer = leaf.Issuer.String()
+	c.SANs = append(c.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		c.SANs = append(c.SANs, ip.String())
+	}
+	c.NotBefore = leaf.NotBefore
+	c.NotAfter = leaf.NotAfter
+	c.Fingerprint = hex.EncodeToString(sum[:])
+	c.DaysLeft = int(math.Floor(leaf.NotAfter.Sub(now).Hours() / 24))
+
+	switch {
+	case now.After(leaf.NotAfter):
+		c.Status = StatusExpired
+	case now.Before(leaf.NotBefore):
+		c.Status = StatusNotYetValid
+	case leaf.NotAfter.Sub(now) < time.Duration(warnDays)*24*time.Hour:
+		c.Status = StatusExpiring
+	default:
+		c.Status = StatusOK
+	}
+	return c
+}
+
+type usage struct {
+	Usage
+	cert string // path relative to the config directory
+	key  string
+}
+
+// usages pairs the ssl_certificate and ssl_certificate_key directives of the http block and of
+// each server block by position.
+func usages(cfg *nginxconf.Config) []usage {
+	var out []usage
+	pair := func(server string, directives []*nginxconf.Directive) {
+		var certs, keys []*nginxconf.Directive
+		for _, d := range directives {
+			switch d.Name {
+			case "ssl_certificate":
+				certs = append(certs, d)
+			case "ssl_certificate_key":
+				keys = append(keys, d)
+			}
+		}
+		for i, d := range certs {
+			certPath, ok := cfg.RelPath(d.Arg(0))
+			if !ok || strings.Contains(d.Arg(0), "$") {
+				continue
+			}
+			u := usage{Usage: Usage{File: d.File, Line: d.Line, Server: server}, cert: certPath}
+			if i < len(keys) {
+				u.Key = keys[i].Arg(0)
+				if keyPath, ok := cfg.RelPath(u.Key); ok {
+					u.key = keyPath
+				}
+			}
+			out = append(out, u)
+		}
+	}
+
+	pair("http", cfg.HTTPDirectives())
+	for _, srv := range cfg.HTTPServers() {
+		pair(strings.Join(srv.Names(), " "), srv.Directives)
+	}
+	return out
+}
+
+// Problems lists the certificates used by a server block that must not be deployed: expired,
+// not parseable, or paired with a key that does not belong to them.
+func Problems(certs []Cert) []string {
+	var problems []string
+	for _, c := range certs {
+		if len(c.UsedBy) == 0 {
+			continue
+		}
+		switch c.Status {
+		case StatusExpired:
+			problems = append(problems, fmt.Sprintf("%s expired on %s", c.Path, c.NotAfter.Format("2006-01-02")))
+		case StatusInvalid:
+			problems = append(problems, fmt.Sprintf("%s: %s", c.Path, c.Error))
+		}
+		for _, u := range c.UsedBy {
+			if u.KeyMatch != nil && !*u.KeyMatch {
+				problems = append(problems, fmt.Sprintf("%s does not match key %s (%s:%d): %s", c.Path, u.Key, u.File, u.Line, u.KeyError))
+			}
+		}
+	}
+	return problems
+}
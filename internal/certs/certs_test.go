@@ -0,0 +1,109 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSigned returns a PEM certificate and its PEM key.
+func selfSigned(t *testing.T, name string, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name, "www." + name},
+		NotBefore:    notAfter.Add(-400 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestScan(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	okCert, okKey := selfSigned(t, "example.com", now.Add(200*24*time.Hour))
+	soonCert, soonKey := selfSigned(t, "soon.example.com", now.Add(10*24*time.Hour))
+	oldCert, _ := selfSigned(t, "old.example.com", now.Add(-24*time.Hour))
+
+	files := map[string][]byte{
+		"nginx.conf": []byte(`http {
+    ssl_certificate certs/soon.pem;
+    ssl_certificate_key certs/soon.key;
+    server {
+        listen 443 ssl;
+        server_name example.com;
+        ssl_certificate /etc/nginx/certs/example.pem;
+        ssl_certificate_key /etc/nginx/certs/example.key;
+    }
+    server {
+        listen 443 ssl;
+        server_name old.example.com;
+        ssl_certificate certs/old.pem;
+        ssl_certificate_key certs/example.key;
+        ssl_trusted_certificate /etc/ssl/ca.pem;
+    }
+}
+`),
+		"certs/example.pem": okCert,
+		"certs/example.key": okKey,
+		"certs/soon.pem":    append(append([]byte{}, soonCert...), okCert...),
+		"certs/soon.key":    soonKey,
+		"certs/old.pem":     oldCert,
+		"certs/broken.pem":  []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"),
+	}
+	cfg := nginxconf.Load(files, nginxconf.Options{ConfigDir: "/etc/nginx"})
+	certs := Scan(files, cfg, now, 30)
+
+	require.Len(t, certs, 4)
+	byPath := make(map[string]Cert)
+	for _, c := range certs {
+		byPath[c.Path] = c
+	}
+
+	example := byPath["certs/example.pem"]
+	assert.Equal(t, StatusOK, example.Status)
+	assert.Equal(t, "CN=example.com", example.Subject)
+	assert.Equal(t, []string{"example.com", "www.example.com"}, example.SANs)
+	assert.Equal(t, 200, example.DaysLeft)
+	require.Len(t, example.UsedBy, 1)
+	assert.Equal(t, "example.com", example.UsedBy[0].Server)
+	assert.Equal(t, 7, example.UsedBy[0].Line)
+	require.NotNil(t, example.UsedBy[0].KeyMatch)
+	assert.True(t, *example.UsedBy[0].KeyMatch)
+
+	soon := byPath["certs/soon.pem"]
+	assert.Equal(t, StatusExpiring, soon.Status)
+	assert.Equal(t, 2, soon.Chain)
+	require.Len(t, soon.UsedBy, 1)
+	assert.Equal(t, "http", soon.UsedBy[0].Server)
+
+	old := byPath["certs/old.pem"]
+	assert.Equal(t, StatusExpired, old.Status)
+	require.Len(t, old.UsedBy, 1)
+	require.NotNil(t, old.UsedBy[0].KeyMatch)
+	assert.False(t, *old.UsedBy[0].KeyMatch)
+
+	assert.Equal(t, StatusInvalid, byPath["certs/broken.pem"].Status)
+
+	problems := Problems(certs)
+	require.Len(t, problems, 2)
+	assert.Equal(t, "certs/old.pem expired on 2026-05-31", problems[0])
+	assert.Contains(t, problems[1], "certs/old.pem does not match key certs/example.key (nginx.conf:13)")
+}
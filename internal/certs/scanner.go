@@ -0,0 +1,144 @@
+package certs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/logn-xu/gitops-nginx/internal/state"
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// HostCerts are the certificates of one config tree of a host.
+type HostCerts struct {
+	Group  string `json:"group"`
+	Host   string `json:"host"`
+	Name   string `json:"name"`
+	Source string `json:"source"` // "prod" or "remote"
+	Certs  []Cert `json:"certs"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ScanPrefix scans the config tree of a host stored under prefix.
+func ScanPrefix(ctx context.Context, etcdClient *etcd.Client, prefix string, srvCfg *config.ServerConfig, warnDays int) ([]Cert, error) {
+	files, err := etcdClient.GetFiles(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files from etcd: %w", err)
+	}
+	cfg := nginxconf.Load(files, nginxconf.Options{ConfigDir: srvCfg.NginxConfigDir})
+	return Scan(files, cfg, time.Now(), warnDays), nil
+}
+
+// Scanner periodically scans the production and remote prefixes of every server and keeps a
+// cert_expiry alert open for each tree with expired or expiring certificates.
+type Scanner struct {
+	etcdClient   *etcd.Client
+	stateStore   *state.Store
+	groups       []config.NginxServerGroup
+	sources      map[string]string // source -> key prefix
+	warnDays     int
+	pollInterval time.Duration
+}
+
+// NewScanner creates a certificate scanner for the given server groups.
+func NewScanner(etcdClient *etcd.Client, cfg *config.Config, groups []config.NginxServerGroup) *Scanner {
+	return &Scanner{
+		etcdClient: etcdClient,
+		stateStore: state.NewStore(etcdClient, cfg.Sync.State.KeyPrefix),
+		groups:     groups,
+		sources: map[string]string{
+			"prod":   cfg.Sync.GitSyncer.KeyPrefix,
+			"remote": cfg.Sync.NginxSyncer.KeyPrefix,
+		},
+		warnDays:     cfg.Certs.WarnDays,
+		pollInterval: max(time.Duration(cfg.Certs.IntervalSeconds)*time.Second, time.Minute),
+	}
+}
+
+// Reloadable returns true indicating this service can be hot-reloaded
+func (s *Scanner) Reloadable() bool { return true }
+
+// Start scans once and then on every interval until ctx is canceled.
+func (s *Scanner) Start(ctx context.Context) error {
+	l := log.Logger.WithField("service", "cert_scanner")
+	l.Info("starting certificate scanner")
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.scan(ctx)
+		select {
+		case <-ctx.Done():
+			l.Info("stopping certificate scanner")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scanner) scan(ctx context.Context) {
+	for _, group := range s.groups {
+		for i := range group.Servers {
+			srvCfg := &group.Servers[i]
+			for source, keyPrefix := range s.sources {
+				prefix := path.Join(keyPrefix, group.Group, srvCfg.Host, filepath.Base(srvCfg.NginxConfigDir))
+				if err := s.check(ctx, group.Group, srvCfg, source, prefix); err != nil {
+					log.Logger.WithFields(log.Fields{
+						"group":  group.Group,
+						"host":   srvCfg.Host,
+						"source": source,
+					}).WithError(err).Warn("failed to scan certificates")
+				}
+			}
+		}
+	}
+}
+
+func (s *Scanner) check(ctx context.Context, group string, srvCfg *config.ServerConfig, source, prefix string) error {
+	certs, err := ScanPrefix(ctx, s.etcdClient, prefix, srvCfg, s.warnDays)
+	if err != nil {
+		return err
+	}
+
+	alertSource := "certs." + source
+	details := make(map[string]string)
+	var expired, expiring int
+	for _, c := range certs {
+		switch c.Status {
+		case StatusExpired:
+			expired++
+		case StatusExpiring:
+			expiring++
+		default:
+			continue
+		}
+		details[c.Path] = fmt.Sprintf("%s, %s, not after %s", c.Status, strings.Join(c.SANs, " "), c.NotAfter.Format(time.RFC3339))
+		log.Logger.WithFields(log.Fields{
+			"group":     group,
+			"host":      srvCfg.Host,
+			"source":    source,
+			"cert":      c.Path,
+			"days_left": c.DaysLeft,
+		}).Warnf("certificate %s", c.Status)
+	}
+
+	if expired+expiring == 0 {
+		return s.stateStore.ResolveAlert(ctx, state.AlertCertExpiry, group, srvCfg.Host, alertSource)
+	}
+	_, err = s.stateStore.RaiseAlert(ctx, state.Alert{
+		Kind:    state.AlertCertExpiry,
+		Source:  alertSource,
+		Group:   group,
+		Host:    srvCfg.Host,
+		Message: fmt.Sprintf("%d expired and %d expiring certificate(s) within %d days in the %s tree", expired, expiring, s.warnDays, source),
+		Details: details,
+	})
+	return err
+}
@@ -0,0 +1,164 @@
+package compare
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/logn-xu/gitops-nginx/internal/diff"
+)
+
+// File statuses of a host-to-host comparison.
+const (
+	StatusSame    = "same"
+	StatusChanged = "changed"
+	StatusOnlyA   = "only_a" // the file exists on host a only
+	StatusOnlyB   = "only_b" // the file exists on host b only
+)
+
+// File is the comparison of one file of two host trees.
+type File struct {
+	Path         string `json:"path"`
+	Status       string `json:"status"`
+	Diff         string `json:"diff,omitempty"` // unified diff from a to b
+	AddedLines   int    `json:"added_lines,omitempty"`
+	RemovedLines int    `json:"removed_lines,omitempty"`
+}
+
+// Result is the comparison of two host trees.
+type Result struct {
+	Same    bool   `json:"same"`
+	Files   []File `json:"files"`
+	Equal   int    `json:"equal"`
+	Changed int    `json:"changed"`
+	OnlyA   int    `json:"only_a"`
+	OnlyB   int    `json:"only_b"`
+}
+
+// Trees compares the files of host a with those of host b, both keyed by path relative to the
+// config directory. Files are sorted by path; every differing file carries a unified diff.
+func Trees(a, b map[string][]byte) (*Result, error) {
+	paths := make(map[string]struct{}, len(a)+len(b))
+	for relPath := range a {
+		paths[relPath] = struct{}{}
+	}
+	for relPath := range b {
+		paths[relPath] = struct{}{}
+	}
+	sorted := make([]string, 0, len(paths))
+	for relPath := range paths {
+		sorted = append(sorted, relPath)
+	}
+	sort.Strings(sorted)
+
+	r := &Result{Files: make([]File, 0, len(sorted))}
+	for _, relPath := range sorted {
+		contentA, inA := a[relPath]
+		contentB, inB := b[relPath]
+
+		f := File{Path: relPath}
+		switch {
+		case !inB:
+			f.Status = StatusOnlyA
+			r.OnlyA++
+		case !inA:
+			f.Status = StatusOnlyB
+			r.OnlyB++
+		case string(contentA) == string(contentB):
+			f.Status = StatusSame
+			r.Equal++
+			r.Files = append(r.Files, f)
+			continue
+		default:
+			f.Status = StatusChanged
+			r.Changed++
+		}
+
+		d, err := diff.GenerateUnifiedDiff(string(contentA), string(contentB), "a/"+relPath, "b/"+relPath)
+		if err != nil {
+			return nil, err
+		}
+		f.Diff = d.UnifiedDiff
+		f.AddedLines = d.AddedLines
+		f.RemovedLines = d.RemovedLines
+		r.Files = append(r.Files, f)
+	}
+	r.Same = r.Changed == 0 && r.OnlyA == 0 && r.OnlyB == 0
+	return r, nil
+}
+
+// TreeHash returns a digest of a host tree from its file hashes (relPath -> md5). Two hosts
+// have the same tree hash exactly when they hold the same paths with the same contents.
+func TreeHash(hashes map[string]string) string {
+	paths := make([]string, 0, len(hashes))
+	for relPath := range hashes {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, relPath := range paths {
+		h.Write([]byte(relPath))
+		h.Write([]byte{0})
+		h.Write([]byte(hashes[relPath]))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HostTree is the tree hash of a single host of a group.
+type HostTree struct {
+	Host  string `json:"host"`
+	Name  string `json:"name"`
+	Hash  string `json:"hash,omitempty"`
+	Files int    `json:"files"`
+	Error string `json:"error,omitempty"`
+}
+
+// Cluster is a set of hosts with an identical tree.
+type Cluster struct {
+	Hash  string   `json:"hash"`
+	Files int      `json:"files"`
+	Hosts []string `json:"hosts"`
+}
+
+// Report is the consistency of the trees of a group.
+type Report struct {
+	// Consistent is set when every host was read and all share one tree.
+	Consistent bool `json:"consistent"`
+	// Clusters groups the hosts by tree hash, the largest cluster first.
+	Clusters []Cluster `json:"clusters"`
+	// Errors lists the hosts whose tree could not be read.
+	Errors []HostTree `json:"errors,omitempty"`
+}
+
+// Group clusters the hosts of a group by tree hash. Hosts with an error are reported apart.
+func Group(trees []HostTree) *Report {
+	r := &Report{Clusters: []Cluster{}}
+	index := make(map[string]int)
+	for _, t := range trees {
+		if t.Error != "" {
+			r.Errors = append(r.Errors, t)
+			continue
+		}
+		i, ok := index[t.Hash]
+		if !ok {
+			i = len(r.Clusters)
+			index[t.Hash] = i
+			r.Clusters = append(r.Clusters, Cluster{Hash: t.Hash, Files: t.Files})
+		}
+		r.Clusters[i].Hosts = append(r.Clusters[i].Hosts, t.Host)
+	}
+
+	for i := range r.Clusters {
+		sort.Strings(r.Clusters[i].Hosts)
+	}
+	sort.SliceStable(r.Clusters, func(i, j int) bool {
+		if len(r.Clusters[i].Hosts) != len(r.Clusters[j].Hosts) {
+			return len(r.Clusters[i].Hosts) > len(r.Clusters[j].Hosts)
+		}
+		return r.Clusters[i].Hosts[0] < r.Clusters[j].Hosts[0]
+	})
+	r.Consistent = len(r.Clusters) <= 1 && len(r.Errors) == 0
+	return r
+}
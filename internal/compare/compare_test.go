@@ -0,0 +1,83 @@
+package compare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrees(t *testing.T) {
+	a := map[string][]byte{
+		"nginx.conf":      []byte("worker_processes 4;\n"),
+		"conf.d/www.conf": []byte("server {\n    listen 80;\n}\n"),
+		"conf.d/old.conf": []byte("# old\n"),
+	}
+	b := map[string][]byte{
+		"nginx.conf":      []byte("worker_processes 4;\n"),
+		"conf.d/www.conf": []byte("server {\n    listen 8080;\n}\n"),
+		"conf.d/new.conf": []byte("# new\n"),
+	}
+
+	r, err := Trees(a, b)
+	require.NoError(t, err)
+	assert.False(t, r.Same)
+	assert.Equal(t, 1, r.Equal)
+	assert.Equal(t, 1, r.Changed)
+	assert.Equal(t, 1, r.OnlyA)
+	assert.Equal(t, 1, r.OnlyB)
+
+	require.Len(t, r.Files, 4)
+	statuses := make(map[string]string)
+	for _, f := range r.Files {
+		statuses[f.Path] = f.Status
+	}
+	assert.Equal(t, map[string]string{
+		"nginx.conf":      StatusSame,
+		"conf.d/www.conf": StatusChanged,
+		"conf.d/old.conf": StatusOnlyA,
+		"conf.d/new.conf": StatusOnlyB,
+	}, statuses)
+	assert.Equal(t, "conf.d/new.conf", r.Files[0].Path)
+
+	www := r.Files[2]
+	assert.Equal(t, "conf.d/www.conf", www.Path)
+	assert.Contains(t, www.Diff, "--- a/conf.d/www.conf")
+	assert.Contains(t, www.Diff, "+++ b/conf.d/www.conf")
+	assert.Contains(t, www.Diff, "-    listen 80;")
+	assert.Contains(t, www.Diff, "+    listen 8080;")
+	assert.Equal(t, 1, www.AddedLines)
+	assert.Equal(t, 1, www.RemovedLines)
+	assert.Empty(t, r.Files[3].Diff)
+
+	same, err := Trees(a, a)
+	require.NoError(t, err)
+	assert.True(t, same.Same)
+}
+
+func TestTreeHash(t *testing.T) {
+	h := TreeHash(map[string]string{"nginx.conf": "a", "conf.d/www.conf": "b"})
+	assert.Equal(t, h, TreeHash(map[string]string{"conf.d/www.conf": "b", "nginx.conf": "a"}))
+	assert.NotEqual(t, h, TreeHash(map[string]string{"nginx.conf": "a", "conf.d/www.conf": "c"}))
+	assert.NotEqual(t, h, TreeHash(map[string]string{"nginx.conf": "a", "conf.d/api.conf": "b"}))
+	assert.NotEqual(t, h, TreeHash(map[string]string{"nginx.conf": "a"}))
+}
+
+func TestGroup(t *testing.T) {
+	r := Group([]HostTree{
+		{Host: "web-03", Hash: "y", Files: 3},
+		{Host: "web-02", Hash: "x", Files: 2},
+		{Host: "web-01", Hash: "x", Files: 2},
+		{Host: "web-04", Error: "etcd unavailable"},
+	})
+	assert.False(t, r.Consistent)
+	require.Len(t, r.Clusters, 2)
+	assert.Equal(t, Cluster{Hash: "x", Files: 2, Hosts: []string{"web-01", "web-02"}}, r.Clusters[0])
+	assert.Equal(t, Cluster{Hash: "y", Files: 3, Hosts: []string{"web-03"}}, r.Clusters[1])
+	require.Len(t, r.Errors, 1)
+	assert.Equal(t, "web-04", r.Errors[0].Host)
+
+	r = Group([]HostTree{{Host: "web-01", Hash: "x"}, {Host: "web-02", Hash: "x"}})
+	assert.True(t, r.Consistent)
+	assert.Len(t, r.Clusters, 1)
+}
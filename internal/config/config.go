@@ -16,6 +16,10 @@ type Config struct {
 	NginxServers []NginxServerGroup `mapstructure:"nginx_servers"`
 	Sync         SyncConfig         `mapstructure:"sync"`
 	Git          GitConfig          `mapstructure:"git"`
+	DeployPolicy DeployPolicyConfig `mapstructure:"deploy_policy"`
+	Lint         LintConfig         `mapstructure:"lint"`
+	ConfigPolicy ConfigPolicyConfig `mapstructure:"config_policy"`
+	Certs        CertsConfig        `mapstructure:"certs"`
 }
 
 // APIConfig holds the API server configuration
@@ -23,6 +27,15 @@ type APIConfig struct {
 	Listen               string   `mapstructure:"listen"`
 	AllowOrigins         []string `mapstructure:"allow_origins"`
 	EnableEmbeddedServer bool     `mapstructure:"enable_embedded_server"`
+	// Tokens enables bearer token authentication; the API is open when empty.
+	Tokens []APITokenConfig `mapstructure:"tokens"`
+}
+
+// APITokenConfig maps a bearer token to a user and a role
+type APITokenConfig struct {
+	Token string `mapstructure:"token"`
+	User  string `mapstructure:"user"`
+	Role  string `mapstructure:"role"` // "admin" or "operator"
 }
 
 // LoggingConfig holds the logging configuration
@@ -50,6 +63,16 @@ type EtcdConfig struct {
 type NginxServerGroup struct {
 	Group   string         `mapstructure:"group"`
 	Servers []ServerConfig `mapstructure:"servers"`
+	// Vars are template variables shared by all servers of the group.
+	Vars map[string]any `mapstructure:"vars"`
+	// Branch overrides git.branch for this group.
+	Branch string `mapstructure:"branch"`
+	// Ref pins the group to a fixed tag or commit instead of a branch.
+	Ref string `mapstructure:"ref"`
+	// RequireApproval requires an approved change request to apply to this group.
+	RequireApproval bool `mapstructure:"require_approval"`
+	// Hooks run around an apply to every server of the group, before the server hooks.
+	Hooks HooksConfig `mapstructure:"hooks"`
 }
 
 // ServerConfig holds the configuration for a single server
@@ -63,10 +86,53 @@ type ServerConfig struct {
 	NginxConfigDir  string           `mapstructure:"nginx_config_dir"`
 	CheckDir        string           `mapstructure:"check_dir"`
 	BackupDir       string           `mapstructure:"backup_dir"`
+	// Vars are template variables for this server, overriding the group vars.
+	Vars map[string]any `mapstructure:"vars"`
+	// Hooks run around an apply to this server, after the group hooks.
+	Hooks HooksConfig `mapstructure:"hooks"`
+	// Health probes verify the server after nginx is reloaded by an apply.
+	Health HealthConfig `mapstructure:"health"`
+	// PreservePatterns exempt remote files that are not in git from deletion, e.g. mime.types or certbot certs.
+	PreservePatterns []string `mapstructure:"preserve_patterns"`
+	// NoDelete keeps every remote file that is not in git instead of mirroring deletions.
+	NoDelete bool `mapstructure:"no_delete"`
 	// TestCmd         string           `mapstructure:"test_cmd"`
 	// ReloadCmd       string           `mapstructure:"reload_cmd"`
 }
 
+// HooksConfig holds the ordered commands run around an apply
+type HooksConfig struct {
+	PreApply  []HookConfig `mapstructure:"pre_apply"`  // a failure aborts the apply
+	PostApply []HookConfig `mapstructure:"post_apply"` // run after nginx is reloaded
+	OnFailure []HookConfig `mapstructure:"on_failure"` // run when a pre/post hook, the upload or the reload fails
+}
+
+// HookConfig is a single hook command
+type HookConfig struct {
+	Name    string `mapstructure:"name"`
+	Command string `mapstructure:"command"`
+	Where   string `mapstructure:"where"`   // "remote" (over SSH, default) or "local"
+	Timeout string `mapstructure:"timeout"` // e.g. "30s", default 30s
+}
+
+// HealthConfig holds the HTTP probes run after an apply reloads nginx
+type HealthConfig struct {
+	Probes            []HealthProbeConfig `mapstructure:"probes"`
+	Attempts          int                 `mapstructure:"attempts"`            // attempts per probe, default 3
+	Interval          string              `mapstructure:"interval"`            // wait between attempts, default "2s"
+	RollbackOnFailure bool                `mapstructure:"rollback_on_failure"` // restore the pre-deploy snapshot when a probe fails
+}
+
+// HealthProbeConfig is a single HTTP probe
+type HealthProbeConfig struct {
+	Name           string `mapstructure:"name"`
+	URL            string `mapstructure:"url"`
+	ExpectedStatus int    `mapstructure:"expected_status"` // default 200
+	Host           string `mapstructure:"host"`            // Host header, e.g. to reach a name-based virtual server
+	Where          string `mapstructure:"where"`           // "local" (from gitops-nginx, default) or "remote" (curl over SSH)
+	Timeout        string `mapstructure:"timeout"`         // per attempt, default "5s"
+}
+
 // ServerAuthConfig holds the authentication configuration for a server
 type ServerAuthConfig struct {
 	Method   string `mapstructure:"method"`
@@ -76,9 +142,24 @@ type ServerAuthConfig struct {
 
 // Sync configuration
 type SyncConfig struct {
-	NginxSyncer   NginxSyncer   `mapstructure:"nginx_syncer"`
-	GitSyncer     GitSyncer     `mapstructure:"git_syncer"`
-	PreviewSyncer PreviewSyncer `mapstructure:"preview_syncer"`
+	NginxSyncer   NginxSyncer       `mapstructure:"nginx_syncer"`
+	GitSyncer     GitSyncer         `mapstructure:"git_syncer"`
+	PreviewSyncer PreviewSyncer     `mapstructure:"preview_syncer"`
+	State         StateConfig       `mapstructure:"state"`
+	DeleteGuard   DeleteGuardConfig `mapstructure:"delete_guard"`
+}
+
+// DeleteGuardConfig limits how many files one git sync or one upload may delete.
+// Crossing a limit blocks the operation and raises an alert; zero disables a limit, both are
+// zero by default so the guard is opt-in.
+type DeleteGuardConfig struct {
+	MaxFiles   int     `mapstructure:"max_files"`   // deleted files
+	MaxPercent float64 `mapstructure:"max_percent"` // deleted files in percent of the existing files, single deletions never count
+}
+
+// StateConfig holds where runtime records (synced commits, pins, ...) are stored in etcd
+type StateConfig struct {
+	KeyPrefix string `mapstructure:"key_prefix"`
 }
 
 type NginxSyncer struct {
@@ -108,6 +189,7 @@ type GitConfig struct {
 	SyncMode   string        `mapstructure:"sync_mode"`
 	Auth       GitAuthConfig `mapstructure:"auth"`
 	Poll       GitPollConfig `mapstructure:"poll"`
+	Release    ReleaseConfig `mapstructure:"release"`
 }
 
 // GitAuthConfig holds the git authentication configuration
@@ -124,6 +206,88 @@ type GitPollConfig struct {
 	IntervalSeconds int  `mapstructure:"interval_seconds"`
 }
 
+// DeployPolicyConfig holds the freeze windows and allowed deploy hours
+type DeployPolicyConfig struct {
+	Timezone     string               `mapstructure:"timezone"` // IANA name, defaults to the local timezone
+	AllowedHours []AllowedHoursConfig `mapstructure:"allowed_hours"`
+	Freezes      []FreezeConfig       `mapstructure:"freezes"`
+	ApprovalTTL  string               `mapstructure:"approval_ttl"` // how long a change approval stays valid
+}
+
+// AllowedHoursConfig restricts deploys to a daily time range
+type AllowedHoursConfig struct {
+	Groups []string `mapstructure:"groups"` // empty applies to all groups
+	Days   []string `mapstructure:"days"`   // "mon".."sun", empty means every day
+	Start  string   `mapstructure:"start"`  // "09:00"
+	End    string   `mapstructure:"end"`    // "18:00"
+}
+
+// FreezeConfig is a window during which deploys are rejected, either a fixed date range
+// (start/end) or a recurring window starting at every match of a 5-field cron expression.
+type FreezeConfig struct {
+	Name     string   `mapstructure:"name"`
+	Groups   []string `mapstructure:"groups"`   // empty applies to all groups
+	Start    string   `mapstructure:"start"`    // "2006-01-02" or RFC3339
+	End      string   `mapstructure:"end"`      // "2006-01-02" (inclusive) or RFC3339
+	Cron     string   `mapstructure:"cron"`     // e.g. "0 18 * * fri"
+	Duration string   `mapstructure:"duration"` // e.g. "62h"
+}
+
+// LintConfig configures the offline lint rules run on the config tree of a host
+type LintConfig struct {
+	// Rules overrides the severity of built-in rules by id: "error", "warning", "info" or "off".
+	Rules map[string]string `mapstructure:"rules"`
+	// FailOn is the lowest severity that fails a check, default "error".
+	FailOn string `mapstructure:"fail_on"`
+}
+
+// ConfigPolicyConfig points at the policy rules enforced on the nginx config of every deploy
+type ConfigPolicyConfig struct {
+	// File is the YAML file holding the rules; empty disables policy enforcement.
+	File string `mapstructure:"file"`
+	// BlockOn is the lowest severity that blocks update/prepare and apply, default "error".
+	BlockOn string `mapstructure:"block_on"`
+}
+
+// CertsConfig holds the TLS certificate scanner configuration
+type CertsConfig struct {
+	WarnDays        int `mapstructure:"warn_days"`        // certs expiring within this many days raise an alert
+	IntervalSeconds int `mapstructure:"interval_seconds"` // how often the etcd prefixes are scanned
+}
+
+// FindServer returns the server configuration identified by group and host, or nil if not found.
+func (c *Config) FindServer(group, host string) *ServerConfig {
+	for _, g := range c.NginxServers {
+		if g.Group == group {
+			for i := range g.Servers {
+				if g.Servers[i].Host == host {
+					return &g.Servers[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ReleaseConfig holds the release policy that gates which commits reach the production prefix
+type ReleaseConfig struct {
+	Mode               string `mapstructure:"mode"`                 // "" (branch head), "tag", "signed"
+	TagPattern         string `mapstructure:"tag_pattern"`          // glob matched against tag names, e.g. "release-*"; wildcards also match "/"
+	KeyringPath        string `mapstructure:"keyring_path"`         // armored GPG public keyring for "signed"
+	AllowedSignersPath string `mapstructure:"allowed_signers_path"` // ssh allowed_signers file for "signed"
+	MaxDepth           int    `mapstructure:"max_depth"`            // how many commits to look back for a releasable one
+}
+
+// FindGroup returns the server group with the given name, or nil if not found.
+func (c *Config) FindGroup(group string) *NginxServerGroup {
+	for i := range c.NginxServers {
+		if c.NginxServers[i].Group == group {
+			return &c.NginxServers[i]
+		}
+	}
+	return nil
+}
+
 // LoadConfig loads the configuration from multiple files
 func LoadConfig() (*Config, error) {
 	// 1. Load main config.yaml
@@ -143,6 +307,7 @@ func LoadConfig() (*Config, error) {
 	vMain.SetDefault("sync.nginx_syncer.key_prefix", "/gitops-nginx-remote")
 	vMain.SetDefault("sync.git_syncer.key_prefix", "/gitops-nginx")
 	vMain.SetDefault("sync.preview_syncer.key_prefix", "/gitops-nginx-preview")
+	vMain.SetDefault("sync.state.key_prefix", "/gitops-nginx-state")
 	// set logging default values
 	vMain.SetDefault("logging.level", "info")
 	vMain.SetDefault("logging.app_log.filename", "logs/gitops-nginx.log")
@@ -155,6 +320,18 @@ func LoadConfig() (*Config, error) {
 	vMain.SetDefault("logging.access_log.max_backups", 5)
 	vMain.SetDefault("logging.access_log.max_age", 30)
 	vMain.SetDefault("logging.access_log.compress", true)
+	// set git release default values
+	vMain.SetDefault("git.release.tag_pattern", "*")
+	vMain.SetDefault("git.release.max_depth", 100)
+	// set deploy policy default values
+	vMain.SetDefault("deploy_policy.approval_ttl", "4h")
+	// set lint default values
+	vMain.SetDefault("lint.fail_on", "error")
+	// set config policy default values
+	vMain.SetDefault("config_policy.block_on", "error")
+	// set certificate scanner default values
+	vMain.SetDefault("certs.warn_days", 30)
+	vMain.SetDefault("certs.interval_seconds", 3600)
 	// set etcd default values
 	vMain.SetDefault("etcd.endpoints", []string{"localhost:2379"})
 
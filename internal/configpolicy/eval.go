@@ -0,0 +1,264 @@
+package configpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+// AllowPrefix starts a comment that exempts a block, and the blocks inside it, from a rule:
+//
+//	# policy:allow <rule-id> <justification>
+//
+// An allow comment without a justification does not exempt anything.
+const AllowPrefix = "policy:allow"
+
+// Finding is a rule violation in a config tree.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Message  string   `json:"message"`
+	// Allowed is set when an allow comment with a justification exempts the violation.
+	Allowed       bool   `json:"allowed,omitempty"`
+	Justification string `json:"justification,omitempty"`
+	AllowedAt     string `json:"allowed_at,omitempty"` // file:line of the allow comment
+	// Blocking is set when the violation is not allowed and reaches the block_on severity.
+	Blocking bool `json:"blocking,omitempty"`
+}
+
+// Position returns the position of the finding as file:line.
+func (f *Finding) Position() string {
+	if f.Line == 0 {
+		return f.File
+	}
+	return fmt.Sprintf("%s:%d", f.File, f.Line)
+}
+
+// Result is the outcome of evaluating a policy against a config tree.
+type Result struct {
+	OK       bool      `json:"ok"`
+	Blocking int       `json:"blocking"`
+	Allowed  int       `json:"allowed"`
+	Findings []Finding `json:"findings"`
+}
+
+// scope is a block of the tree, or the top level, with includes expanded.
+type scope struct {
+	block    *nginxconf.Directive // nil for the top level
+	parents  []*scope             // enclosing scopes, innermost first
+	children []*nginxconf.Directive
+	comments []*nginxconf.Directive
+	file     string
+	line     int
+}
+
+func (s *scope) name() string {
+	if s.block == nil {
+		return MainContext
+	}
+	return s.block.Name
+}
+
+func (s *scope) label() string {
+	if s.block == nil {
+		return MainContext
+	}
+	return strings.TrimSpace(s.block.Name + " " + strings.Join(s.block.RawArgs, " "))
+}
+
+// Evaluate runs the rules against every block of cfg reached from its root file.
+func (p *Policy) Evaluate(cfg *nginxconf.Config) *Result {
+	res := &Result{OK: true, Findings: []Finding{}}
+
+	main := &scope{file: cfg.Root}
+	scopes := map[*nginxconf.Directive]*scope{nil: main}
+	order := []*scope{main}
+	cfg.Walk(func(d *nginxconf.Directive, parents []*nginxconf.Directive) bool {
+		var parent *nginxconf.Directive
+		if len(parents) > 0 {
+			parent = parents[len(parents)-1]
+		}
+		sc := scopes[parent]
+		if d.IsComment() {
+			sc.comments = append(sc.comments, d)
+			return true
+		}
+		sc.children = append(sc.children, d)
+		if d.IsBlock {
+			child := &scope{
+				block:   d,
+				parents: append([]*scope{sc}, sc.parents...),
+				file:    d.File,
+				line:    d.Line,
+			}
+			scopes[d] = child
+			order = append(order, child)
+		}
+		return true
+	})
+
+	for _, r := range p.Rules {
+		for _, sc := range order {
+			if r.Match.Block != "*" && r.Match.Block != sc.name() {
+				continue
+			}
+			if !r.Match.Expr.empty() {
+				if ok, _ := r.Match.Expr.eval(sc); !ok {
+					continue
+				}
+			}
+			ok, witness := r.Assert.eval(sc)
+			if ok {
+				continue
+			}
+
+			f := Finding{Rule: r.ID, Severity: r.Severity, File: sc.file, Line: sc.line}
+			if witness != nil {
+				f.File, f.Line = witness.File, witness.Line
+			}
+			f.Message = fmt.Sprintf("%s: %s", sc.label(), r.Assert.String())
+			if r.Description != "" {
+				f.Message = fmt.Sprintf("%s (%s)", r.Description, f.Message)
+			}
+
+			allow, missing := findAllow(sc, r.ID)
+			switch {
+			case allow != nil:
+				f.Allowed = true
+				f.Justification = allowJustification(allow, r.ID)
+				f.AllowedAt = allow.Pos()
+				res.Allowed++
+			case missing != nil:
+				f.Message += fmt.Sprintf("; allow comment at %s has no justification", missing.Pos())
+			}
+			if !f.Allowed && severityRank[f.Severity] >= severityRank[p.blockOn] {
+				f.Blocking = true
+				res.Blocking++
+				res.OK = false
+			}
+			res.Findings = append(res.Findings, f)
+		}
+	}
+	return res
+}
+
+// findAllow returns the allow comment for rule in the scope or its enclosing scopes, or the first
+// allow comment for rule that lacks a justification.
+func findAllow(sc *scope, rule string) (allow, missing *nginxconf.Directive) {
+	scopes := append([]*scope{sc}, sc.parents...)
+	for _, s := range scopes {
+		for _, c := range s.comments {
+			fields := strings.Fields(c.Comment)
+			if len(fields) < 2 || fields[0] != AllowPrefix || fields[1] != rule {
+				continue
+			}
+			if len(fields) == 2 {
+				if missing == nil {
+					missing = c
+				}
+				continue
+			}
+			return c, nil
+		}
+	}
+	return nil, missing
+}
+
+func allowJustification(c *nginxconf.Directive, rule string) string {
+	text := strings.TrimSpace(c.Comment)
+	text = strings.TrimSpace(strings.TrimPrefix(text, AllowPrefix))
+	return strings.TrimSpace(strings.TrimPrefix(text, rule))
+}
+
+// eval evaluates the expression on a scope. The witness is the directive that decided the
+// outcome, if any, e.g. the offending directive of a failed "not has".
+func (e *Expr) eval(sc *scope) (bool, *nginxconf.Directive) {
+	switch {
+	case e.Has != nil:
+		scopes := []*scope{sc}
+		if e.Has.Inherited {
+			scopes = append(scopes, sc.parents...)
+		}
+		for _, s := range scopes {
+			for _, d := range s.children {
+				if e.Has.matches(d) {
+					return true, d
+				}
+			}
+		}
+		return false, nil
+	case e.Listen != "":
+		if sc.block == nil || sc.block.Name != "server" {
+			return false, nil
+		}
+		srv := &nginxconf.ServerBlock{Directive: sc.block, Directives: sc.children}
+		want := nginxconf.ListenAddress(e.Listen)
+		for _, l := range srv.Listens() {
+			if l.Address == want || (!strings.Contains(e.Listen, ":") && strings.HasSuffix(l.Address, ":"+e.Listen)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case e.Args != nil:
+		if sc.block == nil {
+			return false, nil
+		}
+		return matchArgs(e.args, sc.block.Args), nil
+	case e.Not != nil:
+		ok, witness := e.Not.eval(sc)
+		return !ok, witness
+	case e.All != nil:
+		for i := range e.All {
+			if ok, witness := e.All[i].eval(sc); !ok {
+				return false, witness
+			}
+		}
+		return true, nil
+	case e.Any != nil:
+		for i := range e.Any {
+			if ok, witness := e.Any[i].eval(sc); ok {
+				return true, witness
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+func (dp *DirectivePattern) matches(d *nginxconf.Directive) bool {
+	return d.Name == dp.Name && matchArgs(dp.args, d.Args)
+}
+
+// matchArgs reports whether the leading args match the compiled patterns.
+func matchArgs(patterns []*regexp.Regexp, args []string) bool {
+	if len(args) < len(patterns) {
+		return false
+	}
+	for i, re := range patterns {
+		if !re.MatchString(args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func compileGlobs(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		res[i] = globRegexp(p)
+	}
+	return res
+}
+
+// globRegexp compiles a pattern where "*" matches any text, "?" any single character and
+// everything else itself, ignoring case.
+func globRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("(?is)^" + quoted + "$")
+}
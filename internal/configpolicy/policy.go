@@ -0,0 +1,207 @@
+package configpolicy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Severity of a rule. Violations at or above the block_on severity block a deploy.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+var severityRank = map[Severity]int{
+	SeverityInfo:    1,
+	SeverityWarning: 2,
+	SeverityError:   3,
+}
+
+// MainContext is the block name of the top level of nginx.conf in a match.
+const MainContext = "main"
+
+// Rule is a policy evaluated against every block of a config tree selected by Match.
+type Rule struct {
+	ID          string   `yaml:"id" json:"id"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Severity    Severity `yaml:"severity" json:"severity"`
+	Match       Match    `yaml:"match" json:"match"`
+	Assert      Expr     `yaml:"assert" json:"assert"`
+}
+
+// Match selects the blocks a rule applies to: blocks named Block ("main" for the top level,
+// "*" for every block and the top level) that also satisfy the inline expression, if any.
+type Match struct {
+	Block string `yaml:"block" json:"block"`
+	Expr  `yaml:",inline"`
+}
+
+// Expr is a condition on a block. Exactly one field is set.
+type Expr struct {
+	// Has holds if a directive of the block matches the pattern.
+	Has *DirectivePattern `yaml:"has,omitempty" json:"has,omitempty"`
+	// Listen holds for server blocks listening on a port ("443") or address ("10.0.0.1:443").
+	Listen string `yaml:"listen,omitempty" json:"listen,omitempty"`
+	// Args holds if the arguments of the block match the patterns, e.g. a location path.
+	Args []string `yaml:"args,omitempty" json:"args,omitempty"`
+	Not  *Expr    `yaml:"not,omitempty" json:"not,omitempty"`
+	All  []Expr   `yaml:"all,omitempty" json:"all,omitempty"`
+	Any  []Expr   `yaml:"any,omitempty" json:"any,omitempty"`
+
+	args []*regexp.Regexp // Args, compiled by Parse
+}
+
+// DirectivePattern matches a directive by name and leading arguments. In argument patterns "*"
+// matches any text and "?" any single character; they are compared case-insensitively.
+type DirectivePattern struct {
+	Name string   `yaml:"name" json:"name"`
+	Args []string `yaml:"args,omitempty" json:"args,omitempty"`
+	// Inherited also looks at the directives of the enclosing blocks.
+	Inherited bool `yaml:"inherited,omitempty" json:"inherited,omitempty"`
+
+	args []*regexp.Regexp // Args, compiled by Parse
+}
+
+// Policy is a validated set of rules.
+type Policy struct {
+	Rules   []Rule
+	blockOn Severity
+}
+
+// Load reads the policy file at path. blockOn is the lowest severity that blocks, default error.
+func Load(file string, blockOn string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	return Parse(data, blockOn)
+}
+
+// Parse parses and validates policy rules from YAML.
+func Parse(data []byte, blockOn string) (*Policy, error) {
+	var doc struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	p := &Policy{Rules: doc.Rules, blockOn: SeverityError}
+	if blockOn != "" {
+		p.blockOn = Severity(blockOn)
+		if _, ok := severityRank[p.blockOn]; !ok {
+			return nil, fmt.Errorf("policy: invalid block_on %q, must be error, warning or info", blockOn)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.ID == "" || strings.ContainsAny(r.ID, " \t") {
+			return nil, fmt.Errorf("policy: rule %d: id is required and must not contain spaces", i+1)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("policy: duplicate rule %q", r.ID)
+		}
+		seen[r.ID] = true
+		if r.Severity == "" {
+			r.Severity = SeverityError
+		}
+		if _, ok := severityRank[r.Severity]; !ok {
+			return nil, fmt.Errorf("policy: rule %q: invalid severity %q, must be error, warning or info", r.ID, r.Severity)
+		}
+		if r.Match.Block == "" {
+			return nil, fmt.Errorf("policy: rule %q: match.block is required", r.ID)
+		}
+		if !r.Match.Expr.empty() {
+			if err := r.Match.Expr.validate(); err != nil {
+				return nil, fmt.Errorf("policy: rule %q: match: %w", r.ID, err)
+			}
+		}
+		if err := r.Assert.validate(); err != nil {
+			return nil, fmt.Errorf("policy: rule %q: assert: %w", r.ID, err)
+		}
+	}
+	return p, nil
+}
+
+func (e *Expr) empty() bool {
+	return e.Has == nil && e.Listen == "" && e.Args == nil && e.Not == nil && e.All == nil && e.Any == nil
+}
+
+// validate checks that exactly one field of the expression and its subexpressions is set and
+// compiles their argument patterns.
+func (e *Expr) validate() error {
+	set := 0
+	for _, ok := range []bool{e.Has != nil, e.Listen != "", e.Args != nil, e.Not != nil, e.All != nil, e.Any != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of has, listen, args, not, all or any must be set")
+	}
+
+	switch {
+	case e.Has != nil:
+		if e.Has.Name == "" {
+			return fmt.Errorf("has: name is required")
+		}
+		e.Has.args = compileGlobs(e.Has.Args)
+	case e.Args != nil:
+		e.args = compileGlobs(e.Args)
+	case e.Not != nil:
+		return e.Not.validate()
+	case e.All != nil || e.Any != nil:
+		for _, subs := range [][]Expr{e.All, e.Any} {
+			for i := range subs {
+				if err := subs[i].validate(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// String renders the expression for violation messages, e.g. "has add_header Strict-Transport-Security".
+func (e *Expr) String() string {
+	join := func(op string, exprs []Expr) string {
+		parts := make([]string, len(exprs))
+		for i := range exprs {
+			parts[i] = exprs[i].String()
+		}
+		return op + "(" + strings.Join(parts, ", ") + ")"
+	}
+	switch {
+	case e.Has != nil:
+		s := strings.TrimSpace("has " + e.Has.Name + " " + strings.Join(e.Has.Args, " "))
+		if e.Has.Inherited {
+			s += " (inherited)"
+		}
+		return s
+	case e.Listen != "":
+		return "listen " + e.Listen
+	case e.Args != nil:
+		return "args " + strings.Join(e.Args, " ")
+	case e.Not != nil:
+		return "not " + e.Not.String()
+	case e.All != nil:
+		return join("all", e.All)
+	case e.Any != nil:
+		return join("any", e.Any)
+	}
+	return ""
+}
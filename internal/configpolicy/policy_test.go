@@ -0,0 +1,195 @@
+package configpolicy
+
+import (
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+rules:
+  - id: hsts
+    description: servers on 443 must set HSTS
+    match:
+      block: server
+      listen: "443"
+    assert:
+      has: {name: add_header, args: [strict-transport-security], inherited: true}
+  - id: no_autoindex
+    severity: error
+    match:
+      block: "*"
+    assert:
+      not:
+        has: {name: autoindex, args: ["on"]}
+  - id: admin_allowlist
+    severity: warning
+    match:
+      block: location
+      args: ["/admin*"]
+    assert:
+      any:
+        - has: {name: allow}
+        - has: {name: auth_basic}
+`
+
+func evaluate(t *testing.T, blockOn string, files map[string]string) *Result {
+	t.Helper()
+	p, err := Parse([]byte(testPolicy), blockOn)
+	require.NoError(t, err)
+	tree := make(map[string][]byte)
+	for name, content := range files {
+		tree[name] = []byte(content)
+	}
+	return p.Evaluate(nginxconf.Load(tree, nginxconf.Options{ConfigDir: "/etc/nginx"}))
+}
+
+func TestEvaluate(t *testing.T) {
+	res := evaluate(t, "", map[string]string{
+		"nginx.conf": `http {
+    include conf.d/*.conf;
+}
+`,
+		"conf.d/a.conf": `server {
+    listen 443 ssl;
+    server_name a.example.com;
+    add_header Strict-Transport-Security "max-age=31536000" always;
+}
+server {
+    listen 443 ssl;
+    server_name b.example.com;
+    location /files/ {
+        autoindex on;
+    }
+    location /admin/ {
+        proxy_pass http://admin;
+    }
+}
+server {
+    listen 80;
+    server_name c.example.com;
+    location /mirror/ {
+        # policy:allow no_autoindex public mirror, approved by security
+        autoindex on;
+    }
+    location /pub/ {
+        # policy:allow no_autoindex
+        autoindex on;
+    }
+}
+`,
+	})
+
+	var got []string
+	for _, f := range res.Findings {
+		got = append(got, f.Rule+" "+f.Position())
+	}
+	assert.Equal(t, []string{
+		"hsts conf.d/a.conf:6",
+		"no_autoindex conf.d/a.conf:10",
+		"no_autoindex conf.d/a.conf:21",
+		"no_autoindex conf.d/a.conf:25",
+		"admin_allowlist conf.d/a.conf:12",
+	}, got)
+
+	assert.Equal(t, "servers on 443 must set HSTS (server: has add_header strict-transport-security (inherited))", res.Findings[0].Message)
+
+	allowed := res.Findings[2]
+	assert.True(t, allowed.Allowed)
+	assert.False(t, allowed.Blocking)
+	assert.Equal(t, "public mirror, approved by security", allowed.Justification)
+	assert.Equal(t, "conf.d/a.conf:20", allowed.AllowedAt)
+
+	unjustified := res.Findings[3]
+	assert.False(t, unjustified.Allowed)
+	assert.True(t, unjustified.Blocking)
+	assert.Contains(t, unjustified.Message, "allow comment at conf.d/a.conf:24 has no justification")
+
+	assert.False(t, res.Findings[4].Blocking, "warnings do not block by default")
+	assert.False(t, res.OK)
+	assert.Equal(t, 3, res.Blocking)
+	assert.Equal(t, 1, res.Allowed)
+}
+
+func TestEvaluateInheritedAndBlockOn(t *testing.T) {
+	files := map[string]string{
+		"nginx.conf": `http {
+    add_header Strict-Transport-Security "max-age=31536000";
+    server {
+        listen 443 ssl;
+        location /admin {
+            auth_basic "admin";
+        }
+        location /administrator {
+        }
+    }
+}
+`,
+	}
+	res := evaluate(t, "", files)
+	assert.True(t, res.OK)
+	require.Len(t, res.Findings, 1)
+	assert.Equal(t, "admin_allowlist", res.Findings[0].Rule)
+	assert.Equal(t, 8, res.Findings[0].Line)
+
+	res = evaluate(t, "warning", files)
+	assert.False(t, res.OK)
+	assert.Equal(t, 1, res.Blocking)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name, policy, err string
+	}{
+		{"unknown field", "rules:\n  - id: a\n    match: {block: server}\n    assert: {hass: {name: x}}\n", "field hass not found"},
+		{"no id", "rules:\n  - match: {block: server}\n    assert: {has: {name: x}}\n", "id is required"},
+		{"duplicate", "rules:\n  - {id: a, match: {block: server}, assert: {has: {name: x}}}\n  - {id: a, match: {block: server}, assert: {has: {name: x}}}\n", "duplicate rule"},
+		{"no block", "rules:\n  - {id: a, match: {}, assert: {has: {name: x}}}\n", "match.block is required"},
+		{"empty assert", "rules:\n  - {id: a, match: {block: server}}\n", "exactly one of"},
+		{"two fields", "rules:\n  - {id: a, match: {block: server}, assert: {has: {name: x}, listen: '443'}}\n", "exactly one of"},
+		{"severity", "rules:\n  - {id: a, severity: fatal, match: {block: server}, assert: {has: {name: x}}}\n", "invalid severity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.policy), "")
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	_, err := Parse([]byte(testPolicy), "fatal")
+	assert.ErrorContains(t, err, "invalid block_on")
+}
+
+func TestEvaluateNestedArgs(t *testing.T) {
+	p, err := Parse([]byte(`
+rules:
+  - id: request_id
+    match:
+      block: location
+      all:
+        - args: ["/API*"]
+        - not: {args: ["/api/public*"]}
+    assert:
+      has: {name: proxy_set_header, args: [x-request-id]}
+`), "")
+	require.NoError(t, err)
+
+	res := p.Evaluate(nginxconf.Load(map[string][]byte{"nginx.conf": []byte(`http {
+    server {
+        location /api/v1 {
+        }
+        location /api/v2 {
+            proxy_set_header X-Request-ID $request_id;
+        }
+        location /api/public {
+        }
+        location / {
+        }
+    }
+}
+`)}, nginxconf.Options{ConfigDir: "/etc/nginx"}))
+	require.Len(t, res.Findings, 1)
+	assert.Equal(t, 3, res.Findings[0].Line)
+}
@@ -0,0 +1,142 @@
+package deploypolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	dayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// cronSchedule is a parsed 5-field cron expression (minute hour day-of-month month day-of-week).
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// domAny and dowAny record a "*" field; when both day fields are restricted,
+	// a time matches if either of them matches, like in crontab.
+	domAny, dowAny bool
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", spec)
+	}
+
+	var (
+		cs  cronSchedule
+		err error
+	)
+	if cs.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron expression %q: minute: %w", spec, err)
+	}
+	if cs.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron expression %q: hour: %w", spec, err)
+	}
+	if cs.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron expression %q: day of month: %w", spec, err)
+	}
+	if cs.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("cron expression %q: month: %w", spec, err)
+	}
+	if cs.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("cron expression %q: day of week: %w", spec, err)
+	}
+	// 7 is an alias for sunday
+	if cs.dow[7] {
+		cs.dow[0] = true
+	}
+	cs.domAny = fields[2] == "*"
+	cs.dowAny = fields[4] == "*"
+	return &cs, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges ("a-b") and steps ("*/n", "a-b/n").
+func parseCronField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseCronValue(startPart, names); err != nil {
+				return nil, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(endPart, names); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// matches reports whether the schedule fires at the minute of t.
+func (cs *cronSchedule) matches(t time.Time) bool {
+	if !cs.minute[t.Minute()] || !cs.hour[t.Hour()] || !cs.month[int(t.Month())] {
+		return false
+	}
+	domMatch := cs.dom[t.Day()]
+	dowMatch := cs.dow[int(t.Weekday())]
+	switch {
+	case cs.domAny && cs.dowAny:
+		return true
+	case cs.domAny:
+		return dowMatch
+	case cs.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// lastFire returns the most recent time in (t-window, t] at which the schedule fired.
+func (cs *cronSchedule) lastFire(t time.Time, window time.Duration) (time.Time, bool) {
+	start := t.Truncate(time.Minute)
+	for m := start; t.Sub(m) < window; m = m.Add(-time.Minute) {
+		if cs.matches(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,28 @@
+package deploypolicy
+
+import (
+	"fmt"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+)
+
+// CheckDeletes returns a violation when deleting files out of existing crosses the delete guard.
+func CheckDeletes(cfg config.DeleteGuardConfig, deleting, existing int) *Violation {
+	if cfg.MaxFiles > 0 && deleting > cfg.MaxFiles {
+		return &Violation{
+			Kind:    KindMassDelete,
+			Message: fmt.Sprintf("%d files would be deleted, more than the limit of %d", deleting, cfg.MaxFiles),
+		}
+	}
+	// A single deletion is always allowed, otherwise small trees could never lose a file
+	if cfg.MaxPercent > 0 && deleting > 1 && existing > 0 {
+		percent := float64(deleting) * 100 / float64(existing)
+		if percent > cfg.MaxPercent {
+			return &Violation{
+				Kind:    KindMassDelete,
+				Message: fmt.Sprintf("%d of %d files (%.0f%%) would be deleted, more than the limit of %.0f%%", deleting, existing, percent, cfg.MaxPercent),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package deploypolicy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+)
+
+// maxCronFreeze bounds the duration of a recurring freeze, which is also how far back
+// the schedule is searched for the start of the window.
+const maxCronFreeze = 31 * 24 * time.Hour
+
+// Violation kinds
+const (
+	KindFreeze       = "freeze"
+	KindOutsideHours = "outside_hours"
+	KindMassDelete   = "mass_delete"
+)
+
+// Violation explains why a deploy is not allowed at a given time.
+type Violation struct {
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name,omitempty"`
+	Message string    `json:"message"`
+	Until   time.Time `json:"until,omitempty"`
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Policy decides whether deploys to a group are allowed at a given time.
+type Policy struct {
+	loc          *time.Location
+	allowedHours []allowedHours
+	freezes      []freeze
+}
+
+type allowedHours struct {
+	groups     []string
+	days       map[time.Weekday]bool
+	start, end int // minutes since midnight, end exclusive
+	label      string
+}
+
+type freeze struct {
+	name     string
+	groups   []string
+	start    time.Time
+	end      time.Time
+	cron     *cronSchedule
+	duration time.Duration
+}
+
+// New parses the deploy policy configuration.
+func New(cfg config.DeployPolicyConfig) (*Policy, error) {
+	p := &Policy{loc: time.Local}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deploy policy timezone %q: %w", cfg.Timezone, err)
+		}
+		p.loc = loc
+	}
+
+	for i, ah := range cfg.AllowedHours {
+		parsed, err := parseAllowedHours(ah)
+		if err != nil {
+			return nil, fmt.Errorf("allowed_hours[%d]: %w", i, err)
+		}
+		p.allowedHours = append(p.allowedHours, parsed)
+	}
+
+	for i, fc := range cfg.Freezes {
+		parsed, err := p.parseFreeze(fc)
+		if err != nil {
+			return nil, fmt.Errorf("freezes[%d] %s: %w", i, fc.Name, err)
+		}
+		p.freezes = append(p.freezes, parsed)
+	}
+
+	return p, nil
+}
+
+// Check returns the violation that forbids deploying to group at now, or nil if deploys are allowed.
+// Freeze windows are checked first, then the allowed deploy hours.
+func (p *Policy) Check(group string, now time.Time) *Violation {
+	now = now.In(p.loc)
+
+	for _, f := range p.freezes {
+		if !appliesTo(f.groups, group) {
+			continue
+		}
+		if until, ok := f.activeUntil(now); ok {
+			return &Violation{
+				Kind:    KindFreeze,
+				Name:    f.name,
+				Message: fmt.Sprintf("deploys to %s are frozen by %q until %s", group, f.name, until.Format(time.RFC3339)),
+				Until:   until,
+			}
+		}
+	}
+
+	var windows []string
+	for _, ah := range p.allowedHours {
+		if !appliesTo(ah.groups, group) {
+			continue
+		}
+		if ah.contains(now) {
+			return nil
+		}
+		windows = append(windows, ah.label)
+	}
+	if len(windows) > 0 {
+		return &Violation{
+			Kind:    KindOutsideHours,
+			Message: fmt.Sprintf("deploys to %s are only allowed %s (now %s)", group, strings.Join(windows, " or "), now.Format("Mon 15:04 MST")),
+		}
+	}
+
+	return nil
+}
+
+func appliesTo(groups []string, group string) bool {
+	return len(groups) == 0 || slices.Contains(groups, group)
+}
+
+func parseAllowedHours(cfg config.AllowedHoursConfig) (allowedHours, error) {
+	ah := allowedHours{groups: cfg.Groups}
+
+	var err error
+	if ah.start, err = parseClock(cfg.Start); err != nil {
+		return ah, fmt.Errorf("start: %w", err)
+	}
+	if ah.end, err = parseClock(cfg.End); err != nil {
+		return ah, fmt.Errorf("end: %w", err)
+	}
+	if ah.start == ah.end {
+		return ah, fmt.Errorf("start and end must differ")
+	}
+
+	if len(cfg.Days) > 0 {
+		ah.days = make(map[time.Weekday]bool)
+		for _, day := range cfg.Days {
+			v, ok := dayNames[strings.ToLower(day)]
+			if !ok {
+				return ah, fmt.Errorf("invalid day %q", day)
+			}
+			ah.days[time.Weekday(v)] = true
+		}
+	}
+
+	days := "daily"
+	if len(cfg.Days) > 0 {
+		days = strings.Join(cfg.Days, ",")
+	}
+	ah.label = fmt.Sprintf("%s %s-%s", days, cfg.Start, cfg.End)
+	return ah, nil
+}
+
+// contains reports whether t falls in the window. Windows with end before start span midnight
+// and belong to the day they start on.
+func (ah allowedHours) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if ah.start < ah.end {
+		return ah.dayAllowed(day) && minute >= ah.start && minute < ah.end
+	}
+	if minute >= ah.start {
+		return ah.dayAllowed(day)
+	}
+	return minute < ah.end && ah.dayAllowed((day+6)%7)
+}
+
+func (ah allowedHours) dayAllowed(day time.Weekday) bool {
+	return ah.days == nil || ah.days[day]
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (p *Policy) parseFreeze(cfg config.FreezeConfig) (freeze, error) {
+	f := freeze{name: cfg.Name, groups: cfg.Groups}
+	if f.name == "" {
+		f.name = "freeze"
+	}
+
+	if cfg.Cron != "" {
+		if cfg.Start != "" || cfg.End != "" {
+			return f, fmt.Errorf("cron and start/end are mutually exclusive")
+		}
+		cs, err := parseCron(cfg.Cron)
+		if err != nil {
+			return f, err
+		}
+		d, err := time.ParseDuration(cfg.Duration)
+		if err != nil || d <= 0 {
+			return f, fmt.Errorf("invalid duration %q", cfg.Duration)
+		}
+		if d > maxCronFreeze {
+			return f, fmt.Errorf("duration %s exceeds %s", d, maxCronFreeze)
+		}
+		f.cron = cs
+		f.duration = d
+		return f, nil
+	}
+
+	if cfg.Start == "" || cfg.End == "" {
+		return f, fmt.Errorf("either cron and duration or start and end are required")
+	}
+	var err error
+	if f.start, err = p.parseDate(cfg.Start, false); err != nil {
+		return f, fmt.Errorf("start: %w", err)
+	}
+	if f.end, err = p.parseDate(cfg.End, true); err != nil {
+		return f, fmt.Errorf("end: %w", err)
+	}
+	if !f.end.After(f.start) {
+		return f, fmt.Errorf("end must be after start")
+	}
+	return f, nil
+}
+
+// parseDate accepts RFC3339 timestamps and plain dates; a plain end date includes the whole day.
+func (p *Policy) parseDate(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, p.loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// activeUntil reports whether the freeze covers t and when it ends.
+func (f freeze) activeUntil(t time.Time) (time.Time, bool) {
+	if f.cron != nil {
+		fired, ok := f.cron.lastFire(t, f.duration)
+		if !ok {
+			return time.Time{}, false
+		}
+		return fired.Add(f.duration), true
+	}
+	if !t.Before(f.start) && t.Before(f.end) {
+		return f.end, true
+	}
+	return time.Time{}, false
+}
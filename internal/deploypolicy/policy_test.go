@@ -0,0 +1,121 @@
+package deploypolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := New(config.DeployPolicyConfig{
+		Timezone: "UTC",
+		AllowedHours: []config.AllowedHoursConfig{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00"},
+			{Groups: []string{"batch"}, Start: "22:00", End: "02:00"},
+		},
+		Freezes: []config.FreezeConfig{
+			{Name: "new-year", Start: "2026-12-24", End: "2027-01-01"},
+			{Name: "weekend", Groups: []string{"web"}, Cron: "0 17 * * fri", Duration: "64h"},
+		},
+	})
+	require.NoError(t, err)
+
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts
+	}
+
+	tests := []struct {
+		name  string
+		group string
+		now   string
+		kind  string
+	}{
+		{"within allowed hours", "api", "2026-10-14T10:00:00Z", ""},
+		{"before allowed hours", "api", "2026-10-14T08:59:00Z", KindOutsideHours},
+		{"weekend is outside allowed hours", "api", "2026-10-17T10:00:00Z", KindOutsideHours},
+		{"date range freeze", "api", "2026-12-28T10:00:00Z", KindFreeze},
+		{"date range end is inclusive", "api", "2027-01-01T23:59:00Z", KindFreeze},
+		{"after date range freeze", "api", "2027-01-04T10:00:00Z", ""},
+		{"cron freeze starts", "web", "2026-10-16T17:00:00Z", KindFreeze},
+		{"cron freeze spans the weekend", "web", "2026-10-19T08:59:00Z", KindFreeze},
+		{"cron freeze ended", "web", "2026-10-19T09:00:00Z", ""},
+		{"cron freeze is group scoped", "api", "2026-10-16T17:30:00Z", ""},
+		{"window spanning midnight", "batch", "2026-10-17T01:00:00Z", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := policy.Check(tt.group, at(tt.now))
+			if tt.kind == "" {
+				assert.Nil(t, v)
+				return
+			}
+			require.NotNil(t, v)
+			assert.Equal(t, tt.kind, v.Kind)
+		})
+	}
+
+	v := policy.Check("web", at("2026-10-17T12:00:00Z"))
+	require.NotNil(t, v)
+	assert.Equal(t, "weekend", v.Name)
+	assert.Equal(t, at("2026-10-19T09:00:00Z"), v.Until)
+}
+
+func TestParseCron(t *testing.T) {
+	cs, err := parseCron("*/15 9-17 1,15 * mon-fri")
+	require.NoError(t, err)
+
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts
+	}
+	// Both day fields are restricted: either one matching is enough
+	assert.True(t, cs.matches(at("2026-10-15T09:30:00Z")))  // thursday
+	assert.True(t, cs.matches(at("2026-11-15T09:45:00Z")))  // sunday, 15th
+	assert.False(t, cs.matches(at("2026-10-18T09:30:00Z"))) // sunday, 18th
+	assert.False(t, cs.matches(at("2026-10-15T09:10:00Z")))
+	assert.False(t, cs.matches(at("2026-10-15T18:00:00Z")))
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * * funday", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := parseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	for _, cfg := range []config.DeployPolicyConfig{
+		{Timezone: "Nowhere/Nope"},
+		{AllowedHours: []config.AllowedHoursConfig{{Start: "9am", End: "18:00"}}},
+		{Freezes: []config.FreezeConfig{{Name: "x", Cron: "0 0 * * *"}}},
+		{Freezes: []config.FreezeConfig{{Name: "x", Start: "2026-01-02", End: "2026-01-01"}}},
+		{Freezes: []config.FreezeConfig{{Name: "x"}}},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err)
+	}
+}
+
+func TestCheckDeletes(t *testing.T) {
+	guard := config.DeleteGuardConfig{MaxFiles: 10, MaxPercent: 50}
+
+	assert.Nil(t, CheckDeletes(guard, 0, 0))
+	assert.Nil(t, CheckDeletes(guard, 1, 1), "a single deletion is always allowed")
+	assert.Nil(t, CheckDeletes(guard, 5, 10))
+
+	v := CheckDeletes(guard, 6, 10)
+	require.NotNil(t, v)
+	assert.Equal(t, KindMassDelete, v.Kind)
+	assert.Contains(t, v.Message, "6 of 10 files (60%)")
+
+	v = CheckDeletes(guard, 11, 100)
+	require.NotNil(t, v)
+	assert.Contains(t, v.Message, "more than the limit of 10")
+
+	assert.Nil(t, CheckDeletes(config.DeleteGuardConfig{}, 100, 100), "zero limits disable the guard")
+}
@@ -2,7 +2,10 @@ package etcd
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/logn-xu/gitops-nginx/internal/config"
@@ -45,3 +48,82 @@ func (c *Client) GetPrefix(ctx context.Context, key string) (*clientv3.GetRespon
 func (c *Client) Delete(ctx context.Context, key string) (*clientv3.DeleteResponse, error) {
 	return c.Client.Delete(ctx, key)
 }
+
+// DeletePrefix removes all keys with a given prefix.
+func (c *Client) DeletePrefix(ctx context.Context, key string) (*clientv3.DeleteResponse, error) {
+	return c.Client.Delete(ctx, key, clientv3.WithPrefix())
+}
+
+// GetFiles returns the file contents stored under prefix keyed by path relative to prefix,
+// leaving out metadata keys.
+func (c *Client) GetFiles(ctx context.Context, prefix string) (map[string][]byte, error) {
+	resp, err := c.GetPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		if IsMetaKey(key) {
+			continue
+		}
+		relPath := strings.TrimPrefix(key, prefix)
+		relPath = strings.TrimPrefix(relPath, "/")
+		if relPath == "" {
+			continue
+		}
+		files[relPath] = kv.Value
+	}
+	return files, nil
+}
+
+// GetFileHashes returns the md5 hash of every file stored under prefix keyed by path relative
+// to prefix. The recorded .hash value is used when present, otherwise the content is hashed.
+func (c *Client) GetFileHashes(ctx context.Context, prefix string) (map[string]string, error) {
+	resp, err := c.GetPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]string)
+	contents := make(map[string][]byte)
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		if strings.HasSuffix(key, ".hash") {
+			recorded[strings.TrimSuffix(key, ".hash")] = string(kv.Value)
+			continue
+		}
+		if !IsMetaKey(key) {
+			contents[key] = kv.Value
+		}
+	}
+
+	hashes := make(map[string]string, len(contents))
+	for key, content := range contents {
+		relPath := strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+		if relPath == "" {
+			continue
+		}
+		hash, ok := recorded[key]
+		if !ok {
+			sum := md5.Sum(content)
+			hash = hex.EncodeToString(sum[:])
+		}
+		hashes[relPath] = hash
+	}
+	return hashes, nil
+}
+
+// MetaSuffixes lists the suffixes of the metadata keys stored next to each file key.
+var MetaSuffixes = []string{".hash", ".commit", ".meta", ".error"}
+
+// IsMetaKey reports whether key holds file metadata rather than file content.
+func IsMetaKey(key string) bool {
+	for _, suffix := range MetaSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+// Package etcdtest provides an in-memory etcd client for tests that need a state store or
+// file prefixes without a running etcd server.
+package etcdtest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// KV is an in-memory implementation of the etcd key-value API. It supports single keys,
+// ranges and prefixes; transaction conditions can only compare the mod revision of a key.
+type KV struct {
+	mu    sync.Mutex
+	txnMu sync.Mutex // serializes transactions
+	data  map[string]entry
+	rev   int64
+
+	// FailPut, when set, is called before every put and fails it with the returned error.
+	FailPut func(key string) error
+}
+
+// entry is a stored value and the revision of its last put.
+type entry struct {
+	value       []byte
+	modRevision int64
+}
+
+// NewClient returns an etcd client backed by a new in-memory KV.
+func NewClient() (*etcd.Client, *KV) {
+	kv := &KV{data: make(map[string]entry)}
+	return &etcd.Client{Client: &clientv3.Client{KV: kv}}, kv
+}
+
+// Keys returns every stored key, sorted.
+func (kv *KV) Keys() []string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// match returns the sorted keys selected by op.
+func (kv *KV) match(op clientv3.Op) []string {
+	key := string(op.KeyBytes())
+	end := op.RangeBytes()
+	var keys []string
+	for k := range kv.data {
+		switch {
+		case end == nil:
+			if k != key {
+				continue
+			}
+		case string(end) == "\x00":
+			if k < key {
+				continue
+			}
+		default:
+			if k < key || k >= string(end) {
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (kv *KV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	if kv.FailPut != nil {
+		if err := kv.FailPut(key); err != nil {
+			return nil, err
+		}
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.rev++
+	kv.data[key] = entry{value: []byte(val), modRevision: kv.rev}
+	return &clientv3.PutResponse{}, nil
+}
+
+func (kv *KV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	resp := &clientv3.GetResponse{}
+	for _, k := range kv.match(clientv3.OpGet(key, opts...)) {
+		e := kv.data[k]
+		resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: e.value, ModRevision: e.modRevision})
+	}
+	resp.Count = int64(len(resp.Kvs))
+	return resp, nil
+}
+
+func (kv *KV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	resp := &clientv3.DeleteResponse{}
+	for _, k := range kv.match(clientv3.OpDelete(key, opts...)) {
+		delete(kv.data, k)
+		resp.Deleted++
+	}
+	if resp.Deleted > 0 {
+		kv.rev++
+	}
+	return resp, nil
+}
+
+func (kv *KV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return &clientv3.CompactResponse{}, nil
+}
+
+func (kv *KV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	key := string(op.KeyBytes())
+	var opts []clientv3.OpOption
+	if end := op.RangeBytes(); end != nil {
+		opts = append(opts, clientv3.WithRange(string(end)))
+	}
+	switch {
+	case op.IsGet():
+		resp, err := kv.Get(ctx, key, opts...)
+		if err != nil {
+			return clientv3.OpResponse{}, err
+		}
+		return resp.OpResponse(), nil
+	case op.IsPut():
+		resp, err := kv.Put(ctx, key, string(op.ValueBytes()))
+		if err != nil {
+			return clientv3.OpResponse{}, err
+		}
+		return resp.OpResponse(), nil
+	case op.IsDelete():
+		resp, err := kv.Delete(ctx, key, opts...)
+		if err != nil {
+			return clientv3.OpResponse{}, err
+		}
+		return resp.OpResponse(), nil
+	}
+	return clientv3.OpResponse{}, errors.New("etcdtest: unsupported operation")
+}
+
+func (kv *KV) Txn(ctx context.Context) clientv3.Txn {
+	return &txn{kv: kv, ctx: ctx}
+}
+
+// txn applies its Then operations in order if every condition holds, its Else operations
+// otherwise. Transactions are atomic with respect to each other, not to single operations.
+type txn struct {
+	kv      *KV
+	ctx     context.Context
+	cmps    []clientv3.Cmp
+	ops     []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+func (t *txn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *txn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.ops = append(t.ops, ops...)
+	return t
+}
+
+func (t *txn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+func (t *txn) Commit() (*clientv3.TxnResponse, error) {
+	t.kv.txnMu.Lock()
+	defer t.kv.txnMu.Unlock()
+	succeeded := true
+	for _, cmp := range t.cmps {
+		ok, err := t.kv.compare(pb.Compare(cmp))
+		if err != nil {
+			return nil, err
+		}
+		succeeded = succeeded && ok
+	}
+	ops := t.ops
+	if !succeeded {
+		ops = t.elseOps
+	}
+	for _, op := range ops {
+		if _, err := t.kv.Do(t.ctx, op); err != nil {
+			return nil, err
+		}
+	}
+	return &clientv3.TxnResponse{Succeeded: succeeded}, nil
+}
+
+// compare evaluates a transaction condition on the mod revision of a key, 0 for a missing key.
+func (kv *KV) compare(cmp pb.Compare) (bool, error) {
+	if cmp.Target != pb.Compare_MOD || len(cmp.RangeEnd) > 0 {
+		return false, errors.New("etcdtest: only mod revision conditions on single keys are supported")
+	}
+	kv.mu.Lock()
+	rev := kv.data[string(cmp.Key)].modRevision
+	kv.mu.Unlock()
+	want := cmp.GetModRevision()
+	switch cmp.Result {
+	case pb.Compare_EQUAL:
+		return rev == want, nil
+	case pb.Compare_NOT_EQUAL:
+		return rev != want, nil
+	case pb.Compare_GREATER:
+		return rev > want, nil
+	case pb.Compare_LESS:
+		return rev < want, nil
+	}
+	return false, errors.New("etcdtest: unsupported comparison")
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+)
+
+// ErrNotFastForward is returned when a promotion would rewrite the history of the target branch.
+var ErrNotFastForward = errors.New("not a fast-forward")
+
+// ErrTagExists is returned when a promotion tag already exists locally or on the remote.
+var ErrTagExists = errors.New("tag already exists")
+
+// GroupRef returns the ref a group tracks: its own ref or branch, falling back to git.branch.
+func GroupRef(cfg *config.GitConfig, group *config.NginxServerGroup) string {
+	if group != nil && group.Ref != "" {
+		return group.Ref
+	}
+	if group != nil && group.Branch != "" {
+		return group.Branch
+	}
+	return defaultBranch(cfg)
+}
+
+// ResolveGroupCommit returns the commit a group currently tracks.
+// A group ref (tag or commit) wins over a group branch, which wins over git.branch.
+// Group branches other than git.branch are read from their remote-tracking reference,
+// since only git.branch is checked out and pulled.
+func ResolveGroupCommit(repo *Repository, cfg *config.GitConfig, group *config.NginxServerGroup) (*object.Commit, error) {
+	var hash plumbing.Hash
+	switch refName := GroupRef(cfg, group); {
+	case group != nil && group.Ref != "":
+		h, err := repo.ResolveRevision(plumbing.Revision(refName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve ref %s: %w", refName, err)
+		}
+		hash = *h
+	case refName != defaultBranch(cfg):
+		ref, err := repo.Reference(plumbing.NewRemoteReferenceName(RemoteName(cfg), refName), true)
+		if err != nil {
+			ref, err = repo.Reference(plumbing.NewBranchReferenceName(refName), true)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get branch %s: %w", refName, err)
+		}
+		hash = ref.Hash()
+	default:
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(refName), true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get branch %s: %w", refName, err)
+		}
+		hash = ref.Hash()
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object %s: %w", hash.String(), err)
+	}
+	return commit, nil
+}
+
+// FastForwardBranch moves branch on the remote to target, refusing anything but a fast-forward.
+func FastForwardBranch(cfg *config.GitConfig, repo *Repository, branch string, target plumbing.Hash) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	targetCommit, err := repo.CommitObject(target)
+	if err != nil {
+		return fmt.Errorf("failed to get commit object %s: %w", target, err)
+	}
+
+	current, err := repo.Reference(plumbing.NewRemoteReferenceName(RemoteName(cfg), branch), true)
+	if err == nil {
+		if current.Hash() == target {
+			return nil
+		}
+		currentCommit, err := repo.CommitObject(current.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to get commit object %s: %w", current.Hash(), err)
+		}
+		ok, err := currentCommit.IsAncestor(targetCommit)
+		if err != nil {
+			return fmt.Errorf("failed to check ancestry: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: branch %s at %s is not an ancestor of %s", ErrNotFastForward, branch, current.Hash(), target)
+		}
+	}
+
+	refSpec := gitconfig.RefSpec(fmt.Sprintf("%s:%s", target, plumbing.NewBranchReferenceName(branch)))
+	return push(cfg, repo, refSpec)
+}
+
+// PushTag creates a lightweight tag at target and pushes it to the remote. An existing tag is
+// never moved: ErrTagExists is returned if the tag exists locally or on the remote.
+func PushTag(cfg *config.GitConfig, repo *Repository, name string, target plumbing.Hash) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	// The remote is asked explicitly, a plain push would move a tag that is an ancestor of target
+	tagRef := plumbing.NewTagReferenceName(name)
+	if _, err := repo.Reference(tagRef, false); err == nil {
+		return fmt.Errorf("%w: %s", ErrTagExists, name)
+	}
+	exists, err := remoteHasRef(cfg, repo, tagRef)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s on remote %s", ErrTagExists, name, RemoteName(cfg))
+	}
+
+	if _, err := repo.CreateTag(name, target, nil); err != nil {
+		return fmt.Errorf("failed to create tag %s: %w", name, err)
+	}
+	if err := push(cfg, repo, gitconfig.RefSpec(fmt.Sprintf("%s:%s", tagRef, tagRef))); err != nil {
+		_ = repo.DeleteTag(name)
+		return err
+	}
+	return nil
+}
+
+// remoteHasRef reports whether the remote has the reference name.
+func remoteHasRef(cfg *config.GitConfig, repo *Repository, name plumbing.ReferenceName) (bool, error) {
+	remote, err := repo.Remote(RemoteName(cfg))
+	if err != nil {
+		return false, fmt.Errorf("failed to get remote %s: %w", RemoteName(cfg), err)
+	}
+	auth, err := getAuth(cfg)
+	if err != nil {
+		return false, fmt.Errorf("failed to get git auth: %w", err)
+	}
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return false, fmt.Errorf("failed to list remote %s: %w", RemoteName(cfg), err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func push(cfg *config.GitConfig, repo *Repository, refSpec gitconfig.RefSpec) error {
+	auth, err := getAuth(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get git auth: %w", err)
+	}
+	err = repo.Push(&git.PushOptions{
+		RemoteName: RemoteName(cfg),
+		Auth:       auth,
+		RefSpecs:   []gitconfig.RefSpec{refSpec},
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to push %s: %w", refSpec, err)
+	}
+	return nil
+}
+
+func defaultBranch(cfg *config.GitConfig) string {
+	if cfg.Branch != "" {
+		return cfg.Branch
+	}
+	return "master"
+}
+
+// RemoteName returns the git remote the repository is cloned from, pulled from and pushed to.
+func RemoteName(cfg *config.GitConfig) string {
+	if cfg.RemoteName != "" {
+		return cfg.RemoteName
+	}
+	return "origin"
+}
@@ -0,0 +1,139 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commitOn stores a commit with the tree of parent on top of it, without touching the worktree.
+func commitOn(t *testing.T, repo *Repository, parent plumbing.Hash, message string) plumbing.Hash {
+	t.Helper()
+	parentCommit, err := repo.CommitObject(parent)
+	require.NoError(t, err)
+	sig := object.Signature{Name: "dev", Email: "dev@example.com", When: time.Now()}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      message,
+		TreeHash:     parentCommit.TreeHash,
+		ParentHashes: []plumbing.Hash{parent},
+	}
+	obj := repo.Storer.NewEncodedObject()
+	require.NoError(t, commit.Encode(obj))
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	require.NoError(t, err)
+	return hash
+}
+
+func remoteRef(t *testing.T, bareDir string, name plumbing.ReferenceName) plumbing.Hash {
+	t.Helper()
+	bare, err := git.PlainOpen(bareDir)
+	require.NoError(t, err)
+	ref, err := bare.Reference(name, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash
+	}
+	require.NoError(t, err)
+	return ref.Hash()
+}
+
+func TestFastForwardBranch(t *testing.T) {
+	cfg, repo, bareDir := newClonedRepo(t)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	staging := plumbing.NewBranchReferenceName("staging")
+
+	// A missing branch is created
+	c1 := commitOn(t, repo, head.Hash(), "c1")
+	require.NoError(t, FastForwardBranch(cfg, repo, "staging", c1))
+	assert.Equal(t, c1, remoteRef(t, bareDir, staging))
+
+	// A descendant fast-forwards the branch, the same commit is a no-op
+	_, err = SyncRepository(cfg)
+	require.NoError(t, err)
+	c2 := commitOn(t, repo, c1, "c2")
+	require.NoError(t, FastForwardBranch(cfg, repo, "staging", c2))
+	assert.Equal(t, c2, remoteRef(t, bareDir, staging))
+	_, err = SyncRepository(cfg)
+	require.NoError(t, err)
+	require.NoError(t, FastForwardBranch(cfg, repo, "staging", c2))
+	assert.Equal(t, c2, remoteRef(t, bareDir, staging))
+}
+
+func TestFastForwardBranchRejectsNonFastForward(t *testing.T) {
+	cfg, repo, bareDir := newClonedRepo(t)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	master := plumbing.NewBranchReferenceName("master")
+
+	c1 := commitOn(t, repo, head.Hash(), "c1")
+	require.NoError(t, FastForwardBranch(cfg, repo, "master", c1))
+	_, err = SyncRepository(cfg)
+	require.NoError(t, err)
+
+	// A sibling of the branch head would drop c1
+	sibling := commitOn(t, repo, head.Hash(), "sibling")
+	err = FastForwardBranch(cfg, repo, "master", sibling)
+	assert.ErrorIs(t, err, ErrNotFastForward)
+	assert.Equal(t, c1, remoteRef(t, bareDir, master))
+
+	// An older commit would move the branch backwards
+	err = FastForwardBranch(cfg, repo, "master", head.Hash())
+	assert.ErrorIs(t, err, ErrNotFastForward)
+	assert.Equal(t, c1, remoteRef(t, bareDir, master))
+}
+
+func TestFastForwardBranchStaleTrackingRef(t *testing.T) {
+	cfg, repo, bareDir := newClonedRepo(t)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	master := plumbing.NewBranchReferenceName("master")
+
+	// Another clone moved the branch after the last fetch
+	otherCfg := *cfg
+	otherCfg.RepoPath = filepath.Join(t.TempDir(), "other")
+	other, err := SyncRepository(&otherCfg)
+	require.NoError(t, err)
+	moved := commitOn(t, other, head.Hash(), "moved")
+	require.NoError(t, FastForwardBranch(&otherCfg, other, "master", moved))
+
+	sibling := commitOn(t, repo, head.Hash(), "sibling")
+	err = FastForwardBranch(cfg, repo, "master", sibling)
+	require.Error(t, err)
+	assert.Equal(t, moved, remoteRef(t, bareDir, master))
+}
+
+func TestPushTag(t *testing.T) {
+	cfg, repo, bareDir := newClonedRepo(t)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	tag := plumbing.NewTagReferenceName("promote/web/1")
+
+	require.NoError(t, PushTag(cfg, repo, "promote/web/1", head.Hash()))
+	assert.Equal(t, head.Hash(), remoteRef(t, bareDir, tag))
+
+	// An existing tag is never moved
+	c1 := commitOn(t, repo, head.Hash(), "c1")
+	err = PushTag(cfg, repo, "promote/web/1", c1)
+	assert.ErrorIs(t, err, ErrTagExists)
+	assert.Equal(t, head.Hash(), remoteRef(t, bareDir, tag))
+
+	// So is a tag another clone pushed, and the rejected tag is not left behind locally
+	otherCfg := *cfg
+	otherCfg.RepoPath = filepath.Join(t.TempDir(), "other")
+	other, err := SyncRepository(&otherCfg)
+	require.NoError(t, err)
+	require.NoError(t, PushTag(&otherCfg, other, "promote/web/2", head.Hash()))
+	err = PushTag(cfg, repo, "promote/web/2", c1)
+	assert.ErrorIs(t, err, ErrTagExists)
+	assert.Equal(t, head.Hash(), remoteRef(t, bareDir, plumbing.NewTagReferenceName("promote/web/2")))
+	_, err = repo.Tag("promote/web/2")
+	assert.ErrorIs(t, err, git.ErrTagNotFound)
+}
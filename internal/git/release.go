@@ -0,0 +1,339 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// Release policy modes
+const (
+	ReleaseModeHead   = ""
+	ReleaseModeTag    = "tag"
+	ReleaseModeSigned = "signed"
+)
+
+const (
+	pgpSignaturePrefix = "-----BEGIN PGP SIGNATURE-----"
+	sshSignaturePrefix = "-----BEGIN SSH SIGNATURE-----"
+	sshSigNamespace    = "git"
+)
+
+// ReleaseState is the result of evaluating the release policy against a branch.
+type ReleaseState struct {
+	Mode string
+	// Deployable is the newest commit on the branch that satisfies the policy, nil if none does.
+	Deployable *object.Commit
+	// Pending holds the commits newer than Deployable that do not satisfy the policy, newest first.
+	Pending []*object.Commit
+}
+
+// ResolveRelease walks the first-parent history of head and returns the newest commit that
+// satisfies the release policy, together with the newer commits that are still pending.
+func ResolveRelease(repo *Repository, cfg *config.ReleaseConfig, head *object.Commit) (*ReleaseState, error) {
+	state := &ReleaseState{Mode: cfg.Mode}
+
+	qualifies, err := releaseQualifier(repo, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if qualifies == nil {
+		state.Deployable = head
+		return state, nil
+	}
+
+	maxDepth := cfg.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = 100
+	}
+
+	commit := head
+	for depth := 0; commit != nil && depth < maxDepth; depth++ {
+		ok, err := qualifies(commit)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			state.Deployable = commit
+			return state, nil
+		}
+		state.Pending = append(state.Pending, commit)
+
+		if commit.NumParents() == 0 {
+			break
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent of commit %s: %w", commit.Hash, err)
+		}
+		commit = parent
+	}
+
+	return state, nil
+}
+
+// IsReleasable reports whether commit itself satisfies the release policy. Commits that reach
+// production without walking a branch, such as pinned commits, must pass the same check.
+func IsReleasable(repo *Repository, cfg *config.ReleaseConfig, commit *object.Commit) (bool, error) {
+	qualifies, err := releaseQualifier(repo, cfg)
+	if err != nil {
+		return false, err
+	}
+	if qualifies == nil {
+		return true, nil
+	}
+	return qualifies(commit)
+}
+
+// releaseQualifier returns the check a commit must pass under the release policy, nil when
+// every commit qualifies.
+func releaseQualifier(repo *Repository, cfg *config.ReleaseConfig) (func(*object.Commit) (bool, error), error) {
+	switch cfg.Mode {
+	case ReleaseModeHead:
+		return nil, nil
+	case ReleaseModeTag:
+		tagged, err := taggedCommits(repo, cfg.TagPattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(c *object.Commit) (bool, error) {
+			_, ok := tagged[c.Hash]
+			return ok, nil
+		}, nil
+	case ReleaseModeSigned:
+		verifier, err := newSignatureVerifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return verifier.verify, nil
+	}
+	return nil, fmt.Errorf("unsupported release mode: %s", cfg.Mode)
+}
+
+// taggedCommits returns the commits pointed to by tags whose name matches pattern.
+func taggedCommits(repo *Repository, pattern string) (map[plumbing.Hash][]string, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := matchTag(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid tag_pattern %q: %w", pattern, err)
+	}
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer iter.Close()
+
+	tagged := make(map[plumbing.Hash][]string)
+	for {
+		ref, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to iterate tags: %w", err)
+		}
+
+		name := ref.Name().Short()
+		if matched, _ := matchTag(pattern, name); !matched {
+			continue
+		}
+
+		// Annotated tags point to a tag object, lightweight tags point to the commit
+		target := ref.Hash()
+		if tag, err := repo.TagObject(target); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				continue
+			}
+			target = commit.Hash
+		}
+		tagged[target] = append(tagged[target], name)
+	}
+	return tagged, nil
+}
+
+// matchTag reports whether a tag name matches pattern. Patterns use the path.Match syntax, but
+// like "git tag --list" the wildcards also match "/": "release*" matches "release/1.2" and
+// "release/*" matches "release/2024/1".
+func matchTag(pattern, name string) (bool, error) {
+	// path.Match stops wildcards at "/", so swap it for a byte that cannot appear in a ref name
+	const sep = "\x00"
+	return path.Match(strings.ReplaceAll(pattern, "/", sep), strings.ReplaceAll(name, "/", sep))
+}
+
+// signatureVerifier verifies GPG and SSH commit signatures against the configured keys.
+type signatureVerifier struct {
+	pgpKeyring     string
+	allowedSigners []ssh.PublicKey
+}
+
+func newSignatureVerifier(cfg *config.ReleaseConfig) (*signatureVerifier, error) {
+	if cfg.KeyringPath == "" && cfg.AllowedSignersPath == "" {
+		return nil, fmt.Errorf("release mode %q requires keyring_path or allowed_signers_path", cfg.Mode)
+	}
+
+	v := &signatureVerifier{}
+	if cfg.KeyringPath != "" {
+		keyring, err := os.ReadFile(cfg.KeyringPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring %s: %w", cfg.KeyringPath, err)
+		}
+		v.pgpKeyring = string(keyring)
+	}
+	if cfg.AllowedSignersPath != "" {
+		keys, err := loadAllowedSigners(cfg.AllowedSignersPath)
+		if err != nil {
+			return nil, err
+		}
+		v.allowedSigners = keys
+	}
+	return v, nil
+}
+
+// verify reports whether the commit carries a valid signature from an allowed key.
+// Invalid or unknown signatures are not an error, the commit simply does not qualify.
+func (v *signatureVerifier) verify(c *object.Commit) (bool, error) {
+	signature := strings.TrimSpace(c.PGPSignature)
+	switch {
+	case strings.HasPrefix(signature, pgpSignaturePrefix):
+		if v.pgpKeyring == "" {
+			return false, nil
+		}
+		_, err := c.Verify(v.pgpKeyring)
+		return err == nil, nil
+	case strings.HasPrefix(signature, sshSignaturePrefix):
+		if len(v.allowedSigners) == 0 {
+			return false, nil
+		}
+		payload := &plumbing.MemoryObject{}
+		if err := c.EncodeWithoutSignature(payload); err != nil {
+			return false, fmt.Errorf("failed to encode commit %s: %w", c.Hash, err)
+		}
+		reader, err := payload.Reader()
+		if err != nil {
+			return false, err
+		}
+		defer reader.Close()
+		message, err := io.ReadAll(reader)
+		if err != nil {
+			return false, err
+		}
+		return verifySSHSignature(signature, message, v.allowedSigners), nil
+	default:
+		return false, nil
+	}
+}
+
+// loadAllowedSigners parses an ssh allowed_signers file ("principals [options] keytype key [comment]").
+func loadAllowedSigners(filePath string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowed signers %s: %w", filePath, err)
+	}
+
+	var keys []ssh.PublicKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Drop the principals field, the rest has the authorized_keys format
+		_, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse allowed signer %q: %w", line, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read allowed signers %s: %w", filePath, err)
+	}
+	return keys, nil
+}
+
+// verifySSHSignature verifies an armored SSHSIG signature (as produced by "ssh-keygen -Y sign")
+// over message and reports whether it was made by one of the allowed keys.
+func verifySSHSignature(armored string, message []byte, allowed []ssh.PublicKey) bool {
+	var body strings.Builder
+	for _, line := range strings.Split(armored, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-----") {
+			continue
+		}
+		body.WriteString(line)
+	}
+	blob, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil || !bytes.HasPrefix(blob, []byte("SSHSIG")) {
+		return false
+	}
+
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(blob[6:], &sig); err != nil || sig.Version != 1 || sig.Namespace != sshSigNamespace {
+		return false
+	}
+
+	pubKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return false
+	}
+	isAllowed := false
+	for _, key := range allowed {
+		if bytes.Equal(key.Marshal(), pubKey.Marshal()) {
+			isAllowed = true
+			break
+		}
+	}
+	if !isAllowed {
+		return false
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return false
+	}
+	h.Write(message)
+
+	signed := ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return false
+	}
+	return pubKey.Verify(append([]byte("SSHSIG"), signed...), &signature) == nil
+}
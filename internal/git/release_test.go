@@ -0,0 +1,354 @@
+package git
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testRepo is a throwaway repository with helpers to create commits and tags.
+type testRepo struct {
+	t    *testing.T
+	repo *Repository
+	n    int
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	r, err := git.PlainInit(t.TempDir(), false)
+	require.NoError(t, err)
+	return &testRepo{t: t, repo: &Repository{r}}
+}
+
+// commit writes a file and commits it, signed with signer when not nil.
+func (tr *testRepo) commit(signer git.Signer) *object.Commit {
+	tr.t.Helper()
+	tr.n++
+	w, err := tr.repo.Worktree()
+	require.NoError(tr.t, err)
+	name := filepath.Join(w.Filesystem.Root(), "nginx.conf")
+	require.NoError(tr.t, os.WriteFile(name, []byte(strings.Repeat("#\n", tr.n)), 0o644))
+	_, err = w.Add("nginx.conf")
+	require.NoError(tr.t, err)
+
+	hash, err := w.Commit("change "+string(rune('0'+tr.n)), &git.CommitOptions{
+		Author: &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Unix(int64(1700000000+tr.n), 0)},
+		Signer: signer,
+	})
+	require.NoError(tr.t, err)
+	c, err := tr.repo.CommitObject(hash)
+	require.NoError(tr.t, err)
+	return c
+}
+
+func (tr *testRepo) tag(name string, c *object.Commit, annotated bool) {
+	tr.t.Helper()
+	var opts *git.CreateTagOptions
+	if annotated {
+		opts = &git.CreateTagOptions{
+			Message: name,
+			Tagger:  &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Unix(1700000000, 0)},
+		}
+	}
+	_, err := tr.repo.CreateTag(name, c.Hash, opts)
+	require.NoError(tr.t, err)
+}
+
+func hashes(commits []*object.Commit) []plumbing.Hash {
+	var out []plumbing.Hash
+	for _, c := range commits {
+		out = append(out, c.Hash)
+	}
+	return out
+}
+
+// sshKey is an ed25519 key pair generated with ssh-keygen, which also signs like "git commit -S".
+type sshKey struct {
+	privateFile string
+	publicLine  string
+}
+
+func newSSHKey(t *testing.T) *sshKey {
+	t.Helper()
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "dev@example.com", "-f", file).CombinedOutput()
+	require.NoError(t, err, string(out))
+	pub, err := os.ReadFile(file + ".pub")
+	require.NoError(t, err)
+	return &sshKey{privateFile: file, publicLine: strings.TrimSpace(string(pub))}
+}
+
+// signer returns a signer using the given SSHSIG namespace, "git" for commits.
+func (k *sshKey) signer(namespace string) git.Signer {
+	return sshKeygenSigner{key: k, namespace: namespace}
+}
+
+type sshKeygenSigner struct {
+	key       *sshKey
+	namespace string
+}
+
+func (s sshKeygenSigner) Sign(message io.Reader) ([]byte, error) {
+	cmd := exec.Command("ssh-keygen", "-q", "-Y", "sign", "-n", s.namespace, "-f", s.key.privateFile)
+	cmd.Stdin = message
+	return cmd.Output()
+}
+
+func writeAllowedSigners(t *testing.T, keys ...*sshKey) string {
+	t.Helper()
+	var buf strings.Builder
+	buf.WriteString("# release signers\n\n")
+	for i, k := range keys {
+		if i%2 == 1 {
+			buf.WriteString(`dev@example.com namespaces="git" ` + k.publicLine + "\n")
+		} else {
+			buf.WriteString("dev@example.com " + k.publicLine + "\n")
+		}
+	}
+	file := filepath.Join(t.TempDir(), "allowed_signers")
+	require.NoError(t, os.WriteFile(file, []byte(buf.String()), 0o644))
+	return file
+}
+
+func TestResolveReleaseHead(t *testing.T) {
+	tr := newTestRepo(t)
+	tr.commit(nil)
+	head := tr.commit(nil)
+
+	state, err := ResolveRelease(tr.repo, &config.ReleaseConfig{}, head)
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash, state.Deployable.Hash)
+	assert.Empty(t, state.Pending)
+}
+
+func TestResolveReleaseTag(t *testing.T) {
+	tr := newTestRepo(t)
+	c1 := tr.commit(nil)
+	c2 := tr.commit(nil)
+	c3 := tr.commit(nil)
+	c4 := tr.commit(nil)
+	tr.tag("v1.0", c1, false)
+	tr.tag("release/2024/1", c2, true)
+	tr.tag("nightly", c4, false)
+
+	tests := []struct {
+		pattern    string
+		deployable *object.Commit
+		pending    []*object.Commit
+	}{
+		{pattern: "v*", deployable: c1, pending: []*object.Commit{c4, c3, c2}},
+		// Wildcards match "/" like git tag --list
+		{pattern: "release/*", deployable: c2, pending: []*object.Commit{c4, c3}},
+		{pattern: "release*", deployable: c2, pending: []*object.Commit{c4, c3}},
+		{pattern: "", deployable: c4},
+		{pattern: "hotfix-*", pending: []*object.Commit{c4, c3, c2, c1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			cfg := &config.ReleaseConfig{Mode: ReleaseModeTag, TagPattern: tt.pattern}
+			state, err := ResolveRelease(tr.repo, cfg, c4)
+			require.NoError(t, err)
+			if tt.deployable == nil {
+				assert.Nil(t, state.Deployable)
+			} else {
+				require.NotNil(t, state.Deployable)
+				assert.Equal(t, tt.deployable.Hash, state.Deployable.Hash)
+			}
+			assert.Equal(t, hashes(tt.pending), hashes(state.Pending))
+		})
+	}
+
+	t.Run("max depth", func(t *testing.T) {
+		cfg := &config.ReleaseConfig{Mode: ReleaseModeTag, TagPattern: "v*", MaxDepth: 2}
+		state, err := ResolveRelease(tr.repo, cfg, c4)
+		require.NoError(t, err)
+		assert.Nil(t, state.Deployable)
+		assert.Equal(t, hashes([]*object.Commit{c4, c3}), hashes(state.Pending))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := ResolveRelease(tr.repo, &config.ReleaseConfig{Mode: ReleaseModeTag, TagPattern: "v[1"}, c4)
+		assert.ErrorContains(t, err, "invalid tag_pattern")
+	})
+}
+
+func TestIsReleasable(t *testing.T) {
+	tr := newTestRepo(t)
+	tagged := tr.commit(nil)
+	untagged := tr.commit(nil)
+	tr.tag("release-1", tagged, true)
+
+	cfg := &config.ReleaseConfig{Mode: ReleaseModeTag, TagPattern: "release-*"}
+	ok, err := IsReleasable(tr.repo, cfg, tagged)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = IsReleasable(tr.repo, cfg, untagged)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = IsReleasable(tr.repo, &config.ReleaseConfig{}, untagged)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = IsReleasable(tr.repo, &config.ReleaseConfig{Mode: "vibes"}, untagged)
+	assert.Error(t, err)
+}
+
+func TestResolveReleaseSigned(t *testing.T) {
+	trusted := newSSHKey(t)
+	untrusted := newSSHKey(t)
+
+	tr := newTestRepo(t)
+	valid := tr.commit(trusted.signer("git"))
+	unsigned := tr.commit(nil)
+	foreign := tr.commit(untrusted.signer("git"))
+	wrongNamespace := tr.commit(trusted.signer("file"))
+
+	cfg := &config.ReleaseConfig{Mode: ReleaseModeSigned, AllowedSignersPath: writeAllowedSigners(t, trusted)}
+
+	for name, tt := range map[string]struct {
+		commit *object.Commit
+		want   bool
+	}{
+		"valid":           {valid, true},
+		"unsigned":        {unsigned, false},
+		"untrusted":       {foreign, false},
+		"wrong namespace": {wrongNamespace, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ok, err := IsReleasable(tr.repo, cfg, tt.commit)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+
+	state, err := ResolveRelease(tr.repo, cfg, wrongNamespace)
+	require.NoError(t, err)
+	require.NotNil(t, state.Deployable)
+	assert.Equal(t, valid.Hash, state.Deployable.Hash)
+	assert.Equal(t, hashes([]*object.Commit{wrongNamespace, foreign, unsigned}), hashes(state.Pending))
+
+	// Once the second key is allowed its commit becomes the newest deployable one
+	cfg.AllowedSignersPath = writeAllowedSigners(t, trusted, untrusted)
+	state, err = ResolveRelease(tr.repo, cfg, wrongNamespace)
+	require.NoError(t, err)
+	assert.Equal(t, foreign.Hash, state.Deployable.Hash)
+
+	_, err = ResolveRelease(tr.repo, &config.ReleaseConfig{Mode: ReleaseModeSigned}, valid)
+	assert.ErrorContains(t, err, "requires keyring_path or allowed_signers_path")
+}
+
+func TestVerifySSHSignature(t *testing.T) {
+	trusted := newSSHKey(t)
+	other := newSSHKey(t)
+	allowed, err := loadAllowedSigners(writeAllowedSigners(t, trusted))
+	require.NoError(t, err)
+	require.Len(t, allowed, 1)
+
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nrelease\n")
+	sign := func(k *sshKey) string {
+		sig, err := k.signer("git").Sign(bytes.NewReader(message))
+		require.NoError(t, err)
+		return string(sig)
+	}
+
+	valid := sign(trusted)
+	assert.True(t, verifySSHSignature(valid, message, allowed))
+
+	// The signature does not cover a modified payload
+	assert.False(t, verifySSHSignature(valid, append([]byte("x"), message...), allowed))
+
+	// Signed by a key that is not in allowed_signers
+	assert.False(t, verifySSHSignature(sign(other), message, allowed))
+
+	// Signed by another key but claiming to be the trusted one
+	assert.False(t, verifySSHSignature(swapSSHSigPublicKey(t, sign(other), trusted), message, allowed))
+
+	assert.False(t, verifySSHSignature("-----BEGIN SSH SIGNATURE-----\nnot base64\n-----END SSH SIGNATURE-----", message, allowed))
+}
+
+// swapSSHSigPublicKey replaces the public key embedded in an armored SSHSIG signature.
+func swapSSHSigPublicKey(t *testing.T, armored string, key *sshKey) string {
+	t.Helper()
+	var body strings.Builder
+	for _, line := range strings.Split(armored, "\n") {
+		if line != "" && !strings.HasPrefix(line, "-----") {
+			body.WriteString(strings.TrimSpace(line))
+		}
+	}
+	blob, err := base64.StdEncoding.DecodeString(body.String())
+	require.NoError(t, err)
+
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	require.NoError(t, ssh.Unmarshal(blob[6:], &sig))
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.publicLine))
+	require.NoError(t, err)
+	sig.PublicKey = pub.Marshal()
+
+	encoded := base64.StdEncoding.EncodeToString(append([]byte("SSHSIG"), ssh.Marshal(sig)...))
+	return "-----BEGIN SSH SIGNATURE-----\n" + encoded + "\n-----END SSH SIGNATURE-----\n"
+}
+
+func TestLoadAllowedSigners(t *testing.T) {
+	a := newSSHKey(t)
+	b := newSSHKey(t)
+	keys, err := loadAllowedSigners(writeAllowedSigners(t, a, b))
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	bad := filepath.Join(t.TempDir(), "allowed_signers")
+	require.NoError(t, os.WriteFile(bad, []byte("dev@example.com ssh-ed25519 not-a-key\n"), 0o644))
+	_, err = loadAllowedSigners(bad)
+	assert.ErrorContains(t, err, "failed to parse allowed signer")
+
+	_, err = loadAllowedSigners(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestMatchTag(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "v1.0", true},
+		{"*", "release/1.0", true},
+		{"release-*", "release-1.0", true},
+		{"release-*", "prerelease-1.0", false},
+		{"release/*", "release/2024/1", true},
+		{"release/*", "releases/1", false},
+		{"v?.?", "v1.2", true},
+		{"v[0-9]*", "vx", false},
+	} {
+		got, err := matchTag(tt.pattern, tt.name)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%s %s", tt.pattern, tt.name)
+	}
+
+	_, err := matchTag("v[1", "v1")
+	assert.Error(t, err)
+}
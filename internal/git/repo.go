@@ -1,13 +1,16 @@
 package git
 
 import (
+	"errors"
 	"fmt"
-
 	"os"
-
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -44,6 +47,7 @@ func SyncRepository(cfg *config.GitConfig) (*Repository, error) {
 		// Repository does not exist, clone it
 		r, err := git.PlainClone(cfg.RepoPath, false, &git.CloneOptions{
 			URL:           cfg.RepoURL,
+			RemoteName:    RemoteName(cfg),
 			Auth:          auth,
 			ReferenceName: plumbing.NewBranchReferenceName(branch),
 			Progress:      os.Stdout,
@@ -75,8 +79,9 @@ func SyncRepository(cfg *config.GitConfig) (*Repository, error) {
 	}
 
 	// Pull changes from remote
+	remote := RemoteName(cfg)
 	err = w.Pull(&git.PullOptions{
-		RemoteName:    "origin",
+		RemoteName:    remote,
 		Auth:          auth,
 		ReferenceName: plumbing.NewBranchReferenceName(branch),
 		Force:         true,
@@ -85,6 +90,19 @@ func SyncRepository(cfg *config.GitConfig) (*Repository, error) {
 		return nil, fmt.Errorf("failed to pull changes: %w", err)
 	}
 
+	// Group branches, refs and tag based releases need every branch and tag,
+	// not only the ones following the pulled branch
+	err = r.Fetch(&git.FetchOptions{
+		RemoteName: remote,
+		Auth:       auth,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec("+refs/heads/*:refs/remotes/" + remote + "/*")},
+		Tags:       git.AllTags,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("failed to fetch branches and tags: %w", err)
+	}
+
 	return &Repository{r}, nil
 }
 
@@ -160,3 +178,115 @@ func (r *Repository) GetHeadHash() (plumbing.Hash, error) {
 	}
 	return ref.Hash(), nil
 }
+
+// ErrDirExists is returned by CommitDir when the directory already holds files and replace is not set.
+var ErrDirExists = errors.New("directory already exists in repository")
+
+// CommitDir writes files, keyed by path relative to dir, into dir (relative to the repository
+// root), commits the result on the current branch and optionally pushes the branch to the remote.
+// An existing non-empty dir is an error unless replace is set; its files that are not in files
+// are then deleted and the removals staged. The whole sequence holds the same lock as
+// SyncRepository so it never races with a pull, and on any failure the worktree and the branch
+// are reset to where they were, discarding a commit that could not be pushed.
+func CommitDir(cfg *config.GitConfig, repo *Repository, dir string, files map[string][]byte, replace bool, message string, push bool) (hash plumbing.Hash, err error) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	absDir := filepath.Join(w.Filesystem.Root(), filepath.FromSlash(dir))
+	if entries, err := os.ReadDir(absDir); err == nil && len(entries) > 0 && !replace {
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrDirExists, dir)
+	}
+
+	var head plumbing.Hash
+	if ref, err := repo.Head(); err == nil {
+		head = ref.Hash()
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get HEAD reference: %w", err)
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		hash = plumbing.ZeroHash
+		if rerr := restoreWorktree(w, absDir, head); rerr != nil {
+			err = fmt.Errorf("%w (failed to restore the worktree: %v)", err, rerr)
+		}
+	}()
+
+	if err := os.RemoveAll(absDir); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to remove existing directory %s: %w", absDir, err)
+	}
+	for relPath, content := range files {
+		localPath := filepath.Join(absDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to create directory for %s: %w", localPath, err)
+		}
+		if err := os.WriteFile(localPath, content, 0644); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to write %s: %w", localPath, err)
+		}
+	}
+
+	// Stage the removal of tracked files that the new tree no longer has
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, entry := range idx.Entries {
+		relPath, ok := strings.CutPrefix(entry.Name, dir+"/")
+		if !ok {
+			continue
+		}
+		if _, keep := files[relPath]; !keep {
+			if _, err := w.Remove(entry.Name); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to stage removal of %s: %w", entry.Name, err)
+			}
+		}
+	}
+	if len(files) > 0 {
+		if _, err := w.Add(dir); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to stage %s: %w", dir, err)
+		}
+	}
+
+	hash, err = w.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "gitops-nginx",
+			Email: "gitops-nginx@localhost",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	if !push {
+		return hash, nil
+	}
+
+	auth, err := getAuth(cfg)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get git auth: %w", err)
+	}
+	if err := repo.Push(&git.PushOptions{RemoteName: RemoteName(cfg), Auth: auth}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, fmt.Errorf("failed to push commit %s, discarded it: %w", hash, err)
+	}
+
+	return hash, nil
+}
+
+// restoreWorktree drops everything written under absDir and resets the index, the worktree
+// and the current branch to head.
+func restoreWorktree(w *git.Worktree, absDir string, head plumbing.Hash) error {
+	if err := os.RemoveAll(absDir); err != nil {
+		return err
+	}
+	if head.IsZero() {
+		return nil
+	}
+	return w.Reset(&git.ResetOptions{Commit: head, Mode: git.HardReset})
+}
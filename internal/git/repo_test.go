@@ -0,0 +1,176 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClonedRepo creates a bare remote with an initial commit on master and syncs a worktree
+// from it like the syncer does.
+func newClonedRepo(t *testing.T) (*config.GitConfig, *Repository, string) {
+	t.Helper()
+	base := t.TempDir()
+
+	seedDir := filepath.Join(base, "seed")
+	seed, err := git.PlainInit(seedDir, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "README.md"), []byte("nginx configs\n"), 0o644))
+	w, err := seed.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add("README.md")
+	require.NoError(t, err)
+	_, err = w.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	bareDir := filepath.Join(base, "remote.git")
+	_, err = git.PlainClone(bareDir, true, &git.CloneOptions{URL: seedDir})
+	require.NoError(t, err)
+
+	cfg := &config.GitConfig{RepoURL: bareDir, RepoPath: filepath.Join(base, "work"), Branch: "master"}
+	repo, err := SyncRepository(cfg)
+	require.NoError(t, err)
+	return cfg, repo, bareDir
+}
+
+func assertClean(t *testing.T, repo *Repository) {
+	t.Helper()
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status.String())
+}
+
+func TestCommitDir(t *testing.T) {
+	cfg, repo, bareDir := newClonedRepo(t)
+
+	hash, err := CommitDir(cfg, repo, "web/10.0.0.1/nginx", map[string][]byte{
+		"nginx.conf":      []byte("worker_processes 4;\n"),
+		"conf.d/old.conf": []byte("# old\n"),
+	}, false, "bootstrap", true)
+	require.NoError(t, err)
+
+	bare, err := git.PlainOpen(bareDir)
+	require.NoError(t, err)
+	ref, err := bare.Reference(plumbing.NewBranchReferenceName("master"), true)
+	require.NoError(t, err)
+	assert.Equal(t, hash, ref.Hash())
+
+	_, err = CommitDir(cfg, repo, "web/10.0.0.1/nginx", map[string][]byte{"nginx.conf": []byte("x\n")}, false, "again", false)
+	assert.ErrorIs(t, err, ErrDirExists)
+
+	// Replacing the directory stages the removal of files that are gone
+	hash, err = CommitDir(cfg, repo, "web/10.0.0.1/nginx", map[string][]byte{
+		"nginx.conf": []byte("worker_processes 8;\n"),
+	}, true, "replace", false)
+	require.NoError(t, err)
+	commit, err := repo.CommitObject(hash)
+	require.NoError(t, err)
+	tree, err := commit.Tree()
+	require.NoError(t, err)
+	_, err = tree.File("web/10.0.0.1/nginx/conf.d/old.conf")
+	assert.ErrorIs(t, err, object.ErrFileNotFound)
+	f, err := tree.File("web/10.0.0.1/nginx/nginx.conf")
+	require.NoError(t, err)
+	content, err := f.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "worker_processes 8;\n", content)
+	assertClean(t, repo)
+}
+
+func TestCommitDirRestoresOnFailure(t *testing.T) {
+	cfg, repo, _ := newClonedRepo(t)
+	_, err := CommitDir(cfg, repo, "web/10.0.0.1/nginx", map[string][]byte{
+		"nginx.conf": []byte("worker_processes 4;\n"),
+	}, false, "bootstrap", true)
+	require.NoError(t, err)
+	head, err := repo.Head()
+	require.NoError(t, err)
+
+	assertRestored := func(t *testing.T) {
+		t.Helper()
+		after, err := repo.Head()
+		require.NoError(t, err)
+		assert.Equal(t, head.Hash(), after.Hash())
+		assertClean(t, repo)
+		content, err := os.ReadFile(filepath.Join(cfg.RepoPath, "web/10.0.0.1/nginx/nginx.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "worker_processes 4;\n", string(content))
+	}
+
+	t.Run("write", func(t *testing.T) {
+		// "conf.d" cannot be a file and a directory at once
+		_, err := CommitDir(cfg, repo, "web/10.0.0.1/nginx", map[string][]byte{
+			"nginx.conf":      []byte("worker_processes 8;\n"),
+			"conf.d":          []byte("x\n"),
+			"conf.d/www.conf": []byte("y\n"),
+		}, true, "broken", false)
+		require.Error(t, err)
+		assertRestored(t)
+	})
+
+	t.Run("push", func(t *testing.T) {
+		remote, err := repo.Remote("origin")
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteRemote("origin"))
+		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{filepath.Join(t.TempDir(), "missing.git")}})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = repo.DeleteRemote("origin")
+			_, _ = repo.CreateRemote(remote.Config())
+		})
+
+		hash, err := CommitDir(cfg, repo, "web/10.0.0.1/nginx", map[string][]byte{
+			"nginx.conf": []byte("worker_processes 8;\n"),
+		}, true, "unpushable", true)
+		require.ErrorContains(t, err, "discarded")
+		assert.True(t, hash.IsZero())
+		assertRestored(t)
+	})
+}
+
+func TestSyncRepositoryRemoteName(t *testing.T) {
+	cfg, _, bareDir := newClonedRepo(t)
+	cfg.RepoPath = filepath.Join(t.TempDir(), "work")
+	cfg.RemoteName = "upstream"
+
+	repo, err := SyncRepository(cfg)
+	require.NoError(t, err)
+	_, err = repo.Remote("upstream")
+	require.NoError(t, err)
+
+	// Another clone moves the branch, the next sync pulls it from the configured remote
+	other, err := git.PlainClone(filepath.Join(t.TempDir(), "other"), false, &git.CloneOptions{URL: bareDir})
+	require.NoError(t, err)
+	w, err := other.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(w.Filesystem.Root(), "nginx.conf"), []byte("worker_processes 4;\n"), 0o644))
+	_, err = w.Add("nginx.conf")
+	require.NoError(t, err)
+	moved, err := w.Commit("add nginx.conf", &git.CommitOptions{
+		Author: &object.Signature{Name: "dev", Email: "dev@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	require.NoError(t, other.Push(&git.PushOptions{}))
+
+	repo, err = SyncRepository(cfg)
+	require.NoError(t, err)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, moved, head.Hash())
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName("upstream", "master"), true)
+	require.NoError(t, err)
+	assert.Equal(t, moved, ref.Hash())
+}
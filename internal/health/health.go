@@ -0,0 +1,213 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+)
+
+// Probe locations
+const (
+	WhereLocal  = "local"
+	WhereRemote = "remote"
+)
+
+const (
+	defaultAttempts = 3
+	defaultInterval = 2 * time.Second
+	defaultTimeout  = 5 * time.Second
+)
+
+// Result is the outcome of a single probe.
+type Result struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Where      string `json:"where"`
+	OK         bool   `json:"ok"`
+	Status     int    `json:"status,omitempty"` // HTTP status of the last attempt
+	Expected   int    `json:"expected"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// RemoteRunner runs a shell command on the target server.
+type RemoteRunner interface {
+	RunCommandContext(ctx context.Context, cmd string) (string, error)
+}
+
+// Validate checks the probe definitions.
+func Validate(cfg config.HealthConfig) error {
+	var errs []error
+	if cfg.Attempts < 0 {
+		errs = append(errs, fmt.Errorf("attempts must not be negative"))
+	}
+	if cfg.Interval != "" {
+		if d, err := time.ParseDuration(cfg.Interval); err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("invalid interval %q", cfg.Interval))
+		}
+	}
+	for i, p := range cfg.Probes {
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("probe %d (%s): url must be an absolute http(s) URL", i, p.Name))
+		}
+		if p.Where != "" && p.Where != WhereLocal && p.Where != WhereRemote {
+			errs = append(errs, fmt.Errorf("probe %d (%s): where must be 'local' or 'remote'", i, p.Name))
+		}
+		if p.Timeout != "" {
+			if d, err := time.ParseDuration(p.Timeout); err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("probe %d (%s): invalid timeout %q", i, p.Name, p.Timeout))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check runs every probe, retrying each up to the configured attempts. The returned error
+// names the failed probes; the results hold the details of all of them.
+func Check(ctx context.Context, cfg config.HealthConfig, remote RemoteRunner) ([]Result, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	attempts := cfg.Attempts
+	if attempts == 0 {
+		attempts = defaultAttempts
+	}
+	interval := defaultInterval
+	if cfg.Interval != "" {
+		interval, _ = time.ParseDuration(cfg.Interval)
+	}
+
+	results := make([]Result, 0, len(cfg.Probes))
+	var failed []string
+	for i, p := range cfg.Probes {
+		res := probe(ctx, i, p, attempts, interval, remote)
+		if !res.OK {
+			failed = append(failed, res.Name)
+		}
+		results = append(results, res)
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("health probes failed: %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+func probe(ctx context.Context, index int, p config.HealthProbeConfig, attempts int, interval time.Duration, remote RemoteRunner) (res Result) {
+	res = Result{
+		Name:     p.Name,
+		URL:      p.URL,
+		Where:    p.Where,
+		Expected: p.ExpectedStatus,
+	}
+	if res.Name == "" {
+		res.Name = fmt.Sprintf("probe[%d]", index)
+	}
+	if res.Where == "" {
+		res.Where = WhereLocal
+	}
+	if res.Expected == 0 {
+		res.Expected = http.StatusOK
+	}
+	timeout := defaultTimeout
+	if p.Timeout != "" {
+		timeout, _ = time.ParseDuration(p.Timeout)
+	}
+
+	start := time.Now()
+	defer func() { res.DurationMs = time.Since(start).Milliseconds() }()
+
+	for res.Attempts < attempts {
+		if res.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				res.Error = ctx.Err().Error()
+				return res
+			case <-time.After(interval):
+			}
+		}
+		res.Attempts++
+
+		status, err := fetchStatus(ctx, p, res.Where, timeout, remote)
+		res.Status = status
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case status != res.Expected:
+			res.Error = fmt.Sprintf("got status %d, expected %d", status, res.Expected)
+		default:
+			res.OK = true
+			res.Error = ""
+			return res
+		}
+	}
+	return res
+}
+
+func fetchStatus(ctx context.Context, p config.HealthProbeConfig, where string, timeout time.Duration, remote RemoteRunner) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch where {
+	case WhereLocal:
+		return fetchLocal(ctx, p)
+	case WhereRemote:
+		if remote == nil {
+			return 0, fmt.Errorf("no remote connection")
+		}
+		return fetchRemote(ctx, p, timeout, remote)
+	default:
+		return 0, fmt.Errorf("unknown probe location %q", where)
+	}
+}
+
+// noRedirectClient reports redirects as they are, so that a probe can expect e.g. a 301.
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func fetchLocal(ctx context.Context, p config.HealthProbeConfig) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if p.Host != "" {
+		req.Host = p.Host
+	}
+	resp, err := noRedirectClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func fetchRemote(ctx context.Context, p config.HealthProbeConfig, timeout time.Duration, remote RemoteRunner) (int, error) {
+	cmd := fmt.Sprintf("curl -s -o /dev/null -w '%%{http_code}' --max-time %d", max(1, int(timeout.Seconds()+0.5)))
+	if p.Host != "" {
+		cmd += " -H " + ssh.ShellQuote("Host: "+p.Host)
+	}
+	cmd += " " + ssh.ShellQuote(p.URL)
+
+	output, err := remote.RunCommandContext(ctx, cmd)
+	output = strings.TrimSpace(output)
+	status, convErr := strconv.Atoi(output)
+	if convErr != nil || status == 0 {
+		if err == nil {
+			err = fmt.Errorf("unexpected curl output %q", output)
+		}
+		return 0, fmt.Errorf("curl failed: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRemote struct {
+	output   string
+	commands []string
+}
+
+func (f *fakeRemote) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	f.commands = append(f.commands, cmd)
+	return f.output, nil
+}
+
+func TestCheckRetriesUntilHealthy(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "www.example.com" || calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	results, err := Check(context.Background(), config.HealthConfig{
+		Interval: "10ms",
+		Probes:   []config.HealthProbeConfig{{Name: "home", URL: srv.URL, Host: "www.example.com"}},
+	}, nil)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].OK)
+	assert.Equal(t, 3, results[0].Attempts)
+	assert.Equal(t, http.StatusOK, results[0].Status)
+}
+
+func TestCheckFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	results, err := Check(context.Background(), config.HealthConfig{
+		Attempts: 2,
+		Interval: "10ms",
+		Probes: []config.HealthProbeConfig{
+			{URL: srv.URL, ExpectedStatus: http.StatusFound},
+			{Name: "api", URL: srv.URL + "/api"},
+		},
+	}, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "api")
+	require.Len(t, results, 2)
+	assert.True(t, results[0].OK)
+	assert.Equal(t, "probe[0]", results[0].Name)
+	assert.False(t, results[1].OK)
+	assert.Equal(t, 2, results[1].Attempts)
+	assert.Equal(t, "got status 302, expected 200", results[1].Error)
+}
+
+func TestCheckRemote(t *testing.T) {
+	remote := &fakeRemote{output: "200"}
+	results, err := Check(context.Background(), config.HealthConfig{
+		Probes: []config.HealthProbeConfig{{URL: "http://127.0.0.1/", Host: "a.example.com", Where: WhereRemote}},
+	}, remote)
+
+	require.NoError(t, err)
+	assert.True(t, results[0].OK)
+	require.Len(t, remote.commands, 1)
+	assert.Equal(t, "curl -s -o /dev/null -w '%{http_code}' --max-time 5 -H 'Host: a.example.com' 'http://127.0.0.1/'", remote.commands[0])
+}
+
+func TestValidate(t *testing.T) {
+	err := Validate(config.HealthConfig{
+		Interval: "soon",
+		Probes:   []config.HealthProbeConfig{{URL: "/healthz", Where: "elsewhere"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid interval "soon"`)
+	assert.Contains(t, err.Error(), "absolute http(s) URL")
+	assert.Contains(t, err.Error(), "where must be")
+}
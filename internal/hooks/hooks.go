@@ -0,0 +1,211 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+)
+
+// Hook phases
+const (
+	PhasePreApply  = "pre_apply"
+	PhasePostApply = "post_apply"
+	PhaseOnFailure = "on_failure"
+)
+
+// Hook locations
+const (
+	WhereRemote = "remote"
+	WhereLocal  = "local"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Result is the outcome of a single hook.
+type Result struct {
+	Phase      string `json:"phase"`
+	Name       string `json:"name"`
+	Where      string `json:"where"`
+	Command    string `json:"command"`
+	OK         bool   `json:"ok"`
+	Output     string `json:"output"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// RemoteRunner runs a shell command on the target server.
+type RemoteRunner interface {
+	RunCommandContext(ctx context.Context, cmd string) (string, error)
+}
+
+// Merge returns the hooks of a server: for each phase the group hooks, then the server hooks.
+func Merge(group *config.NginxServerGroup, server *config.ServerConfig) config.HooksConfig {
+	var merged config.HooksConfig
+	if group != nil {
+		merged.PreApply = append(merged.PreApply, group.Hooks.PreApply...)
+		merged.PostApply = append(merged.PostApply, group.Hooks.PostApply...)
+		merged.OnFailure = append(merged.OnFailure, group.Hooks.OnFailure...)
+	}
+	merged.PreApply = append(merged.PreApply, server.Hooks.PreApply...)
+	merged.PostApply = append(merged.PostApply, server.Hooks.PostApply...)
+	merged.OnFailure = append(merged.OnFailure, server.Hooks.OnFailure...)
+	return merged
+}
+
+// Validate checks the hook definitions of every phase.
+func Validate(cfg config.HooksConfig) error {
+	var errs []error
+	phases := []struct {
+		name  string
+		hooks []config.HookConfig
+	}{
+		{PhasePreApply, cfg.PreApply},
+		{PhasePostApply, cfg.PostApply},
+		{PhaseOnFailure, cfg.OnFailure},
+	}
+	for _, p := range phases {
+		for i, h := range p.hooks {
+			if strings.TrimSpace(h.Command) == "" {
+				errs = append(errs, fmt.Errorf("%s hook %d (%s): command is empty", p.name, i, h.Name))
+			}
+			if h.Where != "" && h.Where != WhereRemote && h.Where != WhereLocal {
+				errs = append(errs, fmt.Errorf("%s hook %d (%s): where must be 'remote' or 'local'", p.name, i, h.Name))
+			}
+			if h.Timeout != "" {
+				if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+					errs = append(errs, fmt.Errorf("%s hook %d (%s): invalid timeout %q", p.name, i, h.Name, h.Timeout))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run runs the hooks of a phase in order and stops at the first failure, which is returned
+// together with the results collected so far. env is exported to every hook.
+func Run(ctx context.Context, phase string, hooks []config.HookConfig, remote RemoteRunner, env map[string]string) ([]Result, error) {
+	results := make([]Result, 0, len(hooks))
+	for i, h := range hooks {
+		res := runOne(ctx, phase, i, h, remote, env)
+		results = append(results, res)
+		if !res.OK {
+			return results, fmt.Errorf("%s hook %q failed: %s", phase, res.Name, res.Error)
+		}
+	}
+	return results, nil
+}
+
+// RunAll runs every hook of a phase regardless of failures, e.g. for on_failure cleanup.
+func RunAll(ctx context.Context, phase string, hooks []config.HookConfig, remote RemoteRunner, env map[string]string) []Result {
+	results := make([]Result, 0, len(hooks))
+	for i, h := range hooks {
+		results = append(results, runOne(ctx, phase, i, h, remote, env))
+	}
+	return results
+}
+
+func runOne(ctx context.Context, phase string, index int, h config.HookConfig, remote RemoteRunner, env map[string]string) Result {
+	res := Result{
+		Phase:   phase,
+		Name:    h.Name,
+		Where:   h.Where,
+		Command: h.Command,
+	}
+	if res.Name == "" {
+		res.Name = fmt.Sprintf("%s[%d]", phase, index)
+	}
+	if res.Where == "" {
+		res.Where = WhereRemote
+	}
+
+	timeout := defaultTimeout
+	if h.Timeout != "" {
+		d, err := time.ParseDuration(h.Timeout)
+		if err != nil || d <= 0 {
+			res.Error = fmt.Sprintf("invalid timeout %q", h.Timeout)
+			return res
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	env = withPhase(env, phase)
+	start := time.Now()
+	var err error
+	switch res.Where {
+	case WhereLocal:
+		res.Output, err = runLocal(ctx, h.Command, env)
+	case WhereRemote:
+		if remote == nil {
+			err = fmt.Errorf("no remote connection")
+			break
+		}
+		res.Output, err = remote.RunCommandContext(ctx, exportEnv(env)+h.Command)
+	default:
+		err = fmt.Errorf("unknown hook location %q", res.Where)
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		res.Error = err.Error()
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+func runLocal(ctx context.Context, command string, env map[string]string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	// Children of the shell may keep the output open after it is killed
+	cmd.WaitDelay = time.Second
+	cmd.Env = os.Environ()
+	for _, k := range sortedKeys(env) {
+		cmd.Env = append(cmd.Env, k+"="+env[k])
+	}
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func withPhase(env map[string]string, phase string) map[string]string {
+	merged := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		merged[k] = v
+	}
+	merged["GITOPS_HOOK_PHASE"] = phase
+	return merged
+}
+
+// exportEnv renders env as a shell prefix, since SSH servers usually refuse client environment variables.
+func exportEnv(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("export")
+	for _, k := range sortedKeys(env) {
+		fmt.Fprintf(&b, " %s=%s", k, ssh.ShellQuote(env[k]))
+	}
+	b.WriteString("; ")
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
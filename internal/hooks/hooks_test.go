@@ -0,0 +1,73 @@
+package hooks
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRemote struct {
+	commands []string
+}
+
+func (f *fakeRemote) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	f.commands = append(f.commands, cmd)
+	return "remote ok\n", nil
+}
+
+func TestRunStopsAtFirstFailure(t *testing.T) {
+	remote := &fakeRemote{}
+	results, err := Run(context.Background(), PhasePreApply, []config.HookConfig{
+		{Name: "drain", Command: "drain.sh"},
+		{Name: "local", Where: WhereLocal, Command: `echo "$GITOPS_HOST $GITOPS_HOOK_PHASE"`},
+		{Name: "fail", Where: WhereLocal, Command: "exit 3"},
+		{Name: "never", Command: "never.sh"},
+	}, remote, map[string]string{"GITOPS_HOST": "10.0.0.1"})
+
+	require.Error(t, err)
+	require.Len(t, results, 3)
+	assert.True(t, results[0].OK)
+	assert.Equal(t, "10.0.0.1 pre_apply\n", results[1].Output)
+	assert.False(t, results[2].OK)
+
+	require.Len(t, remote.commands, 1)
+	assert.True(t, strings.HasPrefix(remote.commands[0], "export GITOPS_HOOK_PHASE='pre_apply' GITOPS_HOST='10.0.0.1'; "))
+	assert.True(t, strings.HasSuffix(remote.commands[0], "drain.sh"))
+}
+
+func TestRunTimeout(t *testing.T) {
+	results, err := Run(context.Background(), PhasePostApply, []config.HookConfig{
+		{Where: WhereLocal, Command: "sleep 5", Timeout: "100ms"},
+	}, nil, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, "post_apply[0]", results[0].Name)
+	assert.Contains(t, results[0].Error, "timed out")
+}
+
+func TestMerge(t *testing.T) {
+	group := &config.NginxServerGroup{Hooks: config.HooksConfig{PreApply: []config.HookConfig{{Name: "group"}}}}
+	server := &config.ServerConfig{Hooks: config.HooksConfig{PreApply: []config.HookConfig{{Name: "server"}}}}
+
+	merged := Merge(group, server)
+	require.Len(t, merged.PreApply, 2)
+	assert.Equal(t, "group", merged.PreApply[0].Name)
+	assert.Equal(t, "server", merged.PreApply[1].Name)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(config.HooksConfig{PreApply: []config.HookConfig{{Command: "true", Where: WhereLocal, Timeout: "5s"}}}))
+
+	err := Validate(config.HooksConfig{
+		PostApply: []config.HookConfig{{Command: " "}},
+		OnFailure: []config.HookConfig{{Command: "true", Where: "elsewhere", Timeout: "soon"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "post_apply hook 0 (): command is empty")
+	assert.Contains(t, err.Error(), "where must be")
+	assert.Contains(t, err.Error(), `invalid timeout "soon"`)
+}
@@ -0,0 +1,71 @@
+package ignore
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IsIgnored checks if a file path matches any ignore pattern
+// It automatically ignores .git directory and hidden files/directories starting with .
+// unless they are explicitly not ignored (though we enforce hidden file ignore for now based on requirements)
+// The requirements say: "filter out .swp . hidden files".
+func IsIgnored(filePath string, ignorePatterns []string) bool {
+	filename := filepath.Base(filePath)
+
+	// Always ignore .git directory
+	if strings.Contains(filePath, ".git/") || filename == ".git" {
+		return true
+	}
+
+	// Always ignore hidden files (starting with .)
+	// This covers .DS_Store, .gitignore, .env, etc.
+	if strings.HasPrefix(filename, ".") {
+		return true
+	}
+
+	// Always ignore swap files (ending with .swp) or backup files (ending with ~)
+	if strings.HasSuffix(filename, ".swp") || strings.HasSuffix(filename, "~") {
+		return true
+	}
+
+	// Always ignore Vim's 4913 test file
+	if filename == "4913" {
+		return true
+	}
+
+	return Match(filePath, ignorePatterns)
+}
+
+// Match reports whether a slash-separated relative path matches any of the glob patterns.
+// A pattern matches the file name, any single path component, the whole path, or a leading
+// directory of it, so "*.log", "temp", "temp/*" and "ssl/live" all cover temp/x or ssl/live/a/b.
+func Match(filePath string, patterns []string) bool {
+	filePath = strings.TrimPrefix(path.Clean(filePath), "/")
+	components := strings.Split(filePath, "/")
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+		if pattern == "" {
+			continue
+		}
+
+		// Use glob match for the filename and each path component
+		for _, component := range components {
+			if matched, _ := filepath.Match(pattern, component); matched {
+				return true
+			}
+		}
+
+		// Path patterns match the whole path or one of its leading directories
+		if !strings.Contains(pattern, "/") {
+			continue
+		}
+		for i := len(components); i > 0; i-- {
+			if matched, _ := filepath.Match(pattern, strings.Join(components[:i], "/")); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package ignore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsIgnored(t *testing.T) {
+	patterns := []string{"*.log", "temp/*"}
+
+	assert.True(t, IsIgnored("logs/access.log", patterns))
+	assert.True(t, IsIgnored("temp/scratch.conf", patterns))
+	assert.True(t, IsIgnored("conf.d/.www.conf.swp", patterns))
+	assert.True(t, IsIgnored(".git/HEAD", nil))
+	assert.False(t, IsIgnored("conf.d/www.conf", patterns))
+	assert.False(t, IsIgnored("templates/temp.conf", patterns))
+}
+
+func TestMatch(t *testing.T) {
+	patterns := []string{"mime.types", "ssl/live", "modules-enabled/*.conf"}
+
+	assert.True(t, Match("mime.types", patterns))
+	assert.True(t, Match("ssl/live/example.com/fullchain.pem", patterns))
+	assert.True(t, Match("modules-enabled/50-mod-stream.conf", patterns))
+	assert.False(t, Match("ssl/dhparam.pem", patterns))
+	assert.False(t, Match("conf.d/www.conf", patterns))
+	assert.False(t, Match("conf.d/www.conf", nil))
+}
@@ -0,0 +1,122 @@
+package inventory
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+// Host is the inventory of one config tree of a host.
+type Host struct {
+	Group     string     `json:"group"`
+	Host      string     `json:"host"`
+	Name      string     `json:"name"`
+	Source    string     `json:"source"` // "prod" or "remote"
+	Servers   []Server   `json:"servers"`
+	Upstreams []Upstream `json:"upstreams"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Server is an http server block.
+type Server struct {
+	File         string             `json:"file"`
+	Line         int                `json:"line"`
+	Names        []string           `json:"names"`
+	Listens      []nginxconf.Listen `json:"listens"`
+	Certificates []string           `json:"certificates,omitempty"`
+	Locations    []Location         `json:"locations,omitempty"`
+}
+
+// Location is a location block with the directives that decide how it answers.
+type Location struct {
+	File      string     `json:"file"`
+	Line      int        `json:"line"`
+	Modifier  string     `json:"modifier,omitempty"` // "=", "^~", "~", "~*" or "" for a prefix
+	Path      string     `json:"path"`
+	ProxyPass string     `json:"proxy_pass,omitempty"`
+	Root      string     `json:"root,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	Return    string     `json:"return,omitempty"`
+	Locations []Location `json:"locations,omitempty"` // nested locations
+}
+
+// Upstream is an upstream block.
+type Upstream struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Line    int      `json:"line"`
+	Members []Member `json:"members"`
+}
+
+// Member is a server of an upstream block.
+type Member struct {
+	Address string   `json:"address"`
+	Params  []string `json:"params,omitempty"`
+}
+
+// passDirectives hand a request to a backend; the first one found is reported as ProxyPass.
+var passDirectives = []string{"proxy_pass", "fastcgi_pass", "grpc_pass", "uwsgi_pass", "scgi_pass", "memcached_pass"}
+
+// Build collects the http servers and upstreams of a parsed config tree.
+func Build(cfg *nginxconf.Config) ([]Server, []Upstream) {
+	servers := []Server{}
+	for _, srv := range cfg.HTTPServers() {
+		s := Server{
+			File:    srv.File,
+			Line:    srv.Line,
+			Names:   srv.Names(),
+			Listens: srv.Listens(),
+		}
+		for _, d := range srv.Find("ssl_certificate") {
+			s.Certificates = append(s.Certificates, d.Arg(0))
+		}
+		s.Locations = locations(cfg, srv.Directives)
+		servers = append(servers, s)
+	}
+
+	upstreams := []Upstream{}
+	cfg.Walk(func(d *nginxconf.Directive, parents []*nginxconf.Directive) bool {
+		if d.Name != "upstream" || !d.IsBlock {
+			return true
+		}
+		u := Upstream{Name: d.Arg(0), File: d.File, Line: d.Line, Members: []Member{}}
+		for _, m := range cfg.Children(d) {
+			if m.Name == "server" && len(m.Args) > 0 {
+				u.Members = append(u.Members, Member{Address: m.Args[0], Params: m.Args[1:]})
+			}
+		}
+		upstreams = append(upstreams, u)
+		return false
+	})
+	return servers, upstreams
+}
+
+func locations(cfg *nginxconf.Config, directives []*nginxconf.Directive) []Location {
+	var out []Location
+	for _, d := range directives {
+		if d.Name != "location" || !d.IsBlock || len(d.Args) == 0 {
+			continue
+		}
+		loc := Location{File: d.File, Line: d.Line, Path: d.Args[len(d.Args)-1]}
+		if len(d.Args) > 1 {
+			loc.Modifier = d.Args[0]
+		}
+		children := cfg.Children(d)
+		for _, c := range children {
+			switch {
+			case loc.ProxyPass == "" && slices.Contains(passDirectives, c.Name):
+				loc.ProxyPass = strings.Join(c.Args, " ")
+			case c.Name == "root":
+				loc.Root = c.Arg(0)
+			case c.Name == "alias":
+				loc.Alias = c.Arg(0)
+			case c.Name == "return" && loc.Return == "":
+				loc.Return = strings.Join(c.Args, " ")
+			}
+		}
+		loc.Locations = locations(cfg, children)
+		out = append(out, loc)
+	}
+	return out
+}
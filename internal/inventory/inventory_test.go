@@ -0,0 +1,102 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildHost(t *testing.T, files map[string]string) Host {
+	t.Helper()
+	tree := make(map[string][]byte)
+	for p, content := range files {
+		tree[p] = []byte(content)
+	}
+	servers, upstreams := Build(nginxconf.Load(tree, nginxconf.Options{}))
+	return Host{Group: "web", Host: "10.0.0.1", Name: "web-1", Source: "prod", Servers: servers, Upstreams: upstreams}
+}
+
+func TestBuild(t *testing.T) {
+	h := buildHost(t, map[string]string{
+		"nginx.conf": `http {
+    upstream api_backend {
+        server 10.0.1.10:8080 weight=2;
+        server 10.0.1.11:8080 backup;
+    }
+    include conf.d/*.conf;
+}
+`,
+		"conf.d/api.conf": `server {
+    listen 443 ssl;
+    server_name api.example.com;
+    ssl_certificate certs/api.pem;
+    location / {
+        proxy_pass http://api_backend;
+        location = /health { return 200 ok; }
+    }
+    location ~* \.png$ { root /srv/static; }
+}
+`,
+	})
+
+	require.Len(t, h.Servers, 1)
+	srv := h.Servers[0]
+	assert.Equal(t, "conf.d/api.conf", srv.File)
+	assert.Equal(t, []string{"api.example.com"}, srv.Names)
+	assert.Equal(t, []string{"certs/api.pem"}, srv.Certificates)
+	assert.True(t, srv.Listens[0].SSL)
+
+	require.Len(t, srv.Locations, 2)
+	assert.Equal(t, "http://api_backend", srv.Locations[0].ProxyPass)
+	assert.Equal(t, Location{File: "conf.d/api.conf", Line: 7, Modifier: "=", Path: "/health", Return: "200 ok"}, srv.Locations[0].Locations[0])
+	assert.Equal(t, "~*", srv.Locations[1].Modifier)
+	assert.Equal(t, "/srv/static", srv.Locations[1].Root)
+
+	require.Len(t, h.Upstreams, 1)
+	assert.Equal(t, []Member{
+		{Address: "10.0.1.10:8080", Params: []string{"weight=2"}},
+		{Address: "10.0.1.11:8080", Params: []string{"backup"}},
+	}, h.Upstreams[0].Members)
+}
+
+func TestLookup(t *testing.T) {
+	h := buildHost(t, map[string]string{
+		"nginx.conf": `http {
+    upstream api_backend { server 10.0.1.10:8080; }
+    server {
+        server_name api.example.com;
+        location / { proxy_pass http://api_backend; }
+    }
+    server {
+        server_name *.example.com;
+        location /legacy/ { proxy_pass http://10.0.1.10:9000/; }
+    }
+    server {
+        server_name www.example.org;
+        location / { proxy_pass http://10.0.2.20; }
+    }
+}
+`,
+	})
+	hosts := []Host{h}
+
+	domain := FindDomain(hosts, "API.example.com")
+	require.Len(t, domain, 2)
+	assert.Equal(t, 3, domain[0].Line)
+	assert.Equal(t, "server_name *.example.com listen *:80", domain[1].Detail)
+	assert.Empty(t, FindDomain(hosts, "example.net"))
+
+	backend := FindBackend(hosts, "10.0.1.10")
+	var kinds []string
+	for _, m := range backend {
+		kinds = append(kinds, m.Kind)
+	}
+	assert.Equal(t, []string{KindUpstream, KindLocation, KindLocation}, kinds)
+	assert.Equal(t, "upstream api_backend server 10.0.1.10:8080", backend[0].Detail)
+	assert.Equal(t, "server_name *.example.com location /legacy/ -> http://10.0.1.10:9000/", backend[2].Detail)
+
+	assert.Len(t, FindBackend(hosts, "10.0.1.10:9000"), 1)
+	assert.Len(t, FindBackend(hosts, "api_backend"), 2)
+}
@@ -0,0 +1,129 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+// Match kinds
+const (
+	KindServer   = "server"
+	KindUpstream = "upstream"
+	KindLocation = "location"
+)
+
+// Match is a hit of a reverse lookup.
+type Match struct {
+	Group  string `json:"group"`
+	Host   string `json:"host"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Kind   string `json:"kind"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Detail string `json:"detail"`
+}
+
+func (h *Host) match(kind, file string, line int, format string, args ...any) Match {
+	return Match{
+		Group:  h.Group,
+		Host:   h.Host,
+		Name:   h.Name,
+		Source: h.Source,
+		Kind:   kind,
+		File:   file,
+		Line:   line,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
+
+// FindDomain returns the server blocks whose server_name matches domain, following the
+// nginx wildcard and regex forms.
+func FindDomain(hosts []Host, domain string) []Match {
+	matches := []Match{}
+	for i := range hosts {
+		h := &hosts[i]
+		for _, srv := range h.Servers {
+			for _, name := range srv.Names {
+				if nginxconf.MatchServerName(name, domain) {
+					matches = append(matches, h.match(KindServer, srv.File, srv.Line, "server_name %s listen %s", strings.Join(srv.Names, " "), listenAddresses(srv)))
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// FindBackend returns the upstream members pointing at backend and the locations passing
+// requests to it, directly or through one of those upstreams. backend is an address with or
+// without port, a host name or an upstream name.
+func FindBackend(hosts []Host, backend string) []Match {
+	backend = strings.ToLower(backend)
+	matches := []Match{}
+	for i := range hosts {
+		h := &hosts[i]
+		upstreams := make(map[string]bool)
+		for _, u := range h.Upstreams {
+			if strings.ToLower(u.Name) == backend {
+				upstreams[u.Name] = true
+				matches = append(matches, h.match(KindUpstream, u.File, u.Line, "upstream %s", u.Name))
+				continue
+			}
+			for _, m := range u.Members {
+				if addressMatches(m.Address, backend) {
+					upstreams[u.Name] = true
+					matches = append(matches, h.match(KindUpstream, u.File, u.Line, "upstream %s server %s", u.Name, m.Address))
+				}
+			}
+		}
+
+		for _, srv := range h.Servers {
+			var visit func(locs []Location)
+			visit = func(locs []Location) {
+				for _, loc := range locs {
+					if target := passTarget(loc.ProxyPass); target != "" && (addressMatches(target, backend) || upstreams[target]) {
+						matches = append(matches, h.match(KindLocation, loc.File, loc.Line, "server_name %s location %s -> %s",
+							strings.Join(srv.Names, " "), strings.TrimSpace(loc.Modifier+" "+loc.Path), loc.ProxyPass))
+					}
+					visit(loc.Locations)
+				}
+			}
+			visit(srv.Locations)
+		}
+	}
+	return matches
+}
+
+// addressMatches reports whether an address, with or without port, is backend.
+func addressMatches(addr, backend string) bool {
+	addr = strings.ToLower(addr)
+	if addr == backend {
+		return true
+	}
+	if i := strings.LastIndex(addr, ":"); i >= 0 && !strings.HasSuffix(addr, "]") {
+		return addr[:i] == backend
+	}
+	return false
+}
+
+// passTarget returns the host[:port] part of a *_pass argument.
+func passTarget(pass string) string {
+	if i := strings.Index(pass, "://"); i >= 0 {
+		pass = pass[i+3:]
+	}
+	if i := strings.IndexAny(pass, "/ "); i >= 0 {
+		pass = pass[:i]
+	}
+	return pass
+}
+
+func listenAddresses(srv Server) string {
+	addrs := make([]string, 0, len(srv.Listens))
+	for _, l := range srv.Listens {
+		addrs = append(addrs, l.Address)
+	}
+	return strings.Join(addrs, " ")
+}
@@ -0,0 +1,134 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+// Severity of a finding. SeverityOff disables a rule.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeverityOff     Severity = "off"
+)
+
+var severityRank = map[Severity]int{
+	SeverityInfo:    1,
+	SeverityWarning: 2,
+	SeverityError:   3,
+}
+
+// Rule is a built-in lint rule.
+type Rule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Severity    Severity `json:"severity"` // default severity
+	check       func(in *Input, report func(file string, line int, format string, args ...any))
+}
+
+// Finding is a problem reported by a rule.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Result holds the findings of a lint run, sorted by file and line.
+type Result struct {
+	OK       bool      `json:"ok"`
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Infos    int       `json:"infos"`
+	Findings []Finding `json:"findings"`
+}
+
+// Input is the config tree of a host to lint.
+type Input struct {
+	Config *nginxconf.Config
+	// Protected reports files that exist on the server without being in the tree
+	// (see ssh.ScpOptions); referencing them is not a problem. May be nil.
+	Protected func(relPath string) bool
+}
+
+// Linter runs the built-in rules with the configured severities.
+type Linter struct {
+	severities map[string]Severity
+	failOn     Severity
+}
+
+// Rules returns the built-in rules with their default severities.
+func Rules() []Rule {
+	return rules
+}
+
+// New validates the lint configuration.
+func New(cfg config.LintConfig) (*Linter, error) {
+	l := &Linter{severities: make(map[string]Severity), failOn: SeverityError}
+	for _, r := range rules {
+		l.severities[r.ID] = r.Severity
+	}
+	for id, sev := range cfg.Rules {
+		if _, ok := l.severities[id]; !ok {
+			return nil, fmt.Errorf("lint: unknown rule %q", id)
+		}
+		s := Severity(sev)
+		if _, ok := severityRank[s]; !ok && s != SeverityOff {
+			return nil, fmt.Errorf("lint: rule %q: invalid severity %q, must be error, warning, info or off", id, sev)
+		}
+		l.severities[id] = s
+	}
+	if cfg.FailOn != "" {
+		l.failOn = Severity(cfg.FailOn)
+		if _, ok := severityRank[l.failOn]; !ok {
+			return nil, fmt.Errorf("lint: invalid fail_on %q, must be error, warning or info", cfg.FailOn)
+		}
+	}
+	return l, nil
+}
+
+// Lint runs the enabled rules. The result is not OK if a finding is at or above the fail_on severity.
+func (l *Linter) Lint(in *Input) *Result {
+	res := &Result{OK: true, Findings: []Finding{}}
+	for _, r := range rules {
+		sev := l.severities[r.ID]
+		if sev == SeverityOff {
+			continue
+		}
+		r.check(in, func(file string, line int, format string, args ...any) {
+			res.Findings = append(res.Findings, Finding{
+				Rule:     r.ID,
+				Severity: sev,
+				File:     file,
+				Line:     line,
+				Message:  fmt.Sprintf(format, args...),
+			})
+			switch sev {
+			case SeverityError:
+				res.Errors++
+			case SeverityWarning:
+				res.Warnings++
+			case SeverityInfo:
+				res.Infos++
+			}
+			if severityRank[sev] >= severityRank[l.failOn] {
+				res.OK = false
+			}
+		})
+	}
+	sort.SliceStable(res.Findings, func(i, j int) bool {
+		a, b := res.Findings[i], res.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return res
+}
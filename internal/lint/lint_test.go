@@ -0,0 +1,146 @@
+package lint
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lintFiles(t *testing.T, cfg config.LintConfig, files map[string]string) *Result {
+	t.Helper()
+	tree := make(map[string][]byte)
+	for p, content := range files {
+		tree[p] = []byte(content)
+	}
+	l, err := New(cfg)
+	require.NoError(t, err)
+	return l.Lint(&Input{
+		Config: nginxconf.Load(tree, nginxconf.Options{ConfigDir: "/etc/nginx"}),
+		Protected: func(relPath string) bool {
+			return relPath == "certs/preserved.pem"
+		},
+	})
+}
+
+func TestLint(t *testing.T) {
+	res := lintFiles(t, config.LintConfig{}, map[string]string{
+		"nginx.conf": `http {
+    upstream backend { server 10.0.0.1:8080; }
+    include conf.d/*.conf;
+    include snippets/missing.conf;
+}
+`,
+		"conf.d/a.conf": `server {
+    listen 80 default_server;
+    server_name example.com;
+    location / { proxy_pass http://backend; }
+    location /api { proxy_pass http://api_backend/v1; }
+    location /ext { proxy_pass http://example.org; }
+    location /var { proxy_pass http://$upstream; }
+}
+`,
+		"conf.d/b.conf": `server {
+    listen 0.0.0.0:80 default_server;
+    server_name EXAMPLE.com www.example.com;
+}
+server {
+    listen 443 ssl http2;
+    server_name example.com;
+    ssl_certificate /etc/nginx/certs/example.pem;
+    ssl_certificate_key certs/preserved.pem;
+    ssl_trusted_certificate /etc/ssl/chain.pem;
+}
+`,
+		"certs/other.pem": "",
+	})
+
+	var got []string
+	for _, f := range res.Findings {
+		got = append(got, fmt.Sprintf("%s:%d %s", f.File, f.Line, f.Rule))
+	}
+	assert.Equal(t, []string{
+		"conf.d/a.conf:5 undefined_upstream",
+		"conf.d/b.conf:2 duplicate_listen",
+		"conf.d/b.conf:3 duplicate_listen",
+		"conf.d/b.conf:6 deprecated_directive",
+		"conf.d/b.conf:8 missing_certificate",
+		"nginx.conf:4 missing_include",
+	}, got)
+	assert.False(t, res.OK)
+	assert.Equal(t, 4, res.Errors)
+	assert.Equal(t, 2, res.Warnings)
+	assert.Equal(t, SeverityWarning, res.Findings[0].Severity)
+	assert.Equal(t, `proxy_pass "http://api_backend/v1": upstream "api_backend" is not defined, nginx resolves it as a host name`, res.Findings[0].Message)
+}
+
+func TestLintUndefinedUpstreamHosts(t *testing.T) {
+	res := lintFiles(t, config.LintConfig{}, map[string]string{
+		"nginx.conf": `http {
+    server {
+        location /local { proxy_pass http://localhost; }
+        location /app { proxy_pass http://app; }
+        location /port { proxy_pass http://app:8080; }
+    }
+}
+`,
+	})
+	// A docker service name is indistinguishable from a misspelled upstream, it does not fail the check
+	assert.True(t, res.OK)
+	require.Len(t, res.Findings, 1)
+	assert.Equal(t, 4, res.Findings[0].Line)
+	assert.Equal(t, SeverityWarning, res.Findings[0].Severity)
+
+	res = lintFiles(t, config.LintConfig{Rules: map[string]string{"undefined_upstream": "error"}}, map[string]string{
+		"nginx.conf": "http { server { location / { proxy_pass http://app; } } }\n",
+	})
+	assert.False(t, res.OK)
+}
+
+func TestLintSeverities(t *testing.T) {
+	files := map[string]string{
+		"nginx.conf": "http { server { listen 80; ssl on; } }\n",
+	}
+
+	res := lintFiles(t, config.LintConfig{}, files)
+	assert.True(t, res.OK)
+	require.Len(t, res.Findings, 1)
+	assert.Equal(t, SeverityWarning, res.Findings[0].Severity)
+
+	res = lintFiles(t, config.LintConfig{FailOn: "warning"}, files)
+	assert.False(t, res.OK)
+
+	res = lintFiles(t, config.LintConfig{Rules: map[string]string{"deprecated_directive": "off"}, FailOn: "info"}, files)
+	assert.True(t, res.OK)
+	assert.Empty(t, res.Findings)
+}
+
+func TestLintFormatting(t *testing.T) {
+	files := map[string]string{
+		"nginx.conf":    "events {}\nhttp {\n    include conf.d/*.conf;\n}\n",
+		"conf.d/a.conf": "server {\n    listen 80;\n  server_name a;\n}\n",
+	}
+
+	res := lintFiles(t, config.LintConfig{}, files)
+	assert.Empty(t, res.Findings, "formatting is off by default")
+
+	res = lintFiles(t, config.LintConfig{Rules: map[string]string{"formatting": "warning"}}, files)
+	assert.True(t, res.OK)
+	require.Len(t, res.Findings, 1)
+	assert.Equal(t, "conf.d/a.conf", res.Findings[0].File)
+	assert.Equal(t, 3, res.Findings[0].Line)
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(config.LintConfig{Rules: map[string]string{"no_such_rule": "error"}})
+	assert.ErrorContains(t, err, "unknown rule")
+
+	_, err = New(config.LintConfig{Rules: map[string]string{"parse_error": "fatal"}})
+	assert.ErrorContains(t, err, "invalid severity")
+
+	_, err = New(config.LintConfig{FailOn: "off"})
+	assert.ErrorContains(t, err, "invalid fail_on")
+}
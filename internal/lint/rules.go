@@ -0,0 +1,262 @@
+package lint
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+type reportFunc = func(file string, line int, format string, args ...any)
+
+var rules = []Rule{
+	{
+		ID:          "parse_error",
+		Description: "syntax errors in a file reached from nginx.conf",
+		Severity:    SeverityError,
+		check:       checkParseErrors,
+	},
+	{
+		ID:          "missing_include",
+		Description: "include directives that match no file of the tree or form a cycle",
+		Severity:    SeverityError,
+		check:       checkMissingIncludes,
+	},
+	{
+		ID:          "duplicate_listen",
+		Description: "http servers with the same server_name on the same listen address, or two default servers",
+		Severity:    SeverityError,
+		check:       checkDuplicateListen,
+	},
+	{
+		ID:          "missing_certificate",
+		Description: "ssl_certificate and related directives pointing at files missing from the tree",
+		Severity:    SeverityError,
+		check:       checkMissingCertificates,
+	},
+	{
+		ID:          "undefined_upstream",
+		Description: "proxy_pass and other *_pass directives naming an upstream that is not defined",
+		Severity:    SeverityWarning,
+		check:       checkUndefinedUpstreams,
+	},
+	{
+		ID:          "deprecated_directive",
+		Description: "directives and listen parameters deprecated or removed in current nginx versions",
+		Severity:    SeverityWarning,
+		check:       checkDeprecated,
+	},
+	{
+		ID:          "formatting",
+		Description: "files reached from nginx.conf that differ from the output of gitops-nginx fmt",
+		Severity:    SeverityOff,
+		check:       checkFormatting,
+	},
+}
+
+func checkParseErrors(in *Input, report reportFunc) {
+	for _, e := range in.Config.Graph.Errors {
+		report(e.File, e.Line, "%s", e.Msg)
+	}
+}
+
+func checkMissingIncludes(in *Input, report reportFunc) {
+	for _, e := range in.Config.Graph.Unresolved {
+		switch {
+		case e.From == "":
+			report("", 0, "%s %s", e.Pattern, e.Error)
+		case e.Error == "outside of the config directory":
+			// not part of the tree, nothing to check against
+		default:
+			report(e.From, e.Line, "include %q: %s", e.Pattern, e.Error)
+		}
+	}
+}
+
+func checkDuplicateListen(in *Input, report reportFunc) {
+	names := make(map[string]*nginxconf.ServerBlock) // "addr name" -> server
+	defaultServers := make(map[string]nginxconf.Listen)
+	for _, srv := range in.Config.HTTPServers() {
+		var addrs []string
+		for _, l := range srv.Listens() {
+			if slices.Contains(addrs, l.Address) {
+				continue
+			}
+			addrs = append(addrs, l.Address)
+			if !l.DefaultServer {
+				continue
+			}
+			if first, ok := defaultServers[l.Address]; ok {
+				report(l.File, l.Line, "duplicate default server for %s, already defined at %s:%d", l.Address, first.File, first.Line)
+			} else {
+				defaultServers[l.Address] = l
+			}
+		}
+
+		// report a conflict at the server_name directive that declares the name
+		nameDirective := make(map[string]*nginxconf.Directive)
+		for _, d := range srv.Find("server_name") {
+			for _, name := range d.Args {
+				if _, ok := nameDirective[strings.ToLower(name)]; !ok {
+					nameDirective[strings.ToLower(name)] = d
+				}
+			}
+		}
+
+		for _, addr := range addrs {
+			for _, name := range srv.Names() {
+				key := addr + " " + name
+				first, ok := names[key]
+				if !ok {
+					names[key] = srv
+					continue
+				}
+				if first == srv {
+					continue
+				}
+				d := srv.Directive
+				if nd, ok := nameDirective[name]; ok {
+					d = nd
+				}
+				report(d.File, d.Line, "conflicting server name %q on %s, already defined by the server at %s", name, addr, first.Pos())
+			}
+		}
+	}
+}
+
+var certificateDirectives = []string{
+	"ssl_certificate",
+	"ssl_certificate_key",
+	"ssl_trusted_certificate",
+	"ssl_client_certificate",
+	"ssl_dhparam",
+}
+
+func checkMissingCertificates(in *Input, report reportFunc) {
+	in.Config.Walk(func(d *nginxconf.Directive, _ []*nginxconf.Directive) bool {
+		if !slices.Contains(certificateDirectives, d.Name) || len(d.Args) != 1 {
+			return true
+		}
+		file := d.Args[0]
+		if strings.Contains(file, "$") || strings.HasPrefix(file, "data:") || strings.HasPrefix(file, "engine:") {
+			return true
+		}
+		relPath, ok := in.Config.RelPath(file)
+		if !ok {
+			// outside of the config directory, e.g. /etc/letsencrypt
+			return true
+		}
+		if in.Config.Exists(relPath) || (in.Protected != nil && in.Protected(relPath)) {
+			return true
+		}
+		report(d.File, d.Line, "%s %q: file not found in the config tree", d.Name, file)
+		return true
+	})
+}
+
+var passDirectives = []string{
+	"proxy_pass",
+	"fastcgi_pass",
+	"grpc_pass",
+	"uwsgi_pass",
+	"scgi_pass",
+	"memcached_pass",
+}
+
+func checkUndefinedUpstreams(in *Input, report reportFunc) {
+	upstreams := make(map[string]bool)
+	in.Config.Walk(func(d *nginxconf.Directive, _ []*nginxconf.Directive) bool {
+		if d.Name == "upstream" && d.IsBlock {
+			upstreams[d.Arg(0)] = true
+		}
+		return true
+	})
+	in.Config.Walk(func(d *nginxconf.Directive, _ []*nginxconf.Directive) bool {
+		if !slices.Contains(passDirectives, d.Name) {
+			return true
+		}
+		if name, ok := upstreamName(d.Arg(0)); ok && !upstreams[name] {
+			report(d.File, d.Line, "%s %q: upstream %q is not defined, nginx resolves it as a host name", d.Name, d.Arg(0), name)
+		}
+		return true
+	})
+}
+
+// upstreamName returns the host of a *_pass target when it likely refers to an upstream block:
+// a single label without port that is not an address and not localhost. Such a name may also be
+// a host resolved by DNS, so undefined ones are only reported as warnings by default.
+func upstreamName(target string) (string, bool) {
+	if target == "" || strings.Contains(target, "$") {
+		return "", false
+	}
+	if i := strings.Index(target, "://"); i >= 0 {
+		target = target[i+3:]
+	}
+	if strings.HasPrefix(target, "unix:") {
+		return "", false
+	}
+	if i := strings.Index(target, "/"); i >= 0 {
+		target = target[:i]
+	}
+	if target == "" || target == "localhost" || strings.ContainsAny(target, ".:[") {
+		return "", false
+	}
+	return target, true
+}
+
+var deprecatedDirectives = map[string]string{
+	"ssl":                         `use the "ssl" parameter of the listen directive`,
+	"optimize_server_names":       "use server_name_in_redirect",
+	"spdy_chunk_size":             "SPDY was replaced by HTTP/2",
+	"spdy_headers_comp":           "SPDY was replaced by HTTP/2",
+	"proxy_upstream_fail_timeout": `use the "fail_timeout" parameter of the upstream server directive`,
+	"proxy_upstream_max_fails":    `use the "max_fails" parameter of the upstream server directive`,
+}
+
+func checkDeprecated(in *Input, report reportFunc) {
+	in.Config.Walk(func(d *nginxconf.Directive, _ []*nginxconf.Directive) bool {
+		if hint, ok := deprecatedDirectives[d.Name]; ok {
+			report(d.File, d.Line, "%q is deprecated, %s", d.Name, hint)
+			return true
+		}
+		if d.Name != "listen" || len(d.Args) < 2 {
+			return true
+		}
+		for _, param := range d.Args[1:] {
+			switch param {
+			case "http2":
+				report(d.File, d.Line, `the "http2" parameter of listen is deprecated since nginx 1.25.1, use the "http2 on" directive`)
+			case "spdy":
+				report(d.File, d.Line, `the "spdy" parameter of listen is no longer supported, use the "http2 on" directive`)
+			}
+		}
+		return true
+	})
+}
+
+func checkFormatting(in *Input, report reportFunc) {
+	for _, relPath := range in.Config.Paths {
+		f, ok := in.Config.Files[relPath]
+		if !ok {
+			continue
+		}
+		src, _ := in.Config.Source(relPath)
+		formatted := nginxconf.Format(f)
+		if string(formatted) == string(src) {
+			continue
+		}
+		report(relPath, firstDifferentLine(src, formatted), "file is not formatted, run gitops-nginx fmt")
+	}
+}
+
+// firstDifferentLine returns the 1-based line at which a and b first differ.
+func firstDifferentLine(a, b []byte) int {
+	la := strings.Split(string(a), "\n")
+	lb := strings.Split(string(b), "\n")
+	for i := range min(len(la), len(lb)) {
+		if la[i] != lb[i] {
+			return i + 1
+		}
+	}
+	return min(len(la), len(lb))
+}
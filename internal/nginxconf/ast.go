@@ -0,0 +1,55 @@
+package nginxconf
+
+import "fmt"
+
+// Directive is a simple directive, a block directive or a comment of an nginx config file.
+type Directive struct {
+	Name    string       `json:"name"`               // "#" for comments
+	Args    []string     `json:"args,omitempty"`     // unquoted and unescaped
+	RawArgs []string     `json:"raw_args,omitempty"` // as written, including quotes
+	Comment string       `json:"comment,omitempty"`  // text after "#" for comments
+	File    string       `json:"file"`
+	Line    int          `json:"line"`
+	EndLine int          `json:"end_line,omitempty"` // line of the terminating ";" or "}"
+	IsBlock bool         `json:"is_block,omitempty"`
+	Block   []*Directive `json:"block,omitempty"`
+	// Includes lists the files an include directive resolved to, in load order.
+	Includes []string `json:"includes,omitempty"`
+
+	argLines []int // line of each argument, for Format
+}
+
+// IsComment reports whether d is a comment.
+func (d *Directive) IsComment() bool {
+	return d.Name == "#"
+}
+
+// Arg returns the i-th argument, or "" if there is none.
+func (d *Directive) Arg(i int) string {
+	if i < len(d.Args) {
+		return d.Args[i]
+	}
+	return ""
+}
+
+// Pos returns the position of d as "file:line".
+func (d *Directive) Pos() string {
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+// File is a parsed config file.
+type File struct {
+	Path       string       `json:"path"`
+	Directives []*Directive `json:"directives"`
+}
+
+// ParseError is a syntax error at a position in a config file.
+type ParseError struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Msg  string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
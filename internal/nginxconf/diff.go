@@ -0,0 +1,261 @@
+package nginxconf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Change kinds
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change is a structural difference between two versions of a config file.
+type Change struct {
+	Kind      string `json:"kind"`
+	Context   string `json:"context,omitempty"` // enclosing blocks, e.g. "http › server api.example.com"
+	Directive string `json:"directive"`         // directive name, or block label for added/removed blocks
+	Before    string `json:"before,omitempty"`
+	After     string `json:"after,omitempty"`
+	Line      int    `json:"line,omitempty"` // line in the new version, in the old one for removals
+}
+
+// String describes the change in block terms, e.g.
+// "server api.example.com › location /v2: proxy_pass changed from X to Y".
+func (c Change) String() string {
+	prefix := ""
+	if c.Context != "" {
+		prefix = c.Context + ": "
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		if c.After == "" {
+			return fmt.Sprintf("%s%s added", prefix, c.Directive)
+		}
+		return fmt.Sprintf("%s%s %s added", prefix, c.Directive, c.After)
+	case ChangeRemoved:
+		if c.Before == "" {
+			return fmt.Sprintf("%s%s removed", prefix, c.Directive)
+		}
+		return fmt.Sprintf("%s%s %s removed", prefix, c.Directive, c.Before)
+	}
+	return fmt.Sprintf("%s%s changed from %s to %s", prefix, c.Directive, c.Before, c.After)
+}
+
+// contextSeparator joins the block labels of Change.Context.
+const contextSeparator = " › "
+
+// Diff compares two parsed versions of a file. Comments, formatting and the order of directives
+// are ignored, except where nginx evaluates directives in order: regex locations, allow/deny and
+// the rewrite module directives (rewrite, return, break, set, if). A reorder among those is
+// reported as a change.
+// Blocks are matched by name and arguments (server blocks by their server names); directives
+// that occur once are reported as changed, repeated ones (listen, add_header, ...) as added or
+// removed values.
+func Diff(before, after *File) []Change {
+	changes := []Change{}
+	diffBlock(nil, before.Directives, after.Directives, &changes)
+	return changes
+}
+
+// IsConfigFile reports whether a file is compared structurally: nginx config files end in ".conf".
+func IsConfigFile(relPath string) bool {
+	return strings.HasSuffix(relPath, ".conf")
+}
+
+// DiffContent parses and compares two versions of a file. Empty content is an empty file.
+func DiffContent(name string, before, after []byte) ([]Change, error) {
+	a, err := Parse(name, before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Parse(name, after)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(a, b), nil
+}
+
+// blockLabel identifies a block directive among its siblings.
+func blockLabel(d *Directive) string {
+	if d.Name == "server" && len(d.Args) == 0 {
+		var names []string
+		for _, c := range d.Block {
+			if c.Name == "server_name" {
+				names = append(names, c.Args...)
+			}
+		}
+		if len(names) > 0 {
+			return "server " + strings.Join(names, " ")
+		}
+		return "server"
+	}
+	return strings.TrimSpace(d.Name + " " + rawArgs(d))
+}
+
+func rawArgs(d *Directive) string {
+	return strings.Join(d.RawArgs, " ")
+}
+
+func diffBlock(context []string, before, after []*Directive, changes *[]Change) {
+	ctx := strings.Join(context, contextSeparator)
+	add := func(c Change) {
+		c.Context = ctx
+		*changes = append(*changes, c)
+	}
+
+	// blocks, paired by label in order of occurrence
+	beforeBlocks, beforeOrder := groupBlocks(before)
+	afterBlocks, afterOrder := groupBlocks(after)
+	for _, label := range afterOrder {
+		b, a := beforeBlocks[label], afterBlocks[label]
+		for i, d := range a {
+			if i < len(b) {
+				diffBlock(append(context[:len(context):len(context)], label), b[i].Block, d.Block, changes)
+				continue
+			}
+			add(Change{Kind: ChangeAdded, Directive: label, Line: d.Line})
+		}
+	}
+	for _, label := range beforeOrder {
+		b, a := beforeBlocks[label], afterBlocks[label]
+		for i := len(a); i < len(b); i++ {
+			add(Change{Kind: ChangeRemoved, Directive: label, Line: b[i].Line})
+		}
+	}
+
+	// simple directives, grouped by name
+	beforeSimple, beforeNames := groupSimple(before)
+	afterSimple, afterNames := groupSimple(after)
+	for _, name := range afterNames {
+		b, a := beforeSimple[name], afterSimple[name]
+		if len(b) == 1 && len(a) == 1 {
+			if rawArgs(b[0]) != rawArgs(a[0]) {
+				add(Change{Kind: ChangeChanged, Directive: name, Before: rawArgs(b[0]), After: rawArgs(a[0]), Line: a[0].Line})
+			}
+			continue
+		}
+		remaining := slices.Clone(b)
+		for _, d := range a {
+			if i := slices.IndexFunc(remaining, func(o *Directive) bool { return rawArgs(o) == rawArgs(d) }); i >= 0 {
+				remaining = slices.Delete(remaining, i, i+1)
+				continue
+			}
+			add(Change{Kind: ChangeAdded, Directive: name, After: rawArgs(d), Line: d.Line})
+		}
+		for _, d := range remaining {
+			add(Change{Kind: ChangeRemoved, Directive: name, Before: rawArgs(d), Line: d.Line})
+		}
+	}
+	for _, name := range beforeNames {
+		if _, ok := afterSimple[name]; ok {
+			continue
+		}
+		for _, d := range beforeSimple[name] {
+			add(Change{Kind: ChangeRemoved, Directive: name, Before: rawArgs(d), Line: d.Line})
+		}
+	}
+
+	// regex locations are tried in order
+	diffOrder("regex location order", regexLocations(before), regexLocations(after), add)
+
+	// the first matching allow/deny wins, rewrite module directives run in order
+	for _, g := range orderedDirectives {
+		diffOrder(g.label, orderedSequence(before, g.names), orderedSequence(after, g.names), add)
+	}
+}
+
+// orderedDirectives are the groups of directives whose relative order changes what nginx does.
+var orderedDirectives = []struct {
+	label string
+	names []string
+}{
+	{"allow/deny order", []string{"allow", "deny"}},
+	{"rewrite order", []string{"rewrite", "return", "break", "set", "if"}},
+}
+
+// orderedSequence returns the directives of directives named in names, in order, each as its
+// name and arguments.
+func orderedSequence(directives []*Directive, names []string) []string {
+	var out []string
+	for _, d := range directives {
+		if !d.IsComment() && slices.Contains(names, d.Name) {
+			out = append(out, strings.TrimSpace(d.Name+" "+rawArgs(d)))
+		}
+	}
+	return out
+}
+
+// diffOrder reports a change when the entries present in both versions appear in another
+// order. Added and removed entries are reported elsewhere.
+func diffOrder(label string, before, after []string, add func(Change)) {
+	commonBefore, commonAfter := commonEntries(before, after), commonEntries(after, before)
+	if !slices.Equal(commonBefore, commonAfter) {
+		add(Change{
+			Kind:      ChangeChanged,
+			Directive: label,
+			Before:    strings.Join(commonBefore, ", "),
+			After:     strings.Join(commonAfter, ", "),
+		})
+	}
+}
+
+// commonEntries returns the entries of a, in order, that also occur in b, as often as in b.
+func commonEntries(a, b []string) []string {
+	counts := make(map[string]int)
+	for _, e := range b {
+		counts[e]++
+	}
+	var out []string
+	for _, e := range a {
+		if counts[e] > 0 {
+			counts[e]--
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func groupBlocks(directives []*Directive) (map[string][]*Directive, []string) {
+	groups := make(map[string][]*Directive)
+	var order []string
+	for _, d := range directives {
+		if !d.IsBlock {
+			continue
+		}
+		label := blockLabel(d)
+		if _, ok := groups[label]; !ok {
+			order = append(order, label)
+		}
+		groups[label] = append(groups[label], d)
+	}
+	return groups, order
+}
+
+func groupSimple(directives []*Directive) (map[string][]*Directive, []string) {
+	groups := make(map[string][]*Directive)
+	var order []string
+	for _, d := range directives {
+		if d.IsBlock || d.IsComment() {
+			continue
+		}
+		if _, ok := groups[d.Name]; !ok {
+			order = append(order, d.Name)
+		}
+		groups[d.Name] = append(groups[d.Name], d)
+	}
+	return groups, order
+}
+
+func regexLocations(directives []*Directive) []string {
+	var out []string
+	for _, d := range directives {
+		if d.Name == "location" && d.IsBlock && len(d.Args) > 1 && (d.Args[0] == "~" || d.Args[0] == "~*") {
+			out = append(out, blockLabel(d))
+		}
+	}
+	return out
+}
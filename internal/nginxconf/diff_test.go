@@ -0,0 +1,93 @@
+package nginxconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffContent(t *testing.T) {
+	before := `http {
+    server {
+        listen 80;
+        server_name api.example.com;
+        location /v2 {
+            proxy_pass http://old;
+            add_header X-A 1;
+        }
+        location ~ \.php$ { fastcgi_pass php; }
+        location ~ \.js$ { root /srv; }
+        location /legacy { return 410; }
+    }
+}
+`
+	after := `# reformatted and commented
+http {
+  server {
+    server_name api.example.com;
+    listen 80;
+    listen 443 ssl;
+    location /v2 {
+      add_header X-A 1;   # same header
+      proxy_pass http://new;
+      proxy_set_header Host $host;
+    }
+    location ~ \.js$ { root /srv; }
+    location ~ \.php$ { fastcgi_pass php; }
+  }
+  server { server_name static.example.com; }
+}
+`
+	changes, err := DiffContent("conf.d/api.conf", []byte(before), []byte(after))
+	require.NoError(t, err)
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	assert.Equal(t, []string{
+		"http › server api.example.com › location /v2: proxy_pass changed from http://old to http://new",
+		"http › server api.example.com › location /v2: proxy_set_header Host $host added",
+		"http › server api.example.com: location /legacy removed",
+		"http › server api.example.com: listen 443 ssl added",
+		`http › server api.example.com: regex location order changed from location ~ \.php$, location ~ \.js$ to location ~ \.js$, location ~ \.php$`,
+		"http: server static.example.com added",
+	}, got)
+	assert.Equal(t, 9, changes[0].Line)
+}
+
+func TestDiffContentFormattingOnly(t *testing.T) {
+	changes, err := DiffContent("nginx.conf",
+		[]byte("events {}\nhttp { include mime.types; gzip on; }\n"),
+		[]byte("# comment\nevents { }\nhttp {\n    gzip   on;\n    include mime.types;\n}\n"))
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = DiffContent("nginx.conf", []byte("http {"), nil)
+	assert.Error(t, err)
+}
+
+func TestDiffContentOrderSensitive(t *testing.T) {
+	changes, err := DiffContent("conf.d/admin.conf",
+		[]byte("server {\n    location /admin {\n        allow 10.0.0.1;\n        deny all;\n    }\n}\n"),
+		[]byte("server {\n    location /admin {\n        deny all;\n        allow 10.0.0.1;\n    }\n}\n"))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "server › location /admin: allow/deny order changed from allow 10.0.0.1, deny all to deny all, allow 10.0.0.1", changes[0].String())
+
+	changes, err = DiffContent("conf.d/api.conf",
+		[]byte("server {\n    rewrite ^/old/(.*)$ /new/$1 last;\n    if ($bot) { return 403; }\n    return 301 https://$host$request_uri;\n}\n"),
+		[]byte("server {\n    return 301 https://$host$request_uri;\n    rewrite ^/old/(.*)$ /new/$1 last;\n    if ($bot) { return 403; }\n}\n"))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "rewrite order", changes[0].Directive)
+
+	// Adding a rule keeps the order of the others, only the addition is reported
+	changes, err = DiffContent("conf.d/admin.conf",
+		[]byte("location /admin { allow 10.0.0.1; deny all; }\n"),
+		[]byte("location /admin { allow 10.0.0.1; allow 10.0.0.2; deny all; }\n"))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "location /admin: allow 10.0.0.2 added", changes[0].String())
+}
@@ -0,0 +1,97 @@
+package nginxconf
+
+import (
+	"bytes"
+	"strings"
+)
+
+// indent is the indentation of one block level in formatted output.
+const indent = "    "
+
+// Format renders a parsed file in canonical form: one directive per line, blocks indented by
+// four spaces, arguments separated by a single space and trailing whitespace removed. Arguments
+// keep their quoting, line breaks between arguments (e.g. in log_format) are kept as indented
+// continuation lines, comments stay where they were and runs of blank lines collapse into one.
+func Format(f *File) []byte {
+	var w formatter
+	w.directives(f.Directives, 0, 0)
+	w.endLine()
+	return w.buf.Bytes()
+}
+
+// FormatSource parses and formats the content of a config file.
+func FormatSource(name string, data []byte) ([]byte, error) {
+	f, err := Parse(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return Format(f), nil
+}
+
+type formatter struct {
+	buf  bytes.Buffer
+	open bool // the current output line is not terminated yet
+}
+
+func (w *formatter) endLine() {
+	if w.open {
+		w.buf.WriteByte('\n')
+		w.open = false
+	}
+}
+
+// directives writes the directives of a block at depth. prevLine is the line of the opening
+// brace, so that a comment following it on the same line stays there.
+func (w *formatter) directives(directives []*Directive, depth, prevLine int) {
+	for i, d := range directives {
+		if d.IsComment() && w.open && d.Line == prevLine {
+			w.buf.WriteString(" #" + trimComment(d.Comment))
+			continue
+		}
+		w.endLine()
+		if i > 0 && d.Line > prevLine+1 {
+			w.buf.WriteByte('\n')
+		}
+		w.buf.WriteString(strings.Repeat(indent, depth))
+		w.open = true
+
+		if d.IsComment() {
+			w.buf.WriteString("#" + trimComment(d.Comment))
+			prevLine = d.Line
+			continue
+		}
+
+		w.buf.WriteString(d.Name)
+		lastLine := d.Line
+		for j, raw := range d.RawArgs {
+			if j < len(d.argLines) && d.argLines[j] > lastLine {
+				w.buf.WriteByte('\n')
+				w.buf.WriteString(strings.Repeat(indent, depth+1))
+			} else {
+				w.buf.WriteByte(' ')
+			}
+			w.buf.WriteString(raw)
+			if j < len(d.argLines) {
+				lastLine = d.argLines[j] + strings.Count(raw, "\n")
+			}
+		}
+
+		switch {
+		case !d.IsBlock:
+			w.buf.WriteByte(';')
+		case len(d.Block) == 0:
+			w.buf.WriteString(" {}")
+		default:
+			w.buf.WriteString(" {")
+			w.directives(d.Block, depth+1, lastLine)
+			w.endLine()
+			w.buf.WriteString(strings.Repeat(indent, depth) + "}")
+			w.open = true
+		}
+		prevLine = d.EndLine
+	}
+}
+
+func trimComment(text string) string {
+	return strings.TrimRight(text, " \t\r")
+}
@@ -0,0 +1,60 @@
+package nginxconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	src := "# main config   \n" +
+		"user  nginx;\n" +
+		"\n\n\n" +
+		"events {   }\n" +
+		"http{\n" +
+		"\tlog_format  main  '$remote_addr - $remote_user'\n" +
+		"\t\t\t'\"$request\" $status';\n" +
+		"  include   mime.types;  # types\n" +
+		"\n" +
+		"  server { # default\n" +
+		"      listen 80 default_server;server_name \"_\";\n" +
+		"\n" +
+		"\n" +
+		"  location / {\n" +
+		"  return 404;\n" +
+		"  }   }\n" +
+		"}\n"
+
+	want := `# main config
+user nginx;
+
+events {}
+http {
+    log_format main '$remote_addr - $remote_user'
+        '"$request" $status';
+    include mime.types; # types
+
+    server { # default
+        listen 80 default_server;
+        server_name "_";
+
+        location / {
+            return 404;
+        }
+    }
+}
+`
+	out, err := FormatSource("nginx.conf", []byte(src))
+	require.NoError(t, err)
+	assert.Equal(t, want, string(out))
+
+	again, err := FormatSource("nginx.conf", out)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(again), "formatting must be idempotent")
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	_, err := FormatSource("nginx.conf", []byte("http {\n"))
+	assert.Error(t, err)
+}
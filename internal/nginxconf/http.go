@@ -0,0 +1,160 @@
+package nginxconf
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ServerBlock is a server block of the http context.
+type ServerBlock struct {
+	*Directive
+	// Directives are the direct children of the block with includes expanded and comments left out.
+	Directives []*Directive
+}
+
+// Listen is a parsed listen directive.
+type Listen struct {
+	Address       string `json:"address"` // normalized host:port, "*" for any address
+	DefaultServer bool   `json:"default_server,omitempty"`
+	SSL           bool   `json:"ssl,omitempty"`
+	File          string `json:"file"`
+	Line          int    `json:"line"`
+}
+
+// HTTPServers returns the server blocks of the http context in load order.
+func (c *Config) HTTPServers() []*ServerBlock {
+	var servers []*ServerBlock
+	c.Walk(func(d *Directive, parents []*Directive) bool {
+		n := len(parents)
+		if d.Name == "server" && d.IsBlock && n > 0 && parents[n-1].Name == "http" {
+			servers = append(servers, &ServerBlock{Directive: d, Directives: c.Children(d)})
+			return false
+		}
+		return true
+	})
+	return servers
+}
+
+// HTTPDirectives returns the directives of the http block with includes expanded.
+func (c *Config) HTTPDirectives() []*Directive {
+	var out []*Directive
+	c.Walk(func(d *Directive, parents []*Directive) bool {
+		if d.Name == "http" && d.IsBlock && len(parents) == 0 {
+			out = c.Children(d)
+		}
+		return false
+	})
+	return out
+}
+
+// Children returns the directives of a block with includes expanded and comments left out.
+func (c *Config) Children(block *Directive) []*Directive {
+	return c.expand(block.Block, make(map[string]bool))
+}
+
+func (c *Config) expand(directives []*Directive, stack map[string]bool) []*Directive {
+	var out []*Directive
+	for _, d := range directives {
+		if d.IsComment() {
+			continue
+		}
+		if d.Name != "include" || d.IsBlock {
+			out = append(out, d)
+			continue
+		}
+		for _, inc := range d.Includes {
+			f, ok := c.Files[inc]
+			if !ok || stack[inc] {
+				continue
+			}
+			stack[inc] = true
+			out = append(out, c.expand(f.Directives, stack)...)
+			delete(stack, inc)
+		}
+	}
+	return out
+}
+
+// Find returns the directives of the server block with the given name.
+func (s *ServerBlock) Find(name string) []*Directive {
+	var out []*Directive
+	for _, d := range s.Directives {
+		if d.Name == name {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Names returns the server names, in lower case. A server without server_name has the name "".
+func (s *ServerBlock) Names() []string {
+	var names []string
+	for _, d := range s.Find("server_name") {
+		for _, name := range d.Args {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	return names
+}
+
+// Listens returns the listen addresses of the server, *:80 when it has no listen directive.
+func (s *ServerBlock) Listens() []Listen {
+	var listens []Listen
+	for _, d := range s.Find("listen") {
+		params := d.Args[min(1, len(d.Args)):]
+		listens = append(listens, Listen{
+			Address:       ListenAddress(d.Arg(0)),
+			DefaultServer: slices.Contains(params, "default_server") || slices.Contains(params, "default"),
+			SSL:           slices.Contains(params, "ssl"),
+			File:          d.File,
+			Line:          d.Line,
+		})
+	}
+	if len(listens) == 0 {
+		listens = []Listen{{Address: "*:80", File: s.File, Line: s.Line}}
+	}
+	return listens
+}
+
+// ListenAddress normalizes the address of a listen directive to host:port, "*" for any address.
+func ListenAddress(addr string) string {
+	if strings.HasPrefix(addr, "unix:") {
+		return addr
+	}
+	if !strings.ContainsAny(addr, ".:[") && !strings.ContainsFunc(addr, func(r rune) bool { return r < '0' || r > '9' }) {
+		return "*:" + addr
+	}
+	host, port := addr, "80"
+	if i := strings.LastIndex(addr, ":"); i >= 0 && !strings.HasSuffix(addr, "]") {
+		host, port = addr[:i], addr[i+1:]
+	}
+	if host == "" || host == "0.0.0.0" || host == "*" {
+		host = "*"
+	}
+	return host + ":" + port
+}
+
+// MatchServerName reports whether a server_name entry matches a host name: exact names,
+// "*.example.com", ".example.com" (also matching example.com), "example.*" and "~regex".
+func MatchServerName(pattern, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if pattern == "" || host == "" {
+		return pattern == host
+	}
+	switch {
+	case strings.HasPrefix(pattern, "~"):
+		re, err := regexp.Compile(pattern[1:])
+		return err == nil && re.MatchString(host)
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	case strings.HasPrefix(pattern, "."):
+		return host == pattern[1:] || strings.HasSuffix(host, pattern)
+	case strings.HasSuffix(pattern, ".*"):
+		return strings.HasPrefix(host, pattern[:len(pattern)-1])
+	}
+	return strings.ToLower(pattern) == host
+}
@@ -0,0 +1,63 @@
+package nginxconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenAddress(t *testing.T) {
+	assert.Equal(t, "*:80", ListenAddress("80"))
+	assert.Equal(t, "*:8080", ListenAddress("0.0.0.0:8080"))
+	assert.Equal(t, "*:443", ListenAddress("*:443"))
+	assert.Equal(t, "127.0.0.1:80", ListenAddress("127.0.0.1"))
+	assert.Equal(t, "[::]:80", ListenAddress("[::]:80"))
+	assert.Equal(t, "[::1]:80", ListenAddress("[::1]"))
+	assert.Equal(t, "unix:/run/nginx.sock", ListenAddress("unix:/run/nginx.sock"))
+}
+
+func TestMatchServerName(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"example.com", "Example.COM", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{".example.com", "example.com", true},
+		{".example.com", "api.example.com", true},
+		{"example.*", "example.org", true},
+		{"example.*", "www.example.org", false},
+		{`~^api\d+\.example\.com$`, "api1.example.com", true},
+		{`~^api\d+\.example\.com$`, "api.example.com", false},
+		{"", "", true},
+		{"_", "example.com", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MatchServerName(tt.pattern, tt.host), "%s %s", tt.pattern, tt.host)
+	}
+}
+
+func TestHTTPServers(t *testing.T) {
+	cfg := Load(map[string][]byte{
+		"nginx.conf": []byte(`http {
+    server {
+        include snippets/listen.conf;
+        server_name Example.com;
+    }
+    server { server_name _; }
+}
+stream { server { listen 53 udp; } }
+`),
+		"snippets/listen.conf": []byte("listen 443 ssl default_server;\n# comment\n"),
+	}, Options{})
+
+	servers := cfg.HTTPServers()
+	assert.Len(t, servers, 2)
+	assert.Equal(t, []string{"example.com"}, servers[0].Names())
+	assert.Equal(t, []Listen{{Address: "*:443", DefaultServer: true, SSL: true, File: "snippets/listen.conf", Line: 1}}, servers[0].Listens())
+	assert.Len(t, servers[0].Directives, 2)
+	assert.Equal(t, []Listen{{Address: "*:80", File: "nginx.conf", Line: 6}}, servers[1].Listens())
+}
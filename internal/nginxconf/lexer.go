@@ -0,0 +1,145 @@
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokSemicolon
+	tokOpenBrace
+	tokCloseBrace
+	tokComment
+)
+
+// token is a lexical token. For words, value is unquoted and unescaped while raw is the text as written.
+type token struct {
+	kind  tokenKind
+	value string
+	raw   string
+	line  int
+}
+
+// lex splits nginx config text into tokens, following the rules of ngx_conf_read_token:
+// words end at whitespace, ";", "{" or "}", quotes only start at the beginning of a word,
+// a backslash escapes the next character and "${name}" is part of a word.
+func lex(file string, data []byte) ([]token, error) {
+	var tokens []token
+	line := 1
+	i := 0
+	for i < len(data) {
+		ch := data[i]
+		switch {
+		case ch == '\n':
+			line++
+			i++
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			i++
+		case ch == '#':
+			end := i
+			for end < len(data) && data[end] != '\n' {
+				end++
+			}
+			text := string(data[i+1 : end])
+			tokens = append(tokens, token{kind: tokComment, value: text, raw: "#" + text, line: line})
+			i = end
+		case ch == ';':
+			tokens = append(tokens, token{kind: tokSemicolon, value: ";", raw: ";", line: line})
+			i++
+		case ch == '{':
+			tokens = append(tokens, token{kind: tokOpenBrace, value: "{", raw: "{", line: line})
+			i++
+		case ch == '}':
+			tokens = append(tokens, token{kind: tokCloseBrace, value: "}", raw: "}", line: line})
+			i++
+		case ch == '"' || ch == '\'':
+			start, startLine := i, line
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(data) {
+				c := data[i]
+				if c == '\\' && i+1 < len(data) {
+					switch next := data[i+1]; next {
+					case '"', '\'', '\\':
+						b.WriteByte(next)
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					case 'n':
+						b.WriteByte('\n')
+					default:
+						b.WriteByte(c)
+						b.WriteByte(next)
+					}
+					if data[i+1] == '\n' {
+						line++
+					}
+					i += 2
+					continue
+				}
+				if c == ch {
+					closed = true
+					i++
+					break
+				}
+				if c == '\n' {
+					line++
+				}
+				b.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return nil, &ParseError{File: file, Line: startLine, Msg: "unexpected end of file, unterminated quoted string"}
+			}
+			if i < len(data) && !isDelimiter(data[i]) {
+				return nil, &ParseError{File: file, Line: line, Msg: fmt.Sprintf("unexpected %q after quoted string", data[i])}
+			}
+			tokens = append(tokens, token{kind: tokWord, value: b.String(), raw: string(data[start:i]), line: startLine})
+		default:
+			start, startLine := i, line
+			var b strings.Builder
+			for i < len(data) && !isDelimiter(data[i]) {
+				c := data[i]
+				if c == '\\' && i+1 < len(data) {
+					b.WriteByte(c)
+					b.WriteByte(data[i+1])
+					if data[i+1] == '\n' {
+						line++
+					}
+					i += 2
+					continue
+				}
+				// "${name}" keeps its braces inside the word
+				if c == '$' && i+1 < len(data) && data[i+1] == '{' {
+					end := i + 2
+					for end < len(data) && data[end] != '}' && !isSpace(data[end]) {
+						end++
+					}
+					if end >= len(data) || data[end] != '}' {
+						return nil, &ParseError{File: file, Line: line, Msg: "unterminated variable name"}
+					}
+					b.Write(data[i : end+1])
+					i = end + 1
+					continue
+				}
+				b.WriteByte(c)
+				i++
+			}
+			tokens = append(tokens, token{kind: tokWord, value: b.String(), raw: string(data[start:i]), line: startLine})
+		}
+	}
+	return tokens, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isDelimiter(c byte) bool {
+	return isSpace(c) || c == ';' || c == '{' || c == '}'
+}
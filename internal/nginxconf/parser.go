@@ -0,0 +1,90 @@
+package nginxconf
+
+import "fmt"
+
+// Parse parses one nginx config file. Includes are not followed; see Load.
+func Parse(file string, data []byte) (*File, error) {
+	tokens, err := lex(file, data)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{file: file, tokens: tokens}
+	directives, err := p.parseBlock(false)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Path: file, Directives: directives}, nil
+}
+
+type parser struct {
+	file   string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) errorf(line int, format string, args ...any) error {
+	return &ParseError{File: p.file, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseBlock parses directives until the closing brace of the block, or the end of the file at top level.
+func (p *parser) parseBlock(inBlock bool) ([]*Directive, error) {
+	directives := []*Directive{}
+	var cur *Directive
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+
+		switch tok.kind {
+		case tokComment:
+			directives = append(directives, &Directive{Name: "#", Comment: tok.value, File: p.file, Line: tok.line, EndLine: tok.line})
+		case tokWord:
+			if cur == nil {
+				cur = &Directive{Name: tok.value, File: p.file, Line: tok.line}
+				continue
+			}
+			cur.Args = append(cur.Args, tok.value)
+			cur.RawArgs = append(cur.RawArgs, tok.raw)
+			cur.argLines = append(cur.argLines, tok.line)
+		case tokSemicolon:
+			if cur == nil {
+				return nil, p.errorf(tok.line, `unexpected ";"`)
+			}
+			cur.EndLine = tok.line
+			directives = append(directives, cur)
+			cur = nil
+		case tokOpenBrace:
+			if cur == nil {
+				return nil, p.errorf(tok.line, `unexpected "{"`)
+			}
+			block, err := p.parseBlock(true)
+			if err != nil {
+				return nil, err
+			}
+			cur.IsBlock = true
+			cur.Block = block
+			cur.EndLine = p.tokens[p.pos-1].line
+			directives = append(directives, cur)
+			cur = nil
+		case tokCloseBrace:
+			if cur != nil {
+				return nil, p.errorf(tok.line, `unexpected "}", directive %q is not terminated by ";"`, cur.Name)
+			}
+			if !inBlock {
+				return nil, p.errorf(tok.line, `unexpected "}"`)
+			}
+			return directives, nil
+		}
+	}
+
+	line := 1
+	if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	if cur != nil {
+		return nil, p.errorf(line, `unexpected end of file, expecting ";" or "}"`)
+	}
+	if inBlock {
+		return nil, p.errorf(line, `unexpected end of file, expecting "}"`)
+	}
+	return directives, nil
+}
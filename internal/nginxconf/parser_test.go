@@ -0,0 +1,150 @@
+package nginxconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	src := `# main config
+worker_processes auto;
+
+http {
+    log_format main '$remote_addr "$request"';
+    server {
+        listen 80;
+        server_name example.com www.example.com; # inline
+        location ~ ^/api/(.*)$ {
+            return 200 "ok\n";
+            set $x ${host}suffix;
+        }
+    }
+}
+`
+	f, err := Parse("nginx.conf", []byte(src))
+	require.NoError(t, err)
+	require.Len(t, f.Directives, 3)
+
+	assert.True(t, f.Directives[0].IsComment())
+	assert.Equal(t, " main config", f.Directives[0].Comment)
+
+	wp := f.Directives[1]
+	assert.Equal(t, "worker_processes", wp.Name)
+	assert.Equal(t, []string{"auto"}, wp.Args)
+	assert.Equal(t, 2, wp.Line)
+
+	http := f.Directives[2]
+	assert.True(t, http.IsBlock)
+	assert.Equal(t, 4, http.Line)
+	require.Len(t, http.Block, 2)
+	assert.Equal(t, []string{"main", `$remote_addr "$request"`}, http.Block[0].Args)
+	assert.Equal(t, []string{"main", `'$remote_addr "$request"'`}, http.Block[0].RawArgs)
+
+	server := http.Block[1]
+	require.Len(t, server.Block, 4)
+	assert.Equal(t, []string{"example.com", "www.example.com"}, server.Block[1].Args)
+	assert.True(t, server.Block[2].IsComment())
+
+	loc := server.Block[3]
+	assert.Equal(t, []string{"~", "^/api/(.*)$"}, loc.Args)
+	assert.Equal(t, 9, loc.Line)
+	assert.Equal(t, []string{"200", "ok\n"}, loc.Block[0].Args)
+	assert.Equal(t, []string{"$x", "${host}suffix"}, loc.Block[1].Args)
+	assert.Equal(t, "nginx.conf:11", loc.Block[1].Pos())
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+		msg  string
+	}{
+		{"unterminated block", "http {\n  server {\n  }\n", 3, `expecting "}"`},
+		{"missing semicolon", "http {\n  listen 80\n}\n", 3, `not terminated by ";"`},
+		{"extra brace", "events {}\n}\n", 2, `unexpected "}"`},
+		{"unterminated string", "return 200 \"ok;\n", 1, "unterminated quoted string"},
+		{"eof in directive", "worker_processes auto", 1, `expecting ";" or "}"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test.conf", []byte(tt.src))
+			require.Error(t, err)
+			var pe *ParseError
+			require.ErrorAs(t, err, &pe)
+			assert.Equal(t, "test.conf", pe.File)
+			assert.Equal(t, tt.line, pe.Line)
+			assert.Contains(t, pe.Msg, tt.msg)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string][]byte{
+		"nginx.conf": []byte(`events {}
+http {
+    include mime.types;
+    include /etc/nginx/conf.d/*.conf;
+    include snippets/missing.conf;
+    include /usr/share/nginx/modules/*.conf;
+}
+`),
+		"mime.types":           []byte("types { text/html html; }\n"),
+		"conf.d/a.conf":        []byte("server { listen 80; include snippets/ssl.conf; }\n"),
+		"conf.d/b.conf":        []byte("server { listen 81; include snippets/ssl.conf; }\n"),
+		"conf.d/broken.conf":   []byte("server {\n"),
+		"snippets/ssl.conf":    []byte("ssl_protocols TLSv1.3;\n"),
+		"conf.d/unused.conf.x": []byte("x;\n"),
+		"sites/orphan.conf":    []byte("server { listen 82; }\n"),
+	}
+
+	cfg := Load(files, Options{ConfigDir: "/etc/nginx/"})
+	g := cfg.Graph
+
+	var paths []string
+	for _, f := range g.Files {
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(t, []string{"nginx.conf", "mime.types", "conf.d/a.conf", "snippets/ssl.conf", "conf.d/b.conf", "conf.d/broken.conf"}, paths)
+	assert.Len(t, g.Edges, 6)
+	assert.Equal(t, IncludeEdge{From: "nginx.conf", Line: 4, Pattern: "/etc/nginx/conf.d/*.conf", To: "conf.d/a.conf"}, g.Edges[1])
+
+	require.Len(t, g.Unresolved, 2)
+	assert.Equal(t, "no such file", g.Unresolved[0].Error)
+	assert.Equal(t, "outside of the config directory", g.Unresolved[1].Error)
+
+	require.Len(t, g.Errors, 1)
+	assert.Equal(t, "conf.d/broken.conf", g.Errors[0].File)
+	assert.Equal(t, []string{"sites/orphan.conf"}, g.Orphans)
+
+	// included directives are walked in place with the parents of the include
+	var listens []string
+	cfg.Walk(func(d *Directive, parents []*Directive) bool {
+		if d.Name == "ssl_protocols" {
+			require.Len(t, parents, 2)
+			assert.Equal(t, "server", parents[1].Name)
+		}
+		if d.Name == "listen" {
+			listens = append(listens, d.Arg(0))
+		}
+		return true
+	})
+	assert.Equal(t, []string{"80", "81"}, listens)
+}
+
+func TestLoadCycle(t *testing.T) {
+	files := map[string][]byte{
+		"nginx.conf": []byte("include a.conf;\n"),
+		"a.conf":     []byte("include b.conf;\n"),
+		"b.conf":     []byte("include a.conf;\n"),
+	}
+	cfg := Load(files, Options{})
+	require.Len(t, cfg.Graph.Unresolved, 1)
+	assert.Equal(t, IncludeEdge{From: "b.conf", Line: 1, Pattern: "a.conf", To: "a.conf", Error: "include cycle"}, cfg.Graph.Unresolved[0])
+
+	n := 0
+	cfg.Walk(func(*Directive, []*Directive) bool { n++; return true })
+	assert.Equal(t, 3, n)
+}
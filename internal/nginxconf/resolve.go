@@ -0,0 +1,258 @@
+package nginxconf
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultRoot is the main config file, relative to the config directory.
+const DefaultRoot = "nginx.conf"
+
+// Options controls how Load resolves includes.
+type Options struct {
+	// Root is the main config file relative to the config directory; defaults to DefaultRoot.
+	Root string
+	// ConfigDir is the absolute config directory on the server (e.g. /etc/nginx). Absolute
+	// include paths under it are resolved against the tree; others are reported as unresolved.
+	ConfigDir string
+}
+
+// Config is a config tree loaded from the root file, following includes.
+type Config struct {
+	Root      string
+	ConfigDir string
+	Paths     []string         // every file of the tree, sorted
+	Files     map[string]*File // parsed files by path relative to the config directory
+	Graph     *Graph
+
+	exists map[string]bool
+	source map[string][]byte
+}
+
+// Graph describes how the files of a config tree include each other.
+type Graph struct {
+	Root       string        `json:"root"`
+	Files      []GraphFile   `json:"files"`
+	Edges      []IncludeEdge `json:"edges"`
+	Unresolved []IncludeEdge `json:"unresolved,omitempty"`
+	Orphans    []string      `json:"orphans,omitempty"` // .conf files the root never includes
+	Errors     []*ParseError `json:"errors,omitempty"`
+}
+
+// GraphFile is a file reached from the root.
+type GraphFile struct {
+	Path       string `json:"path"`
+	Directives int    `json:"directives"`
+	Error      string `json:"error,omitempty"`
+}
+
+// IncludeEdge is one include directive resolved to one file. Unresolved edges have no To and an Error.
+type IncludeEdge struct {
+	From    string `json:"from"`
+	Line    int    `json:"line"`
+	Pattern string `json:"pattern"`
+	To      string `json:"to,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Load parses the root file of a config tree (relPath -> content) and every file it includes.
+// Parse errors and unresolved includes are recorded in the graph rather than returned, so a
+// partly broken tree can still be inspected.
+func Load(files map[string][]byte, opts Options) *Config {
+	root := opts.Root
+	if root == "" {
+		root = DefaultRoot
+	}
+	l := &loader{
+		files: files,
+		cfg: &Config{
+			Root:      root,
+			ConfigDir: strings.TrimSuffix(opts.ConfigDir, "/"),
+			Files:     make(map[string]*File),
+			Graph:     &Graph{Root: root, Files: []GraphFile{}, Edges: []IncludeEdge{}},
+			exists:    make(map[string]bool),
+			source:    files,
+		},
+		visiting: make(map[string]bool),
+		visited:  make(map[string]bool),
+	}
+	for relPath := range files {
+		l.cfg.Paths = append(l.cfg.Paths, relPath)
+		l.cfg.exists[relPath] = true
+	}
+	sort.Strings(l.cfg.Paths)
+
+	if _, ok := files[root]; ok {
+		l.visit(root)
+	} else {
+		l.cfg.Graph.Unresolved = append(l.cfg.Graph.Unresolved, IncludeEdge{Pattern: root, Error: "root file not found"})
+	}
+
+	for _, relPath := range l.cfg.Paths {
+		if strings.HasSuffix(relPath, ".conf") && !l.visited[relPath] {
+			l.cfg.Graph.Orphans = append(l.cfg.Graph.Orphans, relPath)
+		}
+	}
+	return l.cfg
+}
+
+type loader struct {
+	files    map[string][]byte
+	cfg      *Config
+	visiting map[string]bool // files on the current include path, for cycle detection
+	visited  map[string]bool
+}
+
+func (l *loader) visit(relPath string) {
+	l.visited[relPath] = true
+	gf := GraphFile{Path: relPath}
+	f, err := Parse(relPath, l.files[relPath])
+	if err != nil {
+		gf.Error = err.Error()
+		if pe, ok := err.(*ParseError); ok {
+			l.cfg.Graph.Errors = append(l.cfg.Graph.Errors, pe)
+		}
+		l.cfg.Graph.Files = append(l.cfg.Graph.Files, gf)
+		return
+	}
+	gf.Directives = countDirectives(f.Directives)
+	l.cfg.Files[relPath] = f
+	l.cfg.Graph.Files = append(l.cfg.Graph.Files, gf)
+
+	l.visiting[relPath] = true
+	l.resolveIncludes(f.Directives)
+	delete(l.visiting, relPath)
+}
+
+func (l *loader) resolveIncludes(directives []*Directive) {
+	for _, d := range directives {
+		if d.IsBlock {
+			l.resolveIncludes(d.Block)
+			continue
+		}
+		if d.Name != "include" || len(d.Args) != 1 {
+			continue
+		}
+
+		pattern := d.Args[0]
+		edge := IncludeEdge{From: d.File, Line: d.Line, Pattern: pattern}
+		matches, errMsg := l.match(pattern)
+		if errMsg != "" {
+			edge.Error = errMsg
+			l.cfg.Graph.Unresolved = append(l.cfg.Graph.Unresolved, edge)
+			continue
+		}
+		for _, m := range matches {
+			e := edge
+			e.To = m
+			if l.visiting[m] {
+				e.Error = "include cycle"
+				l.cfg.Graph.Unresolved = append(l.cfg.Graph.Unresolved, e)
+				continue
+			}
+			d.Includes = append(d.Includes, m)
+			l.cfg.Graph.Edges = append(l.cfg.Graph.Edges, e)
+			if !l.visited[m] {
+				l.visit(m)
+			}
+		}
+	}
+}
+
+// match returns the files an include pattern resolves to, in the sorted order nginx loads globs in.
+func (l *loader) match(pattern string) ([]string, string) {
+	rel, ok := l.cfg.RelPath(pattern)
+	if !ok {
+		return nil, "outside of the config directory"
+	}
+
+	if !strings.ContainsAny(rel, "*?[") {
+		if !l.cfg.Exists(rel) {
+			return nil, "no such file"
+		}
+		return []string{rel}, ""
+	}
+
+	// nginx accepts a glob that matches nothing
+	var matches []string
+	for _, p := range l.cfg.Paths {
+		ok, err := path.Match(rel, p)
+		if err != nil {
+			return nil, "invalid pattern: " + err.Error()
+		}
+		if ok {
+			matches = append(matches, p)
+		}
+	}
+	return matches, ""
+}
+
+// RelPath maps a file path used in a directive to a path relative to the config directory.
+// Relative paths are taken as relative to the config directory, as nginx resolves them against
+// its conf prefix. It returns false for absolute paths outside of the config directory.
+func (c *Config) RelPath(p string) (string, bool) {
+	if !path.IsAbs(p) {
+		return path.Clean(p), true
+	}
+	if c.ConfigDir == "" || !strings.HasPrefix(p, c.ConfigDir+"/") {
+		return "", false
+	}
+	return path.Clean(strings.TrimPrefix(p, c.ConfigDir+"/")), true
+}
+
+// Exists reports whether the tree contains a file, by path relative to the config directory.
+func (c *Config) Exists(relPath string) bool {
+	return c.exists[relPath]
+}
+
+// Source returns the content of a file of the tree as loaded.
+func (c *Config) Source(relPath string) ([]byte, bool) {
+	data, ok := c.source[relPath]
+	return data, ok
+}
+
+func countDirectives(directives []*Directive) int {
+	n := 0
+	for _, d := range directives {
+		if d.IsComment() {
+			continue
+		}
+		n++
+		n += countDirectives(d.Block)
+	}
+	return n
+}
+
+// Walk calls fn for every directive of the tree in load order, with the enclosing block
+// directives as parents. Include directives are followed in place, as nginx does, so the
+// parents of an included directive are those of the include. Returning false from fn skips
+// the children of a block directive.
+func (c *Config) Walk(fn func(d *Directive, parents []*Directive) bool) {
+	root, ok := c.Files[c.Root]
+	if !ok {
+		return
+	}
+	c.walk(root.Directives, nil, map[string]bool{c.Root: true}, fn)
+}
+
+func (c *Config) walk(directives []*Directive, parents []*Directive, stack map[string]bool, fn func(*Directive, []*Directive) bool) {
+	for _, d := range directives {
+		if !fn(d, parents) {
+			continue
+		}
+		if d.IsBlock {
+			c.walk(d.Block, append(parents[:len(parents):len(parents)], d), stack, fn)
+			continue
+		}
+		for _, inc := range d.Includes {
+			f, ok := c.Files[inc]
+			if !ok || stack[inc] {
+				continue
+			}
+			stack[inc] = true
+			c.walk(f.Directives, parents, stack, fn)
+			delete(stack, inc)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package plan
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/certs"
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/diff"
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+)
+
+// File operations
+const (
+	ActionAdd    = "add"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// FileChange is a single file operation that applying the production prefix would perform.
+type FileChange struct {
+	Path         string `json:"path"`
+	Action       string `json:"action"`
+	Diff         string `json:"diff,omitempty"`
+	AddedLines   int    `json:"added_lines"`
+	RemovedLines int    `json:"removed_lines"`
+	// Semantic lists the structural changes of an nginx config file, nil if it does not parse.
+	Semantic []nginxconf.Change `json:"semantic,omitempty"`
+}
+
+// HostPlan lists the file operations for one host.
+type HostPlan struct {
+	Group     string       `json:"group"`
+	Host      string       `json:"host"`
+	Name      string       `json:"name"`
+	Prefix    string       `json:"prefix"`
+	RemoteDir string       `json:"remote_dir"`
+	Changes   []FileChange `json:"changes"`
+	Unchanged int          `json:"unchanged"`
+	Add       int          `json:"add"`
+	Update    int          `json:"update"`
+	Delete    int          `json:"delete"`
+	Preserved int          `json:"preserved,omitempty"` // remote files not in etcd that are protected from deletion
+	// CertProblems lists expired, invalid or mismatched certificate/key pairs the apply would ship.
+	CertProblems []string `json:"cert_problems,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Plan is the summary across hosts.
+type Plan struct {
+	Hosts  []HostPlan `json:"hosts"`
+	Add    int        `json:"add"`
+	Update int        `json:"update"`
+	Delete int        `json:"delete"`
+	Errors int        `json:"errors"`
+	// CertProblems is the number of hosts whose desired tree has certificate problems.
+	CertProblems int `json:"cert_problems"`
+}
+
+// RemoteReader reads the content of a remote file by path relative to the config directory.
+type RemoteReader func(relPath string) ([]byte, error)
+
+// Compute returns the file operations that turn the remote tree into the desired tree, sorted by path.
+// desired maps relative paths to content, remote maps relative paths to md5 hashes; the content of
+// remote files is only read, through readRemote, for files that differ. It never writes anything.
+func Compute(desired map[string][]byte, remote map[string]string, readRemote RemoteReader) ([]FileChange, int, error) {
+	var (
+		changes   []FileChange
+		unchanged int
+	)
+
+	for relPath, content := range desired {
+		sum := md5.Sum(content)
+		remoteHash, exists := remote[relPath]
+		if exists && remoteHash == hex.EncodeToString(sum[:]) {
+			unchanged++
+			continue
+		}
+
+		var before []byte
+		action := ActionAdd
+		if exists {
+			action = ActionUpdate
+			var err error
+			if before, err = readRemote(relPath); err != nil {
+				return nil, 0, err
+			}
+		}
+		change, err := newFileChange(relPath, action, string(before), string(content))
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, change)
+	}
+
+	for relPath := range remote {
+		if _, ok := desired[relPath]; ok {
+			continue
+		}
+		before, err := readRemote(relPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		change, err := newFileChange(relPath, ActionDelete, string(before), "")
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, unchanged, nil
+}
+
+func newFileChange(relPath, action, before, after string) (FileChange, error) {
+	res, err := diff.GenerateUnifiedDiff(before, after, "remote/"+relPath, "prod/"+relPath)
+	if err != nil {
+		return FileChange{}, err
+	}
+	change := FileChange{
+		Path:         relPath,
+		Action:       action,
+		Diff:         res.UnifiedDiff,
+		AddedLines:   res.AddedLines,
+		RemovedLines: res.RemovedLines,
+	}
+	if nginxconf.IsConfigFile(relPath) {
+		// a file that does not parse keeps the line diff only, nginx -t reports the error
+		change.Semantic, _ = nginxconf.DiffContent(relPath, []byte(before), []byte(after))
+	}
+	return change, nil
+}
+
+// ForHost plans a single host: the production prefix in etcd against the live remote config directory.
+// Failures are reported in HostPlan.Error so that one unreachable host does not hide the others.
+func ForHost(ctx context.Context, etcdClient *etcd.Client, client *ssh.Client, keyPrefix, group string, srvCfg *config.ServerConfig, opts ssh.ScpOptions) HostPlan {
+	hp := HostPlan{
+		Group:     group,
+		Host:      srvCfg.Host,
+		Name:      srvCfg.Name,
+		Prefix:    path.Join(keyPrefix, group, srvCfg.Host, filepath.Base(srvCfg.NginxConfigDir)),
+		RemoteDir: srvCfg.NginxConfigDir,
+		Changes:   []FileChange{},
+	}
+
+	desired, err := etcdClient.GetFiles(ctx, hp.Prefix)
+	if err != nil {
+		hp.Error = fmt.Sprintf("failed to get files from etcd: %v", err)
+		return hp
+	}
+	nginxCfg := nginxconf.Load(desired, nginxconf.Options{ConfigDir: srvCfg.NginxConfigDir})
+	hp.CertProblems = certs.Problems(certs.Scan(desired, nginxCfg, time.Now(), 0))
+
+	remote, err := ssh.ListRemoteFiles(client, srvCfg.NginxConfigDir)
+	if err != nil {
+		hp.Error = fmt.Sprintf("failed to list remote files: %v", err)
+		return hp
+	}
+	// Protected files stay on the remote, so they are not planned as deletions
+	for relPath := range remote {
+		if _, ok := desired[relPath]; !ok && opts.Protected(relPath) {
+			delete(remote, relPath)
+			hp.Preserved++
+		}
+	}
+
+	changes, unchanged, err := Compute(desired, remote, func(relPath string) ([]byte, error) {
+		return client.ReadFile(path.Join(srvCfg.NginxConfigDir, relPath))
+	})
+	if err != nil {
+		hp.Error = err.Error()
+		return hp
+	}
+	hp.Changes = changes
+	hp.Unchanged = unchanged
+	for _, change := range changes {
+		switch change.Action {
+		case ActionAdd:
+			hp.Add++
+		case ActionUpdate:
+			hp.Update++
+		case ActionDelete:
+			hp.Delete++
+		}
+	}
+	return hp
+}
+
+// Summarize builds the cross-host plan from per-host plans.
+func Summarize(hosts []HostPlan) *Plan {
+	p := &Plan{Hosts: hosts}
+	for _, hp := range hosts {
+		p.Add += hp.Add
+		p.Update += hp.Update
+		p.Delete += hp.Delete
+		if hp.Error != "" {
+			p.Errors++
+		}
+		if len(hp.CertProblems) > 0 {
+			p.CertProblems++
+		}
+	}
+	return p
+}
+
+// HasChanges reports whether applying the plan would modify any host.
+func (p *Plan) HasChanges() bool {
+	return p.Add+p.Update+p.Delete > 0
+}
@@ -0,0 +1,67 @@
+package plan
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCompute(t *testing.T) {
+	remoteContent := map[string]string{
+		"nginx.conf":          "worker_processes 2;\n",
+		"conf.d/same.conf":    "server {}\n",
+		"conf.d/removed.conf": "server { listen 81; }\n",
+	}
+	remote := make(map[string]string)
+	for p, c := range remoteContent {
+		remote[p] = md5Hex(c)
+	}
+	desired := map[string][]byte{
+		"nginx.conf":        []byte("worker_processes 4;\n"),
+		"conf.d/same.conf":  []byte("server {}\n"),
+		"conf.d/added.conf": []byte("server { listen 82; }\n"),
+	}
+
+	var reads []string
+	changes, unchanged, err := Compute(desired, remote, func(relPath string) ([]byte, error) {
+		reads = append(reads, relPath)
+		return []byte(remoteContent[relPath]), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, unchanged)
+	assert.ElementsMatch(t, []string{"nginx.conf", "conf.d/removed.conf"}, reads)
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, "conf.d/added.conf", changes[0].Path)
+	assert.Equal(t, ActionAdd, changes[0].Action)
+	assert.Equal(t, 1, changes[0].AddedLines)
+
+	assert.Equal(t, "conf.d/removed.conf", changes[1].Path)
+	assert.Equal(t, ActionDelete, changes[1].Action)
+	assert.Equal(t, 1, changes[1].RemovedLines)
+
+	assert.Equal(t, "nginx.conf", changes[2].Path)
+	assert.Equal(t, ActionUpdate, changes[2].Action)
+	assert.Contains(t, changes[2].Diff, "-worker_processes 2;")
+	assert.Contains(t, changes[2].Diff, "+worker_processes 4;")
+	require.Len(t, changes[2].Semantic, 1)
+	assert.Equal(t, "worker_processes changed from 2 to 4", changes[2].Semantic[0].String())
+}
+
+func TestComputeReadError(t *testing.T) {
+	_, _, err := Compute(
+		map[string][]byte{"nginx.conf": []byte("a")},
+		map[string]string{"nginx.conf": md5Hex("b")},
+		func(string) ([]byte, error) { return nil, errors.New("boom") },
+	)
+	assert.Error(t, err)
+}
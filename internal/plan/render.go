@@ -0,0 +1,95 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+var actionSymbols = map[string]string{
+	ActionAdd:    "+",
+	ActionUpdate: "~",
+	ActionDelete: "-",
+}
+
+// WriteText renders the plan in a human readable, Terraform-like format.
+func WriteText(w io.Writer, p *Plan, showDiff bool) error {
+	return write(w, p, func(b *strings.Builder, change FileChange) {
+		if showDiff {
+			writeDiff(b, change)
+		}
+	})
+}
+
+// WriteSemantic renders the plan like WriteText, with the structural changes of nginx config
+// files instead of line diffs. Other files, and config files that do not parse, show the line diff.
+func WriteSemantic(w io.Writer, p *Plan) error {
+	return write(w, p, func(b *strings.Builder, change FileChange) {
+		if change.Semantic == nil {
+			writeDiff(b, change)
+			return
+		}
+		if len(change.Semantic) == 0 {
+			b.WriteString("      (formatting or comments only)\n")
+		}
+		for _, c := range change.Semantic {
+			fmt.Fprintf(b, "      %s %s\n", semanticSymbols[c.Kind], c)
+		}
+	})
+}
+
+var semanticSymbols = map[string]string{
+	nginxconf.ChangeAdded:   "+",
+	nginxconf.ChangeChanged: "~",
+	nginxconf.ChangeRemoved: "-",
+}
+
+func writeDiff(b *strings.Builder, change FileChange) {
+	if change.Diff == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(change.Diff, "\n"), "\n") {
+		fmt.Fprintf(b, "      %s\n", line)
+	}
+}
+
+func write(w io.Writer, p *Plan, details func(b *strings.Builder, change FileChange)) error {
+	var b strings.Builder
+
+	for _, hp := range p.Hosts {
+		fmt.Fprintf(&b, "%s/%s (%s) %s\n", hp.Group, hp.Host, hp.Name, hp.RemoteDir)
+		if hp.Error != "" {
+			fmt.Fprintf(&b, "  ! error: %s\n\n", hp.Error)
+			continue
+		}
+		for _, problem := range hp.CertProblems {
+			fmt.Fprintf(&b, "  ! cert: %s\n", problem)
+		}
+		if len(hp.Changes) == 0 {
+			fmt.Fprintf(&b, "  no changes (%d files up to date)\n\n", hp.Unchanged)
+			continue
+		}
+		for _, change := range hp.Changes {
+			fmt.Fprintf(&b, "  %s %s (+%d -%d)\n", actionSymbols[change.Action], change.Path, change.AddedLines, change.RemovedLines)
+			details(&b, change)
+		}
+		fmt.Fprintf(&b, "  %d to add, %d to change, %d to delete, %d unchanged", hp.Add, hp.Update, hp.Delete, hp.Unchanged)
+		if hp.Preserved > 0 {
+			fmt.Fprintf(&b, ", %d preserved", hp.Preserved)
+		}
+		b.WriteString("\n\n")
+	}
+
+	fmt.Fprintf(&b, "Plan: %d to add, %d to change, %d to delete across %d host(s).\n", p.Add, p.Update, p.Delete, len(p.Hosts))
+	if p.Errors > 0 {
+		fmt.Fprintf(&b, "%d host(s) could not be planned.\n", p.Errors)
+	}
+	if p.CertProblems > 0 {
+		fmt.Fprintf(&b, "%d host(s) would ship expired or mismatched certificates.\n", p.CertProblems)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
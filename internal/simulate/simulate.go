@@ -0,0 +1,441 @@
+package simulate
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+)
+
+// Request is the request to route.
+type Request struct {
+	Scheme string `json:"scheme"` // "http" (default) or "https"
+	Host   string `json:"host"`   // Host header, a port suffix is ignored
+	Port   int    `json:"port"`   // default 80 for http, 443 for https
+	Path   string `json:"path"`   // a query string is ignored
+	// Addr is the local address the request arrives on, empty for an address no server
+	// listens on explicitly.
+	Addr string `json:"addr,omitempty"`
+}
+
+// Result is the server block and location nginx would pick for a request, and what it does.
+type Result struct {
+	Server   *ServerMatch   `json:"server,omitempty"`
+	Location *LocationMatch `json:"location,omitempty"`
+	Action   Action         `json:"action"`
+	Notes    []string       `json:"notes,omitempty"`
+}
+
+// ServerMatch describes the selected server block.
+type ServerMatch struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Names     []string `json:"names"`
+	Name      string   `json:"name,omitempty"` // the server_name entry that matched
+	MatchedBy string   `json:"matched_by"`     // exact, leading_wildcard, trailing_wildcard, regex, default_server or first_server
+}
+
+// LocationMatch describes the selected location block.
+type LocationMatch struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Modifier  string   `json:"modifier,omitempty"`
+	Path      string   `json:"path"`
+	MatchedBy string   `json:"matched_by"`        // exact, prefix or regex
+	Parents   []string `json:"parents,omitempty"` // enclosing locations of a nested match, outermost first
+}
+
+// Action is what the selected location does with the request.
+type Action struct {
+	Return    string `json:"return,omitempty"`
+	ProxyPass string `json:"proxy_pass,omitempty"` // or another *_pass directive, with its name
+	Root      string `json:"root,omitempty"`
+	Alias     string `json:"alias,omitempty"`
+	TryFiles  string `json:"try_files,omitempty"`
+	File      string `json:"file,omitempty"` // the file served from root or alias
+}
+
+var passDirectives = []string{"proxy_pass", "fastcgi_pass", "grpc_pass", "uwsgi_pass", "scgi_pass", "memcached_pass"}
+
+// Normalize fills in the defaults of a request and validates it.
+func (r *Request) Normalize() error {
+	if r.Scheme == "" {
+		r.Scheme = "http"
+	}
+	if r.Scheme != "http" && r.Scheme != "https" {
+		return fmt.Errorf("scheme must be 'http' or 'https'")
+	}
+	if r.Port == 0 {
+		r.Port = 80
+		if r.Scheme == "https" {
+			r.Port = 443
+		}
+	}
+	if h, _, ok := strings.Cut(r.Host, ":"); ok && !strings.HasPrefix(r.Host, "[") {
+		r.Host = h
+	}
+	r.Host = strings.ToLower(strings.TrimSuffix(r.Host, "."))
+	r.Addr = strings.Trim(r.Addr, "[]")
+	if p, _, ok := strings.Cut(r.Path, "?"); ok {
+		r.Path = p
+	}
+	if p, err := url.PathUnescape(r.Path); err == nil {
+		r.Path = p
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		r.Path = "/" + r.Path
+	}
+	return nil
+}
+
+// Route picks the server block and location nginx would use for the request. The request is normalized.
+func Route(cfg *nginxconf.Config, req *Request) (*Result, error) {
+	if err := req.Normalize(); err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	if len(cfg.Graph.Errors) > 0 {
+		res.Notes = append(res.Notes, fmt.Sprintf("%d file(s) could not be parsed and were left out", len(cfg.Graph.Errors)))
+	}
+
+	srv, match := selectServer(cfg.HTTPServers(), req)
+	if srv == nil {
+		if addrs := listenAddresses(cfg.HTTPServers(), req.Port); len(addrs) > 0 {
+			res.Notes = append(res.Notes, fmt.Sprintf("port %d is only listened on at %s, set the request address", req.Port, strings.Join(addrs, ", ")))
+		} else {
+			res.Notes = append(res.Notes, fmt.Sprintf("no server listens on port %d", req.Port))
+		}
+		return res, nil
+	}
+	res.Server = match
+	if req.Scheme == "https" && !slices.ContainsFunc(srv.Listens(), func(l nginxconf.Listen) bool {
+		return l.SSL && listenPort(l.Address) == req.Port
+	}) {
+		res.Notes = append(res.Notes, fmt.Sprintf("the server does not listen with ssl on port %d", req.Port))
+	}
+
+	// rewrite module directives of the server run before the location is searched
+	for _, d := range srv.Directives {
+		switch d.Name {
+		case "return":
+			res.Action.Return = strings.Join(d.Args, " ")
+			res.Notes = append(res.Notes, fmt.Sprintf("return at %s runs before location matching", d.Pos()))
+			return res, nil
+		case "rewrite":
+			res.Notes = append(res.Notes, fmt.Sprintf("rewrite at %s is not simulated", d.Pos()))
+		}
+	}
+
+	var chain []*nginxconf.Directive
+	loc, matchedBy := findLocation(cfg, cfg.Children(srv.Directive), req.Path, &chain, &res.Notes)
+	if loc == nil {
+		res.Notes = append(res.Notes, "no location matches, the request is served by the server block")
+	} else {
+		res.Location = &LocationMatch{
+			File:      loc.File,
+			Line:      loc.Line,
+			Modifier:  locationModifier(loc),
+			Path:      locationPath(loc),
+			MatchedBy: matchedBy,
+		}
+		for _, p := range chain {
+			if p != loc {
+				res.Location.Parents = append(res.Location.Parents, strings.Join(p.Args, " "))
+			}
+		}
+	}
+
+	// scopes from the innermost out, for inherited directives
+	scopes := [][]*nginxconf.Directive{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		scopes = append(scopes, cfg.Children(chain[i]))
+	}
+	scopes = append(scopes, srv.Directives, cfg.HTTPDirectives())
+
+	if len(chain) > 0 {
+		for _, d := range scopes[0] {
+			switch {
+			case d.Name == "return" && res.Action.Return == "":
+				res.Action.Return = strings.Join(d.Args, " ")
+			case slices.Contains(passDirectives, d.Name) && res.Action.ProxyPass == "":
+				res.Action.ProxyPass = d.Name + " " + strings.Join(d.Args, " ")
+				if d.Name == "proxy_pass" {
+					res.Action.ProxyPass = d.Arg(0)
+				}
+			case d.Name == "alias":
+				res.Action.Alias = d.Arg(0)
+			case d.Name == "rewrite":
+				res.Notes = append(res.Notes, fmt.Sprintf("rewrite at %s is not simulated", d.Pos()))
+			}
+		}
+	}
+	if res.Action.Return != "" || res.Action.ProxyPass != "" {
+		return res, nil
+	}
+
+	if tf := inherited(scopes, "try_files"); tf != nil {
+		res.Action.TryFiles = strings.Join(tf.Args, " ")
+	}
+	if res.Action.Alias != "" {
+		res.Action.File = res.Action.Alias + strings.TrimPrefix(req.Path, locationPath(chain[len(chain)-1]))
+		if locationModifier(chain[len(chain)-1]) == "~" || locationModifier(chain[len(chain)-1]) == "~*" {
+			res.Action.File = res.Action.Alias
+		}
+		return res, nil
+	}
+	res.Action.Root = "html"
+	if root := inherited(scopes, "root"); root != nil {
+		res.Action.Root = root.Arg(0)
+	}
+	res.Action.File = strings.TrimSuffix(res.Action.Root, "/") + req.Path
+	return res, nil
+}
+
+// inherited returns the innermost directive with the given name.
+func inherited(scopes [][]*nginxconf.Directive, name string) *nginxconf.Directive {
+	for _, scope := range scopes {
+		for _, d := range scope {
+			if d.Name == name {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+func listenPort(addr string) int {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return 0
+	}
+	port, _ := strconv.Atoi(addr[i+1:])
+	return port
+}
+
+// listenHost returns the host of a normalized listen address, "*" for any IPv4 or IPv6 address.
+func listenHost(addr string) string {
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		host = addr[:i]
+	}
+	host = strings.Trim(host, "[]")
+	if host == "::" {
+		return "*"
+	}
+	return host
+}
+
+// listenAddresses returns the explicit addresses servers listen on at port.
+func listenAddresses(servers []*nginxconf.ServerBlock, port int) []string {
+	var addrs []string
+	for _, srv := range servers {
+		for _, l := range srv.Listens() {
+			if host := listenHost(l.Address); listenPort(l.Address) == port && host != "*" && !slices.Contains(addrs, host) {
+				addrs = append(addrs, host)
+			}
+		}
+	}
+	return addrs
+}
+
+// selectServer picks the server block like nginx. The address and port of the request select
+// the candidates first: the servers listening on exactly that address, or, if there are none,
+// those listening on every address of the port. Among them wins an exact name, then the longest
+// wildcard starting with "*", then the longest wildcard ending with "*", then the first matching
+// regex, and finally the default server of the address.
+func selectServer(servers []*nginxconf.ServerBlock, req *Request) (*nginxconf.ServerBlock, *ServerMatch) {
+	var candidates []*nginxconf.ServerBlock
+	var defaultServer *nginxconf.ServerBlock
+	for _, wantHost := range []string{req.Addr, "*"} {
+		if wantHost == "" {
+			continue
+		}
+		for _, srv := range servers {
+			for _, l := range srv.Listens() {
+				if listenPort(l.Address) != req.Port || listenHost(l.Address) != wantHost {
+					continue
+				}
+				if !slices.Contains(candidates, srv) {
+					candidates = append(candidates, srv)
+				}
+				if l.DefaultServer && defaultServer == nil {
+					defaultServer = srv
+				}
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	newMatch := func(srv *nginxconf.ServerBlock, name, matchedBy string) *ServerMatch {
+		return &ServerMatch{File: srv.File, Line: srv.Line, Names: srv.Names(), Name: name, MatchedBy: matchedBy}
+	}
+
+	for _, srv := range candidates {
+		for _, name := range srv.Names() {
+			if !strings.ContainsAny(name, "*~") && !strings.HasPrefix(name, ".") && name == req.Host {
+				return srv, newMatch(srv, name, "exact")
+			}
+		}
+	}
+
+	var best *nginxconf.ServerBlock
+	var bestName string
+	for _, srv := range candidates {
+		for _, name := range srv.Names() {
+			if (strings.HasPrefix(name, "*.") || strings.HasPrefix(name, ".")) && len(name) > len(bestName) && nginxconf.MatchServerName(name, req.Host) {
+				best, bestName = srv, name
+			}
+		}
+	}
+	if best != nil {
+		return best, newMatch(best, bestName, "leading_wildcard")
+	}
+	for _, srv := range candidates {
+		for _, name := range srv.Names() {
+			if strings.HasSuffix(name, ".*") && len(name) > len(bestName) && nginxconf.MatchServerName(name, req.Host) {
+				best, bestName = srv, name
+			}
+		}
+	}
+	if best != nil {
+		return best, newMatch(best, bestName, "trailing_wildcard")
+	}
+	for _, srv := range candidates {
+		for _, name := range srv.Names() {
+			if strings.HasPrefix(name, "~") && nginxconf.MatchServerName(name, req.Host) {
+				return srv, newMatch(srv, name, "regex")
+			}
+		}
+	}
+
+	if defaultServer != nil {
+		return defaultServer, newMatch(defaultServer, "", "default_server")
+	}
+	return candidates[0], newMatch(candidates[0], "", "first_server")
+}
+
+func locationModifier(d *nginxconf.Directive) string {
+	if len(d.Args) > 1 {
+		return d.Args[0]
+	}
+	return ""
+}
+
+func locationPath(d *nginxconf.Directive) string {
+	if len(d.Args) == 0 {
+		return ""
+	}
+	return d.Args[len(d.Args)-1]
+}
+
+// findLocation searches the locations among directives as ngx_http_core_find_location does:
+// an exact match wins, otherwise the longest prefix is remembered and its nested locations are
+// searched, then the regex locations are tried in order unless the prefix has "^~". The
+// enclosing locations of the result are appended to chain, ending with the result itself.
+// Regexes Go cannot compile (PCRE lookarounds, backreferences, ...) are skipped with a note,
+// since the result only holds if nginx does not match them either.
+func findLocation(cfg *nginxconf.Config, directives []*nginxconf.Directive, uri string, chain *[]*nginxconf.Directive, notes *[]string) (*nginxconf.Directive, string) {
+	var prefix *nginxconf.Directive
+	var regexes []*nginxconf.Directive
+	for _, d := range directives {
+		if d.Name != "location" || !d.IsBlock || len(d.Args) == 0 {
+			continue
+		}
+		p := locationPath(d)
+		switch locationModifier(d) {
+		case "=":
+			if p == uri {
+				*chain = append(*chain, d)
+				return d, "exact"
+			}
+		case "", "^~":
+			if strings.HasPrefix(p, "@") {
+				continue
+			}
+			if strings.HasPrefix(uri, p) && (prefix == nil || len(p) > len(locationPath(prefix))) {
+				prefix = d
+			}
+		case "~", "~*":
+			regexes = append(regexes, d)
+		}
+	}
+
+	var found *nginxconf.Directive
+	matchedBy := ""
+	depth := len(*chain)
+	if prefix != nil {
+		*chain = append(*chain, prefix)
+		found, matchedBy = prefix, "prefix"
+		if nested, by := findLocation(cfg, cfg.Children(prefix), uri, chain, notes); nested != nil {
+			found, matchedBy = nested, by
+			if by == "exact" || by == "regex" {
+				return found, matchedBy
+			}
+		}
+		if locationModifier(prefix) == "^~" {
+			return found, matchedBy
+		}
+	}
+
+	for _, d := range regexes {
+		expr := locationPath(d)
+		if locationModifier(d) == "~*" {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			*notes = append(*notes, fmt.Sprintf("regex location %s at %s cannot be evaluated and was assumed not to match: %v", expr, d.Pos(), err))
+			continue
+		}
+		if !re.MatchString(uri) {
+			continue
+		}
+		*chain = append((*chain)[:depth], d)
+		if nested, by := findLocation(cfg, cfg.Children(d), uri, chain, notes); nested != nil {
+			return nested, by
+		}
+		return d, "regex"
+	}
+	return found, matchedBy
+}
+
+// Diff lists how two results for the same request differ, ignoring file positions.
+func Diff(a, b *Result) []string {
+	var diffs []string
+	add := func(what, x, y string) {
+		if x != y {
+			diffs = append(diffs, fmt.Sprintf("%s: %q -> %q", what, x, y))
+		}
+	}
+	add("server", a.Server.describe(), b.Server.describe())
+	add("location", a.Location.describe(), b.Location.describe())
+	add("return", a.Action.Return, b.Action.Return)
+	add("proxy_pass", a.Action.ProxyPass, b.Action.ProxyPass)
+	add("root", a.Action.Root, b.Action.Root)
+	add("alias", a.Action.Alias, b.Action.Alias)
+	add("try_files", a.Action.TryFiles, b.Action.TryFiles)
+	return diffs
+}
+
+func (m *ServerMatch) describe() string {
+	if m == nil {
+		return ""
+	}
+	return strings.Join(m.Names, " ")
+}
+
+func (m *LocationMatch) describe() string {
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m.Modifier + " " + m.Path)
+}
@@ -0,0 +1,198 @@
+package simulate
+
+import (
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `http {
+    root /srv/default;
+    server {
+        listen 80 default_server;
+        server_name _;
+        return 444;
+    }
+    server {
+        listen 80;
+        listen 443 ssl;
+        server_name example.com www.example.com;
+        root /srv/www;
+
+        location / {
+            try_files $uri /index.html;
+        }
+        location = /healthz {
+            return 200 ok;
+        }
+        location ^~ /static/ {
+            alias /srv/assets/;
+        }
+        location /api/ {
+            proxy_pass http://api_backend;
+            location /api/admin/ {
+                proxy_pass http://admin_backend;
+            }
+        }
+        location ~* \.(png|jpg)$ {
+            root /srv/images;
+        }
+    }
+    server {
+        listen 80;
+        server_name *.example.com;
+        location / { proxy_pass http://wildcard; }
+    }
+    server {
+        listen 80;
+        server_name ~^(?<tenant>\w+)\.example\.org$;
+        location / { proxy_pass http://tenants; }
+    }
+}
+`
+
+func route(t *testing.T, req Request) *Result {
+	t.Helper()
+	cfg := nginxconf.Load(map[string][]byte{"nginx.conf": []byte(testConfig)}, nginxconf.Options{})
+	res, err := Route(cfg, &req)
+	require.NoError(t, err)
+	return res
+}
+
+func TestRouteServer(t *testing.T) {
+	tests := []struct {
+		host      string
+		line      int
+		matchedBy string
+	}{
+		{"www.example.com", 8, "exact"},
+		{"Example.com:8080", 8, "exact"},
+		{"api.example.com", 33, "leading_wildcard"},
+		{"acme.example.org", 38, "regex"},
+		{"unknown.net", 3, "default_server"},
+	}
+	for _, tt := range tests {
+		res := route(t, Request{Host: tt.host, Path: "/"})
+		require.NotNil(t, res.Server, tt.host)
+		assert.Equal(t, tt.line, res.Server.Line, tt.host)
+		assert.Equal(t, tt.matchedBy, res.Server.MatchedBy, tt.host)
+	}
+
+	res := route(t, Request{Host: "unknown.net", Path: "/"})
+	assert.Equal(t, "444", res.Action.Return)
+	assert.Nil(t, res.Location)
+
+	res = route(t, Request{Host: "example.com", Port: 8443, Path: "/"})
+	assert.Nil(t, res.Server)
+	assert.Equal(t, []string{"no server listens on port 8443"}, res.Notes)
+}
+
+func TestRouteLocation(t *testing.T) {
+	tests := []struct {
+		path      string
+		location  string
+		matchedBy string
+		action    Action
+	}{
+		{"/healthz", "/healthz", "exact", Action{Return: "200 ok"}},
+		{"/healthz/x", "/", "prefix", Action{Root: "/srv/www", TryFiles: "$uri /index.html", File: "/srv/www/healthz/x"}},
+		{"/static/logo.png", "/static/", "prefix", Action{Alias: "/srv/assets/", File: "/srv/assets/logo.png"}},
+		{"/api/users?id=1", "/api/", "prefix", Action{ProxyPass: "http://api_backend"}},
+		{"/api/admin/users", "/api/admin/", "prefix", Action{ProxyPass: "http://admin_backend"}},
+		{"/api/logo.PNG", "\\.(png|jpg)$", "regex", Action{Root: "/srv/images", File: "/srv/images/api/logo.PNG"}},
+		{"/img/a%20b.jpg", "\\.(png|jpg)$", "regex", Action{Root: "/srv/images", File: "/srv/images/img/a b.jpg"}},
+	}
+	for _, tt := range tests {
+		res := route(t, Request{Host: "example.com", Path: tt.path})
+		require.NotNil(t, res.Location, tt.path)
+		assert.Equal(t, tt.location, res.Location.Path, tt.path)
+		assert.Equal(t, tt.matchedBy, res.Location.MatchedBy, tt.path)
+		assert.Equal(t, tt.action, res.Action, tt.path)
+	}
+
+	res := route(t, Request{Host: "example.com", Path: "/api/admin/x"})
+	assert.Equal(t, []string{"/api/"}, res.Location.Parents)
+}
+
+func TestRouteHTTPS(t *testing.T) {
+	res := route(t, Request{Scheme: "https", Host: "example.com", Path: "/"})
+	assert.Equal(t, 8, res.Server.Line)
+	assert.Empty(t, res.Notes)
+
+	_, err := Route(nginxconf.Load(nil, nginxconf.Options{}), &Request{Scheme: "ftp"})
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	a := route(t, Request{Host: "example.com", Path: "/api/admin/x"})
+	b := route(t, Request{Host: "example.com", Path: "/api/x"})
+	assert.Equal(t, []string{
+		`location: "/api/admin/" -> "/api/"`,
+		`proxy_pass: "http://admin_backend" -> "http://api_backend"`,
+	}, Diff(a, b))
+	assert.Empty(t, Diff(a, a))
+}
+
+func TestRouteListenAddress(t *testing.T) {
+	cfg := nginxconf.Load(map[string][]byte{"nginx.conf": []byte(`http {
+    server {
+        listen 80;
+        server_name example.com;
+        return 200 any;
+    }
+    server {
+        listen 10.0.0.1:80;
+        server_name other.example.com;
+        return 200 internal;
+    }
+    server {
+        listen 10.0.0.1:8080;
+        server_name example.com;
+    }
+}
+`)}, nginxconf.Options{})
+	route := func(req Request) *Result {
+		t.Helper()
+		res, err := Route(cfg, &req)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Servers on every address do not take requests to an address a server listens on explicitly,
+	// even when only they have the matching name
+	res := route(Request{Host: "example.com", Addr: "10.0.0.1"})
+	require.NotNil(t, res.Server)
+	assert.Equal(t, 7, res.Server.Line)
+	assert.Equal(t, "first_server", res.Server.MatchedBy)
+
+	res = route(Request{Host: "example.com", Addr: "10.0.0.2"})
+	assert.Equal(t, 2, res.Server.Line)
+	assert.Equal(t, "exact", res.Server.MatchedBy)
+	res = route(Request{Host: "example.com"})
+	assert.Equal(t, 2, res.Server.Line)
+
+	res = route(Request{Host: "example.com", Port: 8080})
+	assert.Nil(t, res.Server)
+	assert.Equal(t, []string{"port 8080 is only listened on at 10.0.0.1, set the request address"}, res.Notes)
+	res = route(Request{Host: "example.com", Port: 8080, Addr: "10.0.0.1"})
+	assert.Equal(t, 12, res.Server.Line)
+}
+
+func TestRouteUnsupportedRegex(t *testing.T) {
+	cfg := nginxconf.Load(map[string][]byte{"nginx.conf": []byte(`http {
+    server {
+        listen 80;
+        location / { root /srv/www; }
+        location ~ ^/(?!api)\w+\.php$ { fastcgi_pass php; }
+        location ~ \.php$ { return 403; }
+    }
+}
+`)}, nginxconf.Options{})
+	res, err := Route(cfg, &Request{Host: "example.com", Path: "/index.php"})
+	require.NoError(t, err)
+	assert.Equal(t, "403", res.Action.Return)
+	require.Len(t, res.Notes, 1)
+	assert.Contains(t, res.Notes[0], `regex location ^/(?!api)\w+\.php$ at nginx.conf:5 cannot be evaluated`)
+}
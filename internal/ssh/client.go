@@ -1,6 +1,8 @@
 package ssh
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -119,6 +121,44 @@ func (c *Client) RunCommand(cmd string) (string, error) {
 	return string(output), nil
 }
 
+// ShellQuote quotes s as a single word for the remote shell of RunCommand and RunCommandContext.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// RunCommandContext runs a command on the remote server and kills it when ctx is done.
+func (c *Client) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	session, err := c.sshClient.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+
+	if err := session.Start(cmd); err != nil {
+		return "", fmt.Errorf("failed to start command '%s': %w", cmd, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return output.String(), fmt.Errorf("failed to run command '%s': %w", cmd, err)
+		}
+		return output.String(), nil
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return output.String(), fmt.Errorf("command '%s' aborted: %w", cmd, ctx.Err())
+	}
+}
+
 // ReadFile reads the content of a remote file using SFTP.
 func (c *Client) ReadFile(path string) ([]byte, error) {
 	file, err := c.sftpClient.Open(path)
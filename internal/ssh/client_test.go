@@ -114,3 +114,17 @@ func TestClient_Operations(t *testing.T) {
 		}
 	})
 }
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"":                     "''",
+		"http://127.0.0.1/":    "'http://127.0.0.1/'",
+		"Host: example.com":    "'Host: example.com'",
+		"it's $HOME; rm -rf /": `'it'\''s $HOME; rm -rf /'`,
+	}
+	for s, want := range cases {
+		if got := ShellQuote(s); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
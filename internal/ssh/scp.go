@@ -7,53 +7,82 @@ import (
 	"fmt"
 	"maps"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/logn-xu/gitops-nginx/internal/config"
 	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	"github.com/logn-xu/gitops-nginx/internal/ignore"
 	"github.com/logn-xu/gitops-nginx/pkg/log"
 )
 
 // ScpResult holds the summary of the sync operation.
 type ScpResult struct {
-	Total        int
-	Skipped      int
-	Updated      int
-	Added        int
-	Deleted      int
-	UpdatedFiles []string
-	AddedFiles   []string
-	DeletedFiles []string
+	Total          int
+	Skipped        int
+	Updated        int
+	Added          int
+	Deleted        int
+	Preserved      int
+	UpdatedFiles   []string
+	AddedFiles     []string
+	DeletedFiles   []string
+	PreservedFiles []string
 }
 
-// ScpEtcdToRemote recursively and concurrently copies files from etcd prefix to remote server.
-// It ensures strong consistency: deletes extra remote files, copies missing files, overwrites changed files.
-func ScpEtcdToRemote(ctx context.Context, etcdCli *etcd.Client, pool *SFTPPool, srvCfg *config.ServerConfig, etcdPrefix string, remoteBaseDir string) (ScpResult, error) {
-	var result ScpResult
+// ScpOptions decides which remote files that are not in etcd a mirror upload leaves in place.
+// The zero value still protects hidden and editor files (see ignore.IsIgnored), which the remote
+// syncer never reads; set Exact to mirror deletions exactly.
+type ScpOptions struct {
+	// Exact deletes every remote file that is not in etcd, hidden files included, and overrides
+	// the other fields. Use it for scratch directories such as the check directory.
+	Exact bool
+	// IgnorePatterns are the nginx_syncer ignore patterns, matching remote files are not managed.
+	IgnorePatterns []string
+	// PreservePatterns exempt matching remote files from deletion.
+	PreservePatterns []string
+	// NoDelete keeps every remote file.
+	NoDelete bool
+	// DeleteGuard, if set, is called with the files about to be deleted and the number of remote
+	// files before anything is changed. An error aborts the upload.
+	DeleteGuard func(deleting []string, existing int) error
+}
 
-	// 1. Get all files from etcd
-	resp, err := etcdCli.GetPrefix(ctx, etcdPrefix)
-	if err != nil {
-		return result, fmt.Errorf("failed to get files from etcd: %w", err)
+// NewScpOptions returns the options for uploading into the live config directory of a server.
+func NewScpOptions(srvCfg *config.ServerConfig, ignorePatterns []string) ScpOptions {
+	return ScpOptions{
+		IgnorePatterns:   ignorePatterns,
+		PreservePatterns: srvCfg.PreservePatterns,
+		NoDelete:         srvCfg.NoDelete,
 	}
+}
 
-	// Build map of etcd files: relPath -> content
-	etcdFiles := make(map[string][]byte)
-	for _, kv := range resp.Kvs {
-		key := string(kv.Key)
-		// Skip metadata keys (.hash, .commit, .meta)
-		if strings.HasSuffix(key, ".hash") || strings.HasSuffix(key, ".commit") || strings.HasSuffix(key, ".meta") {
-			continue
-		}
-		relPath := strings.TrimPrefix(key, etcdPrefix)
-		relPath = strings.TrimPrefix(relPath, "/")
-		if relPath == "" {
-			continue
-		}
-		etcdFiles[relPath] = kv.Value
+// Protected reports whether a remote file that is not in etcd must be left in place.
+func (o ScpOptions) Protected(relPath string) bool {
+	if o.Exact {
+		return false
 	}
+	return o.NoDelete || ignore.IsIgnored(relPath, o.IgnorePatterns) || ignore.Match(relPath, o.PreservePatterns)
+}
 
+// ScpEtcdToRemote recursively and concurrently copies files from etcd prefix to remote server.
+// It ensures strong consistency: deletes extra remote files unless opts protects them, copies
+// missing files, overwrites changed files.
+func ScpEtcdToRemote(ctx context.Context, etcdCli *etcd.Client, pool *SFTPPool, srvCfg *config.ServerConfig, etcdPrefix string, remoteBaseDir string, opts ScpOptions) (ScpResult, error) {
+	// 1. Get all files from etcd (metadata keys are skipped)
+	etcdFiles, err := etcdCli.GetFiles(ctx, etcdPrefix)
+	if err != nil {
+		return ScpResult{}, fmt.Errorf("failed to get files from etcd: %w", err)
+	}
+
+	return ScpFilesToRemote(ctx, pool, srvCfg, etcdFiles, remoteBaseDir, opts)
+}
+
+// ScpFilesToRemote mirrors files (relPath -> content) into remoteBaseDir with the same
+// guarantees as ScpEtcdToRemote.
+func ScpFilesToRemote(ctx context.Context, pool *SFTPPool, srvCfg *config.ServerConfig, etcdFiles map[string][]byte, remoteBaseDir string, opts ScpOptions) (ScpResult, error) {
+	var result ScpResult
 	result.Total = len(etcdFiles)
 
 	// 2. Get remote file list
@@ -68,11 +97,23 @@ func ScpEtcdToRemote(ctx context.Context, etcdCli *etcd.Client, pool *SFTPPool,
 		return result, fmt.Errorf("failed to list remote files: %w", err)
 	}
 
-	// 3. Find files to delete (exist on remote but not in etcd)
+	// 3. Find files to delete (exist on remote but not in etcd and not protected)
 	var filesToDelete []string
 	for remoteRelPath := range remoteFiles {
-		if _, exists := etcdFiles[remoteRelPath]; !exists {
-			filesToDelete = append(filesToDelete, remoteRelPath)
+		if _, exists := etcdFiles[remoteRelPath]; exists {
+			continue
+		}
+		if opts.Protected(remoteRelPath) {
+			result.Preserved++
+			result.PreservedFiles = append(result.PreservedFiles, remoteRelPath)
+			continue
+		}
+		filesToDelete = append(filesToDelete, remoteRelPath)
+	}
+	if opts.DeleteGuard != nil {
+		sort.Strings(filesToDelete)
+		if err := opts.DeleteGuard(filesToDelete, len(remoteFiles)); err != nil {
+			return result, err
 		}
 	}
 
@@ -90,7 +131,7 @@ func ScpEtcdToRemote(ctx context.Context, etcdCli *etcd.Client, pool *SFTPPool,
 			}
 			result.Deleted++
 			result.DeletedFiles = append(result.DeletedFiles, relPath)
-			log.Logger.WithField("prefix", etcdPrefix).WithField("remotePath", remotePath).Info("Deleted remote file")
+			log.Logger.WithField("host", srvCfg.Host).WithField("remotePath", remotePath).Info("Deleted remote file")
 		}
 		pool.Put(delClient)
 	}
@@ -169,6 +210,11 @@ func ScpEtcdToRemote(ctx context.Context, etcdCli *etcd.Client, pool *SFTPPool,
 	return result, nil
 }
 
+// ListRemoteFiles lists all files under baseDir and returns a map of relPath -> md5hash.
+func ListRemoteFiles(client *Client, baseDir string) (map[string]string, error) {
+	return listRemoteFilesRecursive(client, baseDir, baseDir)
+}
+
 // listRemoteFilesRecursive recursively lists all files under baseDir and returns a map of relPath -> md5hash.
 func listRemoteFilesRecursive(client *Client, baseDir, currentDir string) (map[string]string, error) {
 	files := make(map[string]string)
@@ -0,0 +1,41 @@
+package ssh
+
+import "testing"
+
+func TestScpOptionsProtected(t *testing.T) {
+	opts := ScpOptions{
+		IgnorePatterns:   []string{"*.log"},
+		PreservePatterns: []string{"mime.types", "ssl/live"},
+	}
+
+	cases := map[string]bool{
+		"mime.types":                    true,
+		"ssl/live/example.com/cert.pem": true,
+		"logs/error.log":                true,
+		".htpasswd":                     true, // hidden files are never managed
+		"conf.d/old.conf":               false,
+		"ssl/dhparam.pem":               false,
+	}
+	for relPath, want := range cases {
+		if got := opts.Protected(relPath); got != want {
+			t.Errorf("Protected(%q) = %v, want %v", relPath, got, want)
+		}
+	}
+
+	if !(ScpOptions{NoDelete: true}).Protected("conf.d/old.conf") {
+		t.Error("NoDelete should protect every file")
+	}
+	if (ScpOptions{}).Protected("conf.d/old.conf") {
+		t.Error("zero options should mirror deletions")
+	}
+	if !(ScpOptions{}).Protected("conf.d/.old.conf") {
+		t.Error("zero options should protect hidden files")
+	}
+
+	exact := ScpOptions{Exact: true, NoDelete: true, PreservePatterns: []string{"mime.types"}}
+	for _, relPath := range []string{"conf.d/.old.conf", ".htpasswd", "mime.types", "nginx.conf~"} {
+		if exact.Protected(relPath) {
+			t.Errorf("Exact should not protect %q", relPath)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Alert kinds
+const (
+	AlertMassDelete = "mass_delete"
+	AlertCertExpiry = "cert_expiry"
+)
+
+// Alert reports a blocked operation that needs attention. There is at most one alert per
+// kind, source and host; raising it again updates LastSeen and Count.
+type Alert struct {
+	Kind      string            `json:"kind"`
+	Source    string            `json:"source"` // e.g. "sync", "update.apply"
+	Group     string            `json:"group"`
+	Host      string            `json:"host"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Count     int               `json:"count"`
+}
+
+// alertKey returns the key of an alert.
+// Format: ${state_key_prefix}/alerts/${kind}/${group}/${host}/${source}
+func (s *Store) alertKey(kind, group, host, source string) string {
+	return s.key("alerts", kind, group, host, source)
+}
+
+// RaiseAlert records an alert, or refreshes it if it is already open. It returns the stored alert.
+func (s *Store) RaiseAlert(ctx context.Context, alert Alert) (*Alert, error) {
+	now := time.Now()
+	key := s.alertKey(alert.Kind, alert.Group, alert.Host, alert.Source)
+
+	var existing Alert
+	ok, err := s.getJSON(ctx, key, &existing)
+	if err != nil {
+		return nil, err
+	}
+	alert.FirstSeen = now
+	alert.Count = 1
+	if ok {
+		alert.FirstSeen = existing.FirstSeen
+		alert.Count = existing.Count + 1
+	}
+	alert.LastSeen = now
+	if err := s.putJSON(ctx, key, alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// ResolveAlert removes an open alert, if any.
+func (s *Store) ResolveAlert(ctx context.Context, kind, group, host, source string) error {
+	return s.delete(ctx, s.alertKey(kind, group, host, source))
+}
+
+// ListAlerts returns the open alerts, most recently seen first.
+func (s *Store) ListAlerts(ctx context.Context) ([]Alert, error) {
+	var alerts []Alert
+	err := s.listJSON(ctx, s.key("alerts"), func(data []byte) error {
+		var alert Alert
+		if err := json.Unmarshal(data, &alert); err != nil {
+			return err
+		}
+		alerts = append(alerts, alert)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(alerts, func(a, b Alert) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return alerts, nil
+}
@@ -0,0 +1,54 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AuditEvent records an operation that bypassed or changed a safety control.
+type AuditEvent struct {
+	ID      string            `json:"id"`
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`
+	Action  string            `json:"action"`
+	Group   string            `json:"group,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Reason  string            `json:"reason,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// RecordAudit appends an event to the audit trail. Events are keyed by time so they list in order.
+func (s *Store) RecordAudit(ctx context.Context, event AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.ID == "" {
+		event.ID = fmt.Sprintf("%020d", event.Time.UnixNano())
+	}
+	return s.putJSON(ctx, s.key("audit", event.ID), event)
+}
+
+// ListAudit returns the most recent audit events, newest first. A limit <= 0 returns all events.
+func (s *Store) ListAudit(ctx context.Context, limit int) ([]AuditEvent, error) {
+	var events []AuditEvent
+	err := s.listJSON(ctx, s.key("audit"), func(data []byte) error {
+		var event AuditEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(events)
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
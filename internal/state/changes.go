@@ -0,0 +1,104 @@
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Change request statuses
+const (
+	ChangePending  = "pending"
+	ChangeApproved = "approved"
+	ChangeApplied  = "applied"
+)
+
+// ChangeRequest is a deploy of a commit to a host (or every host of a group when Host is empty)
+// that has to be approved by a second user before it can be applied.
+type ChangeRequest struct {
+	ID          string    `json:"id"`
+	Group       string    `json:"group"`
+	Host        string    `json:"host,omitempty"`
+	Commit      string    `json:"commit"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	ApprovedBy  string    `json:"approved_by,omitempty"`
+	ApprovedAt  time.Time `json:"approved_at,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	// Fingerprints holds, per host, the fingerprint of the production prefix at approval time.
+	Fingerprints map[string]string `json:"fingerprints,omitempty"`
+	// AppliedHosts lists the hosts the change has been applied to.
+	AppliedHosts []string `json:"applied_hosts,omitempty"`
+}
+
+// Covers reports whether the change targets host.
+func (cr *ChangeRequest) Covers(host string) bool {
+	return cr.Host == "" || cr.Host == host
+}
+
+// NewChangeID returns a random change request id.
+func NewChangeID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate change id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PutChange creates or replaces a change request.
+func (s *Store) PutChange(ctx context.Context, cr ChangeRequest) error {
+	return s.putJSON(ctx, s.key("changes", cr.ID), cr)
+}
+
+// GetChange returns a change request, or nil if it does not exist.
+func (s *Store) GetChange(ctx context.Context, id string) (*ChangeRequest, error) {
+	var cr ChangeRequest
+	ok, err := s.getJSON(ctx, s.key("changes", id), &cr)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &cr, nil
+}
+
+// GetChangeRevision is GetChange that also returns the etcd mod revision of the record, for
+// PutChangeIfUnmodified.
+func (s *Store) GetChangeRevision(ctx context.Context, id string) (*ChangeRequest, int64, error) {
+	var cr ChangeRequest
+	ok, rev, err := s.getJSONRevision(ctx, s.key("changes", id), &cr)
+	if err != nil || !ok {
+		return nil, 0, err
+	}
+	return &cr, rev, nil
+}
+
+// PutChangeIfUnmodified stores a change request read at modRevision in one etcd transaction
+// that fails if the record was written since. It returns false in that case.
+func (s *Store) PutChangeIfUnmodified(ctx context.Context, cr ChangeRequest, modRevision int64) (bool, error) {
+	return s.putJSONIf(ctx, s.key("changes", cr.ID), cr, modRevision)
+}
+
+// ListChanges returns all change requests, or only those of a group when group is not empty,
+// newest first.
+func (s *Store) ListChanges(ctx context.Context, group string) ([]ChangeRequest, error) {
+	var changes []ChangeRequest
+	err := s.listJSON(ctx, s.key("changes"), func(data []byte) error {
+		var cr ChangeRequest
+		if err := json.Unmarshal(data, &cr); err != nil {
+			return err
+		}
+		if group == "" || cr.Group == group {
+			changes = append(changes, cr)
+		}
+		return nil
+	})
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].CreatedAt.After(changes[j].CreatedAt)
+	})
+	return changes, err
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/verify"
+)
+
+// Deployment records one apply to a host.
+type Deployment struct {
+	ID           string         `json:"id"`
+	Group        string         `json:"group"`
+	Host         string         `json:"host"`
+	Commit       string         `json:"commit,omitempty"`
+	DeployedBy   string         `json:"deployed_by"`
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+	Success      bool           `json:"success"`
+	Message      string         `json:"message,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Verification *verify.Report `json:"verification,omitempty"`
+}
+
+// deploymentKey returns the key of a deployment record.
+// Format: ${state_key_prefix}/deployments/${group}/${host}/${id}
+func (s *Store) deploymentKey(group, host string, parts ...string) string {
+	return s.key("deployments", append([]string{group, host}, parts...)...)
+}
+
+// RecordDeployment stores a deployment record. Records are keyed by start time so they list in order.
+func (s *Store) RecordDeployment(ctx context.Context, d Deployment) error {
+	if d.StartedAt.IsZero() {
+		d.StartedAt = time.Now()
+	}
+	if d.ID == "" {
+		d.ID = fmt.Sprintf("%020d", d.StartedAt.UnixNano())
+	}
+	return s.putJSON(ctx, s.deploymentKey(d.Group, d.Host, d.ID), d)
+}
+
+// ListDeployments returns the deployments of a host, newest first. An empty host lists the
+// whole group. A limit <= 0 returns all records.
+func (s *Store) ListDeployments(ctx context.Context, group, host string, limit int) ([]Deployment, error) {
+	prefix := s.key("deployments", group)
+	if host != "" {
+		prefix = s.deploymentKey(group, host)
+	}
+
+	var deployments []Deployment
+	err := s.listJSON(ctx, prefix, func(data []byte) error {
+		var d Deployment
+		if err := json.Unmarshal(data, &d); err != nil {
+			return err
+		}
+		deployments = append(deployments, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(deployments, func(a, b Deployment) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	if limit > 0 && len(deployments) > limit {
+		deployments = deployments[:limit]
+	}
+	return deployments, nil
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// MassDeleteGrant lets the next git sync of a host delete more files than the delete guard allows.
+// It is consumed by that sync.
+type MassDeleteGrant struct {
+	Group     string    `json:"group"`
+	Host      string    `json:"host"`
+	Reason    string    `json:"reason"`
+	GrantedBy string    `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// grantKey returns the key of a mass-delete grant.
+// Format: ${state_key_prefix}/grants/mass_delete/${group}/${host}
+func (s *Store) grantKey(group, host string) string {
+	return s.key("grants", AlertMassDelete, group, host)
+}
+
+// PutMassDeleteGrant stores a one-shot grant for a host, replacing any previous one.
+func (s *Store) PutMassDeleteGrant(ctx context.Context, grant MassDeleteGrant) error {
+	if grant.GrantedAt.IsZero() {
+		grant.GrantedAt = time.Now()
+	}
+	return s.putJSON(ctx, s.grantKey(grant.Group, grant.Host), grant)
+}
+
+// GetMassDeleteGrant returns the grant of a host, or nil if there is none.
+func (s *Store) GetMassDeleteGrant(ctx context.Context, group, host string) (*MassDeleteGrant, error) {
+	var grant MassDeleteGrant
+	ok, err := s.getJSON(ctx, s.grantKey(group, host), &grant)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// DeleteMassDeleteGrant consumes the grant of a host.
+func (s *Store) DeleteMassDeleteGrant(ctx context.Context, group, host string) error {
+	return s.delete(ctx, s.grantKey(group, host))
+}
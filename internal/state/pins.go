@@ -0,0 +1,86 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// groupPinKey is the key segment used for pins that apply to every host of a group.
+const groupPinKey = "_group"
+
+// Pin freezes a host (or every host of a group when Host is empty) on a specific commit.
+type Pin struct {
+	Group     string    `json:"group"`
+	Host      string    `json:"host,omitempty"`
+	Commit    string    `json:"commit"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Active reports whether the pin is in effect at now. Pins without expiry never expire.
+func (p *Pin) Active(now time.Time) bool {
+	return p.ExpiresAt.IsZero() || now.Before(p.ExpiresAt)
+}
+
+func (s *Store) pinKey(group, host string) string {
+	if host == "" {
+		host = groupPinKey
+	}
+	return s.key("pins", group, host)
+}
+
+// PutPin creates or replaces a pin.
+func (s *Store) PutPin(ctx context.Context, pin Pin) error {
+	return s.putJSON(ctx, s.pinKey(pin.Group, pin.Host), pin)
+}
+
+// GetPin returns the pin of a host (or of the group when host is empty), or nil if none exists.
+func (s *Store) GetPin(ctx context.Context, group, host string) (*Pin, error) {
+	var pin Pin
+	ok, err := s.getJSON(ctx, s.pinKey(group, host), &pin)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// DeletePin removes the pin of a host (or of the group when host is empty).
+func (s *Store) DeletePin(ctx context.Context, group, host string) error {
+	return s.delete(ctx, s.pinKey(group, host))
+}
+
+// ListPins returns all pins, or only those of a group when group is not empty.
+func (s *Store) ListPins(ctx context.Context, group string) ([]Pin, error) {
+	prefix := s.key("pins")
+	if group != "" {
+		prefix = s.key("pins", group)
+	}
+	var pins []Pin
+	err := s.listJSON(ctx, prefix, func(data []byte) error {
+		var pin Pin
+		if err := json.Unmarshal(data, &pin); err != nil {
+			return err
+		}
+		pins = append(pins, pin)
+		return nil
+	})
+	return pins, err
+}
+
+// ResolvePin returns the active pin that applies to a host: its own pin first, then the group pin.
+func (s *Store) ResolvePin(ctx context.Context, group, host string) (*Pin, error) {
+	now := time.Now()
+	for _, h := range []string{host, ""} {
+		pin, err := s.GetPin(ctx, group, h)
+		if err != nil {
+			return nil, err
+		}
+		if pin != nil && pin.Active(now) {
+			return pin, nil
+		}
+	}
+	return nil, nil
+}
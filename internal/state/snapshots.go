@@ -0,0 +1,106 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/pkg/log"
+)
+
+// Snapshot describes the live config tree of a host captured before a deploy changed it.
+type Snapshot struct {
+	// ID names the generation holding the files; empty for snapshots stored before generations.
+	ID      string    `json:"id,omitempty"`
+	Group   string    `json:"group"`
+	Host    string    `json:"host"`
+	Commit  string    `json:"commit,omitempty"` // commit that was being deployed
+	TakenBy string    `json:"taken_by"`
+	TakenAt time.Time `json:"taken_at"`
+	Files   int       `json:"files"`
+}
+
+// snapshotKey returns the key of the snapshot record of a host.
+// Format: ${state_key_prefix}/snapshots/${group}/${host}/info and .../gen/${id}/${relpath}
+func (s *Store) snapshotKey(group, host string, parts ...string) string {
+	return s.key("snapshots", append([]string{group, host}, parts...)...)
+}
+
+// snapshotFilesPrefix returns the prefix of the files of a snapshot generation.
+func (s *Store) snapshotFilesPrefix(snap *Snapshot) string {
+	if snap.ID == "" {
+		return s.snapshotKey(snap.Group, snap.Host, "files") + "/"
+	}
+	return s.snapshotKey(snap.Group, snap.Host, "gen", snap.ID) + "/"
+}
+
+// PutSnapshot replaces the snapshot of a host with files (relPath -> content). The files are
+// written as a new generation first and the info record is switched to it last, so a failed or
+// partial write keeps the previous snapshot intact. The previous generation is deleted afterwards.
+func (s *Store) PutSnapshot(ctx context.Context, snap Snapshot, files map[string][]byte) error {
+	previous, err := s.GetSnapshotInfo(ctx, snap.Group, snap.Host)
+	if err != nil {
+		return fmt.Errorf("failed to get previous snapshot of %s: %w", snap.Host, err)
+	}
+
+	if snap.TakenAt.IsZero() {
+		snap.TakenAt = time.Now()
+	}
+	snap.ID = fmt.Sprintf("%020d", time.Now().UnixNano())
+	snap.Files = len(files)
+	filesPrefix := s.snapshotFilesPrefix(&snap)
+	for relPath, content := range files {
+		if _, err := s.etcdClient.Put(ctx, filesPrefix+relPath, string(content)); err != nil {
+			s.deleteSnapshotFiles(ctx, filesPrefix)
+			return fmt.Errorf("failed to store snapshot file %s: %w", relPath, err)
+		}
+	}
+	if err := s.putJSON(ctx, s.snapshotKey(snap.Group, snap.Host, "info"), snap); err != nil {
+		s.deleteSnapshotFiles(ctx, filesPrefix)
+		return err
+	}
+
+	if previous != nil {
+		s.deleteSnapshotFiles(ctx, s.snapshotFilesPrefix(previous))
+	}
+	return nil
+}
+
+// deleteSnapshotFiles removes a snapshot generation that is no longer referenced. It is best
+// effort: a leftover generation only takes space and is never read.
+func (s *Store) deleteSnapshotFiles(ctx context.Context, filesPrefix string) {
+	if _, err := s.etcdClient.DeletePrefix(ctx, filesPrefix); err != nil {
+		log.Logger.WithError(err).WithField("prefix", filesPrefix).Warn("failed to delete stale snapshot files")
+	}
+}
+
+// GetSnapshot returns the snapshot of a host and its files, or nil if none was taken.
+func (s *Store) GetSnapshot(ctx context.Context, group, host string) (*Snapshot, map[string][]byte, error) {
+	var snap Snapshot
+	ok, err := s.getJSON(ctx, s.snapshotKey(group, host, "info"), &snap)
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+
+	filesPrefix := s.snapshotFilesPrefix(&snap)
+	resp, err := s.etcdClient.GetPrefix(ctx, filesPrefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get snapshot files of %s: %w", host, err)
+	}
+	files := make(map[string][]byte, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		files[strings.TrimPrefix(string(kv.Key), filesPrefix)] = kv.Value
+	}
+	return &snap, files, nil
+}
+
+// GetSnapshotInfo returns the snapshot record of a host without its files, or nil if none was taken.
+func (s *Store) GetSnapshotInfo(ctx context.Context, group, host string) (*Snapshot, error) {
+	var snap Snapshot
+	ok, err := s.getJSON(ctx, s.snapshotKey(group, host, "info"), &snap)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &snap, nil
+}
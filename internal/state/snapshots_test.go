@@ -0,0 +1,84 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/etcd/etcdtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutSnapshot(t *testing.T) {
+	client, kv := etcdtest.NewClient()
+	store := NewStore(client, "/gitops-nginx/state")
+	ctx := context.Background()
+
+	snap := Snapshot{Group: "web", Host: "10.0.0.1", Commit: "abc", TakenBy: "alice", TakenAt: time.Now()}
+	require.NoError(t, store.PutSnapshot(ctx, snap, map[string][]byte{
+		"nginx.conf":      []byte("worker_processes 4;\n"),
+		"conf.d/old.conf": []byte("# old\n"),
+	}))
+
+	got, files, err := store.GetSnapshot(ctx, "web", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Files)
+	assert.Equal(t, "abc", got.Commit)
+	assert.Equal(t, map[string][]byte{
+		"nginx.conf":      []byte("worker_processes 4;\n"),
+		"conf.d/old.conf": []byte("# old\n"),
+	}, files)
+
+	// A failed write keeps the previous snapshot and leaves no partial generation behind
+	keys := kv.Keys()
+	kv.FailPut = func(key string) error {
+		if strings.HasSuffix(key, "/www.conf") {
+			return errors.New("etcdserver: request timed out")
+		}
+		return nil
+	}
+	err = store.PutSnapshot(ctx, Snapshot{Group: "web", Host: "10.0.0.1", Commit: "def"}, map[string][]byte{
+		"nginx.conf":      []byte("worker_processes 8;\n"),
+		"conf.d/www.conf": []byte("server {}\n"),
+	})
+	require.ErrorContains(t, err, "request timed out")
+	assert.Equal(t, keys, kv.Keys())
+	got, files, err = store.GetSnapshot(ctx, "web", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", got.Commit)
+	assert.Len(t, files, 2)
+
+	// A successful write replaces the snapshot and drops the previous generation
+	kv.FailPut = nil
+	require.NoError(t, store.PutSnapshot(ctx, Snapshot{Group: "web", Host: "10.0.0.1", Commit: "def"}, map[string][]byte{
+		"nginx.conf": []byte("worker_processes 8;\n"),
+	}))
+	got, files, err = store.GetSnapshot(ctx, "web", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "def", got.Commit)
+	assert.Equal(t, map[string][]byte{"nginx.conf": []byte("worker_processes 8;\n")}, files)
+	assert.Len(t, kv.Keys(), 2) // info and the single file
+}
+
+func TestGetSnapshotLegacyLayout(t *testing.T) {
+	client, _ := etcdtest.NewClient()
+	store := NewStore(client, "/gitops-nginx/state")
+	ctx := context.Background()
+
+	// Snapshots written before generations keep their files under .../files/
+	require.NoError(t, store.putJSON(ctx, store.snapshotKey("web", "10.0.0.1", "info"), Snapshot{Group: "web", Host: "10.0.0.1", Files: 1}))
+	_, err := client.Put(ctx, store.snapshotKey("web", "10.0.0.1", "files", "nginx.conf"), "worker_processes 4;\n")
+	require.NoError(t, err)
+
+	_, files, err := store.GetSnapshot(ctx, "web", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"nginx.conf": []byte("worker_processes 4;\n")}, files)
+
+	require.NoError(t, store.PutSnapshot(ctx, Snapshot{Group: "web", Host: "10.0.0.1"}, map[string][]byte{"nginx.conf": []byte("x\n")}))
+	_, files, err = store.GetSnapshot(ctx, "web", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"nginx.conf": []byte("x\n")}, files)
+}
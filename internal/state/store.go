@@ -0,0 +1,103 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Store persists gitops-nginx runtime records (synced commits, pins, ...) as JSON in etcd.
+type Store struct {
+	etcdClient *etcd.Client
+	keyPrefix  string
+}
+
+// NewStore creates a new Store rooted at keyPrefix.
+func NewStore(etcdClient *etcd.Client, keyPrefix string) *Store {
+	return &Store{
+		etcdClient: etcdClient,
+		keyPrefix:  keyPrefix,
+	}
+}
+
+// key constructs the etcd key of a record.
+// Format: ${state_key_prefix}/${kind}/${parts...}
+func (s *Store) key(kind string, parts ...string) string {
+	return path.Join(append([]string{s.keyPrefix, kind}, parts...)...)
+}
+
+// putJSON stores v as JSON under key.
+func (s *Store) putJSON(ctx context.Context, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	if _, err := s.etcdClient.Put(ctx, key, string(data)); err != nil {
+		return fmt.Errorf("failed to put %s: %w", key, err)
+	}
+	return nil
+}
+
+// putJSONIf stores v as JSON under key if the key is still at modRevision, in one transaction.
+// It returns false if the key was written or deleted in between.
+func (s *Store) putJSONIf(ctx context.Context, key string, v any, modRevision int64) (bool, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	resp, err := s.etcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return false, fmt.Errorf("failed to put %s: %w", key, err)
+	}
+	return resp.Succeeded, nil
+}
+
+// getJSON loads the JSON record stored under key into v. It returns false if the key does not exist.
+func (s *Store) getJSON(ctx context.Context, key string, v any) (bool, error) {
+	ok, _, err := s.getJSONRevision(ctx, key, v)
+	return ok, err
+}
+
+// getJSONRevision is getJSON that also returns the mod revision of the record, for putJSONIf.
+func (s *Store) getJSONRevision(ctx context.Context, key string, v any) (bool, int64, error) {
+	resp, err := s.etcdClient.Get(ctx, key)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return false, 0, nil
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, v); err != nil {
+		return false, 0, fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+	return true, resp.Kvs[0].ModRevision, nil
+}
+
+// delete removes the record stored under key.
+func (s *Store) delete(ctx context.Context, key string) error {
+	if _, err := s.etcdClient.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// listJSON decodes every JSON record stored under prefix, calling decode for each raw value.
+func (s *Store) listJSON(ctx context.Context, prefix string, decode func(data []byte) error) error {
+	resp, err := s.etcdClient.GetPrefix(ctx, prefix+"/")
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	for _, kv := range resp.Kvs {
+		if err := decode(kv.Value); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %w", string(kv.Key), err)
+		}
+	}
+	return nil
+}
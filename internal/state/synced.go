@@ -0,0 +1,46 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// SyncedCommit records the commit whose tree is mirrored into the production prefix of a host.
+type SyncedCommit struct {
+	Group    string    `json:"group"`
+	Host     string    `json:"host"`
+	Ref      string    `json:"ref"`
+	Commit   string    `json:"commit"`
+	Pinned   bool      `json:"pinned,omitempty"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// GetSyncedCommit returns the synced commit of a host, or nil if none was recorded.
+func (s *Store) GetSyncedCommit(ctx context.Context, group, host string) (*SyncedCommit, error) {
+	var rec SyncedCommit
+	ok, err := s.getJSON(ctx, s.key("synced", group, host), &rec)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// PutSyncedCommit records the synced commit of a host.
+func (s *Store) PutSyncedCommit(ctx context.Context, rec SyncedCommit) error {
+	return s.putJSON(ctx, s.key("synced", rec.Group, rec.Host), rec)
+}
+
+// ListSyncedCommits returns the synced commits of every host of a group.
+func (s *Store) ListSyncedCommits(ctx context.Context, group string) ([]SyncedCommit, error) {
+	var recs []SyncedCommit
+	err := s.listJSON(ctx, s.key("synced", group), func(data []byte) error {
+		var rec SyncedCommit
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	return recs, err
+}
@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+const (
+	// CommonLayerDir is the directory name, next to the host directories of a group,
+	// that holds the configuration shared by every host of the group.
+	CommonLayerDir = "_common"
+	// DeleteMarkerSuffix marks a file in the host layer that removes the
+	// same file (without the suffix) inherited from the common layer.
+	DeleteMarkerSuffix = ".deleted"
+
+	// LayerCommon is reported for files that come from <group>/_common/.
+	LayerCommon = "common"
+	// LayerHost is reported for files that come from <group>/<host>/.
+	LayerHost = "host"
+)
+
+// layerPriority orders the layers: a file of a higher priority layer overrides a file
+// with the same relative path in a lower one.
+var layerPriority = map[string]int{LayerCommon: 0, LayerHost: 1}
+
+// hostLayout describes where the layers of a single host live in the repository.
+type hostLayout struct {
+	commonPrefix string
+	hostPrefix   string
+}
+
+// newHostLayout returns the repository layout for a host.
+// Format: ${group}/_common/${config_dir_suffix} and ${group}/${host}/${config_dir_suffix}
+func newHostLayout(group, host, configDirSuffix string) hostLayout {
+	return hostLayout{
+		commonPrefix: path.Join(group, CommonLayerDir, configDirSuffix),
+		hostPrefix:   path.Join(group, host, configDirSuffix),
+	}
+}
+
+// classify maps a repository-relative file path to the path relative to the
+// config directory and the layer it belongs to.
+func (hl hostLayout) classify(repoRelPath string) (string, string, bool) {
+	for _, candidate := range []struct{ prefix, layer string }{
+		{hl.hostPrefix, LayerHost},
+		{hl.commonPrefix, LayerCommon},
+	} {
+		if !strings.HasPrefix(repoRelPath, candidate.prefix+"/") {
+			continue
+		}
+		relPath := strings.TrimPrefix(repoRelPath, candidate.prefix+"/")
+		if relPath == "" {
+			return "", "", false
+		}
+		return relPath, candidate.layer, true
+	}
+	return "", "", false
+}
+
+// sourceFile is a single file of the merged per-host tree.
+type sourceFile struct {
+	Layer string
+	// Template is the relative path of the template the file is rendered from, if any.
+	Template string
+	// Generated is the relative path of the vhost spec the file is generated from, if any.
+	Generated string
+	load      func() ([]byte, error)
+}
+
+// Content reads the file content from its layer.
+func (sf *sourceFile) Content() ([]byte, error) {
+	return sf.load()
+}
+
+// layeredTree merges the common layer and the host layer of a single host.
+// Host files override common files with the same relative path, and host
+// deletion markers remove inherited common files.
+type layeredTree struct {
+	common  map[string]*sourceFile
+	host    map[string]*sourceFile
+	deleted map[string]struct{}
+}
+
+func newLayeredTree() *layeredTree {
+	return &layeredTree{
+		common:  make(map[string]*sourceFile),
+		host:    make(map[string]*sourceFile),
+		deleted: make(map[string]struct{}),
+	}
+}
+
+// add registers a file found in one of the layers.
+func (lt *layeredTree) add(relPath, layer string, load func() ([]byte, error)) {
+	if layer == LayerHost {
+		if target, ok := strings.CutSuffix(relPath, DeleteMarkerSuffix); ok && target != "" {
+			lt.deleted[target] = struct{}{}
+			return
+		}
+		lt.host[relPath] = &sourceFile{Layer: layer, load: load}
+		return
+	}
+	if strings.HasSuffix(relPath, DeleteMarkerSuffix) {
+		return
+	}
+	lt.common[relPath] = &sourceFile{Layer: layer, load: load}
+}
+
+// resolve returns the merged tree keyed by path relative to the config directory.
+func (lt *layeredTree) resolve() map[string]*sourceFile {
+	merged := make(map[string]*sourceFile, len(lt.common)+len(lt.host))
+	for relPath, sf := range lt.common {
+		if _, ok := lt.deleted[relPath]; ok {
+			continue
+		}
+		merged[relPath] = sf
+	}
+	for relPath, sf := range lt.host {
+		merged[relPath] = sf
+	}
+	return merged
+}
+
+// fileMeta is the part of a .meta value that describes where a file comes from.
+type fileMeta struct {
+	Layer     string `json:"layer"`
+	Template  string `json:"template,omitempty"`
+	Generated string `json:"generated,omitempty"`
+}
+
+// sameOrigin reports whether a .meta value records the layer, template and generator of sf.
+func (sf *sourceFile) sameOrigin(meta string) bool {
+	var m fileMeta
+	if meta == "" || json.Unmarshal([]byte(meta), &m) != nil {
+		return false
+	}
+	return m.Layer == sf.Layer && m.Template == sf.Template && m.Generated == sf.Generated
+}
+
+// shadowedBy reports whether the output of sf, generated at a path that other already holds,
+// is dropped because other comes from a higher priority layer, and whether the two conflict
+// because they come from the same layer. Otherwise the output of sf overrides other.
+func (sf *sourceFile) shadowedBy(other *sourceFile) (shadowed, conflict bool) {
+	if other.Layer == sf.Layer {
+		return false, true
+	}
+	return layerPriority[other.Layer] > layerPriority[sf.Layer], false
+}
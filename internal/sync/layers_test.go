@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLayoutClassify(t *testing.T) {
+	layout := newHostLayout("web", "10.0.0.1", "nginx")
+
+	tests := []struct {
+		name      string
+		path      string
+		wantRel   string
+		wantLayer string
+		wantOK    bool
+	}{
+		{"host file", "web/10.0.0.1/nginx/nginx.conf", "nginx.conf", LayerHost, true},
+		{"common file", "web/_common/nginx/conf.d/a.conf", "conf.d/a.conf", LayerCommon, true},
+		{"other host", "web/10.0.0.10/nginx/nginx.conf", "", "", false},
+		{"other group", "api/_common/nginx/nginx.conf", "", "", false},
+		{"other suffix", "web/10.0.0.1/nginx-old/nginx.conf", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel, layer, ok := layout.classify(tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantRel, rel)
+			assert.Equal(t, tt.wantLayer, layer)
+		})
+	}
+}
+
+func TestLayeredTreeResolve(t *testing.T) {
+	content := func(s string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(s), nil }
+	}
+
+	lt := newLayeredTree()
+	lt.add("nginx.conf", LayerHost, content("host"))
+	lt.add("nginx.conf", LayerCommon, content("common"))
+	lt.add("mime.types", LayerCommon, content("types"))
+	lt.add("conf.d/legacy.conf", LayerCommon, content("legacy"))
+	lt.add("conf.d/legacy.conf"+DeleteMarkerSuffix, LayerHost, content(""))
+
+	merged := lt.resolve()
+	assert.Len(t, merged, 2)
+
+	assert.Equal(t, LayerHost, merged["nginx.conf"].Layer)
+	data, err := merged["nginx.conf"].Content()
+	assert.NoError(t, err)
+	assert.Equal(t, "host", string(data))
+
+	assert.Equal(t, LayerCommon, merged["mime.types"].Layer)
+	assert.NotContains(t, merged, "conf.d/legacy.conf")
+	assert.NotContains(t, merged, "conf.d/legacy.conf"+DeleteMarkerSuffix)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
@@ -30,6 +31,7 @@ type PreviewSyncer struct {
 	ignorePatterns []string
 	pollInterval   time.Duration
 	keyPrefix      string
+	templateData   TemplateData
 }
 
 // loadGitignore loads .gitignore patterns from the repository
@@ -64,7 +66,7 @@ func loadGitignore(repoPath string) ([]string, error) {
 }
 
 // NewPreviewSyncer creates a new PreviewSyncer
-func NewPreviewSyncer(etcdClient *etcd.Client, serverConfig *config.ServerConfig, gitConfig *config.GitConfig, syncConfig *config.SyncConfig, groupName string) (*PreviewSyncer, error) {
+func NewPreviewSyncer(etcdClient *etcd.Client, serverConfig *config.ServerConfig, gitConfig *config.GitConfig, syncConfig *config.SyncConfig, group *config.NginxServerGroup) (*PreviewSyncer, error) {
 	// Create file watcher
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -92,12 +94,13 @@ func NewPreviewSyncer(etcdClient *etcd.Client, serverConfig *config.ServerConfig
 		etcdClient:     etcdClient,
 		serverConfig:   serverConfig,
 		gitConfig:      gitConfig,
-		groupName:      groupName,
+		groupName:      group.Group,
 		repoPathAbs:    repoPathAbs,
 		watcher:        watcher,
 		ignorePatterns: ignorePatterns,
 		pollInterval:   5 * time.Second,
 		keyPrefix:      syncConfig.PreviewSyncer.KeyPrefix,
+		templateData:   NewTemplateData(group, serverConfig),
 	}, nil
 }
 
@@ -169,7 +172,7 @@ func (ps *PreviewSyncer) initialSync(ctx context.Context) error {
 	}
 
 	configDirSuffix := filepath.Base(ps.serverConfig.NginxConfigDir)
-	expectedPrefix := path.Join(ps.groupName, ps.serverConfig.Host, configDirSuffix)
+	layout := newHostLayout(ps.groupName, ps.serverConfig.Host, configDirSuffix)
 	etcdPrefix := path.Join(ps.keyPrefix, ps.groupName, ps.serverConfig.Host, configDirSuffix)
 
 	// Get all existing keys from etcd to avoid multiple Get calls
@@ -182,9 +185,8 @@ func (ps *PreviewSyncer) initialSync(ctx context.Context) error {
 		existingData[string(kv.Key)] = string(kv.Value)
 	}
 
-	desiredRel := make(map[string]struct{})
-
-	// Walk through the repository directory and sync relevant files
+	// Walk through the repository directory and collect files from the common and host layers
+	layers := newLayeredTree()
 	err = filepath.WalkDir(repoPath, func(filePath string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -205,61 +207,71 @@ func (ps *PreviewSyncer) initialSync(ctx context.Context) error {
 		if err != nil {
 			return nil
 		}
-		relPath := filepath.ToSlash(rel)
 
-		// Check if file matches the expected nginx config pattern
-		if !strings.HasPrefix(relPath, expectedPrefix) {
+		// Check if file is in one of the layers of this host
+		fileRelPath, layer, ok := layout.classify(filepath.ToSlash(rel))
+		if !ok {
 			return nil
 		}
 
-		// Extract the file path relative to the config directory
-		fileRelPath := strings.TrimPrefix(relPath, expectedPrefix)
-		fileRelPath = strings.TrimPrefix(fileRelPath, "/")
-		if fileRelPath == "" {
-			return nil
-		}
+		layers.add(fileRelPath, layer, func() ([]byte, error) {
+			return os.ReadFile(filePath)
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	desiredRel := make(map[string]struct{})
+
+	for fileRelPath, sf := range generateVhosts(renderTemplates(layers.resolve(), ps.templateData)) {
 		desiredRel[fileRelPath] = struct{}{}
 
-		// Read file content
-		content, err := os.ReadFile(filePath)
+		etcdKey := ps.constructEtcdKey(fileRelPath, configDirSuffix)
+		etcdHashKey := etcdKey + ".hash"
+		etcdMetaKey := etcdKey + ".meta"
+
+		// Read (or render) file content
+		content, err := sf.Content()
+		recordFileError(ctx, ps.etcdClient, existingData, etcdKey, err)
 		if err != nil {
-			l.WithError(err).Errorf("failed to read file %s", filePath)
-			return nil
+			l.WithError(err).Errorf("failed to read file %s from %s layer", fileRelPath, sf.Layer)
+			continue
 		}
 
 		hash := md5.Sum(content)
 		hashStr := hex.EncodeToString(hash[:])
 
-		etcdKey := ps.constructEtcdKey(fileRelPath, configDirSuffix)
-		etcdHashKey := etcdKey + ".hash"
-
 		existingHash := existingData[etcdHashKey]
 		_, contentExists := existingData[etcdKey]
 
 		// Only skip if BOTH the hash matches AND the content actually exists in etcd
-		if existingHash == hashStr && contentExists {
-			return nil
+		// (and the file still comes from the same layer and generator)
+		if existingHash == hashStr && contentExists && sf.sameOrigin(existingData[etcdMetaKey]) {
+			continue
 		}
 
 		if _, err = ps.etcdClient.Put(ctx, etcdKey, string(content)); err != nil {
 			l.WithError(err).Errorf("failed to put file %s into etcd", etcdKey)
-			return nil
+			continue
 		}
 
 		_, _ = ps.etcdClient.Put(ctx, etcdHashKey, hashStr)
 
+		meta := fileMeta{Layer: sf.Layer, Template: sf.Template, Generated: sf.Generated}
+		if metaBytes, err := json.Marshal(meta); err == nil {
+			_, _ = ps.etcdClient.Put(ctx, etcdMetaKey, string(metaBytes))
+		}
+
 		l.WithFields(log.Fields{
 			"host":     ps.serverConfig.Host,
 			"file":     etcdKey,
+			"layer":    sf.Layer,
 			"hash":     hashStr,
 			"existing": existingHash,
 			"re-sync":  !contentExists && existingHash == hashStr,
 		}).Info("synced file to preview etcd")
-
-		return nil
-	})
-	if err != nil {
-		return err
 	}
 
 	if err := mirrorDeleteEtcdPrefix(ctx, ps.etcdClient, etcdPrefix, desiredRel); err != nil {
@@ -15,8 +15,10 @@ import (
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/deploypolicy"
 	"github.com/logn-xu/gitops-nginx/internal/etcd"
 	gitrepo "github.com/logn-xu/gitops-nginx/internal/git"
+	"github.com/logn-xu/gitops-nginx/internal/state"
 	"github.com/logn-xu/gitops-nginx/pkg/log"
 )
 
@@ -25,22 +27,30 @@ type Syncer struct {
 	etcdClient     *etcd.Client
 	serverConfig   *config.ServerConfig
 	gitConfig      *config.GitConfig
+	group          *config.NginxServerGroup
 	groupName      string
 	pollInterval   time.Duration
 	ignorePatterns []string
 	keyPrefix      string
+	templateData   TemplateData
+	stateStore     *state.Store
+	deleteGuard    config.DeleteGuardConfig
 }
 
 // NewSyncer creates a new Syncer.
-func NewSyncer(etcdClient *etcd.Client, serverConfig *config.ServerConfig, gitConfig *config.GitConfig, syncConfig *config.SyncConfig, groupName string, pollInterval time.Duration) *Syncer {
+func NewSyncer(etcdClient *etcd.Client, serverConfig *config.ServerConfig, gitConfig *config.GitConfig, syncConfig *config.SyncConfig, group *config.NginxServerGroup, pollInterval time.Duration) *Syncer {
 	return &Syncer{
 		etcdClient:     etcdClient,
 		serverConfig:   serverConfig,
 		gitConfig:      gitConfig,
-		groupName:      groupName,
+		group:          group,
+		groupName:      group.Group,
 		pollInterval:   pollInterval,
 		ignorePatterns: syncConfig.GitSyncer.IgnorePatterns,
 		keyPrefix:      syncConfig.GitSyncer.KeyPrefix,
+		templateData:   NewTemplateData(group, serverConfig),
+		stateStore:     state.NewStore(etcdClient, syncConfig.State.KeyPrefix),
+		deleteGuard:    syncConfig.DeleteGuard,
 	}
 }
 
@@ -92,22 +102,59 @@ func (s *Syncer) sync(ctx context.Context) error {
 		return fmt.Errorf("failed to sync git repo: %w", err)
 	}
 
-	// Get branch
-	branchName := s.gitConfig.Branch
-	if branchName == "" {
-		branchName = "master"
-	}
-
-	// Get branch reference
-	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branchName), true)
+	// Get the commit tracked by the group (group ref, group branch or git.branch)
+	refName := gitrepo.GroupRef(s.gitConfig, s.group)
+	commit, err := gitrepo.ResolveGroupCommit(repo, s.gitConfig, s.group)
 	if err != nil {
-		return fmt.Errorf("failed to get branch %s: %w", branchName, err)
+		return err
 	}
 
-	// Get commit object
-	commit, err := repo.CommitObject(ref.Hash())
+	// A pin freezes the host (or its group) on a known commit while the branch keeps moving
+	pin, err := s.stateStore.ResolvePin(ctx, s.groupName, s.serverConfig.Host)
 	if err != nil {
-		return fmt.Errorf("failed to get commit object %s: %w", ref.Hash().String(), err)
+		return fmt.Errorf("failed to resolve pin: %w", err)
+	}
+	if pin != nil {
+		pinned, err := repo.CommitObject(plumbing.NewHash(pin.Commit))
+		if err != nil {
+			return fmt.Errorf("failed to get pinned commit %s: %w", pin.Commit, err)
+		}
+		// A pin must not bypass the release policy
+		ok, err := gitrepo.IsReleasable(repo, &s.gitConfig.Release, pinned)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate release policy: %w", err)
+		}
+		if !ok {
+			l.WithFields(log.Fields{
+				"mode": s.gitConfig.Release.Mode,
+				"pin":  pin.Commit,
+			}).Warn("pinned commit does not satisfy the release policy, skipping sync")
+			return nil
+		}
+		l.WithFields(log.Fields{
+			"pin":    pin.Commit,
+			"head":   commit.Hash.String(),
+			"reason": pin.Reason,
+		}).Debug("host is pinned, syncing pinned commit")
+		commit = pinned
+	} else {
+		// Apply the release policy: only a qualifying commit may reach the production prefix
+		release, err := gitrepo.ResolveRelease(repo, &s.gitConfig.Release, commit)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate release policy: %w", err)
+		}
+		if len(release.Pending) > 0 {
+			l.WithFields(log.Fields{
+				"mode":    release.Mode,
+				"head":    commit.Hash.String(),
+				"pending": len(release.Pending),
+			}).Info("commits are pending release policy")
+		}
+		if release.Deployable == nil {
+			l.WithField("mode", release.Mode).Warn("no commit satisfies the release policy, skipping sync")
+			return nil
+		}
+		commit = release.Deployable
 	}
 
 	// Get tree
@@ -118,8 +165,8 @@ func (s *Syncer) sync(ctx context.Context) error {
 
 	// Get config dir suffix
 	configDirSuffix := filepath.Base(s.serverConfig.NginxConfigDir)
-	// Get prefix
-	prefix := path.Join(s.groupName, s.serverConfig.Host, configDirSuffix)
+	// Get layout of the common and host layers
+	layout := newHostLayout(s.groupName, s.serverConfig.Host, configDirSuffix)
 	// Get etcd prefix
 	etcdPrefix := path.Join(s.keyPrefix, s.groupName, s.serverConfig.Host, configDirSuffix)
 
@@ -133,9 +180,8 @@ func (s *Syncer) sync(ctx context.Context) error {
 		existingData[string(kv.Key)] = string(kv.Value)
 	}
 
-	// Get desired relative paths
-	desiredRel := make(map[string]struct{})
-
+	// Collect files from the common and host layers
+	layers := newLayeredTree()
 	iter := tree.Files()
 	for {
 		file, err := iter.Next()
@@ -152,40 +198,62 @@ func (s *Syncer) sync(ctx context.Context) error {
 			continue
 		}
 
-		// Check if file is in the correct directory
-		if !strings.HasPrefix(filePath, prefix) {
+		// Check if file is in one of the layers of this host
+		relPath, layer, ok := layout.classify(filePath)
+		if !ok {
 			continue
 		}
 
-		relPath := strings.TrimPrefix(filePath, prefix)
-		relPath = strings.TrimPrefix(relPath, "/")
-		if relPath == "" {
-			continue
-		}
+		layers.add(relPath, layer, func() ([]byte, error) {
+			content, err := file.Contents()
+			return []byte(content), err
+		})
+	}
+
+	rendered := generateVhosts(renderTemplates(layers.resolve(), s.templateData))
+
+	// Guard against wiping the production prefix, e.g. after a host directory was moved in git
+	allowed, err := s.allowDeletes(ctx, etcdPrefix, existingData, rendered)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return nil
+	}
+
+	// Get desired relative paths
+	desiredRel := make(map[string]struct{})
+
+	for relPath, sf := range rendered {
 		desiredRel[relPath] = struct{}{}
 
-		content, err := file.Contents()
+		etcdKey := s.constructEtcdKey(relPath, configDirSuffix)
+		etcdHashKey := etcdKey + ".hash"
+		etcdCommitKey := etcdKey + ".commit"
+		etcdMetaKey := etcdKey + ".meta"
+
+		// Render errors keep the last good content in etcd and are recorded next to it
+		content, err := sf.Content()
+		recordFileError(ctx, s.etcdClient, existingData, etcdKey, err)
 		if err != nil {
 			l.WithFields(log.Fields{
-				"host": s.serverConfig.Host,
-				"file": filePath,
+				"host":     s.serverConfig.Host,
+				"file":     relPath,
+				"layer":    sf.Layer,
+				"template": sf.Template,
 			}).WithError(err).Error("failed to read file content from git")
 			continue
 		}
 
-		hash := md5.Sum([]byte(content))
+		hash := md5.Sum(content)
 		hashStr := hex.EncodeToString(hash[:])
 
-		etcdKey := s.constructEtcdKey(relPath, configDirSuffix)
-		etcdHashKey := etcdKey + ".hash"
-		etcdCommitKey := etcdKey + ".commit"
-		etcdMetaKey := etcdKey + ".meta"
-
 		existingHash := existingData[etcdHashKey]
 		_, contentExists := existingData[etcdKey]
 
 		// Only skip if BOTH the hash matches AND the content actually exists in etcd
-		if existingHash == hashStr && contentExists {
+		// (and the file still comes from the same layer and generator)
+		if existingHash == hashStr && contentExists && sf.sameOrigin(existingData[etcdMetaKey]) {
 			l.WithFields(log.Fields{
 				"host": s.serverConfig.Host,
 				"file": etcdKey,
@@ -194,7 +262,7 @@ func (s *Syncer) sync(ctx context.Context) error {
 			continue
 		}
 
-		if _, err = s.etcdClient.Put(ctx, etcdKey, content); err != nil {
+		if _, err = s.etcdClient.Put(ctx, etcdKey, string(content)); err != nil {
 			l.WithFields(log.Fields{
 				"host": s.serverConfig.Host,
 				"file": etcdKey,
@@ -208,9 +276,11 @@ func (s *Syncer) sync(ctx context.Context) error {
 		meta := struct {
 			Commit  string `json:"commit"`
 			Message string `json:"message"`
+			fileMeta
 		}{
-			Commit:  commit.Hash.String(),
-			Message: strings.TrimSpace(commit.Message),
+			Commit:   commit.Hash.String(),
+			Message:  strings.TrimSpace(commit.Message),
+			fileMeta: fileMeta{Layer: sf.Layer, Template: sf.Template, Generated: sf.Generated},
 		}
 		if metaBytes, err := json.Marshal(meta); err == nil {
 			_, _ = s.etcdClient.Put(ctx, etcdMetaKey, string(metaBytes))
@@ -219,6 +289,7 @@ func (s *Syncer) sync(ctx context.Context) error {
 		l.WithFields(log.Fields{
 			"host":     s.serverConfig.Host,
 			"file":     etcdKey,
+			"layer":    sf.Layer,
 			"hash":     hashStr,
 			"commit":   commit.Hash.String(),
 			"message":  meta.Message,
@@ -235,9 +306,104 @@ func (s *Syncer) sync(ctx context.Context) error {
 		}).WithError(err).Warn("failed to mirror delete etcd prefix")
 	}
 
+	// Record the commit now mirrored into the production prefix
+	synced, err := s.stateStore.GetSyncedCommit(ctx, s.groupName, s.serverConfig.Host)
+	if err != nil || synced == nil || synced.Commit != commit.Hash.String() || synced.Ref != refName || synced.Pinned != (pin != nil) {
+		err = s.stateStore.PutSyncedCommit(ctx, state.SyncedCommit{
+			Group:    s.groupName,
+			Host:     s.serverConfig.Host,
+			Ref:      refName,
+			Commit:   commit.Hash.String(),
+			Pinned:   pin != nil,
+			SyncedAt: time.Now(),
+		})
+		if err != nil {
+			l.WithError(err).Warn("failed to record synced commit")
+		}
+	}
+
 	return nil
 }
 
+// allowDeletes applies the delete guard to the files a sync would remove from etcdPrefix.
+// When the guard trips the sync is skipped and an alert raised, unless an admin granted the
+// next sync of the host a mass delete.
+func (s *Syncer) allowDeletes(ctx context.Context, etcdPrefix string, existingData map[string]string, desired map[string]*sourceFile) (bool, error) {
+	l := log.Logger.WithField("git_syncer", s.serverConfig.Host)
+
+	existing, deleting := 0, 0
+	for key := range existingData {
+		if etcd.IsMetaKey(key) || key == etcdPrefix {
+			continue
+		}
+		existing++
+		relPath := strings.TrimPrefix(strings.TrimPrefix(key, etcdPrefix), "/")
+		if _, ok := desired[relPath]; !ok {
+			deleting++
+		}
+	}
+
+	violation := deploypolicy.CheckDeletes(s.deleteGuard, deleting, existing)
+	if violation == nil {
+		if err := s.stateStore.ResolveAlert(ctx, state.AlertMassDelete, s.groupName, s.serverConfig.Host, "sync"); err != nil {
+			l.WithError(err).Warn("failed to resolve mass delete alert")
+		}
+		return true, nil
+	}
+
+	grant, err := s.stateStore.GetMassDeleteGrant(ctx, s.groupName, s.serverConfig.Host)
+	if err != nil {
+		return false, fmt.Errorf("failed to get mass delete grant: %w", err)
+	}
+	if grant != nil {
+		if err := s.stateStore.DeleteMassDeleteGrant(ctx, s.groupName, s.serverConfig.Host); err != nil {
+			return false, fmt.Errorf("failed to consume mass delete grant: %w", err)
+		}
+		if err := s.stateStore.RecordAudit(ctx, state.AuditEvent{
+			Actor:  grant.GrantedBy,
+			Action: "mass_delete_override",
+			Group:  s.groupName,
+			Host:   s.serverConfig.Host,
+			Reason: grant.Reason,
+			Details: map[string]string{
+				"operation": "sync",
+				"message":   violation.Message,
+			},
+		}); err != nil {
+			l.WithError(err).Warn("failed to record mass delete override in audit trail")
+		}
+		if err := s.stateStore.ResolveAlert(ctx, state.AlertMassDelete, s.groupName, s.serverConfig.Host, "sync"); err != nil {
+			l.WithError(err).Warn("failed to resolve mass delete alert")
+		}
+		l.WithFields(log.Fields{
+			"deleting":   deleting,
+			"existing":   existing,
+			"granted_by": grant.GrantedBy,
+		}).Warn("mass delete allowed by grant")
+		return true, nil
+	}
+
+	if _, err := s.stateStore.RaiseAlert(ctx, state.Alert{
+		Kind:    state.AlertMassDelete,
+		Source:  "sync",
+		Group:   s.groupName,
+		Host:    s.serverConfig.Host,
+		Message: violation.Message,
+		Details: map[string]string{
+			"deleting": fmt.Sprint(deleting),
+			"existing": fmt.Sprint(existing),
+		},
+	}); err != nil {
+		l.WithError(err).Warn("failed to raise mass delete alert")
+	}
+	l.WithFields(log.Fields{
+		"deleting": deleting,
+		"existing": existing,
+		"reason":   violation.Message,
+	}).Error("sync blocked by the delete guard")
+	return false, nil
+}
+
 // constructEtcdKey constructs the etcd key for a file.
 // Format: /gitops-nginx/${group}/${host}/${config_dir_suffix}/xxx
 func (s *Syncer) constructEtcdKey(relPath, configDirSuffix string) string {
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"text/template"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+)
+
+// TemplateSuffix marks files that are rendered with text/template before being stored in etcd.
+// The rendered output is stored under the file name without the suffix.
+const TemplateSuffix = ".tmpl"
+
+// TemplateData is the data passed to every template of a host.
+type TemplateData struct {
+	Name  string
+	Host  string
+	Port  int
+	Group string
+	// Vars holds the group vars overridden by the server vars.
+	Vars map[string]any
+}
+
+// NewTemplateData builds the template data of a server from its inventory.
+func NewTemplateData(group *config.NginxServerGroup, server *config.ServerConfig) TemplateData {
+	vars := make(map[string]any, len(group.Vars)+len(server.Vars))
+	maps.Copy(vars, group.Vars)
+	maps.Copy(vars, server.Vars)
+	return TemplateData{
+		Name:  server.Name,
+		Host:  server.Host,
+		Port:  server.Port,
+		Group: group.Group,
+		Vars:  vars,
+	}
+}
+
+// renderTemplates replaces the .tmpl files of a merged tree with their rendered output.
+// Rendering happens lazily when the content is read, so a broken template only fails its own file.
+// A template and a plain file with the same output path conflict within a layer; across layers
+// the host layer wins.
+func renderTemplates(files map[string]*sourceFile, data TemplateData) map[string]*sourceFile {
+	rendered := make(map[string]*sourceFile, len(files))
+	maps.Copy(rendered, files)
+
+	for relPath, sf := range files {
+		outPath, ok := strings.CutSuffix(relPath, TemplateSuffix)
+		if !ok || outPath == "" {
+			continue
+		}
+		delete(rendered, relPath)
+
+		tmplPath, src := relPath, sf
+		var shadowed, conflict bool
+		if plain, exists := files[outPath]; exists {
+			shadowed, conflict = src.shadowedBy(plain)
+		}
+		if shadowed {
+			continue
+		}
+		if conflict {
+			rendered[outPath] = &sourceFile{
+				Layer:    src.Layer,
+				Template: tmplPath,
+				load: func() ([]byte, error) {
+					return nil, fmt.Errorf("template %s conflicts with plain file %s", tmplPath, outPath)
+				},
+			}
+			continue
+		}
+
+		rendered[outPath] = &sourceFile{
+			Layer:    src.Layer,
+			Template: tmplPath,
+			load: func() ([]byte, error) {
+				content, err := src.Content()
+				if err != nil {
+					return nil, err
+				}
+				return renderTemplate(tmplPath, content, data)
+			},
+		}
+	}
+
+	return rendered
+}
+
+// renderTemplate renders a single template. Missing variables are reported as errors.
+func renderTemplate(name string, content []byte, data TemplateData) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// recordFileError stores the error of a file next to its etcd key so the tree and check
+// APIs can surface it, or clears a previously stored error once the file is healthy again.
+func recordFileError(ctx context.Context, etcdClient *etcd.Client, existingData map[string]string, etcdKey string, fileErr error) {
+	errKey := etcdKey + ".error"
+	existing, exists := existingData[errKey]
+	if fileErr == nil {
+		if exists {
+			_, _ = etcdClient.Delete(ctx, errKey)
+		}
+		return
+	}
+	if existing != fileErr.Error() {
+		_, _ = etcdClient.Put(ctx, errKey, fileErr.Error())
+	}
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	group := &config.NginxServerGroup{
+		Group: "web",
+		Vars:  map[string]any{"workers": 2, "suffix": "example.com"},
+	}
+	server := &config.ServerConfig{
+		Name: "web-01",
+		Host: "10.0.0.1",
+		Vars: map[string]any{"workers": 8},
+	}
+	data := NewTemplateData(group, server)
+
+	static := func(s string) *sourceFile {
+		return &sourceFile{Layer: LayerHost, load: func() ([]byte, error) { return []byte(s), nil }}
+	}
+
+	files := renderTemplates(map[string]*sourceFile{
+		"nginx.conf.tmpl":       static("worker_processes {{ .Vars.workers }};"),
+		"conf.d/site.conf.tmpl": static("server_name {{ .Name }}.{{ .Vars.suffix }}; listen {{ .Host }}:80;"),
+		"conf.d/bad.conf.tmpl":  static("{{ .Vars.missing }}"),
+		"mime.types":            static("types {}"),
+	}, data)
+
+	require.Len(t, files, 4)
+	assert.NotContains(t, files, "nginx.conf.tmpl")
+
+	content, err := files["nginx.conf"].Content()
+	require.NoError(t, err)
+	assert.Equal(t, "worker_processes 8;", string(content))
+	assert.Equal(t, "nginx.conf.tmpl", files["nginx.conf"].Template)
+
+	content, err = files["conf.d/site.conf"].Content()
+	require.NoError(t, err)
+	assert.Equal(t, "server_name web-01.example.com; listen 10.0.0.1:80;", string(content))
+
+	_, err = files["conf.d/bad.conf"].Content()
+	assert.Error(t, err)
+
+	content, err = files["mime.types"].Content()
+	require.NoError(t, err)
+	assert.Equal(t, "types {}", string(content))
+}
+
+func TestRenderTemplatesConflict(t *testing.T) {
+	static := func(s string) *sourceFile {
+		return &sourceFile{Layer: LayerHost, load: func() ([]byte, error) { return []byte(s), nil }}
+	}
+
+	files := renderTemplates(map[string]*sourceFile{
+		"nginx.conf":      static("plain"),
+		"nginx.conf.tmpl": static("templated"),
+	}, TemplateData{})
+
+	require.Len(t, files, 1)
+	_, err := files["nginx.conf"].Content()
+	assert.ErrorContains(t, err, "conflicts with plain file")
+}
+
+func TestRenderTemplatesAcrossLayers(t *testing.T) {
+	static := func(layer, s string) *sourceFile {
+		return &sourceFile{Layer: layer, load: func() ([]byte, error) { return []byte(s), nil }}
+	}
+
+	files := renderTemplates(map[string]*sourceFile{
+		"nginx.conf":            static(LayerCommon, "plain"),
+		"nginx.conf.tmpl":       static(LayerHost, "worker_processes {{ .Vars.workers }};"),
+		"mime.types":            static(LayerHost, "types {}"),
+		"mime.types.tmpl":       static(LayerCommon, "types { {{ .Vars.types }} }"),
+		"conf.d/site.conf.tmpl": static(LayerCommon, "server {}"),
+	}, TemplateData{Vars: map[string]any{"workers": 4}})
+
+	require.Len(t, files, 3)
+
+	// A host template overrides a common plain file
+	content, err := files["nginx.conf"].Content()
+	require.NoError(t, err)
+	assert.Equal(t, "worker_processes 4;", string(content))
+	assert.Equal(t, LayerHost, files["nginx.conf"].Layer)
+
+	// A host plain file overrides a common template
+	content, err = files["mime.types"].Content()
+	require.NoError(t, err)
+	assert.Equal(t, "types {}", string(content))
+	assert.Empty(t, files["mime.types"].Template)
+
+	assert.Equal(t, "conf.d/site.conf.tmpl", files["conf.d/site.conf"].Template)
+}
+
+func TestSourceFileSameOrigin(t *testing.T) {
+	sf := &sourceFile{Layer: LayerHost, Template: "nginx.conf.tmpl"}
+	assert.True(t, sf.sameOrigin(`{"layer":"host","template":"nginx.conf.tmpl"}`))
+	assert.False(t, sf.sameOrigin(`{"layer":"host"}`), "a plain file replaced by a template")
+	assert.False(t, (&sourceFile{Layer: LayerHost}).sameOrigin(`{"layer":"host","template":"nginx.conf.tmpl"}`))
+	assert.False(t, sf.sameOrigin(""))
+}
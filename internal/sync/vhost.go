@@ -0,0 +1,204 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"go.yaml.in/yaml/v3"
+)
+
+// VhostSuffix marks declarative virtual host specs. Each spec is replaced by a generated
+// nginx config file with the same name and a .conf suffix, e.g. conf.d/api.vhost.yaml
+// generates conf.d/api.conf. The generated file belongs in the http context.
+const VhostSuffix = ".vhost.yaml"
+
+// vhostSpec is a simple reverse proxy described in a *.vhost.yaml file.
+type vhostSpec struct {
+	Domain    string   `yaml:"domain"`
+	Aliases   []string `yaml:"aliases"`
+	Upstreams []string `yaml:"upstreams"`
+	// TLSCert and TLSKey enable HTTPS; plain HTTP then redirects to HTTPS.
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+	// RateLimit is a request rate per client address, e.g. "10r/s", with an optional Burst.
+	RateLimit string `yaml:"rate_limit"`
+	Burst     int    `yaml:"burst"`
+}
+
+var (
+	rateLimitRe  = regexp.MustCompile(`^[0-9]+r/[sm]$`)
+	vhostTokenRe = regexp.MustCompile(`^[^\s;{}'"#]+$`)
+	nonIdentRe   = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+func (v *vhostSpec) validate() error {
+	if v.Domain == "" {
+		return fmt.Errorf("domain is required")
+	}
+	if len(v.Upstreams) == 0 {
+		return fmt.Errorf("at least one upstream is required")
+	}
+	for _, token := range append(append([]string{v.Domain, v.TLSCert, v.TLSKey}, v.Aliases...), v.Upstreams...) {
+		if token != "" && !vhostTokenRe.MatchString(token) {
+			return fmt.Errorf("invalid value %q", token)
+		}
+	}
+	if (v.TLSCert == "") != (v.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if v.RateLimit != "" && !rateLimitRe.MatchString(v.RateLimit) {
+		return fmt.Errorf("invalid rate_limit %q, expected e.g. 10r/s or 600r/m", v.RateLimit)
+	}
+	if v.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if v.Burst > 0 && v.RateLimit == "" {
+		return fmt.Errorf("burst requires rate_limit")
+	}
+	return nil
+}
+
+// name is the identifier of the upstream and rate limit zone of the vhost. Replacing the
+// characters nginx does not allow can map two domains to the same identifier (a.b.example.com,
+// a_b.example.com), so a short hash of the domain keeps it unique.
+func (v *vhostSpec) name() string {
+	sum := sha256.Sum256([]byte(v.Domain))
+	return "vhost_" + nonIdentRe.ReplaceAllString(v.Domain, "_") + "_" + hex.EncodeToString(sum[:4])
+}
+
+var vhostTemplate = template.Must(template.New("vhost").Parse(`# Generated by gitops-nginx from {{ .Spec }}, do not edit.
+upstream {{ .Name }} {
+{{- range .Upstreams }}
+    server {{ . }};
+{{- end }}
+}
+{{- if .RateLimit }}
+
+limit_req_zone $binary_remote_addr zone={{ .Name }}:10m rate={{ .RateLimit }};
+{{- end }}
+{{- if .TLSCert }}
+
+server {
+    listen 80;
+    server_name {{ .ServerNames }};
+
+    return 301 https://$host$request_uri;
+}
+{{- end }}
+
+server {
+{{- if .TLSCert }}
+    listen 443 ssl;
+{{- else }}
+    listen 80;
+{{- end }}
+    server_name {{ .ServerNames }};
+{{- if .TLSCert }}
+
+    ssl_certificate {{ .TLSCert }};
+    ssl_certificate_key {{ .TLSKey }};
+{{- end }}
+
+    location / {
+{{- if .RateLimit }}
+        limit_req zone={{ .Name }}{{ if .Burst }} burst={{ .Burst }} nodelay{{ end }};
+{{- end }}
+        proxy_pass http://{{ .Name }};
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+}
+`))
+
+// renderVhost generates the nginx config of a vhost spec.
+func renderVhost(name string, content []byte) ([]byte, error) {
+	var spec vhostSpec
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("failed to parse vhost spec %s: %w", name, err)
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid vhost spec %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	err := vhostTemplate.Execute(&buf, struct {
+		vhostSpec
+		Spec        string
+		Name        string
+		ServerNames string
+	}{
+		vhostSpec:   spec,
+		Spec:        name,
+		Name:        spec.name(),
+		ServerNames: strings.Join(append([]string{spec.Domain}, spec.Aliases...), " "),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s: %w", name, err)
+	}
+	// The generated file must parse like a hand-written one
+	if _, err := nginxconf.Parse(name, buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to generate %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// generateVhosts replaces the vhost specs of a merged tree with the generated config files.
+// Like templates, generation happens lazily when the content is read, and a spec and a plain
+// file with the same output path only conflict within a layer.
+func generateVhosts(files map[string]*sourceFile) map[string]*sourceFile {
+	generated := make(map[string]*sourceFile, len(files))
+	maps.Copy(generated, files)
+
+	for relPath, sf := range files {
+		base, ok := strings.CutSuffix(relPath, VhostSuffix)
+		if !ok || base == "" || strings.HasSuffix(base, "/") {
+			continue
+		}
+		delete(generated, relPath)
+
+		specPath, src, outPath := relPath, sf, base+".conf"
+		var shadowed, conflict bool
+		if plain, exists := files[outPath]; exists {
+			shadowed, conflict = src.shadowedBy(plain)
+		}
+		if shadowed {
+			continue
+		}
+		if conflict {
+			generated[outPath] = &sourceFile{
+				Layer:     src.Layer,
+				Generated: specPath,
+				load: func() ([]byte, error) {
+					return nil, fmt.Errorf("vhost spec %s conflicts with plain file %s", specPath, outPath)
+				},
+			}
+			continue
+		}
+
+		generated[outPath] = &sourceFile{
+			Layer:     src.Layer,
+			Template:  src.Template,
+			Generated: specPath,
+			load: func() ([]byte, error) {
+				content, err := src.Content()
+				if err != nil {
+					return nil, err
+				}
+				return renderVhost(specPath, content)
+			},
+		}
+	}
+
+	return generated
+}
@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/logn-xu/gitops-nginx/internal/nginxconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateVhosts(t *testing.T) {
+	static := func(layer, s string) *sourceFile {
+		return &sourceFile{Layer: layer, load: func() ([]byte, error) { return []byte(s), nil }}
+	}
+
+	files := generateVhosts(map[string]*sourceFile{
+		"conf.d/api.vhost.yaml": static(LayerCommon, `
+domain: api.example.com
+aliases: [www.api.example.com]
+upstreams: ["10.0.1.10:8080", "10.0.1.11:8080"]
+tls_cert: /etc/nginx/certs/api.pem
+tls_key: /etc/nginx/certs/api.key
+rate_limit: 10r/s
+burst: 20
+`),
+		"conf.d/plain.vhost.yaml": static(LayerHost, "domain: plain.example.com\nupstreams: [10.0.1.20:80]\n"),
+		"conf.d/bad.vhost.yaml":   static(LayerHost, "domain: bad.example.com\nupstream: [10.0.1.20:80]\n"),
+		"conf.d/dup.vhost.yaml":   static(LayerHost, "domain: dup.example.com\nupstreams: [10.0.1.20:80]\n"),
+		"conf.d/dup.conf":         static(LayerHost, "server {}"),
+		"nginx.conf":              static(LayerHost, "http { include conf.d/*.conf; }"),
+	})
+
+	require.Len(t, files, 5)
+	assert.NotContains(t, files, "conf.d/api.vhost.yaml")
+	assert.Equal(t, "", files["nginx.conf"].Generated)
+
+	api := files["conf.d/api.conf"]
+	require.NotNil(t, api)
+	assert.Equal(t, LayerCommon, api.Layer)
+	assert.Equal(t, "conf.d/api.vhost.yaml", api.Generated)
+	content, err := api.Content()
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "# Generated by gitops-nginx from conf.d/api.vhost.yaml, do not edit.\n")
+	assert.Contains(t, string(content), "limit_req zone=vhost_api_example_com_d0c43d38 burst=20 nodelay;")
+
+	f, err := nginxconf.Parse("conf.d/api.conf", content)
+	require.NoError(t, err)
+	var names []string
+	for _, d := range f.Directives {
+		if !d.IsComment() {
+			names = append(names, d.Name)
+		}
+	}
+	assert.Equal(t, []string{"upstream", "limit_req_zone", "server", "server"}, names)
+	formatted := nginxconf.Format(f)
+	assert.Equal(t, string(formatted), string(content), "generated files are canonically formatted")
+
+	content, err = files["conf.d/plain.conf"].Content()
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "    listen 80;\n    server_name plain.example.com;\n")
+	assert.NotContains(t, string(content), "ssl")
+	assert.NotContains(t, string(content), "limit_req")
+
+	_, err = files["conf.d/bad.conf"].Content()
+	assert.ErrorContains(t, err, "field upstream not found")
+
+	_, err = files["conf.d/dup.conf"].Content()
+	assert.ErrorContains(t, err, "conflicts with plain file")
+}
+
+func TestGenerateVhostsAcrossLayers(t *testing.T) {
+	static := func(layer, s string) *sourceFile {
+		return &sourceFile{Layer: layer, load: func() ([]byte, error) { return []byte(s), nil }}
+	}
+
+	files := generateVhosts(map[string]*sourceFile{
+		"conf.d/api.vhost.yaml":  static(LayerHost, "domain: api.example.com\nupstreams: [10.0.1.10:80]\n"),
+		"conf.d/api.conf":        static(LayerCommon, "server {}"),
+		"conf.d/site.vhost.yaml": static(LayerCommon, "domain: site.example.com\nupstreams: [10.0.1.20:80]\n"),
+		"conf.d/site.conf":       static(LayerHost, "server { listen 8080; }"),
+	})
+
+	require.Len(t, files, 2)
+	api := files["conf.d/api.conf"]
+	assert.Equal(t, "conf.d/api.vhost.yaml", api.Generated, "a host spec overrides a common file")
+	content, err := api.Content()
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "server_name api.example.com;")
+
+	site := files["conf.d/site.conf"]
+	assert.Empty(t, site.Generated, "a host file overrides a common spec")
+	content, err = site.Content()
+	require.NoError(t, err)
+	assert.Equal(t, "server { listen 8080; }", string(content))
+}
+
+func TestVhostSpecValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec vhostSpec
+		err  string
+	}{
+		{"no domain", vhostSpec{Upstreams: []string{"a:80"}}, "domain is required"},
+		{"no upstream", vhostSpec{Domain: "a.com"}, "upstream is required"},
+		{"injection", vhostSpec{Domain: "a.com; include /etc/passwd", Upstreams: []string{"a:80"}}, "invalid value"},
+		{"cert without key", vhostSpec{Domain: "a.com", Upstreams: []string{"a:80"}, TLSCert: "a.pem"}, "set together"},
+		{"bad rate", vhostSpec{Domain: "a.com", Upstreams: []string{"a:80"}, RateLimit: "10/s"}, "invalid rate_limit"},
+		{"burst without rate", vhostSpec{Domain: "a.com", Upstreams: []string{"a:80"}, Burst: 5}, "burst requires rate_limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorContains(t, tt.spec.validate(), tt.err)
+		})
+	}
+}
+
+func TestVhostSpecName(t *testing.T) {
+	dotted := (&vhostSpec{Domain: "a.b.example.com"}).name()
+	underscored := (&vhostSpec{Domain: "a_b.example.com"}).name()
+	assert.Equal(t, "vhost_a_b_example_com_532e2dc4", dotted)
+	assert.Equal(t, "vhost_a_b_example_com_c91c532e", underscored)
+	assert.NotEqual(t, dotted, underscored)
+}
@@ -0,0 +1,90 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/logn-xu/gitops-nginx/internal/etcd"
+	"github.com/logn-xu/gitops-nginx/internal/ssh"
+)
+
+// Report is the result of comparing a remote config tree with the production prefix.
+type Report struct {
+	OK         bool      `json:"ok"`
+	Expected   int       `json:"expected"` // files in the production prefix
+	Matched    int       `json:"matched"`
+	Mismatched []string  `json:"mismatched,omitempty"` // content differs from the .hash value
+	Missing    []string  `json:"missing,omitempty"`    // in etcd but not on the remote
+	Unexpected []string  `json:"unexpected,omitempty"` // on the remote but not in etcd
+	Preserved  int       `json:"preserved,omitempty"`  // on the remote but not in etcd, protected from deletion
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Err returns nil for a matching tree and a summary of the differences otherwise.
+func (r *Report) Err() error {
+	if r.OK {
+		return nil
+	}
+	var parts []string
+	if len(r.Mismatched) > 0 {
+		parts = append(parts, fmt.Sprintf("%d mismatched (%s)", len(r.Mismatched), strings.Join(r.Mismatched, ", ")))
+	}
+	if len(r.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("%d missing (%s)", len(r.Missing), strings.Join(r.Missing, ", ")))
+	}
+	if len(r.Unexpected) > 0 {
+		parts = append(parts, fmt.Sprintf("%d unexpected (%s)", len(r.Unexpected), strings.Join(r.Unexpected, ", ")))
+	}
+	return fmt.Errorf("remote does not match production: %s", strings.Join(parts, "; "))
+}
+
+// Compare compares expected and actual hashes (relPath -> md5). Remote files that are not
+// expected but protected (see ssh.ScpOptions) are counted as preserved; protected may be nil.
+func Compare(expected, actual map[string]string, protected func(relPath string) bool) *Report {
+	r := &Report{
+		Expected:  len(expected),
+		CheckedAt: time.Now(),
+	}
+	for relPath, hash := range expected {
+		remoteHash, ok := actual[relPath]
+		switch {
+		case !ok:
+			r.Missing = append(r.Missing, relPath)
+		case remoteHash != hash:
+			r.Mismatched = append(r.Mismatched, relPath)
+		default:
+			r.Matched++
+		}
+	}
+	for relPath := range actual {
+		if _, ok := expected[relPath]; ok {
+			continue
+		}
+		if protected != nil && protected(relPath) {
+			r.Preserved++
+			continue
+		}
+		r.Unexpected = append(r.Unexpected, relPath)
+	}
+	sort.Strings(r.Mismatched)
+	sort.Strings(r.Missing)
+	sort.Strings(r.Unexpected)
+	r.OK = len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Unexpected) == 0
+	return r
+}
+
+// Remote re-hashes the files under remoteDir and compares them with the .hash values under prefix.
+func Remote(ctx context.Context, etcdClient *etcd.Client, client *ssh.Client, prefix, remoteDir string, opts ssh.ScpOptions) (*Report, error) {
+	expected, err := etcdClient.GetFileHashes(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hashes from etcd: %w", err)
+	}
+	actual, err := ssh.ListRemoteFiles(client, remoteDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash remote files: %w", err)
+	}
+	return Compare(expected, actual, opts.Protected), nil
+}
@@ -0,0 +1,44 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	expected := map[string]string{
+		"nginx.conf":         "a",
+		"conf.d/www.conf":    "b",
+		"conf.d/api.conf":    "c",
+		"conf.d/static.conf": "d",
+	}
+	actual := map[string]string{
+		"nginx.conf":         "a",
+		"conf.d/www.conf":    "x",
+		"conf.d/static.conf": "d",
+		"conf.d/manual.conf": "e",
+	}
+
+	r := Compare(expected, actual, nil)
+	assert.False(t, r.OK)
+	assert.Equal(t, 4, r.Expected)
+	assert.Equal(t, 2, r.Matched)
+	assert.Equal(t, []string{"conf.d/www.conf"}, r.Mismatched)
+	assert.Equal(t, []string{"conf.d/api.conf"}, r.Missing)
+	assert.Equal(t, []string{"conf.d/manual.conf"}, r.Unexpected)
+
+	err := r.Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 mismatched (conf.d/www.conf)")
+}
+
+func TestCompareMatching(t *testing.T) {
+	r := Compare(map[string]string{"nginx.conf": "a"}, map[string]string{"nginx.conf": "a", "mime.types": "m"}, func(relPath string) bool {
+		return relPath == "mime.types"
+	})
+	assert.True(t, r.OK)
+	assert.Equal(t, 1, r.Preserved)
+	assert.NoError(t, r.Err())
+}
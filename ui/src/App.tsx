@@ -72,7 +72,7 @@ function App() {
     setTreeLoading(true);
     fetchTree(selectedGroup, selectedHost, mode).then((data) => {
       if (data) {
-        setTreeData(buildTree(data.prefix, data.paths || [], data.file_statuses || {}, showAllFiles));
+        setTreeData(buildTree(data.prefix, data.paths || [], data.file_statuses || {}, showAllFiles, data.file_layers || {}, data.file_errors || {}, data.file_generated || {}));
         setTreeKey((k) => k + 1);
       }
       setTreeLoading(false);
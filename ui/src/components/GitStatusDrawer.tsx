@@ -1,9 +1,9 @@
 import React, { useEffect, useState } from "react";
 import { Drawer, Button, Badge, Typography, Tag, Space, Descriptions, Alert, Spin,Empty } from "antd";
 import { DiffViewer } from "./DiffViewer";
+import { apiFetch } from "../utils/api";
 
 const { Text, Title } = Typography;
-const API_BASE = import.meta.env.VITE_API_BASE || "";
 
 interface CommitInfo {
   hash: string;
@@ -51,7 +51,7 @@ export const GitStatusDrawer: React.FC = () => {
 
     const fetchStatus = () => {
       setLoading(true);
-      fetch(`${API_BASE}/api/v1/git/status`)
+      apiFetch("/api/v1/git/status")
         .then((res) => res.json())
         .then((data: GitStatusResponse) => {
           setData(data);
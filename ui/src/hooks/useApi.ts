@@ -1,6 +1,7 @@
 import { useCallback } from "react";
 import { App } from "antd";
-import { API_BASE, GroupsResponse, TreeResponse, TripleDiffResponse } from "../types";
+import { GroupsResponse, TreeResponse, TripleDiffResponse } from "../types";
+import { apiFetch } from "../utils/api";
 import type { CheckResult } from "../components/CheckResultModal";
 import type { UpdatePrepareResponse, UpdateApplyResponse } from "../components/UpdateResultModal";
 
@@ -9,7 +10,7 @@ export function useApi() {
 
   const fetchGroups = useCallback(async (): Promise<GroupsResponse | null> => {
     try {
-      const res = await fetch(`${API_BASE}/api/v1/groups`);
+      const res = await apiFetch(`/api/v1/groups`);
       return await res.json();
     } catch (err) {
       console.error(err);
@@ -21,8 +22,8 @@ export function useApi() {
   const fetchTree = useCallback(
     async (group: string, host: string, mode: string): Promise<TreeResponse | null> => {
       try {
-        const res = await fetch(
-          `${API_BASE}/api/v1/tree?group=${encodeURIComponent(group)}&host=${encodeURIComponent(host)}&mode=${mode}`
+        const res = await apiFetch(
+          `/api/v1/tree?group=${encodeURIComponent(group)}&host=${encodeURIComponent(host)}&mode=${mode}`
         );
         return await res.json();
       } catch (err) {
@@ -37,8 +38,8 @@ export function useApi() {
   const fetchFileDiff = useCallback(
     async (group: string, host: string, path: string, mode: string): Promise<TripleDiffResponse | null> => {
       try {
-        const res = await fetch(
-          `${API_BASE}/api/v1/triple-diff?group=${encodeURIComponent(group)}&host=${encodeURIComponent(host)}&path=${encodeURIComponent(path)}&mode=${mode}`
+        const res = await apiFetch(
+          `/api/v1/triple-diff?group=${encodeURIComponent(group)}&host=${encodeURIComponent(host)}&path=${encodeURIComponent(path)}&mode=${mode}`
         );
         if (!res.ok) throw new Error("failed to fetch file diff");
         return await res.json();
@@ -54,7 +55,7 @@ export function useApi() {
   const checkConfig = useCallback(
     async (group: string, host: string, mode: string): Promise<CheckResult | null> => {
       try {
-        const res = await fetch(`${API_BASE}/api/v1/check?mode=${mode}`, {
+        const res = await apiFetch(`/api/v1/check?mode=${mode}`, {
           method: "POST",
           headers: { "Content-Type": "application/json" },
           body: JSON.stringify({ server: host, group }),
@@ -72,7 +73,7 @@ export function useApi() {
   const updatePrepare = useCallback(
     async (group: string, host: string): Promise<UpdatePrepareResponse | null> => {
       try {
-        const res = await fetch(`${API_BASE}/api/v1/update/prepare?mode=prod`, {
+        const res = await apiFetch(`/api/v1/update/prepare?mode=prod`, {
           method: "POST",
           headers: { "Content-Type": "application/json" },
           body: JSON.stringify({ server: host, group }),
@@ -92,7 +93,7 @@ export function useApi() {
   const updateApply = useCallback(
     async (group: string, host: string): Promise<UpdateApplyResponse | null> => {
       try {
-        const res = await fetch(`${API_BASE}/api/v1/update/apply?mode=prod`, {
+        const res = await apiFetch(`/api/v1/update/apply?mode=prod`, {
           method: "POST",
           headers: { "Content-Type": "application/json" },
           body: JSON.stringify({ server: host, group }),
@@ -12,6 +12,21 @@ export type TreeResponse = {
   paths: string[];
   diff_paths?: string[];
   file_statuses?: Record<string, string>;
+  file_layers?: Record<string, string>;
+  file_generated?: Record<string, string>;
+  file_errors?: Record<string, string>;
+  pin?: PinStatus;
+};
+
+export type PinStatus = {
+  group: string;
+  host?: string;
+  commit: string;
+  reason: string;
+  created_by: string;
+  created_at: string;
+  expires_at?: string;
+  active: boolean;
 };
 
 export type TripleDiffResponse = {
@@ -31,3 +46,9 @@ export const STATUS_MARKERS: Record<string, { icon: string; color: string; label
   added: { icon: "+", color: "#52c41a", label: "新增" },
   deleted: { icon: "-", color: "#ff4d4f", label: "删除" },
 };
+
+export const LAYER_MARKERS: Record<string, { color: string; label: string }> = {
+  common: { color: "#1677ff", label: "_common" },
+};
+
+export const GENERATED_MARKER = { color: "#722ed1", label: "generated" };
@@ -0,0 +1,39 @@
+import { API_BASE } from "../types";
+
+const TOKEN_KEY = "gitops-nginx-token";
+
+export const getApiToken = () => localStorage.getItem(TOKEN_KEY) || "";
+
+export const setApiToken = (token: string) => {
+  if (token) {
+    localStorage.setItem(TOKEN_KEY, token);
+  } else {
+    localStorage.removeItem(TOKEN_KEY);
+  }
+};
+
+// declined stops asking again after the user cancelled the prompt, e.g. while polling
+let declined = false;
+
+const withToken = (init: RequestInit = {}): RequestInit => {
+  const token = getApiToken();
+  if (!token) return init;
+  const headers = new Headers(init.headers);
+  headers.set("Authorization", `Bearer ${token}`);
+  return { ...init, headers };
+};
+
+// apiFetch calls the API with the bearer token from api.tokens. When the server rejects the
+// token (or none is stored yet), it asks for one and retries once.
+export async function apiFetch(path: string, init?: RequestInit): Promise<Response> {
+  const res = await fetch(`${API_BASE}${path}`, withToken(init));
+  if (res.status !== 401 || declined) return res;
+
+  const token = window.prompt("请输入 API Token（api.tokens）", getApiToken());
+  if (token === null) {
+    declined = true;
+    return res;
+  }
+  setApiToken(token.trim());
+  return fetch(`${API_BASE}${path}`, withToken(init));
+}
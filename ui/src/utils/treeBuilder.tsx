@@ -1,11 +1,14 @@
 import type { TreeDataNode } from "antd";
-import { STATUS_MARKERS } from "../types";
+import { GENERATED_MARKER, LAYER_MARKERS, STATUS_MARKERS } from "../types";
 
 export function buildTree(
   prefix: string,
   paths: string[],
   fileStatuses: Record<string, string>,
-  showAll: boolean
+  showAll: boolean,
+  fileLayers: Record<string, string> = {},
+  fileErrors: Record<string, string> = {},
+  fileGenerated: Record<string, string> = {}
 ): TreeDataNode[] {
   const root: Record<string, any> = {};
 
@@ -16,6 +19,9 @@ export function buildTree(
       const isLeaf = idx === segments.length - 1;
       const relPath = segments.slice(0, idx + 1).join("/");
       const status = fileStatuses[relPath];
+      const layer = isLeaf ? fileLayers[relPath] : undefined;
+      const error = isLeaf ? fileErrors[relPath] : undefined;
+      const generated = isLeaf ? fileGenerated[relPath] : undefined;
 
       if (!current[seg]) {
         current[seg] = {
@@ -24,6 +30,9 @@ export function buildTree(
           isLeaf,
           children: isLeaf ? undefined : {},
           status,
+          layer,
+          error,
+          generated,
         };
       }
       current = (current[seg] as any).children ?? {};
@@ -46,7 +55,7 @@ export function buildTree(
         childHasChange = childResult.hasChange;
       }
 
-      const nodeHasChange = !!node.status || childHasChange;
+      const nodeHasChange = !!node.status || !!node.error || childHasChange;
 
       if (nodeHasChange) {
         groupHasChange = true;
@@ -57,13 +66,32 @@ export function buildTree(
       }
 
       const marker = node.status ? STATUS_MARKERS[node.status] : null;
+      const layerMarker = node.layer ? LAYER_MARKERS[node.layer] : null;
       const title =
-        node.isLeaf && marker ? (
-          <span>
-            <span style={{ color: marker.color, marginRight: 4 }}>
-              {marker.icon}
-            </span>
+        node.isLeaf && (marker || layerMarker || node.error || node.generated) ? (
+          <span title={node.error}>
+            {node.error && (
+              <span style={{ color: "#ff4d4f", marginRight: 4 }}>!</span>
+            )}
+            {marker && (
+              <span style={{ color: marker.color, marginRight: 4 }}>
+                {marker.icon}
+              </span>
+            )}
             {node.rawTitle}
+            {layerMarker && (
+              <span style={{ color: layerMarker.color, marginLeft: 6, fontSize: 12 }}>
+                {layerMarker.label}
+              </span>
+            )}
+            {node.generated && (
+              <span
+                title={`generated from ${node.generated}`}
+                style={{ color: GENERATED_MARKER.color, marginLeft: 6, fontSize: 12 }}
+              >
+                {GENERATED_MARKER.label}
+              </span>
+            )}
           </span>
         ) : (
           node.rawTitle